@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/swanchain/go-computing-provider/internal/computing"
+	"github.com/urfave/cli/v2"
+)
+
+var auditCmd = &cli.Command{
+	Name:  "audit",
+	Usage: "Inspect the audit log of operator and chain actions",
+	Subcommands: []*cli.Command{
+		auditList,
+		auditVerify,
+	},
+}
+
+var auditList = &cli.Command{
+	Name:  "list",
+	Usage: "List the latest audit log entries",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "tail",
+			Usage: "Show the last n entries, 0 shows all",
+			Value: 20,
+		},
+		&cli.StringFlag{
+			Name:  "action",
+			Usage: "Only show the specified action, e.g. \"wallet send\"",
+		},
+		&cli.BoolFlag{
+			Name:    "verbose",
+			Usage:   "--verbose",
+			Aliases: []string{"v"},
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		fullFlag := cctx.Bool("verbose")
+		list, err := computing.NewAuditService().GetAuditLogs(cctx.Int("tail"), strings.TrimSpace(cctx.String("action")))
+		if err != nil {
+			return fmt.Errorf("failed to get audit logs, error: %v", err)
+		}
+
+		var taskData [][]string
+		var rowColorList []RowColor
+		for i, entry := range list {
+			createTime := time.Unix(entry.CreateTime, 0).Format("2006-01-02 15:04:05")
+			if fullFlag {
+				taskData = append(taskData, []string{strconv.FormatInt(entry.Id, 10), entry.Actor, entry.Action, entry.Params, entry.TxHash, entry.Result, entry.Hash, createTime})
+			} else {
+				var txHash string
+				if len(entry.TxHash) > 10 {
+					txHash = entry.TxHash[:6] + "..." + entry.TxHash[len(entry.TxHash)-4:]
+				} else {
+					txHash = entry.TxHash
+				}
+				result := entry.Result
+				if len(result) > 30 {
+					result = result[:30] + "..."
+				}
+				taskData = append(taskData, []string{strconv.FormatInt(entry.Id, 10), entry.Actor, entry.Action, txHash, result, createTime})
+			}
+
+			if !strings.EqualFold(entry.Result, "success") {
+				rowColorList = append(rowColorList, RowColor{
+					row:    i,
+					column: []int{2},
+					color:  []tablewriter.Colors{{tablewriter.Bold, tablewriter.FgRedColor}},
+				})
+			}
+		}
+
+		var header []string
+		if fullFlag {
+			header = []string{"ID", "ACTOR", "ACTION", "PARAMS", "TX HASH", "RESULT", "HASH", "CREATE TIME"}
+		} else {
+			header = []string{"ID", "ACTOR", "ACTION", "TX HASH", "RESULT", "CREATE TIME"}
+		}
+		NewVisualTable(header, taskData, rowColorList).Generate(false)
+		return nil
+	},
+}
+
+var auditVerify = &cli.Command{
+	Name:  "verify",
+	Usage: "Verify the integrity of the audit log hash chain",
+	Action: func(cctx *cli.Context) error {
+		count, err := computing.VerifyAuditLog()
+		if err != nil {
+			return fmt.Errorf("audit log verification failed after %d valid entries: %v", count, err)
+		}
+		fmt.Printf("audit log is intact, %d entries verified \n", count)
+		return nil
+	},
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/computing"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
+	"github.com/urfave/cli/v2"
+)
+
+var doctorCmd = &cli.Command{
+	Name:  "doctor",
+	Usage: "Check and repair the state of the cp",
+	Subcommands: []*cli.Command{
+		doctorReconcile,
+	},
+}
+
+var doctorReconcile = &cli.Command{
+	Name:  "reconcile",
+	Usage: "Reconcile the tasks in the database with the deployments of the cluster or the containers",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "Task type. Support fcp and edge types",
+		},
+		&cli.StringFlag{
+			Name:  "orphan-policy",
+			Usage: "How the deployments and containers of no task are handled: keep, adopt or remove, default: the OrphanPolicy of the config",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only report what does not match, without repairing it",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		cpRepoPath, ok := os.LookupEnv("CP_PATH")
+		if !ok {
+			return fmt.Errorf("missing CP_PATH env, please set export CP_PATH=<YOUR CP_PATH>")
+		}
+		if err := conf.InitConfig(cpRepoPath, true); err != nil {
+			return fmt.Errorf("load config file failed, error: %+v", err)
+		}
+
+		policy := conf.GetConfig().Reconciler.GetOrphanPolicy()
+		if cctx.IsSet("orphan-policy") {
+			policy = strings.ToLower(strings.TrimSpace(cctx.String("orphan-policy")))
+		}
+		dryRun := cctx.Bool("dry-run")
+
+		// the running cp deploys and closes the same rows, so it must be stopped before they are repaired
+		release, err := util.LockRepo(cpRepoPath)
+		switch {
+		case errors.Is(err, util.ErrRepoLocked) && !dryRun:
+			return fmt.Errorf("the computing-provider is running, stop it before the reconcile or only report with --dry-run")
+		case errors.Is(err, util.ErrRepoLocked):
+		case err != nil:
+			return err
+		default:
+			defer release()
+		}
+
+		var report models.ReconcileReport
+		switch strings.TrimSpace(cctx.String("type")) {
+		case "fcp":
+			report, err = computing.ReconcileForK8s(dryRun, policy)
+		case "edge":
+			report, err = computing.ReconcileForDocker(dryRun, policy)
+		default:
+			return fmt.Errorf("only support fcp and edge types")
+		}
+		if !dryRun {
+			computing.RecordAudit(computing.AuditActorCli, "doctor reconcile", map[string]interface{}{"type": cctx.String("type"), "policy": policy,
+				"items": len(report.Items)}, "", err)
+		}
+		if err != nil && len(report.Items) == 0 {
+			return fmt.Errorf("failed to reconcile, error: %v", err)
+		}
+
+		if len(report.Items) == 0 {
+			fmt.Println("The database matches the tasks which are running")
+		} else {
+			var data [][]string
+			for _, item := range report.Items {
+				data = append(data, []string{item.Kind, item.Id, item.Found, item.Action})
+			}
+			NewVisualTable([]string{"KIND", "ID", "FOUND", "ACTION"}, data, []RowColor{}).Generate(false)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reconcile, error: %v", err)
+		}
+		return nil
+	},
+}
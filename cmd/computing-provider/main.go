@@ -45,6 +45,11 @@ func main() {
 			contractCmd,
 			priceCmd,
 			networkCmd,
+			auditCmd,
+			validateCmd,
+			nodeCmd,
+			doctorCmd,
+			secretCmd,
 		},
 		Before: func(c *cli.Context) error {
 			cpRepoPath, err := homedir.Expand(c.String(FlagRepo.Name))
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/swanchain/go-computing-provider/internal/computing"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/urfave/cli/v2"
+)
+
+var nodeCmd = &cli.Command{
+	Name:  "node",
+	Usage: "Manage the maintenance of the cp and its nodes",
+	Subcommands: []*cli.Command{
+		nodeDrain,
+		nodeUndrain,
+	},
+}
+
+var nodeDrain = &cli.Command{
+	Name:      "drain",
+	Usage:     "Stop accepting new tasks, or cordon the node of the default cluster when a node is given",
+	ArgsUsage: "[node]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "The reason of the maintenance, returned to the rejected requests",
+		},
+		&cli.BoolFlag{
+			Name:  "cordon",
+			Usage: "Also cordon every node of the default cluster, only for the fcp",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() > 1 {
+			return fmt.Errorf("incorrect number of arguments, got %d, expected at most one node", cctx.NArg())
+		}
+		nodeName := strings.TrimSpace(cctx.Args().First())
+		state, err := computing.DrainNode(nodeName, strings.TrimSpace(cctx.String("reason")), cctx.Bool("cordon"))
+		computing.RecordAudit(computing.AuditActorCli, "node drain", map[string]interface{}{"node": nodeName, "reason": cctx.String("reason"),
+			"cordon": cctx.Bool("cordon")}, "", err)
+		if err != nil {
+			return err
+		}
+
+		if nodeName == "" {
+			fmt.Println("The cp is under maintenance and rejects new tasks, the running tasks are kept until they expire")
+		} else {
+			fmt.Printf("Node %s is cordoned, no new task is placed on it\n", nodeName)
+		}
+		printMaintenance(state)
+
+		drained := state.DrainedNodes
+		if nodeName != "" {
+			drained = []string{nodeName}
+		}
+		for _, node := range drained {
+			jobs, err := computing.JobsOnNode(node)
+			if err != nil {
+				return fmt.Errorf("failed to get the tasks running on node %s, error: %v", node, err)
+			}
+			if len(jobs) > 0 {
+				fmt.Printf("%d tasks are still running on node %s: %s\n", len(jobs), node, strings.Join(jobs, ", "))
+			}
+		}
+		return nil
+	},
+}
+
+var nodeUndrain = &cli.Command{
+	Name:      "undrain",
+	Usage:     "Accept new tasks again and uncordon the drained nodes, or uncordon the node when a node is given",
+	ArgsUsage: "[node]",
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() > 1 {
+			return fmt.Errorf("incorrect number of arguments, got %d, expected at most one node", cctx.NArg())
+		}
+		nodeName := strings.TrimSpace(cctx.Args().First())
+		state, err := computing.UndrainNode(nodeName)
+		computing.RecordAudit(computing.AuditActorCli, "node undrain", map[string]interface{}{"node": nodeName}, "", err)
+		if err != nil {
+			return err
+		}
+
+		if nodeName == "" {
+			fmt.Println("The cp accepts new tasks again")
+		} else {
+			fmt.Printf("Node %s is uncordoned\n", nodeName)
+		}
+		printMaintenance(state)
+		return nil
+	},
+}
+
+func printMaintenance(state models.Maintenance) {
+	var data [][]string
+	if state.Enabled {
+		data = append(data, []string{"MAINTENANCE:", "enabled"})
+		data = append(data, []string{"SINCE:", time.Unix(state.Since, 0).Format("2006-01-02 15:04:05")})
+		if state.Reason != "" {
+			data = append(data, []string{"REASON:", state.Reason})
+		}
+	} else {
+		data = append(data, []string{"MAINTENANCE:", "disabled"})
+	}
+	if len(state.DrainedNodes) > 0 {
+		data = append(data, []string{"DRAINED NODES:", strings.Join(state.DrainedNodes, ", ")})
+	}
+	NewVisualTable([]string{"STATE", ""}, data, []RowColor{}).Generate(false)
+}
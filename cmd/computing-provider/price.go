@@ -6,6 +6,7 @@ import (
 	"github.com/swanchain/go-computing-provider/internal/computing"
 	"github.com/urfave/cli/v2"
 	"os"
+	"strings"
 )
 
 var priceCmd = &cli.Command{
@@ -69,6 +70,10 @@ var viewCmd = &cli.Command{
 				valStr = field.Value + " SWAN/GB-hour"
 				break
 			default:
+				if strings.HasPrefix(field.Name, "TARGET_GPU_SLICE_") {
+					valStr = field.Value + " SWAN/GPU slice a hour"
+					break
+				}
 				valStr = field.Value + " SWAN/GPU unit a hour"
 			}
 			taskData = append(taskData, []string{fmt.Sprintf("%s:", field.Name), valStr})
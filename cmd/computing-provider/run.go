@@ -44,15 +44,21 @@ var runCmd = &cli.Command{
 
 		gin.SetMode(gin.ReleaseMode)
 		r := gin.Default()
-		r.Use(cors.Middleware(cors.Config{
-			Origins:         "*",
-			Methods:         "GET, PUT, POST, DELETE",
-			RequestHeaders:  "Origin, Authorization, Content-Type",
-			ExposedHeaders:  "",
-			MaxAge:          50 * time.Second,
-			ValidateHeaders: false,
-		}))
-		pprof.Register(r)
+		// the client ip keys the rate limits and the audit log, so X-Forwarded-For is only read from the trusted proxies
+		if err := r.SetTrustedProxies(conf.GetConfig().API.TrustedProxies); err != nil {
+			logs.GetLogger().Fatalf("invalid TrustedProxies, error: %v", err)
+		}
+		if origins := conf.GetConfig().API.GetCorsOrigins(); origins != "" {
+			r.Use(cors.Middleware(cors.Config{
+				Origins:         origins,
+				Methods:         "GET, PUT, POST, DELETE",
+				RequestHeaders:  "Origin, Authorization, Content-Type, X-CP-Signature, X-CP-Timestamp, X-CP-Nonce",
+				ExposedHeaders:  "",
+				MaxAge:          50 * time.Second,
+				ValidateHeaders: false,
+			}))
+		}
+		pprof.RouteRegister(r.Group("", computing.ApiTokenAuth()))
 
 		v1 := r.Group("/api/v1")
 		cpManager(v1.Group("/computing"))
@@ -60,12 +66,13 @@ var runCmd = &cli.Command{
 		shutdownChan := make(chan struct{})
 		httpStopper, err := util.ServeHttp(r, "cp-api", ":"+strconv.Itoa(conf.GetConfig().API.Port), true)
 		if err != nil {
-			logs.GetLogger().Fatal("failed to start cp-api endpoint: %s", err)
+			logs.GetLogger().Fatalf("failed to start cp-api endpoint: %s", err)
 		}
 		logs.GetLogger().Infof("CP service started successfully, listening on port: %d", conf.GetConfig().API.Port)
 
 		finishCh := util.MonitorShutdown(shutdownChan,
 			util.ShutdownHandler{Component: "cp-api", StopFunc: httpStopper},
+			util.ShutdownHandler{Component: "background", StopFunc: computing.StopBackground},
 		)
 		<-finishCh
 
@@ -74,11 +81,15 @@ var runCmd = &cli.Command{
 }
 
 func cpManager(router *gin.RouterGroup) {
+	// the hub polls /cp, /host/info, the white and black lists and check_node_port without signing,
+	// they only read the state of the cp and stay open
 	router.GET("/cp", computing.StatisticalSources)
 	router.GET("/host/info", computing.GetServiceProviderInfo)
-	router.POST("/lagrange/jobs", computing.ReceiveJob)
-	router.DELETE("/lagrange/jobs", computing.CancelJob)
-	router.POST("/lagrange/jobs/renew", computing.ReNewJob)
+	router.POST("/lagrange/jobs", computing.RateLimit(conf.RateLimitGroupJob), computing.ReceiveJob)
+	router.DELETE("/lagrange/jobs", computing.RateLimit(conf.RateLimitGroupJob), computing.CancelJob)
+	router.POST("/lagrange/jobs/renew", computing.RateLimit(conf.RateLimitGroupJob), computing.ReNewJob)
+	router.POST("/lagrange/jobs/update", computing.RateLimit(conf.RateLimitGroupJob), computing.UpdateJob)
+	router.POST("/lagrange/jobs/scale", computing.RateLimit(conf.RateLimitGroupJob), computing.ScaleJob)
 	router.GET("/lagrange/spaces/log", computing.GetSpaceLog)
 	router.POST("/lagrange/cp/proof", computing.DoProof)
 	router.GET("/lagrange/cp/whitelist", computing.WhiteList)
@@ -88,9 +99,19 @@ func cpManager(router *gin.RouterGroup) {
 	router.GET("/lagrange/cp/price", computing.GetPrice)
 	router.GET("/lagrange/cp/check_node_port", computing.CheckNodeportServiceEnv)
 
-	router.POST("/cp/ubi", computing.DoUbiTaskForK8s)
+	router.POST("/cp/ubi", computing.RateLimit(conf.RateLimitGroupUbi), computing.DoUbiTaskForK8s)
 	router.POST("/cp/receive/ubi", computing.ReceiveUbiProof)
+	router.GET("/cp/capacity/forecast", computing.RateLimit(conf.RateLimitGroupCheck), computing.ApiTokenAuth(), computing.GetCapacityForecastForK8s)
 
+	// the validate endpoint downloads the space, it is only served to the orchestrator, or to the operator without VerifySign
+	validateAuth := computing.ApiTokenAuth()
+	if conf.GetConfig().HUB.VerifySign {
+		validateAuth = computing.OrchestratorSignAuth()
+	}
+	router.POST("/lagrange/jobs/validate", computing.RateLimit(conf.RateLimitGroupJob), validateAuth, computing.ValidateJob)
+
+	// the usage is billed by the hub, it signs the request like the ones of the jobs
+	router.GET("/lagrange/jobs/:job_uuid/usage", computing.RateLimit(conf.RateLimitGroupJob), computing.OrchestratorSignAuth(), computing.GetJobUsage)
 }
 
 var infoCmd = &cli.Command{
@@ -665,6 +686,7 @@ var changeMultiAddressCmd = &cli.Command{
 
 		newMultiAddress := []string{strings.TrimSpace(multiAddr)}
 		changeMultiAddressTx, err := cpStub.ChangeMultiAddress(newMultiAddress)
+		computing.RecordAudit(computing.AuditActorCli, "account changeMultiAddress", map[string]interface{}{"owner": ownerAddress, "multi_address": newMultiAddress}, changeMultiAddressTx, err)
 		if err != nil {
 			return fmt.Errorf("changeMultiAddress tx failed, error: %v", err)
 		}
@@ -723,6 +745,7 @@ var changeOwnerAddressCmd = &cli.Command{
 		defer client.Close()
 
 		changeOwnerAddressTx, err := cpStub.ChangeOwnerAddress(common.HexToAddress(newOwnerAddr))
+		computing.RecordAudit(computing.AuditActorCli, "account changeOwnerAddress", map[string]interface{}{"owner": ownerAddress, "new_owner": newOwnerAddr}, changeOwnerAddressTx, err)
 		if err != nil {
 			logs.GetLogger().Errorf("changeOwnerAddress tx failed, error: %v", err)
 			return err
@@ -782,6 +805,7 @@ var changeBeneficiaryAddressCmd = &cli.Command{
 		defer client.Close()
 
 		changeBeneficiaryAddressTx, err := cpStub.ChangeBeneficiary(common.HexToAddress(beneficiaryAddress))
+		computing.RecordAudit(computing.AuditActorCli, "account changeBeneficiaryAddress", map[string]interface{}{"owner": ownerAddress, "beneficiary": beneficiaryAddress}, changeBeneficiaryAddressTx, err)
 		if err != nil {
 			logs.GetLogger().Errorf("changeBeneficiaryAddress tx failed, error: %v", err)
 			return err
@@ -841,6 +865,7 @@ var changeWorkerAddressCmd = &cli.Command{
 		defer client.Close()
 
 		changeBeneficiaryAddressTx, err := cpStub.ChangeWorkerAddress(common.HexToAddress(workerAddress))
+		computing.RecordAudit(computing.AuditActorCli, "account changeWorkerAddress", map[string]interface{}{"owner": ownerAddress, "worker": workerAddress}, changeBeneficiaryAddressTx, err)
 		if err != nil {
 			logs.GetLogger().Errorf("changeWorkerAddress tx failed, error: %v", err)
 			return err
@@ -916,6 +941,7 @@ var changeTaskTypesCmd = &cli.Command{
 		defer client.Close()
 
 		changeTaskTypesTx, err := cpStub.ChangeTaskTypes(taskTypesUint)
+		computing.RecordAudit(computing.AuditActorCli, "account changeTaskTypes", map[string]interface{}{"owner": ownerAddress, "task_types": taskTypesUint}, changeTaskTypesTx, err)
 		if err != nil {
 			logs.GetLogger().Errorf("changeTaskTypes tx failed, error: %v", err)
 			return err
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/rifflock/lfshook"
+	"github.com/sirupsen/logrus"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/computing"
+	"github.com/swanchain/go-computing-provider/internal/db"
+)
+
+// TestCpManagerHubCaller calls the routes of the hub the way it does: the read routes unsigned, the usage signed
+func TestCpManagerHubCaller(t *testing.T) {
+	hubKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpRepoPath := initTestRepo(t, crypto.PubkeyToAddress(hubKey.PublicKey).String())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	cpManager(router.Group("/api/v1/computing"))
+
+	usagePath := "/api/v1/computing/lagrange/jobs/job-1/usage"
+	tests := []struct {
+		name   string
+		path   string
+		signed bool
+		want   int
+	}{
+		{"unsigned host info", "/api/v1/computing/host/info", false, http.StatusOK},
+		{"signed usage", usagePath, true, http.StatusOK},
+		{"unsigned usage", usagePath, false, http.StatusUnauthorized},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.signed {
+				signHubRequest(t, req, hubKey, cpRepoPath, fmt.Sprintf("nonce-%d", i))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("GET %s = %d, want %d, body: %s", tt.path, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+// initTestRepo creates a cp repo whose hub signs with the given address, and points CP_PATH, the config, the database and the logs at it
+func initTestRepo(t *testing.T, orchestratorPk string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("CP_PATH", dir)
+
+	logger := logs.GetLogger()
+	hooks := logger.ReplaceHooks(make(logrus.LevelHooks))
+	logger.AddHook(lfshook.NewHook(filepath.Join(dir, "cp.log"), logger.Formatter))
+	t.Cleanup(func() {
+		logger.ReplaceHooks(hooks)
+	})
+
+	content := fmt.Sprintf(`
+[API]
+MultiAddress = "/ip4/127.0.0.1/tcp/9085"
+NodeName = "test"
+
+[UBI]
+UbiEnginePk = ""
+EnableSequencer = false
+AutoChainProof = false
+SequencerUrl = ""
+
+[RPC]
+SWAN_CHAIN_RPC = ""
+
+[HUB]
+VerifySign = true
+OrchestratorPk = %q
+`, orchestratorPk)
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "account"), []byte("0x1111111111111111111111111111111111111111"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.InitConfig(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	db.InitDb(dir)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return dir
+}
+
+// signHubRequest sets the signature headers of the hub, it signs the cp account, the node id and the digest of the request
+func signHubRequest(t *testing.T, req *http.Request, key *ecdsa.PrivateKey, cpRepoPath, nonce string) {
+	t.Helper()
+	cpAccount, err := os.ReadFile(filepath.Join(cpRepoPath, "account"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	digest := crypto.Keccak256Hash([]byte(req.Method), []byte(req.URL.Path)).Hex()
+	message := string(cpAccount) + computing.GetNodeId(cpRepoPath) + digest + timestamp + nonce
+
+	hash := crypto.Keccak256Hash([]byte("\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message)) + message))
+	signature, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature[64] += 27
+	req.Header.Set(computing.HeaderSignature, hexutil.Encode(signature))
+	req.Header.Set(computing.HeaderTimestamp, timestamp)
+	req.Header.Set(computing.HeaderNonce, nonce)
+}
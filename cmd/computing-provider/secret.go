@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/swanchain/go-computing-provider/internal/computing"
+	"github.com/urfave/cli/v2"
+)
+
+var secretCmd = &cli.Command{
+	Name:  "secret",
+	Usage: "Manage the secrets referenced by the spaces with secretRef",
+	Subcommands: []*cli.Command{
+		secretSet,
+		secretList,
+		secretDelete,
+	},
+}
+
+var secretSet = &cli.Command{
+	Name:      "set",
+	Usage:     "Create or replace a secret of the space owner",
+	ArgsUsage: "[name] [key=value]...",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "owner",
+			Usage:    "The wallet address of the space owner",
+			Required: true,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() < 2 {
+			return fmt.Errorf("the name and at least one key=value are required")
+		}
+		name := cctx.Args().First()
+		data := make(map[string]string)
+		for _, kv := range cctx.Args().Tail() {
+			key, value, found := strings.Cut(kv, "=")
+			if !found || key == "" {
+				return fmt.Errorf("invalid key=value: %s", kv)
+			}
+			data[key] = value
+		}
+		if err := computing.NewSecretService().SaveSecret(cctx.String("owner"), name, data); err != nil {
+			return fmt.Errorf("failed to save secret, error: %v", err)
+		}
+		fmt.Printf("secret %s saved, the spaces reference its keys by secretRef: %s/<key> \n", name, name)
+		return nil
+	},
+}
+
+var secretList = &cli.Command{
+	Name:  "list",
+	Usage: "List the secrets, the values are not shown",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "owner",
+			Usage: "Only show the secrets of the wallet address",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		secretService := computing.NewSecretService()
+		list, err := secretService.GetSecrets(cctx.String("owner"))
+		if err != nil {
+			return fmt.Errorf("failed to get secrets, error: %v", err)
+		}
+
+		var taskData [][]string
+		for _, secret := range list {
+			data, err := secretService.GetSecret(secret.WalletAddress, secret.Name)
+			if err != nil {
+				return fmt.Errorf("failed to read secret %s, error: %v", secret.Name, err)
+			}
+			var keys []string
+			for key := range data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			updateTime := time.Unix(secret.UpdateTime, 0).Format("2006-01-02 15:04:05")
+			taskData = append(taskData, []string{secret.WalletAddress, secret.Name, strings.Join(keys, ","), updateTime})
+		}
+		header := []string{"OWNER", "NAME", "KEYS", "UPDATE TIME"}
+		NewVisualTable(header, taskData, []RowColor{}).Generate(false)
+		return nil
+	},
+}
+
+var secretDelete = &cli.Command{
+	Name:      "delete",
+	Usage:     "Delete a secret of the space owner",
+	ArgsUsage: "[name]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "owner",
+			Usage:    "The wallet address of the space owner",
+			Required: true,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("the name of the secret is required")
+		}
+		count, err := computing.NewSecretService().DeleteSecret(cctx.String("owner"), cctx.Args().First())
+		if err != nil {
+			return fmt.Errorf("failed to delete secret, error: %v", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("secret %s is not found", cctx.Args().First())
+		}
+		fmt.Printf("secret %s deleted \n", cctx.Args().First())
+		return nil
+	},
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/swanchain/go-computing-provider/constants"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +24,8 @@ var taskCmd = &cli.Command{
 		taskList,
 		taskDetail,
 		taskDelete,
+		taskUsage,
+		taskForecast,
 	},
 }
 
@@ -115,6 +119,181 @@ var taskDetail = &cli.Command{
 	},
 }
 
+var taskUsage = &cli.Command{
+	Name:      "usage",
+	Usage:     "Show the metered resource usage of a job",
+	ArgsUsage: "[job_uuid]",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "since",
+			Usage: "Only show the usage of the last period, e.g. 24h, 0 shows all",
+		},
+		&cli.BoolFlag{
+			Name:    "verbose",
+			Usage:   "Show every window of five minutes",
+			Aliases: []string{"v"},
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("incorrect number of arguments, got %d, missing args: job_uuid", cctx.NArg())
+		}
+
+		cpRepoPath, ok := os.LookupEnv("CP_PATH")
+		if !ok {
+			return fmt.Errorf("missing CP_PATH env, please set export CP_PATH=<YOUR CP_PATH>")
+		}
+		if err := conf.InitConfig(cpRepoPath, true); err != nil {
+			return fmt.Errorf("load config file failed, error: %+v", err)
+		}
+
+		var since int64
+		if period := cctx.Duration("since"); period > 0 {
+			since = time.Now().Add(-period).Unix()
+		}
+		jobUuid := cctx.Args().First()
+		report, err := computing.GetJobUsageReport(jobUuid, since)
+		if err != nil {
+			return fmt.Errorf("failed to get the usage of job %s, error: %v", jobUuid, err)
+		}
+		if len(report.Windows) == 0 {
+			fmt.Printf("no usage has been metered for job %s\n", jobUuid)
+			return nil
+		}
+
+		if cctx.Bool("verbose") {
+			var windowData [][]string
+			for _, w := range report.Windows {
+				windowData = append(windowData, []string{
+					time.Unix(w.WindowStart, 0).Format("2006-01-02 15:04:05"),
+					fmt.Sprintf("%.2f / %.2f", w.CpuCoresAvg, w.CpuCoresMax),
+					fmt.Sprintf("%s / %s", formatBytes(w.MemoryBytesAvg), formatBytes(w.MemoryBytesMax)),
+					fmt.Sprintf("%.1f%%", w.GpuUtilAvg),
+					formatBytes(w.GpuMemoryBytesMax),
+					formatBytes(w.NetworkRxBytes),
+					formatBytes(w.NetworkTxBytes),
+				})
+			}
+			header := []string{"WINDOW", "CPU AVG/MAX", "MEMORY AVG/MAX", "GPU UTIL", "GPU MEMORY", "NET RX", "NET TX"}
+			NewVisualTable(header, windowData, []RowColor{}).Generate(false)
+		}
+
+		summary := report.Summary
+		var taskData [][]string
+		taskData = append(taskData, []string{"FROM:", time.Unix(summary.From, 0).Format("2006-01-02 15:04:05")})
+		taskData = append(taskData, []string{"TO:", time.Unix(summary.To, 0).Format("2006-01-02 15:04:05")})
+		taskData = append(taskData, []string{"METERED:", (time.Duration(summary.MeteredSeconds) * time.Second).String()})
+		taskData = append(taskData, []string{"CPU:", fmt.Sprintf("%.4f core-hours, max %.2f cores", summary.CpuCoreHours, summary.CpuCoresMax)})
+		taskData = append(taskData, []string{"MEMORY:", fmt.Sprintf("%.4f GiB-hours, max %s", summary.MemoryGiBHours, formatBytes(summary.MemoryBytesMax))})
+		taskData = append(taskData, []string{"GPU:", fmt.Sprintf("%.1f%% utilization, max memory %s", summary.GpuUtilAvg, formatBytes(summary.GpuMemoryBytesMax))})
+		taskData = append(taskData, []string{"NETWORK:", fmt.Sprintf("received %s, sent %s", formatBytes(summary.NetworkRxBytes), formatBytes(summary.NetworkTxBytes))})
+
+		header := []string{"JOB UUID:", report.JobUuid}
+		NewVisualTable(header, taskData, []RowColor{}).SetAutoWrapText(false).Generate(false)
+		return nil
+	},
+}
+
+var taskForecast = &cli.Command{
+	Name:  "forecast",
+	Usage: "Forecast the sellable resources over the next hours from the expirations of the running tasks",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "Task type. Support fcp and edge types",
+		},
+		&cli.IntFlag{
+			Name:  "hours",
+			Usage: fmt.Sprintf("The hours to forecast, at most %d", computing.MaxForecastHours),
+			Value: computing.DefaultForecastHours,
+		},
+		&cli.BoolFlag{
+			Name:    "verbose",
+			Usage:   "Show the resources of every node and the expiring tasks",
+			Aliases: []string{"v"},
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		hours := cctx.Int("hours")
+		if hours <= 0 || hours > computing.MaxForecastHours {
+			return fmt.Errorf("hours must be between 1 and %d", computing.MaxForecastHours)
+		}
+		cpRepoPath, ok := os.LookupEnv("CP_PATH")
+		if !ok {
+			return fmt.Errorf("missing CP_PATH env, please set export CP_PATH=<YOUR CP_PATH>")
+		}
+		if err := conf.InitConfig(cpRepoPath, true); err != nil {
+			return fmt.Errorf("load config file failed, error: %+v", err)
+		}
+
+		var forecast models.CapacityForecast
+		var err error
+		switch strings.TrimSpace(cctx.String("type")) {
+		case "fcp":
+			forecast, err = computing.ForecastCapacityForK8s(hours)
+		case "edge":
+			forecast, err = computing.ForecastCapacityForDocker(hours)
+		default:
+			return fmt.Errorf("only support fcp and edge types")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to forecast the capacity, error: %v", err)
+		}
+
+		verbose := cctx.Bool("verbose")
+		var slotData [][]string
+		for _, slot := range forecast.Slots {
+			slotTime := time.Unix(slot.Time, 0).Format("2006-01-02 15:04")
+			slotData = append(slotData, append([]string{slotTime, "ALL"}, formatCapacity(slot.Total)...))
+			if verbose {
+				for _, node := range slot.Nodes {
+					slotData = append(slotData, append([]string{"", node.NodeName}, formatCapacity(node)...))
+				}
+			}
+		}
+		header := []string{"TIME", "NODE", "CPU", "MEMORY", "STORAGE", "GPU"}
+		NewVisualTable(header, slotData, []RowColor{}).Generate(false)
+
+		if verbose && len(forecast.Releases) > 0 {
+			var releaseData [][]string
+			for _, release := range forecast.Releases {
+				releaseData = append(releaseData, append([]string{release.JobUuid, time.Unix(release.ExpireTime, 0).Format("2006-01-02 15:04:05"),
+					release.Resource.NodeName}, formatCapacity(release.Resource)...))
+			}
+			header = []string{"TASK UUID", "EXPIRE TIME", "NODE", "CPU", "MEMORY", "STORAGE", "GPU"}
+			NewVisualTable(header, releaseData, []RowColor{}).Generate(false)
+		}
+		return nil
+	},
+}
+
+func formatCapacity(capacity models.NodeCapacity) []string {
+	var gpus []string
+	for name, count := range capacity.Gpu {
+		gpus = append(gpus, fmt.Sprintf("%s: %d", name, count))
+	}
+	sort.Strings(gpus)
+	return []string{
+		strconv.FormatInt(capacity.Cpu, 10),
+		fmt.Sprintf("%.2f GiB", capacity.MemoryGiB),
+		fmt.Sprintf("%.2f GiB", capacity.StorageGiB),
+		strings.Join(gpus, ", "),
+	}
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
 var taskDelete = &cli.Command{
 	Name:      "delete",
 	Usage:     "Delete an task from the k8s",
@@ -143,16 +322,16 @@ var taskDelete = &cli.Command{
 		}
 
 		serviceName := constants.K8S_SERVICE_NAME_PREFIX + jobUuid
-		ingressName := constants.K8S_INGRESS_NAME_PREFIX + jobUuid
 
 		k8sService := computing.NewK8sService()
-		k8sService.DeleteIngress(context.TODO(), job.NameSpace, ingressName)
+		computing.DeleteJobIngress(context.TODO(), job.NameSpace, jobUuid)
 		k8sService.DeleteService(context.TODO(), job.NameSpace, serviceName)
 		k8sService.DeleteDeployment(context.TODO(), job.NameSpace, job.K8sDeployName)
 		time.Sleep(3 * time.Second)
 		k8sService.DeleteDeployRs(context.TODO(), job.NameSpace, job.JobUuid)
 
 		computing.NewJobService().DeleteJobEntityByJobUuId(job.JobUuid, models.JOB_TERMINATED_STATUS)
+		computing.RecordAudit(computing.AuditActorCli, "task delete", map[string]interface{}{"job_uuid": jobUuid, "namespace": job.NameSpace}, "", nil)
 		fmt.Printf("job_uuid: %s space serivce successfully deleted \n", jobUuid)
 		return nil
 	},
@@ -166,6 +166,15 @@ var daemonCmd = &cli.Command{
 		logs.GetLogger().Info("Starting a computing-provider client.")
 		cpRepoPath, _ := os.LookupEnv("CP_PATH")
 
+		// the lock is held until the process exits, it keeps the doctor from repairing the database under the running cp
+		if _, err := util.LockRepo(cpRepoPath); err != nil {
+			logs.GetLogger().Fatal(err)
+		}
+		if err := conf.InitConfig(cpRepoPath, true); err != nil {
+			logs.GetLogger().Fatal(err)
+		}
+
+		// the resource-exporter runs in both modes, the native collector falls back to it when it fails
 		resourceExporterContainerName := "resource-exporter"
 		rsExist, err := computing.NewDockerService().CheckRunningContainer(resourceExporterContainerName)
 		if err != nil {
@@ -177,47 +186,58 @@ var daemonCmd = &cli.Command{
 				logs.GetLogger().Errorf("restartResourceExporter failed, error: %v", err)
 			}
 		}
-		if err := conf.InitConfig(cpRepoPath, true); err != nil {
-			logs.GetLogger().Fatal(err)
-		}
 		logs.GetLogger().Info("Your config file is:", filepath.Join(cpRepoPath, "config.toml"))
 
 		computing.SyncCpAccountInfo()
+		// the database is reconciled before the crons, which would otherwise act on the rows it corrects
+		computing.ReconcileOnStart(computing.ReconcileForDocker)
 		computing.CronTaskForEcp()
+		computing.ResumeCheckpoints()
 
 		gin.SetMode(gin.ReleaseMode)
 		r := gin.Default()
-		r.Use(cors.Middleware(cors.Config{
-			Origins:         "*",
-			Methods:         "GET, PUT, POST, DELETE",
-			RequestHeaders:  "Origin, Authorization, Content-Type",
-			ExposedHeaders:  "",
-			MaxAge:          50 * time.Second,
-			ValidateHeaders: false,
-		}))
-		pprof.Register(r)
+		// the client ip keys the rate limits and the audit log, so X-Forwarded-For is only read from the trusted proxies
+		if err := r.SetTrustedProxies(conf.GetConfig().API.TrustedProxies); err != nil {
+			logs.GetLogger().Fatalf("invalid TrustedProxies, error: %v", err)
+		}
+		if origins := conf.GetConfig().API.GetCorsOrigins(); origins != "" {
+			r.Use(cors.Middleware(cors.Config{
+				Origins:         origins,
+				Methods:         "GET, PUT, POST, DELETE",
+				RequestHeaders:  "Origin, Authorization, Content-Type, X-CP-Signature, X-CP-Timestamp, X-CP-Nonce",
+				ExposedHeaders:  "",
+				MaxAge:          50 * time.Second,
+				ValidateHeaders: false,
+			}))
+		}
+		pprof.RouteRegister(r.Group("", computing.ApiTokenAuth()))
 
 		router := r.Group("/api/v1/computing")
 		router.GET("/cp", computing.GetCpResource)
-		router.POST("/cp/ubi", computing.DoUbiTaskForDocker)
+		router.POST("/cp/ubi", computing.RateLimit(conf.RateLimitGroupUbi), computing.DoUbiTaskForDocker)
 		router.POST("/cp/docker/receive/ubi", computing.ReceiveUbiProof)
 
 		ecpImageService := computing.NewImageJobService()
-		router.POST("/cp/deploy/check", ecpImageService.CheckJobCondition)
+		router.POST("/cp/deploy/check", computing.RateLimit(conf.RateLimitGroupCheck), ecpImageService.CheckJobCondition)
 		router.GET("/cp/price", computing.GetPrice)
-		router.POST("/cp/deploy", ecpImageService.DeployJob)
 		router.GET("/cp/job/status", ecpImageService.GetJobStatus)
-		router.DELETE("/cp/job/:job_uuid", ecpImageService.DeleteJob)
+		router.GET("/cp/capacity/forecast", computing.RateLimit(conf.RateLimitGroupCheck), computing.ApiTokenAuth(), computing.GetCapacityForecastForDocker)
+
+		signed := router.Group("", computing.RateLimit(conf.RateLimitGroupJob), computing.OrchestratorSignAuth())
+		signed.POST("/cp/deploy", ecpImageService.DeployJob)
+		signed.DELETE("/cp/job/:job_uuid", ecpImageService.DeleteJob)
+		signed.GET("/cp/job/:job_uuid/usage", computing.GetJobUsage)
 
 		shutdownChan := make(chan struct{})
-		httpStopper, err := util.ServeHttp(r, "cp-api", ":"+strconv.Itoa(conf.GetConfig().API.Port), false)
+		httpStopper, err := util.ServeHttp(r, "cp-api", ":"+strconv.Itoa(conf.GetConfig().API.Port), conf.GetConfig().TLS.DaemonTLS)
 		if err != nil {
-			logs.GetLogger().Fatal("failed to start cp-api endpoint: %s", err)
+			logs.GetLogger().Fatalf("failed to start cp-api endpoint: %s", err)
 		}
 		logs.GetLogger().Infof("CP service started successfully, listening on port: %d", conf.GetConfig().API.Port)
 
 		finishCh := util.MonitorShutdown(shutdownChan,
 			util.ShutdownHandler{Component: "cp-api", StopFunc: httpStopper},
+			util.ShutdownHandler{Component: "background", StopFunc: computing.StopBackground},
 		)
 		<-finishCh
 
@@ -88,6 +88,8 @@ func createAccount(cpRepoPath, ownerAddress, beneficiaryAddress string, workerAd
 		return fmt.Errorf("deploy cp account contract failed, error: %v", err)
 	}
 	cpAccountAddress := contractAddress.Hex()
+	computing.RecordAudit(computing.AuditActorCli, "account create", map[string]interface{}{"owner": ownerAddress, "worker": workerAddress,
+		"beneficiary": beneficiaryAddress, "task_types": taskTypes, "account": cpAccountAddress}, tx.Hash().Hex(), nil)
 
 	err = os.WriteFile(filepath.Join(cpRepoPath, "account"), []byte(cpAccountAddress), 0666)
 	if err != nil {
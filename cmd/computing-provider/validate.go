@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/computing"
+	"github.com/urfave/cli/v2"
+)
+
+var validateCmd = &cli.Command{
+	Name:      "validate",
+	Usage:     "Check the deploy.yaml, Dockerfile or model-setting.json of a space before it is deployed",
+	ArgsUsage: "<path>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the result as json",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("incorrect number of arguments, got %d, expected 1 <path>", cctx.NArg())
+		}
+
+		cpRepoPath, _ := os.LookupEnv("CP_PATH")
+		if err := conf.InitConfig(cpRepoPath, true); err != nil {
+			return fmt.Errorf("load config file failed, error: %+v", err)
+		}
+
+		deployParam, err := computing.LocalDeployParam(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		result := computing.ValidateSpace(deployParam, nil)
+
+		if cctx.Bool("json") {
+			data, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		} else if result.Valid {
+			fmt.Printf("%s space is valid \n", result.DeployType)
+		} else {
+			var taskData [][]string
+			for _, problem := range result.Problems {
+				taskData = append(taskData, []string{problem.File, problem.Message})
+			}
+			NewVisualTable([]string{"FILE", "PROBLEM"}, taskData, []RowColor{}).Generate(false)
+		}
+
+		if !result.Valid {
+			return fmt.Errorf("found %d problems in the %s space", len(result.Problems), result.DeployType)
+		}
+		return nil
+	},
+}
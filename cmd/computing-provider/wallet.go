@@ -293,6 +293,7 @@ var walletSend = &cli.Command{
 			return err
 		}
 		txHash, err := localWallet.WalletSend(ctx, from, to, amount)
+		computing.RecordAudit(computing.AuditActorCli, "wallet send", map[string]interface{}{"from": from, "to": to, "amount": amount}, txHash, err)
 		if err != nil {
 			return err
 		}
@@ -378,6 +379,7 @@ var collateralAddCmd = &cli.Command{
 			return err
 		}
 		txHash, err := localWallet.WalletCollateral(ctx, fromAddress, amount, cpAccountAddress, collateralType)
+		computing.RecordAudit(computing.AuditActorCli, "collateral add", map[string]interface{}{"from": fromAddress, "account": cpAccountAddress, "amount": amount, "type": collateralType}, txHash, err)
 		if err != nil {
 			return err
 		}
@@ -446,6 +448,7 @@ var collateralWithdrawCmd = &cli.Command{
 			return err
 		}
 		txHash, err := localWallet.CollateralWithdraw(ctx, ownerAddress, amount, cpAccountAddress, collateralType)
+		computing.RecordAudit(computing.AuditActorCli, "collateral withdraw", map[string]interface{}{"owner": ownerAddress, "account": cpAccountAddress, "amount": amount, "type": collateralType}, txHash, err)
 		if err != nil {
 			return err
 		}
@@ -487,6 +490,7 @@ var collateralWithDrawRequestCmd = &cli.Command{
 			return err
 		}
 		txHash, err := localWallet.CollateralWithdrawRequest(ctx, ownerAddress, amount, cpAccountAddress)
+		computing.RecordAudit(computing.AuditActorCli, "collateral withdraw-request", map[string]interface{}{"owner": ownerAddress, "account": cpAccountAddress, "amount": amount}, txHash, err)
 		if err != nil {
 			return err
 		}
@@ -523,6 +527,7 @@ var collateralWithDrawConfirmCmd = &cli.Command{
 			return err
 		}
 		txHash, err := localWallet.CollateralWithdrawConfirm(ctx, ownerAddress, cpAccountAddress)
+		computing.RecordAudit(computing.AuditActorCli, "collateral withdraw-confirm", map[string]interface{}{"owner": ownerAddress, "account": cpAccountAddress}, txHash, err)
 		if err != nil {
 			return err
 		}
@@ -641,6 +646,7 @@ var collateralSendCmd = &cli.Command{
 			return err
 		}
 		txHash, err := localWallet.CollateralSend(ctx, from, to, amount)
+		computing.RecordAudit(computing.AuditActorCli, "collateral send", map[string]interface{}{"from": from, "to": to, "amount": amount}, txHash, err)
 		if err != nil {
 			return err
 		}
@@ -714,6 +720,7 @@ var sequencerAddCmd = &cli.Command{
 			return err
 		}
 		txHash, err := localWallet.SequencerDeposit(ctx, fromAddress, amount, cpAccountAddress)
+		computing.RecordAudit(computing.AuditActorCli, "sequencer add", map[string]interface{}{"from": fromAddress, "account": cpAccountAddress, "amount": amount}, txHash, err)
 		if err != nil {
 			return err
 		}
@@ -755,6 +762,7 @@ var sequencerWithdrawCmd = &cli.Command{
 			return err
 		}
 		txHash, err := localWallet.SequencerWithdraw(ctx, ownerAddress, amount, cpAccountAddress)
+		computing.RecordAudit(computing.AuditActorCli, "sequencer withdraw", map[string]interface{}{"owner": ownerAddress, "account": cpAccountAddress, "amount": amount}, txHash, err)
 		if err != nil {
 			return err
 		}
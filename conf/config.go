@@ -11,21 +11,34 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var config *ComputeNode
 
 // ComputeNode is a compute node config
 type ComputeNode struct {
-	API      API
-	UBI      UBI
-	LOG      LOG
-	HUB      HUB
-	MCS      MCS
-	Registry Registry
-	RPC      RPC
-	CONTRACT CONTRACT `toml:"CONTRACT,omitempty"`
+	API         API
+	UBI         UBI
+	LOG         LOG
+	HUB         HUB
+	MCS         MCS
+	Registry    Registry
+	RPC         RPC
+	CONTRACT    CONTRACT    `toml:"CONTRACT,omitempty"`
+	RateLimit   RateLimit   `toml:"RateLimit,omitempty"`
+	TLS         TLS         `toml:"TLS,omitempty"`
+	Storage     Storage     `toml:"Storage,omitempty"`
+	Ingress     Ingress     `toml:"Ingress,omitempty"`
+	Builder     Builder     `toml:"Builder,omitempty"`
+	ImagePolicy ImagePolicy `toml:"ImagePolicy,omitempty"`
+	ImageCache  ImageCache  `toml:"ImageCache,omitempty"`
+	Scheduler   Scheduler   `toml:"Scheduler,omitempty"`
+	Collector   Collector   `toml:"Collector,omitempty"`
+	Reconciler  Reconciler  `toml:"Reconciler,omitempty"`
+	Clusters    []Cluster   `toml:"Clusters,omitempty"`
 }
 
 type API struct {
@@ -36,7 +49,29 @@ type API struct {
 	WalletWhiteList string
 	WalletBlackList string
 	Pricing         bool
+	CorsOrigins     []string `toml:"CorsOrigins,omitempty"`
+	AccessTokens    []string `toml:"AccessTokens,omitempty"`
+	TrustedProxies  []string `toml:"TrustedProxies,omitempty"` // the proxies whose X-Forwarded-For is trusted, none by default
+	HostPortRange   string   `toml:"HostPortRange,omitempty"`  // the host ports the compose jobs of ecp may publish, e.g. "40000-40999", none by default
 }
+
+// GetHostPortRange returns the first and the last port of HostPortRange, ok is false if it is not configured or invalid
+func (a API) GetHostPortRange() (first, last int32, ok bool) {
+	from, to, found := strings.Cut(strings.TrimSpace(a.HostPortRange), "-")
+	if !found {
+		return 0, 0, false
+	}
+	firstPort, err := strconv.ParseInt(strings.TrimSpace(from), 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	lastPort, err := strconv.ParseInt(strings.TrimSpace(to), 10, 32)
+	if err != nil || firstPort <= 0 || lastPort > 65535 || firstPort > lastPort {
+		return 0, 0, false
+	}
+	return int32(firstPort), int32(lastPort), true
+}
+
 type UBI struct {
 	UbiEnginePk     string
 	EnableSequencer bool
@@ -49,11 +84,392 @@ type LOG struct {
 	KeyFile string
 }
 
+// TLS extends the certificate configured in LOG.CrtFile and LOG.KeyFile
+type TLS struct {
+	ClientCaFile      string // CA certificate of the orchestrator, client certificates signed by it are trusted
+	RequireClientCert bool   // reject the connections without a client certificate signed by ClientCaFile
+	DaemonTLS         bool   // serve the ubi daemon over TLS
+	Acme              bool   // obtain the certificate of AcmeHost from Let's Encrypt instead of LOG.CrtFile
+	AcmeHost          string // the hostname the cp api is reached by, not the wildcard space domain of API.Domain
+	AcmeEmail         string
+	AcmeCacheDir      string // default: $CP_PATH/acme
+}
+
+// Storage is the persistent volume setting of space jobs
+type Storage struct {
+	EnablePvc      bool   // mount a persistent volume claim sized by the storage of the space hardware
+	StorageClass   string // empty uses the default storage class of the cluster
+	MountPath      string // default: /data
+	RetentionHours int    // keep the volume for a grace period after the job is deleted, 0 deletes it with the job
+}
+
+// Ingress is how the spaces are exposed on their hostnames
+type Ingress struct {
+	Backend          string // nginx, traefik or gateway, default: nginx
+	ClassName        string // the ingress class of the nginx and traefik backends, default: the backend name
+	GatewayName      string // the Gateway which the HTTPRoutes of the gateway backend attach to
+	GatewayNamespace string
+	TLS              string // none, cert-manager or wildcard, default: none
+	ClusterIssuer    string // the cert-manager ClusterIssuer, used by TLS = cert-manager
+	WildcardSecret   string // the "namespace/name" of the wildcard certificate of API.Domain, used by TLS = wildcard
+}
+
+const (
+	IngressBackendNginx   = "nginx"
+	IngressBackendTraefik = "traefik"
+	IngressBackendGateway = "gateway"
+
+	IngressTLSNone        = "none"
+	IngressTLSCertManager = "cert-manager"
+	IngressTLSWildcard    = "wildcard"
+)
+
+// GetBackend returns the configured backend, or nginx if it is not configured
+func (i Ingress) GetBackend() string {
+	if i.Backend == "" {
+		return IngressBackendNginx
+	}
+	return strings.ToLower(i.Backend)
+}
+
+// GetClassName returns the configured ingress class, or the backend name if it is not configured
+func (i Ingress) GetClassName() string {
+	if i.ClassName == "" {
+		return i.GetBackend()
+	}
+	return i.ClassName
+}
+
+func (i Ingress) validate() error {
+	switch i.GetBackend() {
+	case IngressBackendNginx, IngressBackendTraefik:
+	case IngressBackendGateway:
+		if i.GatewayName == "" {
+			return fmt.Errorf("GatewayName is required by the gateway backend")
+		}
+	default:
+		return fmt.Errorf("unsupported backend %q", i.Backend)
+	}
+
+	switch i.TLS {
+	case "", IngressTLSNone:
+	case IngressTLSCertManager:
+		if i.ClusterIssuer == "" {
+			return fmt.Errorf("ClusterIssuer is required by TLS = %s", IngressTLSCertManager)
+		}
+	case IngressTLSWildcard:
+		if len(strings.Split(i.WildcardSecret, "/")) != 2 {
+			return fmt.Errorf("WildcardSecret must be in the form of namespace/name")
+		}
+	default:
+		return fmt.Errorf("unsupported TLS %q", i.TLS)
+	}
+	if i.GetBackend() == IngressBackendGateway && i.TLS != "" && i.TLS != IngressTLSNone {
+		return fmt.Errorf("the TLS of the gateway backend is terminated by the listeners of the Gateway, set TLS = %s", IngressTLSNone)
+	}
+	return nil
+}
+
+// Builder is where the images of the spaces with a Dockerfile are built
+type Builder struct {
+	Mode      string // docker, kaniko or buildkit, default: docker
+	Namespace string // the namespace of the build jobs of kaniko and buildkit, default: cp-builder
+	Image     string // overrides the default image of kaniko or buildkit
+	CacheRepo string // the repository of the build cache, default: <Registry.ServerAddress>/build-cache
+	Timeout   int    // the timeout of one build in seconds, default: 1800
+}
+
+const (
+	BuilderModeDocker   = "docker"
+	BuilderModeKaniko   = "kaniko"
+	BuilderModeBuildkit = "buildkit"
+)
+
+// GetMode returns the configured mode, or docker if it is not configured
+func (b Builder) GetMode() string {
+	if b.Mode == "" {
+		return BuilderModeDocker
+	}
+	return strings.ToLower(b.Mode)
+}
+
+// InCluster reports whether the images are built by a job inside the cluster
+func (b Builder) InCluster() bool {
+	return b.GetMode() != BuilderModeDocker
+}
+
+func (b Builder) GetNamespace() string {
+	if b.Namespace == "" {
+		return "cp-builder"
+	}
+	return b.Namespace
+}
+
+func (b Builder) GetCacheRepo(registryAddress string) string {
+	if b.CacheRepo == "" {
+		return strings.TrimSuffix(strings.TrimSpace(registryAddress), "/") + "/build-cache"
+	}
+	return b.CacheRepo
+}
+
+func (b Builder) GetTimeout() time.Duration {
+	if b.Timeout <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(b.Timeout) * time.Second
+}
+
+func (b Builder) validate(registry Registry) error {
+	switch b.GetMode() {
+	case BuilderModeDocker:
+	case BuilderModeKaniko, BuilderModeBuildkit:
+		if strings.TrimSpace(registry.ServerAddress) == "" {
+			return fmt.Errorf("Registry.ServerAddress is required by Mode = %s, the cluster pulls the built images from it", b.GetMode())
+		}
+	default:
+		return fmt.Errorf("unsupported Mode: %s", b.Mode)
+	}
+	return nil
+}
+
+// ImagePolicy is checked before the images of the jobs are pulled or used as the base of a build
+type ImagePolicy struct {
+	Enable             bool
+	AllowedRegistries  []string // the registries or repositories allowed, such as "docker.io" or "ghcr.io/swanchain/*", empty allows all
+	BlockedRegistries  []string // the registries or repositories blocked, checked before AllowedRegistries
+	CosignKeys         []string // the cosign public keys, an image must be signed by one of them, empty skips the verification
+	MaxImageSizeGB     float64  // the max compressed size of an image, 0 is unlimited
+	InsecureRegistries []string // the registries served over plain http, such as "registry.local:5000"
+}
+
+// ImageCache is how the images on this host are evicted and pre-pulled
+type ImageCache struct {
+	HighWatermark int      // evict the least recently used images when the disk usage of docker reaches it in percent, default: 85
+	LowWatermark  int      // evict until the disk usage is below it in percent, default: 75
+	Pinned        []string // the images never evicted, besides the UBI and resource exporter images
+	PrePull       []string // the images pulled ahead of the jobs, they are never evicted
+}
+
+func (i ImageCache) GetHighWatermark() float64 {
+	if i.HighWatermark <= 0 || i.HighWatermark > 100 {
+		return 85
+	}
+	return float64(i.HighWatermark)
+}
+
+func (i ImageCache) GetLowWatermark() float64 {
+	if i.LowWatermark <= 0 || float64(i.LowWatermark) > i.GetHighWatermark() {
+		return min(75, i.GetHighWatermark())
+	}
+	return float64(i.LowWatermark)
+}
+
+// Scheduler is how the replicas of the space jobs are placed on the nodes of the cluster
+type Scheduler struct {
+	Strategy  string     // binpack, spread or gpu-affinity, default: spread
+	NodePools []NodePool `toml:"NodePools,omitempty"`
+}
+
+// NodePool is a group of nodes selected by their names or labels, the spaces of its types only run on the pools which take them
+type NodePool struct {
+	Name        string
+	Nodes       []string          // the names of the nodes of the pool
+	Labels      map[string]string // the nodes which have all these labels are also in the pool
+	SpaceTypes  []string          // public or private, the spaces of a type which no pool takes run on any node
+	Tolerations []NodeToleration  `toml:"Tolerations,omitempty"` // the taints of the nodes of the pool which its spaces tolerate
+}
+
+// NodeToleration is a toleration of the pods of a node pool, as the tolerations of a pod spec
+type NodeToleration struct {
+	Key      string
+	Operator string // Equal or Exists, default: Equal
+	Value    string
+	Effect   string // NoSchedule, PreferNoSchedule or NoExecute, empty tolerates every effect
+}
+
+const (
+	SchedulerBinpack     = "binpack"
+	SchedulerSpread      = "spread"
+	SchedulerGpuAffinity = "gpu-affinity"
+)
+
+var nodePoolNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// GetStrategy returns the configured strategy, or spread if it is not configured
+func (s Scheduler) GetStrategy() string {
+	if s.Strategy == "" {
+		return SchedulerSpread
+	}
+	return strings.ToLower(s.Strategy)
+}
+
+// PoolsOf returns the pools which take the spaces of the type
+func (s Scheduler) PoolsOf(spaceType string) []NodePool {
+	var pools []NodePool
+	for _, pool := range s.NodePools {
+		for _, t := range pool.SpaceTypes {
+			if strings.EqualFold(t, spaceType) {
+				pools = append(pools, pool)
+				break
+			}
+		}
+	}
+	return pools
+}
+
+func (s Scheduler) validate() error {
+	switch s.GetStrategy() {
+	case SchedulerBinpack, SchedulerSpread, SchedulerGpuAffinity:
+	default:
+		return fmt.Errorf("unsupported Strategy %q", s.Strategy)
+	}
+
+	names := make(map[string]bool)
+	for _, pool := range s.NodePools {
+		if !nodePoolNamePattern.MatchString(pool.Name) {
+			return fmt.Errorf("the name of a node pool must be a lowercase DNS label, got %q", pool.Name)
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("duplicate node pool %q", pool.Name)
+		}
+		names[pool.Name] = true
+		if len(pool.Nodes) == 0 && len(pool.Labels) == 0 {
+			return fmt.Errorf("node pool %q selects no node, set Nodes or Labels", pool.Name)
+		}
+		for _, toleration := range pool.Tolerations {
+			switch toleration.Operator {
+			case "", "Equal", "Exists":
+			default:
+				return fmt.Errorf("node pool %q has a toleration of unsupported Operator %q", pool.Name, toleration.Operator)
+			}
+			switch toleration.Effect {
+			case "", "NoSchedule", "PreferNoSchedule", "NoExecute":
+			default:
+				return fmt.Errorf("node pool %q has a toleration of unsupported Effect %q", pool.Name, toleration.Effect)
+			}
+			if toleration.Key == "" && toleration.Operator != "Exists" {
+				return fmt.Errorf("node pool %q has a toleration without Key, whose Operator must be Exists", pool.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Collector is how the resources of the nodes are collected
+type Collector struct {
+	Mode string // native or exporter, default: native. The native collector falls back to the resource-exporter when it fails
+}
+
+const (
+	CollectorNative   = "native"
+	CollectorExporter = "exporter"
+)
+
+// GetMode returns the configured mode, or native if it is not configured
+func (c Collector) GetMode() string {
+	if c.Mode == "" {
+		return CollectorNative
+	}
+	return strings.ToLower(c.Mode)
+}
+
+func (c Collector) validate() error {
+	switch c.GetMode() {
+	case CollectorNative, CollectorExporter:
+		return nil
+	}
+	return fmt.Errorf("unsupported Mode %q", c.Mode)
+}
+
+// Cluster is a kubernetes cluster of the cp. Without clusters the cp runs on the cluster of ~/.kube/config,
+// with clusters the space jobs are placed in the first one which has room for them. The first cluster is the
+// default one: the public spaces of API.Domain, the ubi tasks, the capacity forecast, the node drain, the
+// network policy check and the container runtime only use it.
+type Cluster struct {
+	Name       string // a lowercase DNS label, recorded on the jobs deployed to the cluster
+	KubeConfig string // the path of the kubeconfig of the cluster, default: ~/.kube/config
+	PublicIp   string // the ip the node ports of the cluster are reached by, default: the ip of the MultiAddress
+}
+
+func validateClusters(clusters []Cluster) error {
+	names := make(map[string]bool)
+	for _, cluster := range clusters {
+		if !nodePoolNamePattern.MatchString(cluster.Name) {
+			return fmt.Errorf("the name of a cluster must be a lowercase DNS label, got %q", cluster.Name)
+		}
+		if names[cluster.Name] {
+			return fmt.Errorf("duplicate cluster %q", cluster.Name)
+		}
+		names[cluster.Name] = true
+		if cluster.KubeConfig != "" {
+			if _, err := os.Stat(cluster.KubeConfig); err != nil {
+				return fmt.Errorf("the kubeconfig of cluster %q is not found, %v", cluster.Name, err)
+			}
+		}
+		if cluster.PublicIp != "" && net.ParseIP(cluster.PublicIp) == nil {
+			return fmt.Errorf("the PublicIp of cluster %q is invalid, got %q", cluster.Name, cluster.PublicIp)
+		}
+	}
+	return nil
+}
+
+// Reconciler is how the database is reconciled with the cluster or the containers on start
+type Reconciler struct {
+	OrphanPolicy string // keep, adopt or remove, default: keep. How the deployments and containers of no job are handled
+}
+
+const (
+	OrphanKeep   = "keep"
+	OrphanAdopt  = "adopt"
+	OrphanRemove = "remove"
+)
+
+// GetOrphanPolicy returns the configured policy, or keep if it is not configured
+func (r Reconciler) GetOrphanPolicy() string {
+	if r.OrphanPolicy == "" {
+		return OrphanKeep
+	}
+	return strings.ToLower(r.OrphanPolicy)
+}
+
+func (r Reconciler) validate() error {
+	return ValidateOrphanPolicy(r.GetOrphanPolicy())
+}
+
+// ValidateOrphanPolicy checks the policy given in the config or on the command line
+func ValidateOrphanPolicy(policy string) error {
+	switch policy {
+	case OrphanKeep, OrphanAdopt, OrphanRemove:
+		return nil
+	}
+	return fmt.Errorf("unsupported OrphanPolicy %q", policy)
+}
+
 type HUB struct {
 	AccessToken      string
 	BalanceThreshold float64
 	OrchestratorPk   string
 	VerifySign       bool
+	JobSourceHosts   []string `toml:"JobSourceHosts,omitempty"` // the hosts of the space api the cp fetches the spaces to validate from
+}
+
+// defaultJobSourceHost is the domain of the orchestrator and the space api, its subdomains are allowed too
+const defaultJobSourceHost = "swanchain.io"
+
+// AllowJobSourceHost reports whether the host, or a domain it belongs to, is one of JobSourceHosts
+func (h HUB) AllowJobSourceHost(host string) bool {
+	hosts := h.JobSourceHosts
+	if len(hosts) == 0 {
+		hosts = []string{defaultJobSourceHost}
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed != "" && (host == allowed || strings.HasSuffix(host, "."+allowed)) {
+			return true
+		}
+	}
+	return false
 }
 
 type MCS struct {
@@ -72,6 +488,40 @@ type RPC struct {
 	SwanChainRpc string `toml:"SWAN_CHAIN_RPC"`
 }
 
+type RateLimit struct {
+	Rules map[string]RateLimitRule
+}
+
+// RateLimitRule is the token bucket setting of a route group, a rate of 0 means unlimited
+type RateLimitRule struct {
+	IpRate   float64 // requests per second for each client ip
+	IpBurst  int
+	KeyRate  float64 // requests per second for each signing key
+	KeyBurst int
+}
+
+const (
+	RateLimitGroupUbi   = "ubi"
+	RateLimitGroupJob   = "job"
+	RateLimitGroupCheck = "check"
+)
+
+func DefaultRateLimitRules() map[string]RateLimitRule {
+	return map[string]RateLimitRule{
+		RateLimitGroupUbi:   {IpRate: 1, IpBurst: 10, KeyRate: 5, KeyBurst: 20},
+		RateLimitGroupJob:   {IpRate: 1, IpBurst: 10, KeyRate: 5, KeyBurst: 20},
+		RateLimitGroupCheck: {IpRate: 5, IpBurst: 20},
+	}
+}
+
+// GetRule returns the configured rule of the group, or the default one if it is not configured
+func (r RateLimit) GetRule(group string) RateLimitRule {
+	if rule, ok := r.Rules[group]; ok {
+		return rule
+	}
+	return DefaultRateLimitRules()[group]
+}
+
 type CONTRACT struct {
 	SwanToken         string `toml:"SWAN_CONTRACT"`
 	CpAccountRegister string `toml:"REGISTER_CP_CONTRACT"`
@@ -128,6 +578,28 @@ func InitConfig(cpRepoPath string, standalone bool) error {
 		if !isValidDomain(domain) {
 			log.Fatalf("domain \"%s\" is invalid\n", domain)
 		}
+
+		if err = config.Ingress.validate(); err != nil {
+			log.Fatalf("Ingress is invalid, %v\n", err)
+		}
+		if err = config.Builder.validate(config.Registry); err != nil {
+			log.Fatalf("Builder is invalid, %v\n", err)
+		}
+		if err = config.Scheduler.validate(); err != nil {
+			log.Fatalf("Scheduler is invalid, %v\n", err)
+		}
+		if err = config.Collector.validate(); err != nil {
+			log.Fatalf("Collector is invalid, %v\n", err)
+		}
+		if err = validateClusters(config.Clusters); err != nil {
+			log.Fatalf("Clusters is invalid, %v\n", err)
+		}
+	}
+	if err = config.Reconciler.validate(); err != nil {
+		log.Fatalf("Reconciler is invalid, %v\n", err)
+	}
+	if _, _, ok := config.API.GetHostPortRange(); config.API.HostPortRange != "" && !ok {
+		log.Fatalf("API.HostPortRange %q is invalid, it must be like 40000-40999\n", config.API.HostPortRange)
 	}
 
 	networkConfig := build.LoadParam()
@@ -157,6 +629,18 @@ func GetConfig() *ComputeNode {
 	return config
 }
 
+// GetCorsOrigins returns the allowed CORS origins in the format expected by gin-cors, or an empty string when
+// no origin is allowed and the CORS middleware is not installed
+func (a API) GetCorsOrigins() string {
+	var origins []string
+	for _, origin := range a.CorsOrigins {
+		if o := strings.TrimSpace(origin); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return strings.Join(origins, ", ")
+}
+
 func requiredFieldsAreGiven(metaData toml.MetaData) bool {
 	requiredFields := [][]string{
 		{"API"},
@@ -353,6 +837,9 @@ func generateDefaultConfig() ComputeNode {
 			ZkCollateral:      "",
 			Sequencer:         "",
 		},
+		RateLimit: RateLimit{
+			Rules: DefaultRateLimitRules(),
+		},
 	}
 }
 
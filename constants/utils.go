@@ -17,11 +17,13 @@ const K8S_PRIVATE_CONTAINER_PREFIX = "vm-"
 const K8S_INGRESS_NAME_PREFIX = "ing-"
 const K8S_SERVICE_NAME_PREFIX = "svc-"
 const K8S_DEPLOY_NAME_PREFIX = "deploy-"
+const K8S_PVC_NAME_PREFIX = "pvc-"
 
 const CPU_AMD = "AMD"
 const CPU_INTEL = "INTEL"
 
 const SPACE_TYPE_PUBLIC = "public"
+const SPACE_TYPE_PRIVATE = "private"
 
 const (
 	BidMode_All = iota
@@ -0,0 +1,128 @@
+package computing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/swanchain/go-computing-provider/internal/models"
+)
+
+const (
+	AuditActorCli    = "cli"
+	AuditActorSystem = "system"
+
+	auditResultSuccess = "success"
+	auditRetryTimes    = 3
+)
+
+var auditLock sync.Mutex
+
+func AuditActorApi(c *gin.Context) string {
+	return "api:" + c.ClientIP()
+}
+
+// RecordAudit appends an entry to the hash-chained audit log. Failures are only logged,
+// the audited action has already happened and must not be reported as failed.
+func RecordAudit(actor, action string, params map[string]interface{}, txHash string, actionErr error) {
+	paramsBytes, err := json.Marshal(params)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to marshal audit params, action: %s, error: %v", action, err)
+		return
+	}
+
+	result := auditResultSuccess
+	if actionErr != nil {
+		result = "failed: " + actionErr.Error()
+	}
+
+	cpRepoPath, _ := os.LookupEnv("CP_PATH")
+	privateKey, err := loadNodePrivateKey(cpRepoPath)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to record audit log, action: %s, error: %v", action, err)
+		return
+	}
+
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	// the unique index of prev_hash rejects a fork when another process appends at the same time, so retry
+	for i := 0; i < auditRetryTimes; i++ {
+		last, err := NewAuditService().GetLastAuditLog()
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get last audit log, error: %v", err)
+			return
+		}
+
+		entry := &models.AuditLogEntity{
+			Actor:      actor,
+			Action:     action,
+			Params:     string(paramsBytes),
+			TxHash:     txHash,
+			Result:     result,
+			PrevHash:   last.Hash,
+			CreateTime: time.Now().Unix(),
+		}
+		entry.Hash = auditHash(entry)
+		signature, err := crypto.Sign(hexutil.MustDecode(entry.Hash), privateKey)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to sign audit log, action: %s, error: %v", action, err)
+			return
+		}
+		entry.Signature = hexutil.Encode(signature)
+
+		if err = NewAuditService().Create(entry).Error; err == nil {
+			return
+		} else if i == auditRetryTimes-1 {
+			logs.GetLogger().Errorf("failed to save audit log, action: %s, error: %v", action, err)
+		}
+	}
+}
+
+// VerifyAuditLog walks the whole chain and returns the number of checked entries,
+// the error describes the first entry which was modified, removed or not signed by this node.
+func VerifyAuditLog() (int, error) {
+	cpRepoPath, _ := os.LookupEnv("CP_PATH")
+	privateKey, err := loadNodePrivateKey(cpRepoPath)
+	if err != nil {
+		return 0, err
+	}
+	nodeAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	list, err := NewAuditService().GetAllAuditLogs()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get audit logs, error: %v", err)
+	}
+
+	var prevHash string
+	for i, entry := range list {
+		if entry.PrevHash != prevHash {
+			return i, fmt.Errorf("audit log id: %d is not linked to the previous entry, an entry may have been removed", entry.Id)
+		}
+		if auditHash(&entry) != entry.Hash {
+			return i, fmt.Errorf("audit log id: %d hash mismatch, the entry has been modified", entry.Id)
+		}
+
+		signature, err := hexutil.Decode(entry.Signature)
+		if err != nil {
+			return i, fmt.Errorf("audit log id: %d has an invalid signature, error: %v", entry.Id, err)
+		}
+		pubKey, err := crypto.SigToPub(hexutil.MustDecode(entry.Hash), signature)
+		if err != nil || crypto.PubkeyToAddress(*pubKey) != nodeAddress {
+			return i, fmt.Errorf("audit log id: %d is not signed by this node", entry.Id)
+		}
+		prevHash = entry.Hash
+	}
+	return len(list), nil
+}
+
+func auditHash(entry *models.AuditLogEntity) string {
+	data := fmt.Sprintf("%s|%d|%s|%s|%s|%s|%s", entry.PrevHash, entry.CreateTime, entry.Actor, entry.Action, entry.Params, entry.TxHash, entry.Result)
+	return crypto.Keccak256Hash([]byte(data)).Hex()
+}
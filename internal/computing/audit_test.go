@@ -0,0 +1,108 @@
+package computing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/swanchain/go-computing-provider/internal/db"
+	"github.com/swanchain/go-computing-provider/internal/models"
+)
+
+func TestVerifyAuditLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T)
+		checked int
+		wantErr string
+	}{
+		{"intact", func(t *testing.T) {}, 3, ""},
+		{"modified", func(t *testing.T) {
+			if err := db.DB.Model(&models.AuditLogEntity{}).Where("id = ?", 2).Update("params", `{"job":"other"}`).Error; err != nil {
+				t.Fatal(err)
+			}
+		}, 1, "hash mismatch"},
+		{"removed", func(t *testing.T) {
+			if err := db.DB.Delete(&models.AuditLogEntity{}, 2).Error; err != nil {
+				t.Fatal(err)
+			}
+		}, 1, "not linked"},
+		{"signed by another key", func(t *testing.T) {
+			otherKey, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entry models.AuditLogEntity
+			if err = db.DB.First(&entry, 3).Error; err != nil {
+				t.Fatal(err)
+			}
+			signature, err := crypto.Sign(hexutil.MustDecode(entry.Hash), otherKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = db.DB.Model(&entry).Update("signature", hexutil.Encode(signature)).Error; err != nil {
+				t.Fatal(err)
+			}
+		}, 2, "not signed by this node"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDb(t)
+			privateKey, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(filepath.Join(os.Getenv("CP_PATH"), "private_key"), crypto.FromECDSA(privateKey), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			RecordAudit(AuditActorCli, "collateral add", map[string]interface{}{"amount": "1"}, "0x01", nil)
+			RecordAudit(AuditActorSystem, "delete job", map[string]interface{}{"job": "a"}, "", errors.New("not found"))
+			RecordAudit(AuditActorCli, "collateral withdraw", map[string]interface{}{"amount": "1"}, "0x02", nil)
+			tt.tamper(t)
+
+			checked, err := VerifyAuditLog()
+			if checked != tt.checked {
+				t.Errorf("VerifyAuditLog() checked %d entries, want %d", checked, tt.checked)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("VerifyAuditLog() error = %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyAuditLog() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecordAuditChain(t *testing.T) {
+	initTestDb(t)
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(os.Getenv("CP_PATH"), "private_key"), crypto.FromECDSA(privateKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	RecordAudit(AuditActorCli, "first", nil, "", nil)
+	RecordAudit(AuditActorCli, "second", nil, "", errors.New("reverted"))
+
+	list, err := NewAuditService().GetAllAuditLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d audit logs, want 2", len(list))
+	}
+	if list[0].PrevHash != "" || list[1].PrevHash != list[0].Hash {
+		t.Errorf("the entries are not chained: %q <- %q", list[0].Hash, list[1].PrevHash)
+	}
+	if list[0].Result != auditResultSuccess || list[1].Result != "failed: reverted" {
+		t.Errorf("results = %q, %q", list[0].Result, list[1].Result)
+	}
+}
@@ -0,0 +1,125 @@
+package computing
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/contract"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
+)
+
+const (
+	HeaderSignature     = "X-CP-Signature"
+	HeaderTimestamp     = "X-CP-Timestamp"
+	HeaderNonce         = "X-CP-Nonce"
+	HeaderAuthorization = "Authorization"
+)
+
+// OrchestratorSignAuth verifies that a mutating request was signed by the orchestrator configured in HUB.OrchestratorPk.
+// The signed message is cpAccountAddress + nodeID + keccak256(method + path + body) + timestamp + nonce,
+// sent in the X-CP-Signature, X-CP-Timestamp and X-CP-Nonce headers.
+func OrchestratorSignAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !conf.GetConfig().HUB.VerifySign {
+			c.Next()
+			return
+		}
+
+		signature := strings.TrimSpace(c.GetHeader(HeaderSignature))
+		if signature == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, util.CreateErrorResponse(util.SignatureError, fmt.Sprintf("missing %s header", HeaderSignature)))
+			return
+		}
+
+		timestamp, err := strconv.ParseInt(c.GetHeader(HeaderTimestamp), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, fmt.Sprintf("invalid %s header", HeaderTimestamp)))
+			return
+		}
+		envelope := models.SignedEnvelope{Timestamp: timestamp, Nonce: c.GetHeader(HeaderNonce)}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		cpAccountAddress, err := contract.GetCpAccountAddress()
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get cp account contract address, error: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, util.CreateErrorResponse(util.GetCpAccountError))
+			return
+		}
+		cpRepoPath, _ := os.LookupEnv("CP_PATH")
+		nodeID := GetNodeId(cpRepoPath)
+
+		message := signedMessage(fmt.Sprintf("%s%s%s", cpAccountAddress, nodeID, requestDigest(c.Request.Method, c.Request.URL.Path, body)), envelope)
+		ok, err := verifySignatureForHub(conf.GetConfig().HUB.OrchestratorPk, message, signature)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to verify request signature, path: %s, error: %v", c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, util.CreateErrorResponse(util.SignatureError, "verify sign data occur error"))
+			return
+		}
+		if !ok {
+			logs.GetLogger().Warnf("request signature verify failed, path: %s, client: %s", c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, util.CreateErrorResponse(util.SignatureError))
+			return
+		}
+		if !allowSigner(c, conf.GetConfig().HUB.OrchestratorPk) {
+			return
+		}
+		if err = checkSignedEnvelope(NonceSourceHub, envelope); err != nil {
+			logs.GetLogger().Warnf("reject request, path: %s, error: %v", c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(envelopeErrorResponse(err))
+			return
+		}
+		c.Next()
+	}
+}
+
+// ApiTokenAuth protects operator routes with the bearer tokens listed in API.AccessTokens.
+// When no token is configured the routes are only served to the loopback address of the host.
+func ApiTokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokens := conf.GetConfig().API.AccessTokens
+		if len(tokens) == 0 {
+			if ip := net.ParseIP(c.RemoteIP()); ip != nil && ip.IsLoopback() {
+				c.Next()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, util.CreateErrorResponse(util.UnauthorizedError, "no access token is configured, the route is only served to localhost"))
+			return
+		}
+
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader(HeaderAuthorization), "Bearer"))
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, util.CreateErrorResponse(util.UnauthorizedError))
+			return
+		}
+		for _, t := range tokens {
+			if t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		logs.GetLogger().Warnf("invalid api token, path: %s, client: %s", c.Request.URL.Path, c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, util.CreateErrorResponse(util.UnauthorizedError))
+	}
+}
+
+func requestDigest(method, path string, body []byte) string {
+	return crypto.Keccak256Hash([]byte(method), []byte(path), body).Hex()
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
 	"github.com/swanchain/go-computing-provider/conf"
 	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/internal/yaml"
 	"github.com/swanchain/go-computing-provider/util"
 	"io"
 	"log"
@@ -25,14 +26,18 @@ const (
 
 func DownloadSpaceResources(jobUuid string, files []models.SpaceFile) (DeployParam, error) {
 	updateJobStatus(jobUuid, models.DEPLOY_DOWNLOAD_SOURCE)
+	cpRepoPath, _ := os.LookupEnv("CP_PATH")
+	return downloadSpaceFiles(filepath.Join(cpRepoPath, "build"), files)
+}
+
+func downloadSpaceFiles(buildFolder string, files []models.SpaceFile) (DeployParam, error) {
 	var deployParam DeployParam
 
 	var err error
-	cpRepoPath, _ := os.LookupEnv("CP_PATH")
-	buildFolder := filepath.Join(cpRepoPath, "build")
 	if len(files) > 0 {
 		var containsYaml bool
 		var yamlName string
+		var composeName string
 		var modelsSettingFileName string
 
 		var fileNames []string
@@ -51,10 +56,18 @@ func DownloadSpaceResources(jobUuid string, files []models.SpaceFile) (DeployPar
 				containsYaml = true
 				yamlName = file.Name
 			}
+			if yaml.IsComposeFile(file.Name) {
+				composeName = file.Name
+			}
 			if strings.EqualFold(file.Name, modelSetName) {
 				modelsSettingFileName = file.Name
 			}
 		}
+		// the deploy.yaml takes priority over a docker compose file
+		if yamlName == "" && composeName != "" {
+			containsYaml = true
+			yamlName = composeName
+		}
 		prefix := commonPrefix(fileNames)
 		imagePath := filepath.Join(buildFolder, prefix)
 
@@ -121,15 +134,27 @@ func BuildImagesByDockerfile(jobUuid, spaceName, imagePath string) (string, stri
 
 	log.Printf("Image path: %s", imagePath)
 
-	dockerService := NewDockerService()
-	if err := dockerService.BuildImage(imagePath, imageName); err != nil {
-		logs.GetLogger().Errorf("Error building Docker image: %v", err)
+	dockerfile, err := os.ReadFile(dockerfilePath)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to read Dockerfile, path: %s, error: %v", dockerfilePath, err)
+		return "", ""
+	}
+	if err = checkDockerfileBaseImages(string(dockerfile)); err != nil {
+		logs.GetLogger().Errorf("reject the base image of job_uuid: %s, error: %v", jobUuid, err)
+		if err = NewJobService().UpdateJobError(jobUuid, err.Error()); err != nil {
+			logs.GetLogger().Errorf("failed to save job error, job_uuid: %s, error: %v", jobUuid, err)
+		}
+		return "", ""
+	}
+
+	if err := buildImage(jobUuid, spaceName, imagePath, dockerfilePath, imageName); err != nil {
+		logs.GetLogger().Errorf("Error building image, job_uuid: %s, error: %v", jobUuid, err)
 		return "", ""
 	}
 
-	if conf.GetConfig().Registry.ServerAddress != "" {
+	if conf.GetConfig().Registry.ServerAddress != "" && !conf.GetConfig().Builder.InCluster() {
 		updateJobStatus(jobUuid, models.DEPLOY_PUSH_IMAGE)
-		if err := dockerService.PushImage(imageName); err != nil {
+		if err := NewDockerService().PushImage(imageName); err != nil {
 			logs.GetLogger().Errorf("Error Docker push image: %v", err)
 			return "", ""
 		}
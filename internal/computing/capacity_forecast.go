@@ -0,0 +1,346 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ecpCpuPeriod is the cfs period of the ecp containers in microseconds, the default one of docker
+const ecpCpuPeriod = 100000
+
+// The capacity is forecast hour by hour, for one day by default and for one week at most
+const (
+	DefaultForecastHours = 24
+	MaxForecastHours     = 168
+)
+
+// ecpJobExpireTime returns when an ecp job of the duration in seconds expires, 0 for a job without duration
+func ecpJobExpireTime(duration int) int64 {
+	if duration <= 0 {
+		return 0
+	}
+	return time.Now().Unix() + int64(duration)
+}
+
+// ForecastCapacityForK8s projects the sellable resources of the schedulable nodes from the expirations of the space jobs,
+// the pods of the jobs without an expire time, such as the ubi tasks, keep their resources over the whole forecast.
+// Only the nodes of the default cluster are forecast.
+func ForecastCapacityForK8s(hours int) (models.CapacityForecast, error) {
+	from := time.Now().Unix()
+	end := forecastEnd(from, hours)
+
+	ctx := context.TODO()
+	k8sService := NewK8sService()
+	activePods, err := k8sService.GetAllActivePod(ctx)
+	if err != nil {
+		return models.CapacityForecast{}, fmt.Errorf("failed to get the active pods, error: %v", err)
+	}
+	nodes, err := k8sService.k8sClient.CoreV1().Nodes().List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		return models.CapacityForecast{}, fmt.Errorf("failed to list the nodes, error: %v", err)
+	}
+	nodeInfos, err := k8sService.GetNodeInfos(ctx)
+	if err != nil {
+		logs.GetLogger().Warnf("failed to collect the gpus of the nodes, the gpus are left out of the forecast, error: %v", err)
+	}
+
+	// a node counts if the pods of some job tolerate its taints
+	tolerations := jobTolerations(conf.GetConfig().Scheduler.NodePools, true)
+	var free []models.NodeCapacity
+	productNames := make(map[string]map[string]string)
+	for _, node := range nodes.Items {
+		if !schedulableNode(&node, tolerations) {
+			continue
+		}
+		nodeGpu, remainder, _ := GetNodeResource(activePods, &node)
+		capacity := models.NodeCapacity{
+			NodeName:   node.Name,
+			Cpu:        remainder[ResourceCpu],
+			MemoryGiB:  formatGiB(remainder[ResourceMem]),
+			StorageGiB: formatGiB(remainder[ResourceStorage]),
+		}
+
+		used := make(map[string]int64)
+		for name, count := range nodeGpu {
+			used[normalizeGpuName(name)] += count
+		}
+		productNames[node.Name] = make(map[string]string)
+		for _, detail := range nodeInfos[node.Name].Gpu.Details {
+			name := normalizeGpuName(detail.ProductName)
+			productNames[node.Name][name] = detail.ProductName
+			if used[name] > 0 {
+				used[name]--
+				continue
+			}
+			if capacity.Gpu == nil {
+				capacity.Gpu = make(map[string]int64)
+			}
+			capacity.Gpu[detail.ProductName]++
+		}
+		free = append(free, capacity)
+	}
+
+	jobList, err := NewJobService().GetJobList(0)
+	if err != nil {
+		return models.CapacityForecast{}, fmt.Errorf("failed to get the jobs, error: %v", err)
+	}
+	jobs := make(map[string]*models.JobEntity)
+	for _, job := range jobList {
+		if job.ExpireTime > 0 && job.ExpireTime <= end {
+			jobs[strings.ToLower(job.JobUuid)] = job
+		}
+	}
+
+	// a job releases the resources of its pods on each node it runs on
+	releases := make(map[string]*models.CapacityRelease)
+	for _, pod := range activePods {
+		job, ok := jobs[pod.Labels["lad_app"]]
+		if !ok || pod.Spec.NodeName == "" {
+			continue
+		}
+		key := job.JobUuid + "/" + pod.Spec.NodeName
+		release, ok := releases[key]
+		if !ok {
+			release = &models.CapacityRelease{
+				JobUuid:    job.JobUuid,
+				ExpireTime: job.ExpireTime,
+				Resource:   models.NodeCapacity{NodeName: pod.Spec.NodeName},
+			}
+			releases[key] = release
+		}
+		release.Resource.Cpu += cpuInPod(&pod)
+		release.Resource.MemoryGiB += formatGiB(memInPod(&pod))
+		release.Resource.StorageGiB += formatGiB(storageInPod(&pod))
+		if gpuName, count := gpuInPod(&pod); count > 0 {
+			productName, ok := productNames[pod.Spec.NodeName][normalizeGpuName(gpuName)]
+			if !ok {
+				productName = gpuName
+			}
+			if release.Resource.Gpu == nil {
+				release.Resource.Gpu = make(map[string]int64)
+			}
+			release.Resource.Gpu[productName] += count
+		}
+	}
+
+	return buildCapacityForecast(from, hours, free, releases, currentReserve()), nil
+}
+
+// ForecastCapacityForDocker projects the sellable resources of this host from the expirations of the ecp jobs
+func ForecastCapacityForDocker(hours int) (models.CapacityForecast, error) {
+	from := time.Now().Unix()
+	end := forecastEnd(from, hours)
+
+	nodeResource, err := collectHostResource()
+	if err != nil {
+		return models.CapacityForecast{}, fmt.Errorf("failed to collect the resources of this host, error: %v", err)
+	}
+	nodeName := conf.GetConfig().API.NodeName
+	capacity := models.NodeCapacity{
+		NodeName:   nodeName,
+		MemoryGiB:  freeAmount(nodeResource.Memory.Free),
+		StorageGiB: freeAmount(nodeResource.Storage.Free),
+	}
+	productNames := make(map[string]string)
+	for _, detail := range nodeResource.Gpu.Details {
+		productNames[detail.Index] = detail.ProductName
+		if detail.Status == models.Available {
+			if capacity.Gpu == nil {
+				capacity.Gpu = make(map[string]int64)
+			}
+			capacity.Gpu[detail.ProductName]++
+		}
+	}
+
+	ecpJobs, err := NewEcpJobService().GetEcpJobs("")
+	if err != nil {
+		return models.CapacityForecast{}, fmt.Errorf("failed to get the ecp jobs, error: %v", err)
+	}
+
+	// the cpu of the host is sold by the limits of the containers, so the free cpu is what they leave and not what is idle now,
+	// the idle cpu of a running job would be counted again at its release. The containers of a compose job are released together.
+	dockerService := NewDockerService()
+	releases := make(map[string]*models.CapacityRelease)
+	jobNanoCpus := make(map[string]int64)
+	for _, job := range ecpJobs {
+		info, err := dockerService.c.ContainerInspect(context.TODO(), job.ContainerName)
+		if err != nil || info.ContainerJSONBase == nil || info.State == nil || !info.State.Running {
+			continue
+		}
+		hostConfig := info.HostConfig
+		jobNanoCpus[job.Uuid] += containerNanoCpus(hostConfig.Resources)
+		if job.ExpireTime == 0 || job.ExpireTime > end {
+			continue
+		}
+		release, ok := releases[job.Uuid]
+		if !ok {
+			release = &models.CapacityRelease{
+				JobUuid:    job.Uuid,
+				ExpireTime: job.ExpireTime,
+				Resource:   models.NodeCapacity{NodeName: nodeName},
+			}
+			releases[job.Uuid] = release
+		}
+
+		release.Resource.MemoryGiB += formatGiB(hostConfig.Memory)
+		for _, request := range hostConfig.DeviceRequests {
+			for _, id := range request.DeviceIDs {
+				if productName, ok := productNames[id]; ok {
+					if release.Resource.Gpu == nil {
+						release.Resource.Gpu = make(map[string]int64)
+					}
+					release.Resource.Gpu[productName]++
+				}
+			}
+		}
+	}
+
+	totalCpu := int64(freeAmount(nodeResource.Cpu.Total))
+	var allocatedCpu int64
+	for jobUuid, nanoCpus := range jobNanoCpus {
+		// a job holds its part of a cpu as a whole one, the same count is released when it expires
+		cpus := (nanoCpus + 1e9 - 1) / 1e9
+		allocatedCpu += cpus
+		if release, ok := releases[jobUuid]; ok {
+			release.Resource.Cpu = cpus
+		}
+	}
+	capacity.Cpu = max(totalCpu-allocatedCpu, 0)
+
+	return buildCapacityForecast(from, hours, []models.NodeCapacity{capacity}, releases, currentReserve()), nil
+}
+
+// containerNanoCpus returns the cpus a container is limited to in nano cpus, the quota is the cpu time of each period
+func containerNanoCpus(resources container.Resources) int64 {
+	if resources.CPUQuota > 0 {
+		period := resources.CPUPeriod
+		if period <= 0 {
+			period = ecpCpuPeriod
+		}
+		return resources.CPUQuota * 1e9 / period
+	}
+	return resources.NanoCPUs
+}
+
+// forecastEnd returns the time of the last slot of the forecast
+func forecastEnd(from int64, hours int) int64 {
+	return from - from%3600 + int64(hours)*3600
+}
+
+// buildCapacityForecast adds the releases to the free resources of the nodes slot by slot, and keeps the reserve
+// of the resource policy on every node. The releases of the jobs already expired but not yet cleaned up are
+// counted from the first hour, since the cleanup runs periodically.
+func buildCapacityForecast(from int64, hours int, free []models.NodeCapacity, releases map[string]*models.CapacityRelease, reserve reservedResource) models.CapacityForecast {
+	forecast := models.CapacityForecast{
+		From:  from,
+		Hours: hours,
+	}
+	for _, release := range releases {
+		forecast.Releases = append(forecast.Releases, *release)
+	}
+	sort.SliceStable(forecast.Releases, func(i, j int) bool {
+		if forecast.Releases[i].ExpireTime != forecast.Releases[j].ExpireTime {
+			return forecast.Releases[i].ExpireTime < forecast.Releases[j].ExpireTime
+		}
+		return forecast.Releases[i].JobUuid < forecast.Releases[j].JobUuid
+	})
+
+	start := from - from%3600
+	for i := 0; i <= hours; i++ {
+		slotTime := from
+		if i > 0 {
+			slotTime = start + int64(i)*3600
+		}
+
+		nodes := make([]models.NodeCapacity, len(free))
+		index := make(map[string]int)
+		for n, capacity := range free {
+			nodes[n] = capacity
+			nodes[n].Gpu = make(map[string]int64)
+			for name, count := range capacity.Gpu {
+				nodes[n].Gpu[name] = count
+			}
+			index[capacity.NodeName] = n
+		}
+		if i > 0 {
+			for _, release := range forecast.Releases {
+				n, ok := index[release.Resource.NodeName]
+				if !ok || release.ExpireTime > slotTime {
+					continue
+				}
+				nodes[n].Cpu += release.Resource.Cpu
+				nodes[n].MemoryGiB += release.Resource.MemoryGiB
+				nodes[n].StorageGiB += release.Resource.StorageGiB
+				for name, count := range release.Resource.Gpu {
+					nodes[n].Gpu[name] += count
+				}
+			}
+		}
+
+		slot := models.CapacitySlot{Time: slotTime}
+		for _, node := range nodes {
+			sellable := models.NodeCapacity{
+				NodeName:   node.NodeName,
+				Cpu:        max(node.Cpu-reserve.cpu, 0),
+				MemoryGiB:  max(node.MemoryGiB-reserve.memoryGiB, 0),
+				StorageGiB: max(node.StorageGiB-reserve.storageGiB, 0),
+			}
+			slot.Total.Cpu += sellable.Cpu
+			slot.Total.MemoryGiB += sellable.MemoryGiB
+			slot.Total.StorageGiB += sellable.StorageGiB
+			for name, count := range node.Gpu {
+				if sellable.Gpu == nil {
+					sellable.Gpu = make(map[string]int64)
+				}
+				sellable.Gpu[name] = max(count-reserve.gpuQuota(name), 0)
+				if slot.Total.Gpu == nil {
+					slot.Total.Gpu = make(map[string]int64)
+				}
+				slot.Total.Gpu[name] += sellable.Gpu[name]
+			}
+			slot.Nodes = append(slot.Nodes, sellable)
+		}
+		forecast.Slots = append(forecast.Slots, slot)
+	}
+	return forecast
+}
+
+func GetCapacityForecastForK8s(c *gin.Context) {
+	capacityForecast(c, ForecastCapacityForK8s)
+}
+
+func GetCapacityForecastForDocker(c *gin.Context) {
+	capacityForecast(c, ForecastCapacityForDocker)
+}
+
+func capacityForecast(c *gin.Context, forecast func(hours int) (models.CapacityForecast, error)) {
+	hours := DefaultForecastHours
+	if hoursStr := c.Query("hours"); hoursStr != "" {
+		var err error
+		if hours, err = strconv.Atoi(hoursStr); err != nil || hours <= 0 || hours > MaxForecastHours {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, fmt.Sprintf("hours must be between 1 and %d", MaxForecastHours)))
+			return
+		}
+	}
+
+	result, err := forecast(hours)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to forecast the capacity, error: %v", err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.GeResourceError))
+		return
+	}
+	c.JSON(http.StatusOK, util.CreateSuccessResponse(result))
+}
@@ -0,0 +1,100 @@
+package computing
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/swanchain/go-computing-provider/internal/models"
+)
+
+func TestContainerNanoCpus(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources container.Resources
+		want      int64
+	}{
+		{"quota of the default period", container.Resources{CPUQuota: 200000}, 2e9},
+		{"quota of its period", container.Resources{CPUQuota: 100000, CPUPeriod: 50000}, 2e9},
+		{"part of a cpu", container.Resources{CPUQuota: 50000, CPUPeriod: 100000}, 5e8},
+		{"nano cpus", container.Resources{NanoCPUs: 1500000000}, 1.5e9},
+		{"unlimited", container.Resources{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerNanoCpus(tt.resources); got != tt.want {
+				t.Errorf("containerNanoCpus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForecastEnd(t *testing.T) {
+	if got := forecastEnd(1700001000, 24); got != 1699999200+24*3600 {
+		t.Errorf("forecastEnd() = %d, want %d", got, 1699999200+24*3600)
+	}
+}
+
+func TestBuildCapacityForecast(t *testing.T) {
+	const from = int64(1699999200 + 1800) // half past the hour
+	free := []models.NodeCapacity{
+		{NodeName: "node-1", Cpu: 4, MemoryGiB: 16, StorageGiB: 100, Gpu: map[string]int64{"NVIDIA A100": 1}},
+		{NodeName: "node-2", Cpu: 1, MemoryGiB: 2, StorageGiB: 5},
+	}
+	releases := map[string]*models.CapacityRelease{
+		"late/node-1": {JobUuid: "late", ExpireTime: from + 2*3600, Resource: models.NodeCapacity{NodeName: "node-1", Cpu: 8, MemoryGiB: 32, Gpu: map[string]int64{"NVIDIA A100": 2}}},
+		"soon/node-2": {JobUuid: "soon", ExpireTime: from + 600, Resource: models.NodeCapacity{NodeName: "node-2", Cpu: 2, MemoryGiB: 4, StorageGiB: 10}},
+		// expired but not cleaned up yet, it is counted from the first hour
+		"expired/node-2": {JobUuid: "expired", ExpireTime: from - 60, Resource: models.NodeCapacity{NodeName: "node-2", Cpu: 1}},
+		// the node is no longer schedulable, so its release is left out
+		"gone/node-3": {JobUuid: "gone", ExpireTime: from + 600, Resource: models.NodeCapacity{NodeName: "node-3", Cpu: 16}},
+	}
+	reserve := reservedResource{cpu: 1, memoryGiB: 2, storageGiB: 10, gpu: []models.GpuQuota{{Name: "A100", Quota: 1}}}
+
+	forecast := buildCapacityForecast(from, 3, free, releases, reserve)
+	var order []string
+	for _, release := range forecast.Releases {
+		order = append(order, release.JobUuid)
+	}
+	if got := fmt.Sprint(order); got != "[expired gone soon late]" {
+		t.Errorf("releases = %s, want them by the expire time", got)
+	}
+	if len(forecast.Slots) != 4 {
+		t.Fatalf("got %d slots, want 4", len(forecast.Slots))
+	}
+
+	tests := []struct {
+		time    int64
+		cpu     int64
+		memory  float64
+		storage float64
+		gpu     int64
+	}{
+		// now: node-1 sells 3 cpus, node-2 keeps everything in reserve
+		{from, 3, 14, 90, 0},
+		// the expired and the soon jobs give node-2 back 3 cpus, 4 GiB and 10 GiB
+		{1699999200 + 3600, 6, 18, 95, 0},
+		{1699999200 + 2*3600, 6, 18, 95, 0},
+		// the late job gives node-1 back 8 cpus, 32 GiB and 2 gpus
+		{1699999200 + 3*3600, 14, 50, 95, 2},
+	}
+	for i, tt := range tests {
+		slot := forecast.Slots[i]
+		if slot.Time != tt.time {
+			t.Errorf("slot %d time = %d, want %d", i, slot.Time, tt.time)
+		}
+		total := slot.Total
+		if total.Cpu != tt.cpu || math.Abs(total.MemoryGiB-tt.memory) > 1e-9 || math.Abs(total.StorageGiB-tt.storage) > 1e-9 || total.Gpu["NVIDIA A100"] != tt.gpu {
+			t.Errorf("slot %d total = %+v, want cpu %d memory %v storage %v gpu %d", i, total, tt.cpu, tt.memory, tt.storage, tt.gpu)
+		}
+		if len(slot.Nodes) != 2 {
+			t.Errorf("slot %d has %d nodes, want 2", i, len(slot.Nodes))
+		}
+	}
+
+	// the slots do not share the gpus of the free resources
+	if free[0].Gpu["NVIDIA A100"] != 1 {
+		t.Errorf("the free gpus were changed to %d", free[0].Gpu["NVIDIA A100"])
+	}
+}
@@ -0,0 +1,312 @@
+package computing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/internal/yaml"
+	"github.com/swanchain/go-computing-provider/util"
+)
+
+// The kinds of the work which is checkpointed, an interrupted work is resumed at most maxCheckpointAttempts times
+const (
+	checkpointSpaceDeploy = "space_deploy"
+	checkpointEcpDeploy   = "ecp_deploy"
+	checkpointUbiProof    = "ubi_proof"
+
+	maxCheckpointAttempts = 3
+)
+
+// The stages of the work, a proof interrupted while it is submitted is not submitted again, since its transaction
+// may have been sent already
+const (
+	stageReceived   = "received"
+	stageBuilding   = "building"
+	stageDeploying  = "deploying"
+	stageSubmitting = "submitting"
+)
+
+// errInterrupted is returned by the work which stops at a stage since the daemon is shutting down
+var errInterrupted = errors.New("interrupted by the shutdown")
+
+// spaceDeployPayload is the arguments of DeploySpaceTask
+type spaceDeployPayload struct {
+	JobData        models.JobData
+	DeployParam    DeployParam
+	HostName       string
+	GpuProductName string
+	Nodes          []string
+	Pools          []string
+	Cluster        string
+	NodePort       int32
+	JobType        int
+	IpWhiteList    []string
+}
+
+// ecpDeployPayload is the arguments of deployEcpJob, the images are already pinned by the image policy
+type ecpDeployPayload struct {
+	Job     models.EcpJobCreateReq
+	Compose *yaml.ContainerResource
+}
+
+// checkpoint is the progress of a work in the database, a failure to record it is only logged since the work goes on
+type checkpoint struct {
+	kind    string
+	workKey string
+}
+
+// openCheckpoint unseals the payload of the checkpoint into v
+func openCheckpoint(entity models.CheckpointEntity, v interface{}) error {
+	payloadBytes, err := util.Unseal(entity.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to unseal the payload, error: %v", err)
+	}
+	return json.Unmarshal(payloadBytes, v)
+}
+
+// saveCheckpoint records the arguments of a work as it starts, the attempts of a resumed work are kept
+func saveCheckpoint(kind, workKey string, payload interface{}) *checkpoint {
+	cp := &checkpoint{kind: kind, workKey: workKey}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to marshal the checkpoint of %s %s, error: %v", kind, workKey, err)
+		return cp
+	}
+	// the payload holds the env and the secrets of the job, it is sealed like the secret store
+	sealedPayload, err := util.Seal(payloadBytes)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to seal the checkpoint of %s %s, error: %v", kind, workKey, err)
+		return cp
+	}
+
+	checkpointService := NewCheckpointService()
+	entity, err := checkpointService.GetCheckpoint(kind, workKey)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to get the checkpoint of %s %s, error: %v", kind, workKey, err)
+		return cp
+	}
+	now := time.Now().Unix()
+	if entity.Id == 0 {
+		entity.Kind = kind
+		entity.WorkKey = workKey
+		entity.CreateTime = now
+	}
+	entity.Stage = stageReceived
+	entity.Payload = sealedPayload
+	entity.UpdateTime = now
+	if err = checkpointService.SaveCheckpoint(entity); err != nil {
+		logs.GetLogger().Errorf("failed to save the checkpoint of %s %s, error: %v", kind, workKey, err)
+	}
+	return cp
+}
+
+// saveSpaceDeployCheckpoint records the arguments of DeploySpaceTask as the job is received
+func saveSpaceDeployCheckpoint(jobData models.JobData, deployParam DeployParam, hostName string, placement spacePlacement, nodePort int32) *checkpoint {
+	return saveCheckpoint(checkpointSpaceDeploy, jobData.UUID, spaceDeployPayload{
+		JobData:        jobData,
+		DeployParam:    deployParam,
+		HostName:       hostName,
+		GpuProductName: placement.gpuProductName,
+		Nodes:          placement.nodes,
+		Pools:          placement.pools,
+		Cluster:        placement.cluster,
+		NodePort:       nodePort,
+		JobType:        jobData.JobType,
+		IpWhiteList:    jobData.IpWhiteList,
+	})
+}
+
+// advance records the stage the work goes on with. It returns false when the daemon is shutting down, then the work
+// stops and is resumed from the checkpoint on the next start.
+func (cp *checkpoint) advance(stage string) bool {
+	if shuttingDown() {
+		logs.GetLogger().Warnf("%s %s is interrupted by the shutdown before %s, it is resumed on the next start", cp.kind, cp.workKey, stage)
+		return false
+	}
+	if err := NewCheckpointService().UpdateCheckpointStage(cp.kind, cp.workKey, stage); err != nil {
+		logs.GetLogger().Errorf("failed to update the checkpoint of %s %s, error: %v", cp.kind, cp.workKey, err)
+	}
+	return true
+}
+
+// done removes the checkpoint of a work which finished, successfully or not
+func (cp *checkpoint) done() {
+	if err := NewCheckpointService().DeleteCheckpoint(cp.kind, cp.workKey); err != nil {
+		logs.GetLogger().Errorf("failed to delete the checkpoint of %s %s, error: %v", cp.kind, cp.workKey, err)
+	}
+}
+
+// ResumeCheckpoints resumes in the background the deployments and the proof submissions interrupted by the last shutdown
+func ResumeCheckpoints() {
+	checkpointService := NewCheckpointService()
+	checkpoints, err := checkpointService.GetCheckpoints()
+	if err != nil {
+		logs.GetLogger().Errorf("failed to get the checkpoints, error: %v", err)
+		return
+	}
+
+	for _, entity := range checkpoints {
+		entity := entity
+		if entity.Attempts >= maxCheckpointAttempts {
+			logs.GetLogger().Errorf("give up resuming %s %s after %d attempts, stage: %s", entity.Kind, entity.WorkKey, entity.Attempts, entity.Stage)
+			if err = checkpointService.DeleteCheckpoint(entity.Kind, entity.WorkKey); err != nil {
+				logs.GetLogger().Errorf("failed to delete the checkpoint of %s %s, error: %v", entity.Kind, entity.WorkKey, err)
+			}
+			continue
+		}
+		entity.Attempts++
+		entity.UpdateTime = time.Now().Unix()
+		if err = checkpointService.SaveCheckpoint(&entity); err != nil {
+			logs.GetLogger().Errorf("failed to save the checkpoint of %s %s, error: %v", entity.Kind, entity.WorkKey, err)
+			continue
+		}
+
+		logs.GetLogger().Infof("resuming %s %s interrupted at stage %s, attempt: %d", entity.Kind, entity.WorkKey, entity.Stage, entity.Attempts)
+		runInBackground(func() {
+			defer func() {
+				if err := recover(); err != nil {
+					logs.GetLogger().Errorf("resume %s %s catch panic error: %v", entity.Kind, entity.WorkKey, err)
+				}
+			}()
+
+			var err error
+			switch entity.Kind {
+			case checkpointSpaceDeploy:
+				err = resumeSpaceDeploy(entity)
+			case checkpointEcpDeploy:
+				err = resumeEcpDeploy(entity)
+			case checkpointUbiProof:
+				err = resumeUbiProof(entity)
+			default:
+				err = fmt.Errorf("unknown kind")
+			}
+			if err != nil {
+				logs.GetLogger().Errorf("failed to resume %s %s, error: %v", entity.Kind, entity.WorkKey, err)
+				(&checkpoint{kind: entity.Kind, workKey: entity.WorkKey}).done()
+			}
+		})
+	}
+}
+
+func resumeSpaceDeploy(entity models.CheckpointEntity) error {
+	var payload spaceDeployPayload
+	if err := openCheckpoint(entity, &payload); err != nil {
+		return err
+	}
+	placement := spacePlacement{
+		gpuProductName: payload.GpuProductName,
+		nodes:          payload.Nodes,
+		pools:          payload.Pools,
+		cluster:        payload.Cluster,
+	}
+	job, err := NewJobService().GetJobEntityByJobUuid(payload.JobData.UUID)
+	if err != nil {
+		return err
+	}
+	if job.DeleteAt != 0 {
+		return fmt.Errorf("the job is already deleted")
+	}
+	if job.JobUuid == "" {
+		// the daemon stopped before the job was saved, it is saved now as it was received
+		spaceDetail, err := getSpaceDetail(payload.JobData.JobSourceURI)
+		if err != nil {
+			return err
+		}
+		spaceType := constants.SPACE_TYPE_PUBLIC
+		if payload.NodePort > 0 {
+			spaceType = constants.SPACE_TYPE_PRIVATE
+		}
+		if err = NewJobService().SaveJobEntity(newSpaceJobEntity(payload.JobData, spaceDetail, placement, spaceType, waitChainBlockNumber())); err != nil {
+			return err
+		}
+	}
+
+	// the k8s objects created before the interruption are deleted, then the job is deployed again,
+	// the images built or pulled for it are kept
+	if entity.Stage == stageDeploying {
+		if err = deleteJobResources(job.NameSpace, job.JobUuid, "resume the interrupted deployment", false); err != nil {
+			return fmt.Errorf("failed to delete the resources of the interrupted deployment, error: %v", err)
+		}
+	}
+
+	saveGpuCache(placement.gpuProductName)
+	cp := saveSpaceDeployCheckpoint(payload.JobData, payload.DeployParam, payload.HostName, placement, payload.NodePort)
+	DeploySpaceTask(cp, payload.JobData, payload.DeployParam, payload.HostName, placement, payload.NodePort, payload.JobType, payload.IpWhiteList)
+	return nil
+}
+
+func resumeEcpDeploy(entity models.CheckpointEntity) error {
+	var payload ecpDeployPayload
+	if err := openCheckpoint(entity, &payload); err != nil {
+		return err
+	}
+	job := payload.Job
+
+	// the entity of a single container is saved once the container runs, so the deployment has finished
+	ecpJobs, err := NewEcpJobService().GetEcpJobs(job.UUID)
+	if err != nil {
+		return err
+	}
+	if payload.Compose == nil && len(ecpJobs) > 0 {
+		(&checkpoint{kind: entity.Kind, workKey: entity.WorkKey}).done()
+		return nil
+	}
+
+	// the containers created before the interruption are removed, then the job is deployed again
+	if err = NewDockerService().RemoveContainersByLabel(ecpJobLabel + "=" + job.UUID); err != nil {
+		return fmt.Errorf("failed to remove the containers of the interrupted deployment, error: %v", err)
+	}
+	if payload.Compose != nil {
+		if err = removeComposeResources(job.UUID, nil); err != nil {
+			return err
+		}
+	}
+	if len(ecpJobs) > 0 {
+		if err = NewEcpJobService().DeleteContainerByUuid(job.UUID); err != nil {
+			return err
+		}
+	}
+
+	isReceive, _, needCpu, _, indexs, err := checkResourceForImage(job.Resource)
+	if err != nil {
+		return fmt.Errorf("failed to check the resources, error: %v", err)
+	}
+	if !isReceive {
+		return fmt.Errorf("no resources available for the job any more")
+	}
+	var env []string
+	for k, v := range job.Envs {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	deployEcpJob(job, payload.Compose, env, needCpu, indexs)
+	return nil
+}
+
+func resumeUbiProof(entity models.CheckpointEntity) error {
+	if entity.Stage == stageSubmitting {
+		return fmt.Errorf("the proof was being submitted, it is not submitted again to avoid a duplicate transaction")
+	}
+	var c2Proof models.UbiC2Proof
+	if err := openCheckpoint(entity, &c2Proof); err != nil {
+		return err
+	}
+	taskId, err := strconv.Atoi(c2Proof.TaskId)
+	if err != nil {
+		return err
+	}
+	task, err := NewTaskService().GetTaskEntity(int64(taskId))
+	if err != nil {
+		return err
+	}
+	if task.Status != models.TASK_RECEIVED_STATUS && task.Status != models.TASK_RUNNING_STATUS {
+		return fmt.Errorf("the task is already %s", models.TaskStatusStr(task.Status))
+	}
+	submitUBIProof(c2Proof, task)
+	return nil
+}
@@ -0,0 +1,74 @@
+package computing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	mcslogs "github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/rifflock/lfshook"
+	"github.com/sirupsen/logrus"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/db"
+)
+
+// initTestConfig loads a standalone config with the given sections appended to the required fields
+func initTestConfig(t *testing.T, sections string) {
+	t.Helper()
+	initTestLogger(t)
+	dir := t.TempDir()
+	content := `
+[API]
+MultiAddress = "/ip4/127.0.0.1/tcp/9085"
+NodeName = "test"
+
+[UBI]
+UbiEnginePk = ""
+EnableSequencer = false
+AutoChainProof = false
+SequencerUrl = ""
+
+[RPC]
+SWAN_CHAIN_RPC = ""
+` + sections
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.InitConfig(dir, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// initTestDb opens an empty database of the cp under a temp dir, the services of the package use it until the test ends
+func initTestDb(t *testing.T) {
+	t.Helper()
+	initTestLogger(t)
+	dir := t.TempDir()
+	t.Setenv("CP_PATH", dir)
+	db.InitDb(dir)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// initTestLogger writes the log files of both loggers under a temp dir instead of ./logs of the package until the test ends
+func initTestLogger(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, logger := range []*logrus.Logger{logs.GetLogger(), mcslogs.GetLogger()} {
+		hooks := logger.ReplaceHooks(make(logrus.LevelHooks))
+		logger.AddHook(lfshook.NewHook(lfshook.PathMap{
+			logrus.InfoLevel:  filepath.Join(dir, "info.log"),
+			logrus.WarnLevel:  filepath.Join(dir, "warn.log"),
+			logrus.ErrorLevel: filepath.Join(dir, "error.log"),
+			logrus.FatalLevel: filepath.Join(dir, "error.log"),
+			logrus.PanicLevel: filepath.Join(dir, "error.log"),
+		}, logger.Formatter))
+		t.Cleanup(func() {
+			logger.ReplaceHooks(hooks)
+		})
+	}
+}
@@ -2,7 +2,6 @@ package computing
 
 import (
 	"context"
-	"fmt"
 	"github.com/swanchain/go-computing-provider/internal/contract"
 	"strconv"
 	"strings"
@@ -44,8 +43,13 @@ func (task *CronTask) RunTask() {
 	task.getUbiTaskReward()
 	task.checkJobReward()
 	task.cleanImageResource()
+	startNonceCleaner()
+	task.meterJobUsage()
+	task.refreshWildcardSecrets()
 }
 
+// CheckClusterNetworkPolicy checks the calico policies of the default cluster only, the spaces placed in the other
+// clusters are not isolated by them
 func CheckClusterNetworkPolicy() {
 	var err error
 	NetworkPolicyFlag = false
@@ -118,9 +122,11 @@ func CheckClusterNetworkPolicy() {
 }
 
 func checkJobStatus() {
-	go func() {
+	runInBackground(func() {
 		for {
 			select {
+			case <-background.ctx.Done():
+				return
 			case job := <-deployingChan:
 				TaskMap.Store(job.Uuid, &job)
 			case <-time.After(3 * time.Second):
@@ -134,10 +140,11 @@ func checkJobStatus() {
 				})
 			}
 		}
-	}()
+	})
 }
 
 func (task *CronTask) addLabelToNode() {
+	runInBackground(addNodeLabel)
 	c := cron.New(cron.WithSeconds())
 	c.AddFunc("0 */10 * * * ?", func() {
 		defer func() {
@@ -147,7 +154,7 @@ func (task *CronTask) addLabelToNode() {
 		}()
 		addNodeLabel()
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) reportClusterResource() {
@@ -159,15 +166,14 @@ func (task *CronTask) reportClusterResource() {
 			}
 		}()
 
-		k8sService := NewK8sService()
-		statisticalSources, err := k8sService.StatisticalSources(context.TODO())
+		statisticalSources, err := StatisticalSourcesOfClusters(context.TODO())
 		if err != nil {
 			logs.GetLogger().Errorf("failed to collect k8s statistical sources, error: %+v", err)
 			return
 		}
 		checkClusterProviderStatus(statisticalSources)
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) watchNameSpaceForDeleted() {
@@ -178,45 +184,84 @@ func (task *CronTask) watchNameSpaceForDeleted() {
 				logs.GetLogger().Errorf("watchNameSpaceForDeleted catch panic error: %+v", err)
 			}
 		}()
-		service := NewK8sService()
-		namespaces, err := service.ListNamespace(context.TODO())
-		if err != nil {
-			logs.GetLogger().Errorf("Failed get all namespace, error: %+v", err)
-			return
-		}
-
-		for _, namespace := range namespaces {
-			getPods, err := service.GetPods(namespace, "")
+		for _, service := range K8sServices() {
+			if service.k8sClient == nil {
+				continue
+			}
+			namespaces, err := service.ListNamespace(context.TODO())
 			if err != nil {
-				logs.GetLogger().Errorf("Failed get pods form namespace,namepace: %s, error: %+v", namespace, err)
+				logs.GetLogger().Errorf("Failed get all namespace, cluster: %s, error: %+v", service.Cluster, err)
 				continue
 			}
-			if !getPods && (strings.HasPrefix(namespace, constants.K8S_NAMESPACE_NAME_PREFIX) || strings.HasPrefix(namespace, "ubi-task")) {
-				if err = service.DeleteNameSpace(context.TODO(), namespace); err != nil {
-					logs.GetLogger().Errorf("Failed delete namespace, namepace: %s, error: %+v", namespace, err)
+
+			for _, namespace := range namespaces {
+				getPods, err := service.GetPods(namespace, "")
+				if err != nil {
+					logs.GetLogger().Errorf("Failed get pods form namespace,namepace: %s, error: %+v", namespace, err)
+					continue
+				}
+				// the namespace is kept until the retained pvc of deleted jobs are cleaned
+				var pvcRetained bool
+				if strings.HasPrefix(namespace, constants.K8S_NAMESPACE_NAME_PREFIX) {
+					pvcRetained = cleanReleasedPvc(service, namespace)
+				}
+				if !getPods && !pvcRetained && (strings.HasPrefix(namespace, constants.K8S_NAMESPACE_NAME_PREFIX) || strings.HasPrefix(namespace, "ubi-task")) {
+					if err = service.DeleteNameSpace(context.TODO(), namespace); err != nil {
+						logs.GetLogger().Errorf("Failed delete namespace, namepace: %s, error: %+v", namespace, err)
+					}
 				}
 			}
 		}
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) cleanImageResource() {
+	runInBackground(NewImageCacheManager().PrePullOnNodes)
+
 	c := cron.New(cron.WithSeconds())
-	c.AddFunc("* 0/30 * * * ?", func() {
+	c.AddFunc("0 0/30 * * * ?", func() {
 		defer func() {
 			if err := recover(); err != nil {
 				logs.GetLogger().Errorf("cleanImageResource catch panic error: %+v", err)
 			}
 		}()
 		NewDockerService().CleanResourceForK8s()
+		NewImageCacheManager().PrePullOnNodes()
+	})
+	startCron(c)
+}
+
+func (task *CronTask) meterJobUsage() {
+	c := cron.New(cron.WithSeconds())
+	c.AddFunc("0 * * * * ?", func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logs.GetLogger().Errorf("meterJobUsage catch panic error: %+v", err)
+			}
+		}()
+		meterSpaceUsage()
+	})
+	c.AddFunc("0 0 * * * ?", deleteExpiredUsage)
+	startCron(c)
+}
+
+func (task *CronTask) refreshWildcardSecrets() {
+	c := cron.New(cron.WithSeconds())
+	c.AddFunc("0 0 * * * ?", func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logs.GetLogger().Errorf("refreshWildcardSecrets catch panic error: %+v", err)
+			}
+		}()
+		refreshWildcardSecrets()
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) watchExpiredTask() {
 	c := cron.New(cron.WithSeconds())
-	c.AddFunc("* 0/10 * * * ?", func() {
+	c.AddFunc("0 0/10 * * * ?", func() {
 		defer func() {
 			if err := recover(); err != nil {
 				logs.GetLogger().Errorf("watchExpiredTask catch panic error: %+v", err)
@@ -229,16 +274,22 @@ func (task *CronTask) watchExpiredTask() {
 			return
 		}
 
-		deployments, err := NewK8sService().k8sClient.AppsV1().Deployments(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
-			fmt.Println("Error listing deployments:", err)
-			return
-		}
-
 		var deployOnK8s = make(map[string]string)
-		for _, deploy := range deployments.Items {
-			if strings.HasPrefix(deploy.Namespace, constants.K8S_NAMESPACE_NAME_PREFIX) {
-				deployOnK8s[deploy.Name] = deploy.Namespace
+		for _, service := range K8sServices() {
+			// the jobs of a cluster which is not reachable must not be taken as missing
+			if service.k8sClient == nil {
+				logs.GetLogger().Errorf("cluster %q is not connected", service.Cluster)
+				return
+			}
+			deployments, err := service.k8sClient.AppsV1().Deployments(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				logs.GetLogger().Errorf("failed to list the deployments of cluster %q, error: %v", service.Cluster, err)
+				return
+			}
+			for _, deploy := range deployments.Items {
+				if strings.HasPrefix(deploy.Namespace, constants.K8S_NAMESPACE_NAME_PREFIX) {
+					deployOnK8s[deploy.Name] = deploy.Namespace
+				}
 			}
 		}
 
@@ -263,7 +314,7 @@ func (task *CronTask) watchExpiredTask() {
 				if _, ok = deployOnK8s[spaceUuidDeployName]; ok {
 					if NewJobService().GetJobEntityBySpaceUuid(job.SpaceUuid) > 0 && time.Now().Unix() < job.ExpireTime {
 						if job.Status != models.JOB_RUNNING_STATUS {
-							foundDeployment, err := NewK8sService().k8sClient.AppsV1().Deployments(job.NameSpace).Get(context.TODO(), job.K8sDeployName, metav1.GetOptions{})
+							foundDeployment, err := NewK8sServiceFor(job.Cluster).k8sClient.AppsV1().Deployments(job.NameSpace).Get(context.TODO(), job.K8sDeployName, metav1.GetOptions{})
 							if err != nil {
 								continue
 							}
@@ -299,7 +350,7 @@ func (task *CronTask) watchExpiredTask() {
 			createDuration := currentTime.Sub(createdTime)
 
 			if job.NameSpace != "" && job.K8sDeployName != "" {
-				foundDeployment, err := NewK8sService().k8sClient.AppsV1().Deployments(job.NameSpace).Get(context.TODO(), job.K8sDeployName, metav1.GetOptions{})
+				foundDeployment, err := NewK8sServiceFor(job.Cluster).k8sClient.AppsV1().Deployments(job.NameSpace).Get(context.TODO(), job.K8sDeployName, metav1.GetOptions{})
 				if err != nil {
 					if createDuration.Hours() <= 2 && job.Status != models.JOB_RUNNING_STATUS {
 						continue
@@ -324,6 +375,7 @@ func (task *CronTask) watchExpiredTask() {
 						job.Status = models.JOB_RUNNING_STATUS
 						NewJobService().UpdateJobEntityByJobUuid(job)
 					}
+					refreshJobNodeName(job.NameSpace, job.JobUuid, job.NodeName)
 				}
 			}
 
@@ -352,12 +404,12 @@ func (task *CronTask) watchExpiredTask() {
 			}
 		}
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) checkCollateralBalance() {
 	c := cron.New(cron.WithSeconds())
-	c.AddFunc("0 0/10 * * * * ?", func() {
+	c.AddFunc("0 0/10 * * * ?", func() {
 		defer func() {
 			if err := recover(); err != nil {
 				logs.GetLogger().Errorf("task job: [checkCollateralBalance], error: %+v", err)
@@ -380,55 +432,61 @@ func (task *CronTask) checkCollateralBalance() {
 			logs.GetLogger().Warnf("No sufficient collateral Balance, the current collateral balance is: %0.3f. Please run: computing-provider collateral [fromWalletAddress] [amount]", floatResult)
 		}
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) cleanAbnormalDeployment() {
 	c := cron.New(cron.WithSeconds())
-	c.AddFunc("* 0/30 * * * ?", func() {
+	c.AddFunc("0 0/30 * * * ?", func() {
 		defer func() {
 			if err := recover(); err != nil {
 				logs.GetLogger().Errorf("task job: [cleanAbnormalDeployment], error: %+v", err)
 			}
 		}()
 
-		k8sService := NewK8sService()
-		namespaces, err := k8sService.ListNamespace(context.TODO())
-		if err != nil {
-			logs.GetLogger().Errorf("Failed get all namespace, error: %+v", err)
-			return
-		}
+		for _, k8sService := range K8sServices() {
+			if k8sService.k8sClient == nil {
+				continue
+			}
+			namespaces, err := k8sService.ListNamespace(context.TODO())
+			if err != nil {
+				logs.GetLogger().Errorf("Failed get all namespace, cluster: %s, error: %+v", k8sService.Cluster, err)
+				continue
+			}
 
-		for _, namespace := range namespaces {
-			if strings.HasPrefix(namespace, constants.K8S_NAMESPACE_NAME_PREFIX) {
-				deployments, err := k8sService.k8sClient.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
-				if err != nil {
-					logs.GetLogger().Errorf("Error getting deployments in namespace %s: %v\n", namespace, err)
-					continue
-				}
+			for _, namespace := range namespaces {
+				if strings.HasPrefix(namespace, constants.K8S_NAMESPACE_NAME_PREFIX) {
+					deployments, err := k8sService.k8sClient.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+					if err != nil {
+						logs.GetLogger().Errorf("Error getting deployments in namespace %s: %v\n", namespace, err)
+						continue
+					}
 
-				for _, deployment := range deployments.Items {
-					creationTimestamp := deployment.ObjectMeta.CreationTimestamp.Time
-					currentTime := time.Now()
-					age := currentTime.Sub(creationTimestamp)
-					if deployment.Status.AvailableReplicas == 0 && age.Hours() >= 2 {
-						logs.GetLogger().Infof("Cleaning up deployment %s in namespace %s", deployment.Name, namespace)
-						err := k8sService.k8sClient.AppsV1().Deployments(namespace).Delete(context.TODO(), deployment.Name, metav1.DeleteOptions{})
-						if err != nil {
-							if errors.IsNotFound(err) {
-								logs.GetLogger().Errorf("Deployment %s not found. Ignoring", deployment.Name)
+					for _, deployment := range deployments.Items {
+						creationTimestamp := deployment.ObjectMeta.CreationTimestamp.Time
+						currentTime := time.Now()
+						age := currentTime.Sub(creationTimestamp)
+						if deployment.Status.AvailableReplicas == 0 && age.Hours() >= 2 {
+							logs.GetLogger().Infof("Cleaning up deployment %s in namespace %s", deployment.Name, namespace)
+							err := k8sService.k8sClient.AppsV1().Deployments(namespace).Delete(context.TODO(), deployment.Name, metav1.DeleteOptions{})
+							RecordAudit(AuditActorSystem, "clean abnormal deployment", map[string]interface{}{"namespace": namespace, "deployment": deployment.Name,
+								"age": age.String()}, "", err)
+							if err != nil {
+								if errors.IsNotFound(err) {
+									logs.GetLogger().Errorf("Deployment %s not found. Ignoring", deployment.Name)
+								} else {
+									logs.GetLogger().Errorf("Error deleting deployment %s: %v", deployment.Name, err)
+								}
 							} else {
-								logs.GetLogger().Errorf("Error deleting deployment %s: %v", deployment.Name, err)
+								logs.GetLogger().Errorf("abnormal Deployment %s deleted successfully.", deployment.Name)
 							}
-						} else {
-							logs.GetLogger().Errorf("abnormal Deployment %s deleted successfully.", deployment.Name)
 						}
 					}
 				}
 			}
 		}
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) setFailedUbiTaskStatus() {
@@ -467,12 +525,12 @@ func (task *CronTask) setFailedUbiTaskStatus() {
 			NewTaskService().SaveTaskEntity(&ubiTask)
 		}
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) checkJobReward() {
 	c := cron.New(cron.WithSeconds())
-	c.AddFunc("* * 0/20 * * ?", func() {
+	c.AddFunc("0 0/20 * * * ?", func() {
 		defer func() {
 			if err := recover(); err != nil {
 				logs.GetLogger().Errorf("task job: [checkJobReward], error: %+v", err)
@@ -494,7 +552,7 @@ func (task *CronTask) checkJobReward() {
 		close(taskQueue)
 		wg.Wait()
 	})
-	c.Start()
+	startCron(c)
 }
 
 func (task *CronTask) getUbiTaskReward() {
@@ -509,18 +567,29 @@ func (task *CronTask) getUbiTaskReward() {
 			logs.GetLogger().Errorf("failed to sync task from sequencer, error: %v", err)
 		}
 	})
-	c.Start()
+	startCron(c)
 }
 
 func addNodeLabel() {
-	k8sService := NewK8sService()
+	for _, k8sService := range K8sServices() {
+		if k8sService.k8sClient == nil {
+			logs.GetLogger().Errorf("cluster %q is not connected", k8sService.Cluster)
+			continue
+		}
+		addClusterNodeLabel(k8sService)
+	}
+}
+
+func addClusterNodeLabel(k8sService *K8sService) {
 	nodes, err := k8sService.k8sClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		logs.GetLogger().Error(err)
+		logs.GetLogger().Errorf("failed to list the nodes, cluster: %s, error: %v", k8sService.Cluster, err)
 		return
 	}
 
-	nodeGpuInfoMap, err := k8sService.GetResourceExporterPodLog(context.TODO())
+	labelNodePools(k8sService, nodes.Items)
+
+	nodeGpuInfoMap, err := k8sService.GetNodeInfos(context.TODO())
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return
@@ -11,6 +11,7 @@ import (
 	"github.com/swanchain/go-computing-provider/internal/yaml"
 	"github.com/swanchain/go-computing-provider/util"
 	appV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
 	coreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -42,6 +43,7 @@ type Deploy struct {
 	hardwareDesc      string
 	taskUuid          string
 	gpuProductName    string
+	placement         spacePlacement
 
 	// ===
 	spaceType   string
@@ -49,6 +51,9 @@ type Deploy struct {
 	nodePortUrl string
 	userName    string
 	ipWhiteList []string
+
+	k8sResourceType string
+	replicas        int
 }
 
 func NewDeploy(originalJobUuid, lowerJobUuid, hostName, walletAddress, hardwareDesc string, duration int64, spaceType string, spaceHardware models.SpaceHardware, jobType int) *Deploy {
@@ -112,6 +117,22 @@ func (d *Deploy) WithGpuProductName(gpuProductName string) *Deploy {
 	return d
 }
 
+func (d *Deploy) WithPlacement(placement spacePlacement) *Deploy {
+	d.placement = placement
+	d.gpuProductName = placement.gpuProductName
+	return d
+}
+
+// k8sService returns the service of the cluster the job is placed in
+func (d *Deploy) k8sService() *K8sService {
+	return NewK8sServiceFor(d.placement.cluster)
+}
+
+func (d *Deploy) WithReplicas(replicas int) *Deploy {
+	d.replicas = replicas
+	return d
+}
+
 func (d *Deploy) WithYamlInfo(yamlPath string) *Deploy {
 	d.yamlPath = yamlPath
 	return d
@@ -150,7 +171,13 @@ func (d *Deploy) DockerfileToK8s() {
 		return
 	}
 
-	k8sService := NewK8sService()
+	pvcMounts, pvcVolumes, err := d.createPersistentVolume()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return
+	}
+
+	k8sService := d.k8sService()
 	deployment := &appV1.Deployment{
 		TypeMeta: metaV1.TypeMeta{
 			Kind:       "Deployment",
@@ -161,6 +188,7 @@ func (d *Deploy) DockerfileToK8s() {
 			Namespace: d.k8sNameSpace,
 		},
 		Spec: appV1.DeploymentSpec{
+			Replicas: d.replicaCount(),
 			Selector: &metaV1.LabelSelector{
 				MatchLabels: map[string]string{"lad_app": d.jobUuid},
 			},
@@ -173,6 +201,8 @@ func (d *Deploy) DockerfileToK8s() {
 
 				Spec: coreV1.PodSpec{
 					NodeSelector: generateLabel(d.gpuProductName),
+					Affinity:     d.placementAffinity(len(pvcVolumes) > 0),
+					Tolerations:  d.tolerations(),
 					Containers: []coreV1.Container{{
 						Name:            constants.K8S_CONTAINER_NAME_PREFIX + d.jobUuid,
 						Image:           d.image,
@@ -180,9 +210,11 @@ func (d *Deploy) DockerfileToK8s() {
 						Ports: []coreV1.ContainerPort{{
 							ContainerPort: int32(containerPort),
 						}},
-						Env:       d.createEnv(),
-						Resources: d.createResources(),
+						Env:          d.createEnv(),
+						Resources:    d.createResources(),
+						VolumeMounts: pvcMounts,
 					}},
+					Volumes: pvcVolumes,
 				},
 			},
 		}}
@@ -210,6 +242,11 @@ func (d *Deploy) YamlToK8s(nodePort int32) error {
 		return err
 	}
 
+	if err = applyImagePolicy(containerResources); err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
 	if err = d.deployNamespace(); err != nil {
 		logs.GetLogger().Error(err)
 		return err
@@ -235,7 +272,7 @@ func (d *Deploy) YamlToK8s(nodePort int32) error {
 		return nil
 	}
 
-	k8sService := NewK8sService()
+	k8sService := d.k8sService()
 	for _, cr := range containerResources {
 		for i, envVar := range cr.Env {
 			if strings.Contains(envVar.Name, "NEXTAUTH_URL") {
@@ -274,7 +311,37 @@ func (d *Deploy) YamlToK8s(nodePort int32) error {
 			}
 		}
 
+		if cr.Count > 0 {
+			d.replicas = cr.Count
+		}
+		pvcMounts, pvcVolumes, err := d.createPersistentVolume()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		volumeMount = append(volumeMount, pvcMounts...)
+		volumeMount = append(volumeMount, cr.VolumeMountList...)
+		volumes = append(volumes, pvcVolumes...)
+		volumes = append(volumes, cr.Volumes...)
+
+		if err = d.createSecrets(cr.Secrets); err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		hardware := d.createResources()
+		if err = subtractDependResources(&hardware, cr.Depends); err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		mainResources, err := serviceResources(hardware, cr.Resources)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
 		var containers []coreV1.Container
+		var initContainers []coreV1.Container
 		for _, depend := range cr.Depends {
 			var ports []coreV1.ContainerPort
 			for _, port := range depend.Ports {
@@ -284,26 +351,39 @@ func (d *Deploy) YamlToK8s(nodePort int32) error {
 				})
 			}
 
-			var handler = new(coreV1.ExecAction)
-			handler.Command = depend.ReadyCmd
+			readinessProbe := depend.ReadinessProbe
+			if readinessProbe == nil && len(depend.ReadyCmd) > 0 {
+				var handler = new(coreV1.ExecAction)
+				handler.Command = depend.ReadyCmd
+				readinessProbe = &coreV1.Probe{
+					ProbeHandler: coreV1.ProbeHandler{
+						Exec: handler,
+					},
+					InitialDelaySeconds: 5,
+					PeriodSeconds:       5,
+				}
+			}
+
+			var dependResources coreV1.ResourceRequirements
+			if depend.Resources != nil {
+				dependResources = *depend.Resources
+			}
 			containers = append(containers, coreV1.Container{
 				Name:            d.jobUuid + "-" + depend.Name,
 				Image:           depend.ImageName,
 				Command:         depend.Command,
 				Args:            depend.Args,
-				Env:             depend.Env,
+				Env:             d.useJobSecrets(depend.Env),
 				Ports:           ports,
 				ImagePullPolicy: coreV1.PullIfNotPresent,
-				Resources:       coreV1.ResourceRequirements{},
-				ReadinessProbe: &coreV1.Probe{
-					ProbeHandler: coreV1.ProbeHandler{
-						Exec: handler,
-					},
-					InitialDelaySeconds: 5,
-					PeriodSeconds:       5,
-				},
+				Resources:       dependResources,
+				VolumeMounts:    depend.VolumeMountList,
+				LivenessProbe:   depend.LivenessProbe,
+				ReadinessProbe:  readinessProbe,
 			})
+			initContainers = append(initContainers, d.initContainers(depend.InitContainers)...)
 		}
+		initContainers = append(initContainers, d.initContainers(cr.InitContainers)...)
 
 		cr.Env = append(cr.Env, []coreV1.EnvVar{
 			{
@@ -333,43 +413,61 @@ func (d *Deploy) YamlToK8s(nodePort int32) error {
 			Image:           cr.ImageName,
 			Command:         cr.Command,
 			Args:            cr.Args,
-			Env:             cr.Env,
+			Env:             d.useJobSecrets(cr.Env),
 			Ports:           ports,
 			ImagePullPolicy: coreV1.PullIfNotPresent,
-			Resources:       d.createResources(),
+			Resources:       mainResources,
 			VolumeMounts:    volumeMount,
+			LivenessProbe:   cr.LivenessProbe,
+			ReadinessProbe:  cr.ReadinessProbe,
 		})
 
-		deployment := &appV1.Deployment{
-			TypeMeta: metaV1.TypeMeta{
-				Kind:       "Deployment",
-				APIVersion: "apps/v1",
-			},
+		podTemplate := coreV1.PodTemplateSpec{
 			ObjectMeta: metaV1.ObjectMeta{
-				Name:      constants.K8S_DEPLOY_NAME_PREFIX + d.jobUuid,
+				Labels:    map[string]string{"lad_app": d.jobUuid},
 				Namespace: d.k8sNameSpace,
 			},
+			Spec: coreV1.PodSpec{
+				NodeSelector:   generateLabel(d.gpuProductName),
+				Affinity:       d.placementAffinity(len(pvcVolumes) > 0),
+				Tolerations:    d.tolerations(),
+				InitContainers: initContainers,
+				Containers:     containers,
+				Volumes:        volumes,
+				HostAliases:    serviceHostAliases(cr.HostAliases),
+			},
+		}
+		d.image = podImages(d.jobUuid, podTemplate.Spec)
 
-			Spec: appV1.DeploymentSpec{
-				Selector: &metaV1.LabelSelector{
-					MatchLabels: map[string]string{"lad_app": d.jobUuid},
+		if cr.RestartPolicy == "" || cr.RestartPolicy == coreV1.RestartPolicyAlways {
+			deployment := &appV1.Deployment{
+				TypeMeta: metaV1.TypeMeta{
+					Kind:       "Deployment",
+					APIVersion: "apps/v1",
 				},
-				Template: coreV1.PodTemplateSpec{
-					ObjectMeta: metaV1.ObjectMeta{
-						Labels:    map[string]string{"lad_app": d.jobUuid},
-						Namespace: d.k8sNameSpace,
-					},
-					Spec: coreV1.PodSpec{
-						NodeSelector: generateLabel(d.gpuProductName),
-						Containers:   containers,
-						Volumes:      volumes,
-					},
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      constants.K8S_DEPLOY_NAME_PREFIX + d.jobUuid,
+					Namespace: d.k8sNameSpace,
 				},
-			}}
 
-		if _, err = k8sService.CreateDeployment(context.TODO(), d.k8sNameSpace, deployment); err != nil {
-			logs.GetLogger().Error(err)
-			return err
+				Spec: appV1.DeploymentSpec{
+					Replicas: d.replicaCount(),
+					Selector: &metaV1.LabelSelector{
+						MatchLabels: map[string]string{"lad_app": d.jobUuid},
+					},
+					Template: podTemplate,
+				}}
+
+			if _, err = k8sService.CreateDeployment(context.TODO(), d.k8sNameSpace, deployment); err != nil {
+				logs.GetLogger().Error(err)
+				return err
+			}
+		} else {
+			// a deployment always restarts its pod, so the services which should stop are run as a k8s job
+			if err = d.createBatchJob(podTemplate, cr.RestartPolicy); err != nil {
+				logs.GetLogger().Error(err)
+				return err
+			}
 		}
 		updateJobStatus(d.originalJobUuid, models.DEPLOY_PULL_IMAGE)
 
@@ -454,7 +552,13 @@ func (d *Deploy) ModelInferenceToK8s() error {
 		return err
 	}
 
-	k8sService := NewK8sService()
+	pvcMounts, pvcVolumes, err := d.createPersistentVolume()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	k8sService := d.k8sService()
 	deployment := &appV1.Deployment{
 		TypeMeta: metaV1.TypeMeta{
 			Kind:       "Deployment",
@@ -465,6 +569,7 @@ func (d *Deploy) ModelInferenceToK8s() error {
 			Namespace: d.k8sNameSpace,
 		},
 		Spec: appV1.DeploymentSpec{
+			Replicas: d.replicaCount(),
 			Selector: &metaV1.LabelSelector{
 				MatchLabels: map[string]string{"lad_app": d.jobUuid},
 			},
@@ -477,6 +582,8 @@ func (d *Deploy) ModelInferenceToK8s() error {
 
 				Spec: coreV1.PodSpec{
 					NodeSelector: generateLabel(d.gpuProductName),
+					Affinity:     d.placementAffinity(len(pvcVolumes) > 0),
+					Tolerations:  d.tolerations(),
 					Containers: []coreV1.Container{{
 						Name:            constants.K8S_CONTAINER_NAME_PREFIX + d.jobUuid,
 						Image:           d.image,
@@ -484,9 +591,11 @@ func (d *Deploy) ModelInferenceToK8s() error {
 						Ports: []coreV1.ContainerPort{{
 							ContainerPort: int32(80),
 						}},
-						Env: d.createEnv(modelEnvs...),
+						Env:          d.createEnv(modelEnvs...),
+						VolumeMounts: pvcMounts,
 						//Resources: d.createResources(),
 					}},
+					Volumes: pvcVolumes,
 				},
 			},
 		}}
@@ -506,7 +615,7 @@ func (d *Deploy) ModelInferenceToK8s() error {
 }
 
 func (d *Deploy) DeploySshTaskToK8s(containerResource yaml.ContainerResource, nodePort int32) error {
-	k8sService := NewK8sService()
+	k8sService := d.k8sService()
 	volumeMounts, volumes := generateVolume()
 
 	var exclude22Port []int32
@@ -542,6 +651,8 @@ func (d *Deploy) DeploySshTaskToK8s(containerResource yaml.ContainerResource, no
 				Spec: coreV1.PodSpec{
 					Hostname:     d.spaceName + "-" + generateString(4),
 					NodeSelector: generateLabel(d.gpuProductName),
+					Affinity:     &coreV1.Affinity{NodeAffinity: d.nodeAffinity()},
+					Tolerations:  d.tolerations(),
 					Containers: []coreV1.Container{
 						{
 							Name:            constants.K8S_PRIVATE_CONTAINER_PREFIX + d.jobUuid,
@@ -599,7 +710,7 @@ func (d *Deploy) DeploySshTaskToK8s(containerResource yaml.ContainerResource, no
 }
 
 func (d *Deploy) deployNamespace() error {
-	k8sService := NewK8sService()
+	k8sService := d.k8sService()
 	if _, err := k8sService.GetNameSpace(context.TODO(), d.k8sNameSpace, metaV1.GetOptions{}); err != nil {
 		if errors.IsNotFound(err) {
 			namespace := &coreV1.Namespace{
@@ -651,17 +762,17 @@ func (d *Deploy) createResources() coreV1.ResourceRequirements {
 
 	memQuantity, err := resource.ParseQuantity(fmt.Sprintf("%d%s", d.hardwareResource.Memory.Quantity, d.hardwareResource.Memory.Unit))
 	if err != nil {
-		logs.GetLogger().Error("get memory failed, error: %+v", err)
+		logs.GetLogger().Errorf("get memory failed, error: %+v", err)
 		return coreV1.ResourceRequirements{}
 	}
 
 	storageQuantity, err := resource.ParseQuantity(fmt.Sprintf("%d%s", d.hardwareResource.Storage.Quantity, d.hardwareResource.Storage.Unit))
 	if err != nil {
-		logs.GetLogger().Error("get storage failed, error: %+v", err)
+		logs.GetLogger().Errorf("get storage failed, error: %+v", err)
 		return coreV1.ResourceRequirements{}
 	}
 
-	return coreV1.ResourceRequirements{
+	resources := coreV1.ResourceRequirements{
 		Limits: coreV1.ResourceList{
 			coreV1.ResourceCPU:              *resource.NewQuantity(d.hardwareResource.Cpu.Quantity, resource.DecimalSI),
 			coreV1.ResourceMemory:           memQuantity,
@@ -675,10 +786,187 @@ func (d *Deploy) createResources() coreV1.ResourceRequirements {
 			"nvidia.com/gpu":                resource.MustParse(fmt.Sprintf("%d", d.hardwareResource.Gpu.Quantity)),
 		},
 	}
+
+	// a space of gpu slices requests the slice resource instead of whole gpus
+	if d.hardwareResource.GpuSlice != "" {
+		sliceResource := gpuSliceResource(d.hardwareResource.GpuSlice)
+		resources.Limits["nvidia.com/gpu"] = resource.MustParse("0")
+		resources.Requests["nvidia.com/gpu"] = resource.MustParse("0")
+		resources.Limits[sliceResource] = *resource.NewQuantity(d.hardwareResource.Gpu.Quantity, resource.DecimalSI)
+		resources.Requests[sliceResource] = *resource.NewQuantity(d.hardwareResource.Gpu.Quantity, resource.DecimalSI)
+	}
+	return resources
+}
+
+// serviceResources applies the resources of the yaml service to the hardware left for it,
+// the service can request less than the hardware but never more
+func serviceResources(resources coreV1.ResourceRequirements, serviceResources *coreV1.ResourceRequirements) (coreV1.ResourceRequirements, error) {
+	if serviceResources == nil {
+		return resources, nil
+	}
+
+	for _, list := range []coreV1.ResourceList{serviceResources.Requests, serviceResources.Limits} {
+		for name, quantity := range list {
+			if hardware, ok := resources.Limits[name]; ok && quantity.Cmp(hardware) > 0 {
+				return resources, &yaml.ValidationError{Errors: []string{
+					fmt.Sprintf("resources: %s %s exceeds the hardware of the space %s", name, quantity.String(), hardware.String()),
+				}}
+			}
+		}
+	}
+
+	for name, quantity := range serviceResources.Requests {
+		resources.Requests[name] = quantity
+	}
+	for name, quantity := range serviceResources.Limits {
+		resources.Limits[name] = quantity
+		if request, ok := resources.Requests[name]; ok && request.Cmp(quantity) > 0 {
+			resources.Requests[name] = quantity
+		}
+	}
+	return resources, nil
+}
+
+// subtractDependResources leaves the hardware of the space to the main service after the depends take their limits,
+// the depends run in the same pod so they are paid for by the hardware of the space as well
+func subtractDependResources(mainResources *coreV1.ResourceRequirements, depends []yaml.ContainerResource) error {
+	dependLimits := make(coreV1.ResourceList)
+	for _, depend := range depends {
+		if depend.Resources == nil {
+			continue
+		}
+		for _, name := range []coreV1.ResourceName{coreV1.ResourceCPU, coreV1.ResourceMemory, "nvidia.com/gpu"} {
+			if quantity, ok := depend.Resources.Limits[name]; ok {
+				total := dependLimits[name]
+				total.Add(quantity)
+				dependLimits[name] = total
+			}
+		}
+	}
+
+	for name, dependQuantity := range dependLimits {
+		if dependQuantity.IsZero() {
+			continue
+		}
+		// the depends may take all the gpus, but the main service must be left some cpu and memory
+		quantity, ok := mainResources.Limits[name]
+		if !ok || quantity.Cmp(dependQuantity) < 0 || (name != "nvidia.com/gpu" && quantity.Cmp(dependQuantity) == 0) {
+			return &yaml.ValidationError{Errors: []string{
+				fmt.Sprintf("resources: the services reserve %s %s, exceeds the hardware of the space %s", name, dependQuantity.String(), quantity.String()),
+			}}
+		}
+		quantity.Sub(dependQuantity)
+		mainResources.Limits[name] = quantity
+		if request, ok := mainResources.Requests[name]; ok && request.Cmp(quantity) > 0 {
+			mainResources.Requests[name] = quantity
+		}
+	}
+	return nil
+}
+
+// podImages returns the pinned images recorded for the job, the image of a single container or the image of each service
+// as name=image, e.g. the services of a compose file
+func podImages(jobUuid string, podSpec coreV1.PodSpec) string {
+	containers := append(append([]coreV1.Container{}, podSpec.InitContainers...), podSpec.Containers...)
+	if len(containers) == 1 {
+		return containers[0].Image
+	}
+	var images []string
+	for _, c := range containers {
+		images = append(images, strings.TrimPrefix(c.Name, jobUuid+"-")+"="+c.Image)
+	}
+	return strings.Join(images, ",")
+}
+
+// serviceHostAliases resolves the service names to the pod itself, the services of a compose file reach each other by name
+func serviceHostAliases(names []string) []coreV1.HostAlias {
+	if len(names) == 0 {
+		return nil
+	}
+	return []coreV1.HostAlias{{IP: "127.0.0.1", Hostnames: names}}
+}
+
+// createSecrets resolves the secrets referenced by the space from the secret store of the cp, and creates them for the job
+func (d *Deploy) createSecrets(secretRefs map[string][]string) error {
+	k8sService := d.k8sService()
+	secretService := NewSecretService()
+	for name, keys := range secretRefs {
+		data, err := secretService.GetSecret(d.walletAddress, name)
+		if err != nil {
+			return fmt.Errorf("failed to read secret, job_uuid: %s, secret: %s, error: %v", d.jobUuid, name, err)
+		}
+		if data == nil {
+			return fmt.Errorf("secret %s of %s is not found in the secret store of the cp, job_uuid: %s", name, d.walletAddress, d.jobUuid)
+		}
+		for _, key := range keys {
+			if _, ok := data[key]; !ok {
+				return fmt.Errorf("key %s is not found in secret %s, job_uuid: %s", key, name, d.jobUuid)
+			}
+		}
+		if _, err := k8sService.CreateSecret(context.TODO(), d.k8sNameSpace, d.jobUuid, d.jobUuid+"-"+name, data); err != nil {
+			return fmt.Errorf("failed to create secret, job_uuid: %s, secret: %s, error: %v", d.jobUuid, name, err)
+		}
+	}
+	return nil
+}
+
+// useJobSecrets points the secret env to the secrets created for this job
+func (d *Deploy) useJobSecrets(envs []coreV1.EnvVar) []coreV1.EnvVar {
+	for i, env := range envs {
+		if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+			secretKeyRef := *env.ValueFrom.SecretKeyRef
+			secretKeyRef.Name = d.jobUuid + "-" + secretKeyRef.Name
+			envs[i].ValueFrom = &coreV1.EnvVarSource{SecretKeyRef: &secretKeyRef}
+		}
+	}
+	return envs
+}
+
+func (d *Deploy) initContainers(containers []coreV1.Container) []coreV1.Container {
+	var result []coreV1.Container
+	for _, c := range containers {
+		c.Name = d.jobUuid + "-" + c.Name
+		c.Env = d.useJobSecrets(c.Env)
+		result = append(result, c)
+	}
+	return result
+}
+
+func (d *Deploy) createBatchJob(podTemplate coreV1.PodTemplateSpec, restartPolicy coreV1.RestartPolicy) error {
+	podTemplate.Spec.RestartPolicy = restartPolicy
+	job := &batchV1.Job{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      constants.K8S_DEPLOY_NAME_PREFIX + d.jobUuid,
+			Namespace: d.k8sNameSpace,
+			Labels:    map[string]string{"lad_app": d.jobUuid},
+		},
+		Spec: batchV1.JobSpec{
+			Template: podTemplate,
+		},
+	}
+	if restartPolicy == coreV1.RestartPolicyNever {
+		var backoffLimit int32
+		job.Spec.BackoffLimit = &backoffLimit
+	}
+
+	if _, err := d.k8sService().CreateBatchJob(context.TODO(), d.k8sNameSpace, job); err != nil {
+		return fmt.Errorf("failed to create job, job_uuid: %s, error: %v", d.jobUuid, err)
+	}
+	d.k8sResourceType = "job"
+	return nil
+}
+
+func (d *Deploy) replicaCount() *int32 {
+	replicas := int32(max(d.replicas, 1))
+	return &replicas
 }
 
 func (d *Deploy) deployK8sResource(containerPort int32) (string, error) {
-	k8sService := NewK8sService()
+	k8sService := d.k8sService()
 
 	createService, err := k8sService.CreateService(context.TODO(), d.k8sNameSpace, d.jobUuid, containerPort)
 	if err != nil {
@@ -687,7 +975,12 @@ func (d *Deploy) deployK8sResource(containerPort int32) (string, error) {
 
 	serviceHost := fmt.Sprintf("http://%s:%d", createService.Spec.ClusterIP, createService.Spec.Ports[0].Port)
 
-	_, err = k8sService.CreateIngress(context.TODO(), d.k8sNameSpace, d.jobUuid, d.hostName, containerPort, d.ipWhiteList)
+	// the backend is kept with the job, so the space is still removed by it after the Ingress section is changed
+	backend := conf.GetConfig().Ingress.GetBackend()
+	if err = NewJobService().UpdateJobEntityByJobUuid(&models.JobEntity{JobUuid: d.jobUuid, IngressBackend: backend}); err != nil {
+		logs.GetLogger().Errorf("failed to save the ingress backend of the job, job_uuid: %s, error: %v", d.jobUuid, err)
+	}
+	err = ingressBackendOf(backend).Create(context.TODO(), d.k8sNameSpace, d.jobUuid, d.hostName, containerPort, d.ipWhiteList)
 	if err != nil {
 		return "", fmt.Errorf("failed to create ingress, error: %w", err)
 	}
@@ -699,7 +992,11 @@ func (d *Deploy) watchContainerRunningTime() {
 	job.JobUuid = d.jobUuid
 	job.ExpireTime = time.Now().Unix() + d.duration
 	job.ImageName = d.image
+	job.Replicas = int(*d.replicaCount())
 	job.K8sResourceType = "deployment"
+	if d.k8sResourceType != "" {
+		job.K8sResourceType = d.k8sResourceType
+	}
 	if err := NewJobService().UpdateJobEntityByJobUuid(job); err != nil {
 		logs.GetLogger().Errorf("failed to update job info, error: %v", err)
 		return
@@ -729,8 +1026,9 @@ func getHardwareDetail(description string) (string, models.Resource) {
 	} else {
 		taskType = "GPU"
 		hardwareResource.Gpu.Quantity = 1
-		oldName := strings.TrimSpace(confSplits[0])
+		oldName, gpuSlice := parseGpuSlice(strings.TrimSpace(confSplits[0]))
 		hardwareResource.Gpu.Unit = strings.ReplaceAll(oldName, "Nvidia", "NVIDIA")
+		hardwareResource.GpuSlice = gpuSlice
 
 		hardwareResource.Storage.Quantity = 50
 	}
@@ -768,7 +1066,9 @@ func getHardwareDetailByByte(spaceHardware models.SpaceHardware) (string, models
 		if spaceHardware.Gpu != 0 {
 			hardwareResource.Gpu.Quantity = spaceHardware.Gpu
 		}
-		hardwareResource.Gpu.Unit = strings.ReplaceAll(spaceHardware.Hardware, "Nvidia", "NVIDIA")
+		gpuModel, gpuSlice := spaceGpuSlice(spaceHardware)
+		hardwareResource.Gpu.Unit = strings.ReplaceAll(gpuModel, "Nvidia", "NVIDIA")
+		hardwareResource.GpuSlice = gpuSlice
 		if spaceHardware.Storage == 0 {
 			hardwareResource.Storage.Quantity = 50
 		}
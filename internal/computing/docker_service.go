@@ -13,9 +13,11 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
 	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
-	"github.com/swanchain/go-computing-provider/build"
 	"io"
 	"os"
 	"os/exec"
@@ -72,7 +74,7 @@ func ExtractExposedPort(dockerfilePath string) (string, error) {
 	return exposedPort, nil
 }
 
-func (ds *DockerService) BuildImage(buildPath, imageName string) error {
+func (ds *DockerService) BuildImage(ctx context.Context, buildPath, imageName string) error {
 	// Create a buffer
 	buf := new(bytes.Buffer)
 	tw := tar.NewWriter(buf)
@@ -108,7 +110,7 @@ func (ds *DockerService) BuildImage(buildPath, imageName string) error {
 	})
 
 	dockerFileTarReader := bytes.NewReader(buf.Bytes())
-	buildResponse, err := ds.c.ImageBuild(context.Background(), dockerFileTarReader, types.ImageBuildOptions{
+	buildResponse, err := ds.c.ImageBuild(ctx, dockerFileTarReader, types.ImageBuildOptions{
 		Context: dockerFileTarReader,
 		Tags:    []string{imageName},
 	})
@@ -217,6 +219,22 @@ func (ds *DockerService) RemoveContainerByName(containerName string) error {
 	return nil
 }
 
+func (ds *DockerService) RemoveContainersByLabel(label string) error {
+	containerList, err := ds.c.ContainerList(context.Background(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range containerList {
+		if err = ds.c.ContainerRemove(context.Background(), c.ID, container.RemoveOptions{Force: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (ds *DockerService) CleanResourceForK8s() {
 	containers, err := ds.c.ContainerList(context.Background(), container.ListOptions{All: true})
 	if err != nil {
@@ -230,33 +248,8 @@ func (ds *DockerService) CleanResourceForK8s() {
 		}
 	}
 
-	imagesToKeep := []string{
-		build.UBITaskImageIntelCpu,
-		build.UBITaskImageIntelGpu,
-		build.UBITaskImageAmdCpu,
-		build.UBITaskImageAmdGpu,
-		build.UBIResourceExporterDockerImage,
-	}
-
-	keepSet := make(map[string]bool)
-	for _, imageName := range imagesToKeep {
-		keepSet[imageName] = true
-	}
-
-	allImages, err := ds.c.ImageList(context.Background(), image.ListOptions{})
-	if err != nil {
-		logs.GetLogger().Errorf("Failed get image list, error: %+v", err)
-		return
-	}
-	for _, img := range allImages {
-		for _, tag := range img.RepoTags {
-			if !keepSet[tag] {
-				ds.c.ImageRemove(context.Background(), tag, image.RemoveOptions{
-					Force:         false,
-					PruneChildren: true,
-				})
-			}
-		}
+	if err = NewImageCacheManager().Evict(); err != nil {
+		logs.GetLogger().Errorf("failed to evict images, error: %v", err)
 	}
 
 	ctx := context.Background()
@@ -267,37 +260,12 @@ func (ds *DockerService) CleanResourceForK8s() {
 }
 
 func (ds *DockerService) CleanResourceForDocker() {
-	imagesToKeep := []string{
-		build.UBITaskImageIntelCpu,
-		build.UBITaskImageIntelGpu,
-		build.UBITaskImageAmdCpu,
-		build.UBITaskImageAmdGpu,
-		build.UBIResourceExporterDockerImage,
-	}
-
-	keepSet := make(map[string]bool)
-	for _, imageName := range imagesToKeep {
-		keepSet[imageName] = true
-	}
-
-	allImages, err := ds.c.ImageList(context.Background(), image.ListOptions{})
-	if err != nil {
-		logs.GetLogger().Errorf("Failed get image list, error: %+v", err)
-		return
-	}
-	for _, img := range allImages {
-		for _, tag := range img.RepoTags {
-			if !keepSet[tag] {
-				ds.c.ImageRemove(context.Background(), tag, image.RemoveOptions{
-					Force:         false,
-					PruneChildren: true,
-				})
-			}
-		}
+	if err := NewImageCacheManager().Evict(); err != nil {
+		logs.GetLogger().Errorf("failed to evict images, error: %v", err)
 	}
 
 	cmd := exec.Command("docker", "system", "prune", "-f")
-	if err = cmd.Run(); err != nil {
+	if err := cmd.Run(); err != nil {
 		logs.GetLogger().Errorf("failed to clean resource, error: %+v", err)
 		return
 	}
@@ -314,6 +282,7 @@ func (ds *DockerService) PullImage(imageName string) error {
 		logs.GetLogger().Errorf("get %s image failed, error: %+v", imageName, err)
 		return err
 	}
+	touchImage(imageName)
 	if len(images) > 0 {
 		return nil
 	} else {
@@ -351,14 +320,55 @@ func (ds *DockerService) CheckRunningContainer(containerName string) (bool, erro
 }
 
 func (ds *DockerService) ContainerCreateAndStart(config *container.Config, hostConfig *container.HostConfig, containerName string) error {
+	return ds.ContainerCreateAndStartWithNetwork(config, hostConfig, nil, containerName)
+}
+
+func (ds *DockerService) ContainerCreateAndStartWithNetwork(config *container.Config, hostConfig *container.HostConfig, networkConfig *network.NetworkingConfig, containerName string) error {
 	ctx := context.Background()
-	resp, err := ds.c.ContainerCreate(ctx, config, hostConfig, nil, nil, containerName)
+	resp, err := ds.c.ContainerCreate(ctx, config, hostConfig, networkConfig, nil, containerName)
 	if err != nil {
 		return err
 	}
 	return ds.c.ContainerStart(ctx, resp.ID, container.StartOptions{})
 }
 
+func (ds *DockerService) CreateNetwork(networkName string, labels map[string]string) error {
+	_, err := ds.c.NetworkCreate(context.Background(), networkName, network.CreateOptions{
+		Driver: "bridge",
+		Labels: labels,
+	})
+	return err
+}
+
+func (ds *DockerService) RemoveNetwork(networkName string) error {
+	if err := ds.c.NetworkRemove(context.Background(), networkName); err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (ds *DockerService) CreateVolume(volumeName string, labels map[string]string) error {
+	_, err := ds.c.VolumeCreate(context.Background(), volume.CreateOptions{
+		Name:   volumeName,
+		Labels: labels,
+	})
+	return err
+}
+
+func (ds *DockerService) RemoveVolumesByLabel(label string) error {
+	ctx := context.Background()
+	volumes, err := ds.c.VolumeList(ctx, volume.ListOptions{Filters: filters.NewArgs(filters.Arg("label", label))})
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes.Volumes {
+		if err = ds.c.VolumeRemove(ctx, v.Name, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (ds *DockerService) ContainerLogs(containerName string) (string, error) {
 	ctx := context.Background()
 	logReader, err := ds.c.ContainerLogs(ctx, containerName, container.LogsOptions{
@@ -381,6 +391,20 @@ func (ds *DockerService) ContainerLogs(containerName string) (string, error) {
 	}
 }
 
+// ContainerStats returns one sample of the resource usage of the container
+func (ds *DockerService) ContainerStats(containerName string) (container.StatsResponse, error) {
+	var stats container.StatsResponse
+	reader, err := ds.c.ContainerStatsOneShot(context.Background(), containerName)
+	if err != nil {
+		return stats, err
+	}
+	defer reader.Body.Close()
+	if err = json.NewDecoder(reader.Body).Decode(&stats); err != nil {
+		return stats, fmt.Errorf("failed to decode the stats of container %s, error: %v", containerName, err)
+	}
+	return stats, nil
+}
+
 func (ds *DockerService) GetContainerLogStream(containerName string) (io.ReadCloser, error) {
 	ctx := context.Background()
 	return ds.c.ContainerLogs(ctx, containerName, container.LogsOptions{
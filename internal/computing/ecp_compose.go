@@ -0,0 +1,259 @@
+package computing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/internal/yaml"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+// ecpJobLabel marks the docker networks and volumes created for the compose services of an ecp job
+const ecpJobLabel = "ecp_job"
+
+func composeNetworkName(jobUuid string) string {
+	return "ecp-" + jobUuid
+}
+
+func composeVolumeName(jobUuid, name string) string {
+	return jobUuid + "-" + name
+}
+
+// deployComposeJob runs the services of a compose file as containers on one docker network, every service is reachable by its name.
+// The depends are started first, the entry service gets the hardware and the gpus of the job left by the depends.
+// It returns errInterrupted when the shutdown interrupts it before the containers are created.
+func deployComposeJob(cp *checkpoint, job models.EcpJobCreateReq, cr yaml.ContainerResource, env []string, gpuIndexes []string) error {
+	dockerService := NewDockerService()
+	services := append(append([]yaml.ContainerResource{}, cr.Depends...), cr)
+	for _, service := range services {
+		if err := dockerService.PullImage(service.ImageName); err != nil {
+			return fmt.Errorf("failed to pull %s image, error: %v", service.ImageName, err)
+		}
+	}
+	if !cp.advance(stageDeploying) {
+		return errInterrupted
+	}
+
+	if int64(len(gpuIndexes)) > job.Resource.GPU {
+		gpuIndexes = gpuIndexes[:job.Resource.GPU]
+	}
+	serviceGpus := make(map[string][]string)
+	for _, depend := range cr.Depends {
+		if depend.Resources == nil {
+			continue
+		}
+		if quantity, ok := depend.Resources.Limits["nvidia.com/gpu"]; ok {
+			count := int(quantity.Value())
+			if count > len(gpuIndexes) {
+				return fmt.Errorf("the services reserve more gpus than the job requested %d", job.Resource.GPU)
+			}
+			serviceGpus[depend.Name], gpuIndexes = gpuIndexes[:count], gpuIndexes[count:]
+		}
+	}
+	serviceGpus[cr.Name] = gpuIndexes
+
+	mainCpu, mainMemory, err := composeMainResources(job.Resource, cr)
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]string{ecpJobLabel: job.UUID}
+	networkName := composeNetworkName(job.UUID)
+	if err := dockerService.CreateNetwork(networkName, labels); err != nil {
+		return fmt.Errorf("failed to create network %s, error: %v", networkName, err)
+	}
+	for _, v := range cr.Volumes {
+		if err := dockerService.CreateVolume(composeVolumeName(job.UUID, v.Name), labels); err != nil {
+			removeComposeResources(job.UUID, nil)
+			return fmt.Errorf("failed to create volume %s, error: %v", v.Name, err)
+		}
+	}
+
+	// the jobs are saved once every service runs, a failed deployment leaves neither containers nor jobs behind
+	var containerNames []string
+	var jobEntities []*models.EcpJobEntity
+	for _, service := range services {
+		var serviceEnv []string
+		for _, envVar := range service.Env {
+			serviceEnv = append(serviceEnv, envVar.Name+"="+envVar.Value)
+		}
+		resources := composeServiceResources(service)
+		if service.Name == cr.Name {
+			serviceEnv = append(serviceEnv, env...)
+			resources = container.Resources{
+				NanoCPUs: mainCpu,
+				Memory:   mainMemory,
+			}
+		}
+		if gpus := serviceGpus[service.Name]; len(gpus) > 0 {
+			serviceEnv = append(serviceEnv, fmt.Sprintf("CUDA_VISIBLE_DEVICES=%s", strings.Join(gpus, ",")))
+			resources.DeviceRequests = []container.DeviceRequest{
+				{
+					Driver:       "nvidia",
+					DeviceIDs:    gpus,
+					Capabilities: [][]string{{"compute", "utility"}},
+				},
+			}
+		}
+
+		exposedPorts := make(nat.PortSet)
+		portBindings := make(nat.PortMap)
+		for _, port := range service.Ports {
+			containerPort := nat.Port(fmt.Sprintf("%d/%s", port.ContainerPort, strings.ToLower(string(port.Protocol))))
+			exposedPorts[containerPort] = struct{}{}
+			if port.HostPort > 0 {
+				portBindings[containerPort] = append(portBindings[containerPort], nat.PortBinding{HostPort: fmt.Sprint(port.HostPort)})
+			}
+		}
+
+		var mounts []mount.Mount
+		for _, volumeMount := range service.VolumeMountList {
+			mounts = append(mounts, mount.Mount{
+				Type:     mount.TypeVolume,
+				Source:   composeVolumeName(job.UUID, volumeMount.Name),
+				Target:   volumeMount.MountPath,
+				ReadOnly: volumeMount.ReadOnly,
+			})
+		}
+
+		containerConfig := &container.Config{
+			Image:        service.ImageName,
+			Entrypoint:   service.Command,
+			Cmd:          service.Args,
+			Env:          serviceEnv,
+			ExposedPorts: exposedPorts,
+			Labels:       labels,
+			AttachStdout: true,
+			AttachStderr: true,
+			Tty:          true,
+		}
+		hostConfig := &container.HostConfig{
+			Resources:     resources,
+			PortBindings:  portBindings,
+			Mounts:        mounts,
+			RestartPolicy: composeRestartPolicy(cr.RestartPolicy),
+			Privileged:    true,
+		}
+		networkConfig := &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				networkName: {Aliases: []string{service.Name}},
+			},
+		}
+
+		containerName := job.Name + "-" + service.Name + "-" + generateString(5)
+		if err := dockerService.ContainerCreateAndStartWithNetwork(containerConfig, hostConfig, networkConfig, containerName); err != nil {
+			if err := removeComposeResources(job.UUID, append(containerNames, containerName)); err != nil {
+				logs.GetLogger().Errorf("failed to clean up the failed job, job_uuid: %s, error: %v", job.UUID, err)
+			}
+			return fmt.Errorf("failed to create container of service %s, error: %v", service.Name, err)
+		}
+		containerNames = append(containerNames, containerName)
+		logs.GetLogger().Warnf("job_uuid: %s, starting container, service: %s, container name: %s", job.UUID, service.Name, containerName)
+
+		jobEntities = append(jobEntities, &models.EcpJobEntity{
+			Uuid:          job.UUID,
+			Name:          job.Name,
+			Image:         service.ImageName,
+			Env:           strings.Join(serviceEnv, ","),
+			Status:        "created",
+			ContainerName: containerName,
+			CreateTime:    time.Now().Unix(),
+			ExpireTime:    ecpJobExpireTime(job.Duration),
+		})
+	}
+
+	for _, jobEntity := range jobEntities {
+		if err := NewEcpJobService().SaveEcpJobEntity(jobEntity); err != nil {
+			logs.GetLogger().Errorf("failed to save job to db, job_uuid: %s, container: %s, error: %v", job.UUID, jobEntity.ContainerName, err)
+		}
+	}
+	return nil
+}
+
+// composeMainResources returns the nano cpus and the memory left to the entry service after the depends take their limits,
+// the hardware of the job pays for all the services
+func composeMainResources(hardware models.HardwareResource, cr yaml.ContainerResource) (int64, int64, error) {
+	mainCpu, mainMemory := hardware.CPU*1000000000, hardware.Memory
+	for _, depend := range cr.Depends {
+		resources := composeServiceResources(depend)
+		mainCpu -= resources.NanoCPUs
+		mainMemory -= resources.Memory
+	}
+	if mainCpu <= 0 || mainMemory <= 0 {
+		return 0, 0, fmt.Errorf("the depends of %s take all the cpu or memory of the job", cr.Name)
+	}
+	return mainCpu, mainMemory, nil
+}
+
+// checkComposeHostPorts rejects the host ports out of API.HostPortRange, the other ports of the host are not the job's
+func checkComposeHostPorts(cr yaml.ContainerResource) error {
+	first, last, ok := conf.GetConfig().API.GetHostPortRange()
+	for _, service := range append(append([]yaml.ContainerResource{}, cr.Depends...), cr) {
+		for _, port := range service.Ports {
+			if port.HostPort == 0 {
+				continue
+			}
+			if !ok {
+				return fmt.Errorf("service %s publishes host port %d, but no HostPortRange is configured", service.Name, port.HostPort)
+			}
+			if port.HostPort < first || port.HostPort > last {
+				return fmt.Errorf("service %s publishes host port %d, out of the range %d-%d", service.Name, port.HostPort, first, last)
+			}
+		}
+	}
+	return nil
+}
+
+// composeServiceResources converts the compose limits of a depend service, the parser limits every depend
+func composeServiceResources(service yaml.ContainerResource) container.Resources {
+	var resources container.Resources
+	if service.Resources == nil {
+		return resources
+	}
+	if cpu, ok := service.Resources.Limits[coreV1.ResourceCPU]; ok {
+		resources.NanoCPUs = cpu.MilliValue() * 1000000
+	}
+	if memory, ok := service.Resources.Limits[coreV1.ResourceMemory]; ok {
+		resources.Memory = memory.Value()
+	}
+	return resources
+}
+
+func composeRestartPolicy(restartPolicy coreV1.RestartPolicy) container.RestartPolicy {
+	switch restartPolicy {
+	case coreV1.RestartPolicyOnFailure:
+		return container.RestartPolicy{Name: container.RestartPolicyOnFailure}
+	case coreV1.RestartPolicyNever:
+		return container.RestartPolicy{Name: container.RestartPolicyDisabled}
+	default:
+		return container.RestartPolicy{Name: container.RestartPolicyUnlessStopped}
+	}
+}
+
+// removeComposeResources removes the containers, the network and the volumes of an ecp job, a job of a single image has none of the latter.
+// It goes on after a failure, so one stuck container does not leave the rest of the job behind.
+func removeComposeResources(jobUuid string, containerNames []string) error {
+	dockerService := NewDockerService()
+	var errs []error
+	for _, containerName := range containerNames {
+		if err := dockerService.RemoveContainerByName(containerName); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove container %s, error: %v", containerName, err))
+		}
+	}
+	if err := dockerService.RemoveNetwork(composeNetworkName(jobUuid)); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove network, error: %v", err))
+	}
+	if err := dockerService.RemoveVolumesByLabel(ecpJobLabel + "=" + jobUuid); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove volumes, error: %v", err))
+	}
+	return errors.Join(errs...)
+}
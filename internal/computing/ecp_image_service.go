@@ -1,13 +1,15 @@
 package computing
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/docker/docker/api/types/container"
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/gin-gonic/gin"
 	"github.com/swanchain/go-computing-provider/conf"
 	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/internal/yaml"
 	"github.com/swanchain/go-computing-provider/util"
 	"net/http"
 	"strconv"
@@ -23,6 +25,9 @@ func NewImageJobService() *ImageJobService {
 }
 
 func (*ImageJobService) CheckJobCondition(c *gin.Context) {
+	if rejectInMaintenance(c) {
+		return
+	}
 	var job models.EcpJobCreateReq
 	err := c.ShouldBindJSON(&job)
 	if err != nil {
@@ -61,6 +66,9 @@ func (*ImageJobService) CheckJobCondition(c *gin.Context) {
 }
 
 func (*ImageJobService) DeployJob(c *gin.Context) {
+	if rejectInMaintenance(c) {
+		return
+	}
 	var job models.EcpJobCreateReq
 	err := c.ShouldBindJSON(&job)
 	if err != nil {
@@ -80,7 +88,25 @@ func (*ImageJobService) DeployJob(c *gin.Context) {
 		return
 	}
 
-	if strings.TrimSpace(job.Image) == "" {
+	var composeService *yaml.ContainerResource
+	var containerResources []yaml.ContainerResource
+	if strings.TrimSpace(job.Compose) != "" {
+		containerResources, err = yaml.ParseCompose([]byte(job.Compose))
+		if err != nil {
+			logs.GetLogger().Errorf("failed to parse compose, job_uuid: %s, error: %v", job.UUID, err)
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.YamlValidationError, err.Error()))
+			return
+		}
+		composeService = &containerResources[0]
+		if err = checkComposeHostPorts(*composeService); err == nil {
+			_, _, err = composeMainResources(job.Resource, *composeService)
+		}
+		if err != nil {
+			logs.GetLogger().Warnf("reject compose job, job_uuid: %s, error: %v", job.UUID, err)
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.YamlValidationError, err.Error()))
+			return
+		}
+	} else if strings.TrimSpace(job.Image) == "" {
 		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.UbiTaskParamError, "missing required field: image"))
 		return
 	}
@@ -102,11 +128,24 @@ func (*ImageJobService) DeployJob(c *gin.Context) {
 		}
 	}
 
-	if err := NewDockerService().PullImage(job.Image); err != nil {
-		logs.GetLogger().Errorf("failed to pull %s image, error: %v", job.Image, err)
+	if composeService != nil {
+		err = applyImagePolicy(containerResources[:1])
+	} else {
+		job.Image, err = CheckImagePolicy(context.TODO(), job.Image)
+	}
+	if err != nil {
+		logs.GetLogger().Warnf("reject job by the image policy, job_uuid: %s, error: %v", job.UUID, err)
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.ImagePolicyError, err.Error()))
 		return
 	}
 
+	if composeService == nil {
+		if err := NewDockerService().PullImage(job.Image); err != nil {
+			logs.GetLogger().Errorf("failed to pull %s image, error: %v", job.Image, err)
+			return
+		}
+	}
+
 	var env []string
 	for k, v := range job.Envs {
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
@@ -123,84 +162,118 @@ func (*ImageJobService) DeployJob(c *gin.Context) {
 		return
 	}
 
-	go func() {
-		if err := NewDockerService().PullImage(job.Image); err != nil {
-			logs.GetLogger().Errorf("failed to pull %s image, job_uuid: %s, error: %v", job.Image, job.UUID, err)
-			return
+	RecordAudit(AuditActorApi(c), "ecp job deploy", map[string]interface{}{"job_uuid": job.UUID, "name": job.Name, "image": job.Image,
+		"compose": composeService != nil, "resource": job.Resource, "price": job.Price, "duration": job.Duration}, "", nil)
+	runInBackground(func() {
+		deployEcpJob(job, composeService, env, needCpu, indexs)
+	})
+
+	c.JSON(http.StatusOK, util.CreateSuccessResponse(map[string]interface{}{
+		"price": totalCost,
+	}))
+}
+
+// deployEcpJob runs the containers of an ecp job, its checkpoint is kept when the shutdown interrupts it before the
+// containers are created
+func deployEcpJob(job models.EcpJobCreateReq, composeService *yaml.ContainerResource, env []string, needCpu int64, indexs []string) {
+	cp := saveCheckpoint(checkpointEcpDeploy, job.UUID, ecpDeployPayload{Job: job, Compose: composeService})
+	var interrupted bool
+	defer func() {
+		if !interrupted {
+			cp.done()
 		}
-		var needResource container.Resources
-		if job.Resource.GPUModel != "" && job.Resource.GPU > 0 {
-			var useIndexs []string
-			for i := 0; i < int(job.Resource.GPU); i++ {
-				if i >= len(indexs) {
-					break
-				}
-				useIndexs = append(useIndexs, indexs[i])
-				env = append(env, fmt.Sprintf("CUDA_VISIBLE_DEVICES=%s", strings.Join(useIndexs, ",")))
-			}
+	}()
 
-			needResource = container.Resources{
-				CPUQuota: needCpu * 100000,
-				Memory:   job.Resource.Memory,
-				DeviceRequests: []container.DeviceRequest{
-					{
-						Driver:       "nvidia",
-						DeviceIDs:    useIndexs,
-						Capabilities: [][]string{{"compute", "utility"}},
-					},
-				},
+	if composeService != nil {
+		if err := deployComposeJob(cp, job, *composeService, env, indexs); err != nil {
+			if errors.Is(err, errInterrupted) {
+				interrupted = true
+				return
 			}
-		} else {
-			needResource = container.Resources{
-				CPUQuota: needCpu * 100000,
-				Memory:   job.Resource.Memory,
+			logs.GetLogger().Errorf("failed to deploy compose job, job_uuid: %s, error: %v", job.UUID, err)
+		}
+		return
+	}
+	if err := NewDockerService().PullImage(job.Image); err != nil {
+		logs.GetLogger().Errorf("failed to pull %s image, job_uuid: %s, error: %v", job.Image, job.UUID, err)
+		return
+	}
+	if !cp.advance(stageDeploying) {
+		interrupted = true
+		return
+	}
+	var needResource container.Resources
+	if (job.Resource.GPUModel != "" || job.Resource.GPUSlice != "") && job.Resource.GPU > 0 {
+		var useIndexs []string
+		for i := 0; i < int(job.Resource.GPU); i++ {
+			if i >= len(indexs) {
+				break
 			}
+			useIndexs = append(useIndexs, indexs[i])
+			env = append(env, fmt.Sprintf("CUDA_VISIBLE_DEVICES=%s", strings.Join(useIndexs, ",")))
 		}
 
-		hostConfig := &container.HostConfig{
-			Resources:  needResource,
-			Privileged: true,
+		needResource = container.Resources{
+			CPUPeriod: ecpCpuPeriod,
+			CPUQuota:  needCpu * ecpCpuPeriod,
+			Memory:    job.Resource.Memory,
+			DeviceRequests: []container.DeviceRequest{
+				{
+					Driver:       "nvidia",
+					DeviceIDs:    useIndexs,
+					Capabilities: [][]string{{"compute", "utility"}},
+				},
+			},
 		}
-		containerConfig := &container.Config{
-			Image:        job.Image,
-			Env:          env,
-			AttachStdout: true,
-			AttachStderr: true,
-			Tty:          true,
+	} else {
+		needResource = container.Resources{
+			CPUPeriod: ecpCpuPeriod,
+			CPUQuota:  needCpu * ecpCpuPeriod,
+			Memory:    job.Resource.Memory,
 		}
+	}
 
-		containerName := job.Name + "-" + generateString(5)
-		dockerService := NewDockerService()
-		if err := dockerService.ContainerCreateAndStart(containerConfig, hostConfig, containerName); err != nil {
-			logs.GetLogger().Errorf("failed to create job container, job_uuid: %s, error: %v", job.UUID, err)
-			return
-		}
-		logs.GetLogger().Warnf("job_uuid: %s, starting container, container name: %s", job.UUID, containerName)
+	hostConfig := &container.HostConfig{
+		Resources:  needResource,
+		Privileged: true,
+	}
+	containerConfig := &container.Config{
+		Image:        job.Image,
+		Env:          env,
+		Labels:       map[string]string{ecpJobLabel: job.UUID},
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          true,
+	}
 
-		time.Sleep(3 * time.Second)
-		if !dockerService.IsExistContainer(containerName) {
-			logs.GetLogger().Warnf("job_uuid: %s, not found container", job.UUID)
-			return
-		}
-		logs.GetLogger().Warnf("job_uuid: %s, started container, container name: %s", job.UUID, containerName)
-
-		if err = NewEcpJobService().SaveEcpJobEntity(&models.EcpJobEntity{
-			Uuid:          job.UUID,
-			Name:          job.Name,
-			Image:         job.Image,
-			Env:           strings.Join(env, ","),
-			Status:        "created",
-			ContainerName: containerName,
-			CreateTime:    time.Now().Unix(),
-		}); err != nil {
-			logs.GetLogger().Errorf("failed to save job to db, error: %v", err)
-			return
-		}
-	}()
+	containerName := job.Name + "-" + generateString(5)
+	dockerService := NewDockerService()
+	if err := dockerService.ContainerCreateAndStart(containerConfig, hostConfig, containerName); err != nil {
+		logs.GetLogger().Errorf("failed to create job container, job_uuid: %s, error: %v", job.UUID, err)
+		return
+	}
+	logs.GetLogger().Warnf("job_uuid: %s, starting container, container name: %s", job.UUID, containerName)
 
-	c.JSON(http.StatusOK, util.CreateSuccessResponse(map[string]interface{}{
-		"price": totalCost,
-	}))
+	time.Sleep(3 * time.Second)
+	if !dockerService.IsExistContainer(containerName) {
+		logs.GetLogger().Warnf("job_uuid: %s, not found container", job.UUID)
+		return
+	}
+	logs.GetLogger().Warnf("job_uuid: %s, started container, container name: %s", job.UUID, containerName)
+
+	if err := NewEcpJobService().SaveEcpJobEntity(&models.EcpJobEntity{
+		Uuid:          job.UUID,
+		Name:          job.Name,
+		Image:         job.Image,
+		Env:           strings.Join(env, ","),
+		Status:        "created",
+		ContainerName: containerName,
+		CreateTime:    time.Now().Unix(),
+		ExpireTime:    ecpJobExpireTime(job.Duration),
+	}); err != nil {
+		logs.GetLogger().Errorf("failed to save job to db, error: %v", err)
+		return
+	}
 }
 
 func (*ImageJobService) GetJobStatus(c *gin.Context) {
@@ -232,13 +305,19 @@ func (*ImageJobService) DeleteJob(c *gin.Context) {
 		return
 	}
 
-	ecpJobEntity, err := NewEcpJobService().GetEcpJobByUuid(jobUuId)
+	// a compose job has one entity for each of its containers
+	ecpJobs, err := NewEcpJobService().GetEcpJobs(jobUuId)
 	if err != nil {
 		logs.GetLogger().Errorf("failed to get job, job_uuid: %s, error: %v", jobUuId, err)
 		return
 	}
-	containerName := ecpJobEntity.ContainerName
-	if err = NewDockerService().RemoveContainerByName(containerName); err != nil {
+	var containerNames []string
+	for _, ecpJob := range ecpJobs {
+		containerNames = append(containerNames, ecpJob.ContainerName)
+	}
+	err = removeComposeResources(jobUuId, containerNames)
+	RecordAudit(AuditActorApi(c), "ecp job delete", map[string]interface{}{"job_uuid": jobUuId, "container_name": strings.Join(containerNames, ",")}, "", err)
+	if err != nil {
 		logs.GetLogger().Errorf("failed to remove container, job_uuid: %s, error: %v", jobUuId, err)
 		return
 	}
@@ -275,6 +354,11 @@ func checkPriceForDocker(userPrice string, duration int, resource models.Hardwar
 	if err != nil {
 		return false, 0, fmt.Errorf("failed to converting GPU price: %v", err)
 	}
+	if resource.GPUSlice != "" {
+		if gpuPrice, err = gpuSlicePrice(priceConfig, strings.ToLower(resource.GPUSlice)); err != nil {
+			return false, 0, fmt.Errorf("failed to converting GPU slice price: %v", err)
+		}
+	}
 
 	// Calculate total cost
 	cpuCost := float64(resource.CPU) * cpuPrice
@@ -294,37 +378,14 @@ func checkPriceForDocker(userPrice string, duration int, resource models.Hardwar
 }
 
 func checkResourceForImage(resource models.HardwareResource) (bool, string, int64, int64, []string, error) {
-	dockerService := NewDockerService()
-	containerLogStr, err := dockerService.ContainerLogs("resource-exporter")
+	nodeResource, err := collectHostResource()
 	if err != nil {
 		return false, "", 0, 0, nil, err
 	}
 
-	var nodeResource models.NodeResource
-	if err := json.Unmarshal([]byte(containerLogStr), &nodeResource); err != nil {
-		return false, "", 0, 0, nil, err
-	}
-
-	needCpu := resource.CPU
-	var needMemory, needStorage float64
 	var indexs []string
-	if resource.Memory > 0 {
-		needMemory = formatGiB(resource.Memory)
-
-	}
-	if resource.Storage > 0 {
-		needMemory = formatGiB(resource.Storage)
-	}
-
-	remainderCpu, _ := strconv.ParseInt(nodeResource.Cpu.Free, 10, 64)
-
-	var remainderMemory, remainderStorage float64
-	if len(strings.Split(strings.TrimSpace(nodeResource.Memory.Free), " ")) > 0 {
-		remainderMemory, _ = strconv.ParseFloat(strings.Split(strings.TrimSpace(nodeResource.Memory.Free), " ")[0], 64)
-	}
-	if len(strings.Split(strings.TrimSpace(nodeResource.Storage.Free), " ")) > 0 {
-		remainderStorage, err = strconv.ParseFloat(strings.Split(strings.TrimSpace(nodeResource.Storage.Free), " ")[0], 64)
-	}
+	reserve := currentReserve()
+	needCpu, needMemory, fits := hostResourceFits(resource, nodeResource, reserve)
 
 	type gpuData struct {
 		num    int
@@ -353,14 +414,25 @@ func checkResourceForImage(resource models.HardwareResource) (bool, string, int6
 		}
 	}
 
-	logs.GetLogger().Infof("checkResourceForImage: needCpu: %d, needMemory: %.2f, needStorage: %.2f, needGpu: %d, gpuName: %s", needCpu, needMemory, needStorage, resource.GPU, resource.GPUModel)
-	logs.GetLogger().Infof("checkResourceForImage: remainingCpu: %d, remainingMemory: %.2f, remainingStorage: %.2f, remainingGpu: %+v", remainderCpu, remainderMemory, remainderStorage, gpuMap)
-	if needCpu <= remainderCpu && needMemory <= remainderMemory && needStorage <= remainderStorage {
+	logs.GetLogger().Infof("checkResourceForImage: needGpu: %d, gpuName: %s, remainingGpu: %+v", resource.GPU, resource.GPUModel, gpuMap)
+	if fits {
+		if resource.GPUSlice != "" {
+			migDevices, err := availableMigDevices(resource.GPUModel, strings.ToLower(resource.GPUSlice))
+			if err != nil {
+				return false, nodeResource.CpuName, needCpu, int64(needMemory), nil, err
+			}
+			if int64(len(migDevices)) < max(resource.GPU, 1) {
+				return false, nodeResource.CpuName, needCpu, int64(needMemory), nil, nil
+			}
+			return true, nodeResource.CpuName, needCpu, int64(needMemory), migDevices, nil
+		}
 		if resource.GPUModel != "" {
 			var flag bool
 			for k, gd := range gpuMap {
-				if strings.ToUpper(k) == resource.GPUModel && gd.num > 0 {
-					indexs = gd.indexs
+				// the reserved gpus are the last ones, which are never handed out
+				sellable := gd.num - int(reserve.gpuQuota(k))
+				if strings.ToUpper(k) == resource.GPUModel && sellable > 0 && sellable >= int(resource.GPU) {
+					indexs = gd.indexs[:sellable]
 					flag = true
 					break
 				}
@@ -376,6 +448,34 @@ func checkResourceForImage(resource models.HardwareResource) (bool, string, int6
 	return false, nodeResource.CpuName, needCpu, int64(needMemory), indexs, nil
 }
 
+// hostResourceFits reports whether the cpu, the memory and the storage of the job fit in the free resources of the host after the reserve
+func hostResourceFits(resource models.HardwareResource, nodeResource models.NodeResource, reserve reservedResource) (int64, float64, bool) {
+	needCpu := resource.CPU
+	var needMemory, needStorage float64
+	if resource.Memory > 0 {
+		needMemory = formatGiB(resource.Memory)
+	}
+	if resource.Storage > 0 {
+		needStorage = formatGiB(resource.Storage)
+	}
+
+	remainderCpu, _ := strconv.ParseInt(nodeResource.Cpu.Free, 10, 64)
+	var remainderMemory, remainderStorage float64
+	if len(strings.Split(strings.TrimSpace(nodeResource.Memory.Free), " ")) > 0 {
+		remainderMemory, _ = strconv.ParseFloat(strings.Split(strings.TrimSpace(nodeResource.Memory.Free), " ")[0], 64)
+	}
+	if len(strings.Split(strings.TrimSpace(nodeResource.Storage.Free), " ")) > 0 {
+		remainderStorage, _ = strconv.ParseFloat(strings.Split(strings.TrimSpace(nodeResource.Storage.Free), " ")[0], 64)
+	}
+	remainderCpu -= reserve.cpu
+	remainderMemory -= reserve.memoryGiB
+	remainderStorage -= reserve.storageGiB
+
+	logs.GetLogger().Infof("checkResourceForImage: needCpu: %d, needMemory: %.2f, needStorage: %.2f", needCpu, needMemory, needStorage)
+	logs.GetLogger().Infof("checkResourceForImage: remainingCpu: %d, remainingMemory: %.2f, remainingStorage: %.2f", remainderCpu, remainderMemory, remainderStorage)
+	return needCpu, needMemory, needCpu <= remainderCpu && needMemory <= remainderMemory && needStorage <= remainderStorage
+}
+
 func parsePrice(priceStr string) (float64, error) {
 	return strconv.ParseFloat(priceStr, 64)
 }
@@ -0,0 +1,39 @@
+package computing
+
+import (
+	"testing"
+
+	"github.com/swanchain/go-computing-provider/internal/models"
+)
+
+func TestHostResourceFits(t *testing.T) {
+	initTestLogger(t)
+	const gib = int64(1 << 30)
+	host := models.NodeResource{
+		Cpu:     models.Common{Free: "8"},
+		Memory:  models.Common{Free: "16.00 GiB"},
+		Storage: models.Common{Free: "100.00 GiB"},
+	}
+	tests := []struct {
+		name     string
+		resource models.HardwareResource
+		reserve  reservedResource
+		fits     bool
+	}{
+		{"fits", models.HardwareResource{CPU: 4, Memory: 8 * gib, Storage: 50 * gib}, reservedResource{}, true},
+		{"all the free resources", models.HardwareResource{CPU: 8, Memory: 16 * gib, Storage: 100 * gib}, reservedResource{}, true},
+		{"too much cpu", models.HardwareResource{CPU: 9, Memory: 8 * gib, Storage: 50 * gib}, reservedResource{}, false},
+		{"too much memory", models.HardwareResource{CPU: 4, Memory: 17 * gib, Storage: 50 * gib}, reservedResource{}, false},
+		{"too much storage with little memory", models.HardwareResource{CPU: 4, Memory: 1 * gib, Storage: 101 * gib}, reservedResource{}, false},
+		{"storage kept in reserve", models.HardwareResource{CPU: 4, Memory: 8 * gib, Storage: 90 * gib}, reservedResource{storageGiB: 20}, false},
+		{"cpu kept in reserve", models.HardwareResource{CPU: 7, Memory: 8 * gib, Storage: 50 * gib}, reservedResource{cpu: 2}, false},
+		{"memory kept in reserve", models.HardwareResource{CPU: 4, Memory: 12 * gib, Storage: 50 * gib}, reservedResource{memoryGiB: 8}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, fits := hostResourceFits(tt.resource, host, tt.reserve); fits != tt.fits {
+				t.Errorf("hostResourceFits() = %v, want %v", fits, tt.fits)
+			}
+		})
+	}
+}
@@ -1,11 +1,15 @@
 package computing
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/google/wire"
 	"github.com/swanchain/go-computing-provider/internal/db"
 	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
 	"time"
 )
 
@@ -79,6 +83,10 @@ func (jobServ JobService) UpdateJobResultUrlByJobUuid(jobUuid string, resultUrl
 	return jobServ.Model(&models.JobEntity{}).Where("job_uuid=? and delete_at=?", jobUuid, models.UN_DELETEED_FLAG).Update("result_url", resultUrl).Error
 }
 
+func (jobServ JobService) UpdateJobError(jobUuid string, errMsg string) (err error) {
+	return jobServ.Model(&models.JobEntity{}).Where("job_uuid=? and delete_at=?", jobUuid, models.UN_DELETEED_FLAG).Update("error", errMsg).Error
+}
+
 func (jobServ JobService) GetJobEntityByTaskUuid(taskUuid string) (models.JobEntity, error) {
 	var job models.JobEntity
 	err := jobServ.Model(&models.JobEntity{}).Where("task_uuid=? and delete_at=?", taskUuid, models.UN_DELETEED_FLAG).Find(&job).Error
@@ -97,6 +105,14 @@ func (jobServ JobService) GetJobEntityByJobUuid(jobUuid string) (models.JobEntit
 	return job, err
 }
 
+// GetJobCluster returns the cluster of the job by its job_uuid, or by the space_uuid of the old jobs
+func (jobServ JobService) GetJobCluster(uuid string) string {
+	var job models.JobEntity
+	jobServ.Model(&models.JobEntity{}).Where("lower(job_uuid)=? or lower(space_uuid)=?", strings.ToLower(uuid), strings.ToLower(uuid)).
+		Order("id desc").Limit(1).Find(&job)
+	return job.Cluster
+}
+
 func (jobServ JobService) DeleteJobEntityByJobUuId(jobUuid string, jobStatus int) error {
 	return jobServ.Model(&models.JobEntity{}).Where("job_uuid=? and delete_at=?", jobUuid, models.UN_DELETEED_FLAG).Updates(map[string]interface{}{
 		"delete_at":  models.DELETED_FLAG,
@@ -122,6 +138,14 @@ func (jobServ JobService) GetJobList(status int) (list []*models.JobEntity, err
 	return
 }
 
+func (jobServ JobService) RestoreJobEntity(jobUuid string) error {
+	return jobServ.Model(&models.JobEntity{}).Where("job_uuid=? and delete_at=?", jobUuid, models.DELETED_FLAG).Updates(map[string]interface{}{
+		"delete_at":  models.UN_DELETEED_FLAG,
+		"status":     models.JOB_RUNNING_STATUS,
+		"pod_status": models.POD_RUNNING_STATUS,
+	}).Error
+}
+
 func (jobServ JobService) UpdateJobReward(taskUuid string, amount string) (err error) {
 	return jobServ.Model(&models.JobEntity{}).Where("task_uuid=?", taskUuid).Update("reward", amount).Error
 }
@@ -175,10 +199,28 @@ func (cpServ EcpJobService) GetEcpJobs(jobUuid string) ([]models.EcpJobEntity, e
 	return job, err
 }
 
+func (cpServ EcpJobService) GetDeletedEcpJobs(jobUuid string) ([]models.EcpJobEntity, error) {
+	var job []models.EcpJobEntity
+	err := cpServ.Model(&models.EcpJobEntity{}).Where("uuid=? and delete_at=1", jobUuid).Find(&job).Error
+	return job, err
+}
+
+func (cpServ EcpJobService) RestoreEcpJobs(jobUuid string) (err error) {
+	return cpServ.Model(&models.EcpJobEntity{}).Where("uuid =? and delete_at=1", jobUuid).Updates(map[string]interface{}{
+		"delete_at": 0,
+		"status":    "running",
+	}).Error
+}
+
 func (cpServ EcpJobService) UpdateEcpJobEntity(jobUuid, status string) (err error) {
 	return cpServ.Model(&models.EcpJobEntity{}).Where("uuid =?", jobUuid).Update("status", status).Error
 }
 
+// UpdateEcpJobContainerStatus updates the entity of one container, a compose job has one entity for each of its containers
+func (cpServ EcpJobService) UpdateEcpJobContainerStatus(containerName, status string) (err error) {
+	return cpServ.Model(&models.EcpJobEntity{}).Where("container_name =? and delete_at=0", containerName).Update("status", status).Error
+}
+
 func (cpServ EcpJobService) SaveEcpJobEntity(job *models.EcpJobEntity) (err error) {
 	return cpServ.Save(job).Error
 }
@@ -190,7 +232,199 @@ func (cpServ EcpJobService) DeleteContainerByUuid(uuid string) (err error) {
 	}).Error
 }
 
+type NonceService struct {
+	*gorm.DB
+}
+
+// SaveNonce records a nonce, it returns gorm.ErrDuplicatedKey if the same nonce has already been used
+func (nonceServ NonceService) SaveNonce(nonce string, expireTime int64) error {
+	err := nonceServ.Create(&models.RequestNonceEntity{
+		Nonce:      nonce,
+		ExpireTime: expireTime,
+		CreateTime: time.Now().Unix(),
+	}).Error
+	if translator, ok := nonceServ.Dialector.(gorm.ErrorTranslator); ok && err != nil {
+		return translator.Translate(err)
+	}
+	return err
+}
+
+func (nonceServ NonceService) DeleteExpiredNonce() (int64, error) {
+	result := nonceServ.Where("expire_time < ?", time.Now().Unix()).Delete(&models.RequestNonceEntity{})
+	return result.RowsAffected, result.Error
+}
+
+type AuditService struct {
+	*gorm.DB
+}
+
+func (auditServ AuditService) GetLastAuditLog() (*models.AuditLogEntity, error) {
+	var entry models.AuditLogEntity
+	err := auditServ.Model(&models.AuditLogEntity{}).Order("id desc").Limit(1).Find(&entry).Error
+	return &entry, err
+}
+
+func (auditServ AuditService) GetAuditLogs(tailNum int, action string) (list []models.AuditLogEntity, err error) {
+	query := auditServ.Model(&models.AuditLogEntity{})
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if tailNum > 0 {
+		query = query.Limit(tailNum)
+	}
+	err = query.Order("id desc").Find(&list).Error
+	return
+}
+
+func (auditServ AuditService) GetAllAuditLogs() (list []models.AuditLogEntity, err error) {
+	err = auditServ.Model(&models.AuditLogEntity{}).Order("id asc").Find(&list).Error
+	return
+}
+
+type ImageUsageService struct {
+	*gorm.DB
+}
+
+// TouchImage records the image is used now
+func (imageServ ImageUsageService) TouchImage(imageName string) error {
+	return imageServ.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "image_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_used_time"}),
+	}).Create(&models.ImageUsageEntity{
+		ImageName:    imageName,
+		LastUsedTime: time.Now().Unix(),
+	}).Error
+}
+
+func (imageServ ImageUsageService) GetImageUsages() (list []models.ImageUsageEntity, err error) {
+	err = imageServ.Model(&models.ImageUsageEntity{}).Find(&list).Error
+	return
+}
+
+func (imageServ ImageUsageService) DeleteImageUsage(imageNames []string) error {
+	return imageServ.Where("image_name in ?", imageNames).Delete(&models.ImageUsageEntity{}).Error
+}
+
+type JobUsageService struct {
+	*gorm.DB
+}
+
+func (usageServ JobUsageService) GetJobUsage(jobUuid string, windowStart int64) (*models.JobUsageEntity, error) {
+	var usage models.JobUsageEntity
+	err := usageServ.Model(&models.JobUsageEntity{}).Where("job_uuid=? and window_start=?", jobUuid, windowStart).Find(&usage).Error
+	return &usage, err
+}
+
+func (usageServ JobUsageService) SaveJobUsage(usage *models.JobUsageEntity) error {
+	return usageServ.Save(usage).Error
+}
+
+func (usageServ JobUsageService) GetJobUsages(jobUuid string, since int64) (list []models.JobUsageEntity, err error) {
+	err = usageServ.Model(&models.JobUsageEntity{}).Where("job_uuid=? and window_start>=?", jobUuid, since).Order("window_start").Find(&list).Error
+	return
+}
+
+func (usageServ JobUsageService) DeleteJobUsagesBefore(windowStart int64) (int64, error) {
+	result := usageServ.Where("window_start < ?", windowStart).Delete(&models.JobUsageEntity{})
+	return result.RowsAffected, result.Error
+}
+
+type CheckpointService struct {
+	*gorm.DB
+}
+
+func (cpServ CheckpointService) GetCheckpoint(kind, workKey string) (*models.CheckpointEntity, error) {
+	var checkpoint models.CheckpointEntity
+	err := cpServ.Model(&models.CheckpointEntity{}).Where("kind=? and work_key=?", kind, workKey).Find(&checkpoint).Error
+	return &checkpoint, err
+}
+
+func (cpServ CheckpointService) GetCheckpoints() (list []models.CheckpointEntity, err error) {
+	err = cpServ.Model(&models.CheckpointEntity{}).Order("create_time").Find(&list).Error
+	return
+}
+
+func (cpServ CheckpointService) SaveCheckpoint(checkpoint *models.CheckpointEntity) error {
+	return cpServ.Save(checkpoint).Error
+}
+
+func (cpServ CheckpointService) UpdateCheckpointStage(kind, workKey, stage string) error {
+	return cpServ.Model(&models.CheckpointEntity{}).Where("kind=? and work_key=?", kind, workKey).Updates(map[string]interface{}{
+		"stage":       stage,
+		"update_time": time.Now().Unix(),
+	}).Error
+}
+
+func (cpServ CheckpointService) DeleteCheckpoint(kind, workKey string) error {
+	return cpServ.Where("kind=? and work_key=?", kind, workKey).Delete(&models.CheckpointEntity{}).Error
+}
+
+type SecretService struct {
+	*gorm.DB
+}
+
+// SaveSecret creates or replaces the secret of the owner, the data is sealed before it is stored
+func (secretServ SecretService) SaveSecret(walletAddress, name string, data map[string]string) error {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	sealed, err := util.Seal(dataBytes)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	return secretServ.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "wallet_address"}, {Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"data": sealed, "update_time": now}),
+	}).Create(&models.SpaceSecretEntity{
+		WalletAddress: strings.ToLower(walletAddress),
+		Name:          name,
+		Data:          sealed,
+		CreateTime:    now,
+		UpdateTime:    now,
+	}).Error
+}
+
+// GetSecret returns the keys and values of the secret, or nil if the owner has no such secret
+func (secretServ SecretService) GetSecret(walletAddress, name string) (map[string]string, error) {
+	var secret models.SpaceSecretEntity
+	err := secretServ.Model(&models.SpaceSecretEntity{}).Where("wallet_address=? and name=?", strings.ToLower(walletAddress), name).Find(&secret).Error
+	if err != nil || secret.Id == 0 {
+		return nil, err
+	}
+	dataBytes, err := util.Unseal(secret.Data)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]string
+	if err = json.Unmarshal(dataBytes, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (secretServ SecretService) GetSecrets(walletAddress string) (list []models.SpaceSecretEntity, err error) {
+	query := secretServ.Model(&models.SpaceSecretEntity{})
+	if walletAddress != "" {
+		query = query.Where("wallet_address=?", strings.ToLower(walletAddress))
+	}
+	err = query.Order("wallet_address, name").Find(&list).Error
+	return
+}
+
+func (secretServ SecretService) DeleteSecret(walletAddress, name string) (int64, error) {
+	result := secretServ.Where("wallet_address=? and name=?", strings.ToLower(walletAddress), name).Delete(&models.SpaceSecretEntity{})
+	return result.RowsAffected, result.Error
+}
+
 var taskSet = wire.NewSet(db.NewDbService, wire.Struct(new(TaskService), "*"))
 var jobSet = wire.NewSet(db.NewDbService, wire.Struct(new(JobService), "*"))
 var cpInfoSet = wire.NewSet(db.NewDbService, wire.Struct(new(CpInfoService), "*"))
 var ecpJobSet = wire.NewSet(db.NewDbService, wire.Struct(new(EcpJobService), "*"))
+var nonceSet = wire.NewSet(db.NewDbService, wire.Struct(new(NonceService), "*"))
+var auditSet = wire.NewSet(db.NewDbService, wire.Struct(new(AuditService), "*"))
+var imageUsageSet = wire.NewSet(db.NewDbService, wire.Struct(new(ImageUsageService), "*"))
+var jobUsageSet = wire.NewSet(db.NewDbService, wire.Struct(new(JobUsageService), "*"))
+var checkpointSet = wire.NewSet(db.NewDbService, wire.Struct(new(CheckpointService), "*"))
+var secretSet = wire.NewSet(db.NewDbService, wire.Struct(new(SecretService), "*"))
@@ -0,0 +1,257 @@
+package computing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+// A gpu slice is sold as a unit of its own: a MIG profile of the mixed strategy of the nvidia device plugin,
+// or a time-sliced replica advertised as nvidia.com/gpu.shared by renameByDefault.
+const (
+	gpuSliceShared       = "shared"
+	migResourcePrefix    = "nvidia.com/mig-"
+	sharedGpuResource    = "nvidia.com/gpu.shared"
+	gpuProductLabel      = "nvidia.com/gpu.product"
+	gpuSlicePricePrefix  = "TARGET_GPU_SLICE_"
+	migComputeSliceCount = 7
+)
+
+var (
+	migProfilePattern = regexp.MustCompile(`(?i)\b(\d+)g\.\d+gb\b`)
+	sharedPattern     = regexp.MustCompile(`(?i)\bshared\b`)
+	nvidiaSmiGpu      = regexp.MustCompile(`^GPU (\d+): (.+?) \(UUID`)
+	nvidiaSmiMig      = regexp.MustCompile(`^\s+MIG (\S+)\s+Device\s+\d+: \(UUID: (MIG-[^)]+)\)`)
+)
+
+// gpuSliceResource returns the extended resource requested for a slice profile
+func gpuSliceResource(profile string) coreV1.ResourceName {
+	if strings.EqualFold(profile, gpuSliceShared) {
+		return sharedGpuResource
+	}
+	return coreV1.ResourceName(migResourcePrefix + strings.ToLower(profile))
+}
+
+// gpuSliceProfile returns the profile of an extended resource, or "" if the resource is not a gpu slice
+func gpuSliceProfile(name coreV1.ResourceName) string {
+	switch {
+	case name == sharedGpuResource:
+		return gpuSliceShared
+	case strings.HasPrefix(string(name), migResourcePrefix):
+		return strings.TrimPrefix(string(name), migResourcePrefix)
+	}
+	return ""
+}
+
+// parseGpuSlice splits a hardware name such as "NVIDIA A100 1g.10gb" or "NVIDIA 4090 shared" into the gpu model and the slice profile
+func parseGpuSlice(hardware string) (string, string) {
+	if profile := migProfilePattern.FindString(hardware); profile != "" {
+		return strings.TrimSpace(strings.Replace(hardware, profile, "", 1)), strings.ToLower(profile)
+	}
+	if sharedPattern.MatchString(hardware) {
+		return strings.TrimSpace(sharedPattern.ReplaceAllString(hardware, "")), gpuSliceShared
+	}
+	return hardware, ""
+}
+
+// spaceGpuSlice returns the gpu model and the slice profile of the hardware of a space
+func spaceGpuSlice(hardware models.SpaceHardware) (string, string) {
+	if hardware.GpuSlice != "" {
+		return hardware.Hardware, strings.ToLower(hardware.GpuSlice)
+	}
+	return parseGpuSlice(hardware.Hardware)
+}
+
+func gpuSlicesInPod(pod *coreV1.Pod) map[coreV1.ResourceName]int64 {
+	slices := make(map[coreV1.ResourceName]int64)
+	for _, c := range pod.Spec.Containers {
+		for name, quantity := range c.Resources.Requests {
+			if gpuSliceProfile(name) != "" {
+				slices[name] += quantity.Value()
+			}
+		}
+	}
+	return slices
+}
+
+// nodeGpuSlices returns the gpu slices advertised by the node, and how many of them are not requested by the pods
+func nodeGpuSlices(node *coreV1.Node, activePods []coreV1.Pod) []models.GpuSlice {
+	used := make(map[coreV1.ResourceName]int64)
+	for _, pod := range getPodsFromNode(activePods, node) {
+		for name, count := range gpuSlicesInPod(&pod) {
+			used[name] += count
+		}
+	}
+
+	var slices []models.GpuSlice
+	for name, quantity := range node.Status.Allocatable {
+		profile := gpuSliceProfile(name)
+		if profile == "" || quantity.Value() == 0 {
+			continue
+		}
+		slices = append(slices, models.GpuSlice{
+			ProductName: node.Labels[gpuProductLabel],
+			Resource:    string(name),
+			Profile:     profile,
+			Total:       quantity.Value(),
+			Available:   max(quantity.Value()-used[name], 0),
+		})
+	}
+	return slices
+}
+
+// availableGpuSlices is how many slices of the profile the node can still provide, the gpu model is matched by the product label
+func availableGpuSlices(node *coreV1.Node, activePods []coreV1.Pod, gpuModel, profile string) int64 {
+	gpuName := normalizeGpuName(strings.ReplaceAll(gpuModel, "NVIDIA", ""))
+	for _, slice := range nodeGpuSlices(node, activePods) {
+		if slice.Profile != profile {
+			continue
+		}
+		if gpuName == "" || strings.Contains(normalizeGpuName(slice.ProductName), gpuName) {
+			return slice.Available
+		}
+	}
+	return 0
+}
+
+// gpuSliceFraction is the part of a whole gpu a slice stands for, it prices the slices without a configured price.
+// A MIG profile takes n of the 7 compute slices of a gpu, a time-sliced replica is priced as a whole gpu since its share is unknown.
+func gpuSliceFraction(profile string) float64 {
+	if matches := migProfilePattern.FindStringSubmatch(profile); matches != nil {
+		var computeSlices float64
+		fmt.Sscanf(matches[1], "%g", &computeSlices)
+		return min(computeSlices/migComputeSliceCount, 1)
+	}
+	return 1
+}
+
+func gpuSlicePriceKey(profile string) string {
+	return gpuSlicePricePrefix + strings.ToUpper(strings.ReplaceAll(profile, ".", "_"))
+}
+
+// gpuSlicePrice returns the price of one slice of the profile in SWAN an hour
+func gpuSlicePrice(priceConfig HardwarePrice, profile string) (float64, error) {
+	if price, ok := priceConfig.GpusPrice[gpuSlicePriceKey(profile)]; ok && price != "" {
+		return parsePrice(price)
+	}
+	gpuPrice, err := parsePrice(priceConfig.TARGET_GPU_DEFAULT)
+	if err != nil {
+		return 0, err
+	}
+	return gpuPrice * gpuSliceFraction(profile), nil
+}
+
+// migDevice is a MIG device of a gpu on this host, docker takes its uuid as the device id
+type migDevice struct {
+	productName string
+	profile     string
+	uuid        string
+}
+
+func listMigDevices() ([]migDevice, error) {
+	output, err := exec.Command("nvidia-smi", "-L").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gpus by nvidia-smi, error: %v", err)
+	}
+	return parseMigDevices(output), nil
+}
+
+// parseMigDevices reads the MIG devices from the output of nvidia-smi -L, each one follows the line of its gpu
+func parseMigDevices(output []byte) []migDevice {
+	var devices []migDevice
+	var productName string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if matches := nvidiaSmiGpu.FindStringSubmatch(line); matches != nil {
+			productName = matches[2]
+		} else if matches = nvidiaSmiMig.FindStringSubmatch(line); matches != nil {
+			devices = append(devices, migDevice{productName: productName, profile: strings.ToLower(matches[1]), uuid: matches[2]})
+		}
+	}
+	return devices
+}
+
+// dockerGpuSlices returns the MIG devices of this host by profile, time-slicing is not sold in the docker mode
+func dockerGpuSlices() []models.GpuSlice {
+	devices, err := listMigDevices()
+	if err != nil {
+		return nil
+	}
+	used := usedDockerDevices()
+
+	index := make(map[string]int)
+	var slices []models.GpuSlice
+	for _, device := range devices {
+		key := device.productName + "/" + device.profile
+		i, ok := index[key]
+		if !ok {
+			i = len(slices)
+			index[key] = i
+			slices = append(slices, models.GpuSlice{
+				ProductName: device.productName,
+				Resource:    migResourcePrefix + device.profile,
+				Profile:     device.profile,
+			})
+		}
+		slices[i].Total++
+		if !used[device.uuid] {
+			slices[i].Available++
+		}
+	}
+	return slices
+}
+
+// availableMigDevices returns the uuids of the MIG devices of the profile which no running container uses
+func availableMigDevices(gpuModel, profile string) ([]string, error) {
+	if profile == gpuSliceShared {
+		return nil, fmt.Errorf("time-sliced gpus are only sold in the kubernetes mode")
+	}
+	devices, err := listMigDevices()
+	if err != nil {
+		return nil, err
+	}
+	used := usedDockerDevices()
+	gpuName := normalizeGpuName(strings.ReplaceAll(gpuModel, "NVIDIA", ""))
+
+	var uuids []string
+	for _, device := range devices {
+		if device.profile != profile || used[device.uuid] {
+			continue
+		}
+		if gpuName == "" || strings.Contains(normalizeGpuName(device.productName), gpuName) {
+			uuids = append(uuids, device.uuid)
+		}
+	}
+	return uuids, nil
+}
+
+// usedDockerDevices returns the gpu device ids requested by the running containers
+func usedDockerDevices() map[string]bool {
+	used := make(map[string]bool)
+	dockerService := NewDockerService()
+	containers, err := dockerService.c.ContainerList(context.Background(), container.ListOptions{})
+	if err != nil {
+		return used
+	}
+	for _, c := range containers {
+		inspect, err := dockerService.c.ContainerInspect(context.Background(), c.ID)
+		if err != nil || inspect.HostConfig == nil {
+			continue
+		}
+		for _, request := range inspect.HostConfig.DeviceRequests {
+			for _, id := range request.DeviceIDs {
+				used[id] = true
+			}
+		}
+	}
+	return used
+}
@@ -0,0 +1,144 @@
+package computing
+
+import (
+	"math"
+	"testing"
+
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseGpuSlice(t *testing.T) {
+	tests := []struct {
+		hardware string
+		model    string
+		profile  string
+	}{
+		{"NVIDIA A100 1g.10gb", "NVIDIA A100", "1g.10gb"},
+		{"NVIDIA A100 3G.40GB", "NVIDIA A100", "3g.40gb"},
+		{"NVIDIA 4090 shared", "NVIDIA 4090", gpuSliceShared},
+		{"NVIDIA 4090", "NVIDIA 4090", ""},
+		{"NVIDIA A100-SXM4-40GB", "NVIDIA A100-SXM4-40GB", ""},
+	}
+	for _, tt := range tests {
+		model, profile := parseGpuSlice(tt.hardware)
+		if model != tt.model || profile != tt.profile {
+			t.Errorf("parseGpuSlice(%s) = %q, %q, want %q, %q", tt.hardware, model, profile, tt.model, tt.profile)
+		}
+	}
+}
+
+func TestGpuSliceResource(t *testing.T) {
+	tests := []struct {
+		profile  string
+		resource coreV1.ResourceName
+	}{
+		{"1g.10gb", "nvidia.com/mig-1g.10gb"},
+		{"2G.20GB", "nvidia.com/mig-2g.20gb"},
+		{"shared", sharedGpuResource},
+		{"SHARED", sharedGpuResource},
+	}
+	for _, tt := range tests {
+		name := gpuSliceResource(tt.profile)
+		if name != tt.resource {
+			t.Errorf("gpuSliceResource(%s) = %s, want %s", tt.profile, name, tt.resource)
+		}
+		if profile := gpuSliceProfile(name); profile != gpuSliceProfile(tt.resource) || profile == "" {
+			t.Errorf("gpuSliceProfile(%s) = %q", name, profile)
+		}
+	}
+	if profile := gpuSliceProfile("nvidia.com/gpu"); profile != "" {
+		t.Errorf("gpuSliceProfile(nvidia.com/gpu) = %q, want none", profile)
+	}
+}
+
+func TestGpuSlicePrice(t *testing.T) {
+	priceConfig := HardwarePrice{
+		TARGET_GPU_DEFAULT: "1.4",
+		GpusPrice:          map[string]string{"TARGET_GPU_SLICE_2G_20GB": "0.5", "TARGET_GPU_SLICE_3G_40GB": ""},
+	}
+	tests := []struct {
+		profile string
+		want    float64
+	}{
+		{"1g.10gb", 0.2},
+		{"2g.20gb", 0.5},
+		{"3g.40gb", 0.6},
+		{"7g.80gb", 1.4},
+		{gpuSliceShared, 1.4},
+	}
+	for _, tt := range tests {
+		got, err := gpuSlicePrice(priceConfig, tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("gpuSlicePrice(%s) = %v, want %v", tt.profile, got, tt.want)
+		}
+	}
+	if _, err := gpuSlicePrice(HardwarePrice{TARGET_GPU_DEFAULT: "free"}, "1g.10gb"); err == nil {
+		t.Error("gpuSlicePrice() with an invalid default price should fail")
+	}
+}
+
+func TestAvailableGpuSlices(t *testing.T) {
+	node := &coreV1.Node{
+		ObjectMeta: metaV1.ObjectMeta{Name: "node-1", Labels: map[string]string{gpuProductLabel: "NVIDIA-A100-SXM4-40GB"}},
+		Status: coreV1.NodeStatus{Allocatable: coreV1.ResourceList{
+			"nvidia.com/mig-1g.5gb":  *resource.NewQuantity(7, resource.DecimalSI),
+			"nvidia.com/mig-3g.20gb": *resource.NewQuantity(0, resource.DecimalSI),
+			"nvidia.com/gpu":         *resource.NewQuantity(1, resource.DecimalSI),
+		}},
+	}
+	slicePod := func(nodeName string, count int64) coreV1.Pod {
+		return coreV1.Pod{Spec: coreV1.PodSpec{
+			NodeName: nodeName,
+			Containers: []coreV1.Container{{Resources: coreV1.ResourceRequirements{Requests: coreV1.ResourceList{
+				"nvidia.com/mig-1g.5gb": *resource.NewQuantity(count, resource.DecimalSI),
+			}}}},
+		}}
+	}
+	pods := []coreV1.Pod{slicePod("node-1", 2), slicePod("node-1", 1), slicePod("node-2", 3)}
+
+	tests := []struct {
+		gpuModel string
+		profile  string
+		want     int64
+	}{
+		{"NVIDIA A100", "1g.5gb", 4},
+		{"", "1g.5gb", 4},
+		{"NVIDIA H100", "1g.5gb", 0},
+		{"NVIDIA A100", "3g.20gb", 0},
+		{"NVIDIA A100", gpuSliceShared, 0},
+	}
+	for _, tt := range tests {
+		if got := availableGpuSlices(node, pods, tt.gpuModel, tt.profile); got != tt.want {
+			t.Errorf("availableGpuSlices(%q, %s) = %d, want %d", tt.gpuModel, tt.profile, got, tt.want)
+		}
+	}
+}
+
+func TestParseMigDevices(t *testing.T) {
+	output := `GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-5c89852c-d268-c3f3-1b07-005d5ae1dc3f)
+  MIG 1g.5gb      Device  0: (UUID: MIG-c6d4f1ef-42e4-5de3-91c7-45d71c87eb3f)
+  MIG 3g.20gb     Device  1: (UUID: MIG-cba663e8-9bed-5b25-b243-5985ef7c9beb)
+GPU 1: NVIDIA A100-SXM4-80GB (UUID: GPU-1d4d0f3e-d2c6-4cc6-c7c4-b0a5d4a1b0a9)
+GPU 2: NVIDIA H100 80GB HBM3 (UUID: GPU-8b6f1a3e-0c6e-4f3b-9a0b-5b1d6e1e7c2d)
+  MIG 1G.10GB     Device  0: (UUID: MIG-0e6a7a5e-3f3c-5c1d-8f2e-7d9b3c1a2b4e)
+`
+	devices := parseMigDevices([]byte(output))
+	want := []migDevice{
+		{"NVIDIA A100-SXM4-40GB", "1g.5gb", "MIG-c6d4f1ef-42e4-5de3-91c7-45d71c87eb3f"},
+		{"NVIDIA A100-SXM4-40GB", "3g.20gb", "MIG-cba663e8-9bed-5b25-b243-5985ef7c9beb"},
+		{"NVIDIA H100 80GB HBM3", "1g.10gb", "MIG-0e6a7a5e-3f3c-5c1d-8f2e-7d9b3c1a2b4e"},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("parseMigDevices() = %v, want %v", devices, want)
+	}
+	for i := range want {
+		if devices[i] != want[i] {
+			t.Errorf("device %d = %+v, want %+v", i, devices[i], want[i])
+		}
+	}
+}
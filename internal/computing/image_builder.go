@@ -0,0 +1,430 @@
+package computing
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	batchV1 "k8s.io/api/batch/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	builderRegistrySecret = "cp-builder-registry"
+	builderWorkspace      = "/workspace"
+	builderReadyFile      = builderWorkspace + "/.context-ready"
+	builderContainerName  = "builder"
+	contextContainerName  = "context"
+
+	defaultKanikoImage   = "gcr.io/kaniko-project/executor:v1.23.2"
+	defaultBuildkitImage = "moby/buildkit:v0.16.0-rootless"
+	builderHelperImage   = "busybox:1.36"
+)
+
+// activeBuilds holds the jobs whose image is being built, the build log of them is followed until the build ends
+var activeBuilds sync.Map
+
+var invalidTagChars = regexp.MustCompile(`[^a-z0-9_.-]`)
+
+// buildImage builds the Dockerfile under buildPath with the configured builder, the build log is written to build.log of buildPath
+func buildImage(jobUuid, spaceName, buildPath, dockerfilePath, imageName string) error {
+	builder := conf.GetConfig().Builder
+	ctx, cancel := context.WithTimeout(context.Background(), builder.GetTimeout())
+	defer cancel()
+
+	logPath := filepath.Join(buildPath, BuildFileName)
+	os.Remove(logPath)
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return err
+	}
+	logFile.Close()
+
+	activeBuilds.Store(jobUuid, struct{}{})
+	defer activeBuilds.Delete(jobUuid)
+
+	if !builder.InCluster() {
+		if err = NewDockerService().BuildImage(ctx, buildPath, imageName); err == nil {
+			touchImage(imageName)
+		}
+	} else {
+		err = buildImageInCluster(ctx, jobUuid, spaceName, buildPath, dockerfilePath, imageName)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("the build exceeded the timeout of %s", builder.GetTimeout())
+	}
+	return err
+}
+
+// buildImageInCluster runs kaniko or buildkit as a job, the build context is streamed into the pod by its init container,
+// the image and the build cache are pushed to the registry.
+func buildImageInCluster(ctx context.Context, jobUuid, spaceName, buildPath, dockerfilePath, imageName string) error {
+	builder := conf.GetConfig().Builder
+	namespace := builder.GetNamespace()
+	k8sService := NewK8sService()
+
+	if _, err := k8sService.GetNameSpace(ctx, namespace, metaV1.GetOptions{}); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if _, err = k8sService.CreateNameSpace(ctx, &coreV1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: namespace}}, metaV1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create namespace %s, error: %v", namespace, err)
+		}
+	}
+	if err := applyBuilderRegistrySecret(ctx, namespace); err != nil {
+		return fmt.Errorf("failed to apply the registry secret, error: %v", err)
+	}
+
+	dockerfileName, err := filepath.Rel(buildPath, dockerfilePath)
+	if err != nil {
+		return err
+	}
+	jobName := strings.ToLower(fmt.Sprintf("build-%s-%d", jobUuid, time.Now().Unix()))
+	job := newBuildJob(jobName, jobUuid, builder, dockerfileName, imageName, buildCacheRef(builder, spaceName))
+	if _, err = k8sService.CreateBatchJob(ctx, namespace, job); err != nil {
+		return fmt.Errorf("failed to create build job, error: %v", err)
+	}
+	defer func() {
+		if err := k8sService.DeleteBatchJob(context.TODO(), namespace, jobName); err != nil && !errors.IsNotFound(err) {
+			logs.GetLogger().Errorf("failed to delete build job %s, error: %v", jobName, err)
+		}
+	}()
+
+	pod, err := waitForBuildPod(ctx, namespace, jobName, func(pod coreV1.Pod) bool {
+		statuses := pod.Status.InitContainerStatuses
+		return len(statuses) > 0 && statuses[0].State.Running != nil
+	})
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(tarBuildContext(buildPath, writer))
+	}()
+	extract := []string{"sh", "-c", fmt.Sprintf("tar -xzf - -C %s && touch %s", builderWorkspace, builderReadyFile)}
+	if err = k8sService.ExecWithStdin(ctx, namespace, pod.Name, contextContainerName, extract, reader); err != nil {
+		return fmt.Errorf("failed to upload the build context, error: %v", err)
+	}
+
+	pod, err = waitForBuildPod(ctx, namespace, jobName, func(pod coreV1.Pod) bool {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == builderContainerName {
+				return status.State.Running != nil || status.State.Terminated != nil
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if err = streamBuildLog(ctx, namespace, pod.Name, filepath.Join(buildPath, BuildFileName)); err != nil {
+		logs.GetLogger().Warnf("failed to stream the build log, job_uuid: %s, error: %v", jobUuid, err)
+	}
+
+	pod, err = waitForBuildPod(ctx, namespace, jobName, func(pod coreV1.Pod) bool {
+		return pod.Status.Phase == coreV1.PodSucceeded || pod.Status.Phase == coreV1.PodFailed
+	})
+	if err != nil {
+		return err
+	}
+	if pod.Status.Phase == coreV1.PodFailed {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == builderContainerName && status.State.Terminated != nil {
+				return fmt.Errorf("the build failed, exit code: %d, reason: %s", status.State.Terminated.ExitCode, status.State.Terminated.Reason)
+			}
+		}
+		return fmt.Errorf("the build failed, reason: %s", pod.Status.Reason)
+	}
+	return nil
+}
+
+func newBuildJob(jobName, jobUuid string, builder conf.Builder, dockerfileName, imageName, cacheRef string) *batchV1.Job {
+	backoffLimit := int32(0)
+	ttlSeconds := int32(600)
+	deadlineSeconds := int64(builder.GetTimeout().Seconds())
+	labels := map[string]string{"cp_build": jobUuid}
+
+	volumes := []coreV1.Volume{
+		{
+			Name:         "workspace",
+			VolumeSource: coreV1.VolumeSource{EmptyDir: &coreV1.EmptyDirVolumeSource{}},
+		},
+		{
+			Name: "docker-config",
+			VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{
+				SecretName: builderRegistrySecret,
+				Items:      []coreV1.KeyToPath{{Key: coreV1.DockerConfigJsonKey, Path: "config.json"}},
+			}},
+		},
+	}
+
+	var container coreV1.Container
+	switch builder.GetMode() {
+	case conf.BuilderModeBuildkit:
+		volumes = append(volumes, coreV1.Volume{
+			Name:         "buildkitd",
+			VolumeSource: coreV1.VolumeSource{EmptyDir: &coreV1.EmptyDirVolumeSource{}},
+		})
+		uid := int64(1000)
+		container = coreV1.Container{
+			Image:   defaultBuildkitImage,
+			Command: []string{"buildctl-daemonless.sh"},
+			Args: []string{
+				"build",
+				"--frontend", "dockerfile.v0",
+				"--local", "context=" + builderWorkspace,
+				"--local", "dockerfile=" + filepath.Join(builderWorkspace, filepath.Dir(dockerfileName)),
+				"--opt", "filename=" + filepath.Base(dockerfileName),
+				"--output", fmt.Sprintf("type=image,name=%s,push=true", imageName),
+				"--export-cache", fmt.Sprintf("type=registry,ref=%s,mode=max", cacheRef),
+				"--import-cache", fmt.Sprintf("type=registry,ref=%s", cacheRef),
+			},
+			Env: []coreV1.EnvVar{
+				{Name: "BUILDKITD_FLAGS", Value: "--oci-worker-no-process-sandbox"},
+				{Name: "DOCKER_CONFIG", Value: "/home/user/.docker"},
+			},
+			SecurityContext: &coreV1.SecurityContext{
+				RunAsUser:       &uid,
+				RunAsGroup:      &uid,
+				SeccompProfile:  &coreV1.SeccompProfile{Type: coreV1.SeccompProfileTypeUnconfined},
+				AppArmorProfile: &coreV1.AppArmorProfile{Type: coreV1.AppArmorProfileTypeUnconfined},
+			},
+			VolumeMounts: []coreV1.VolumeMount{
+				{Name: "workspace", MountPath: builderWorkspace},
+				{Name: "docker-config", MountPath: "/home/user/.docker"},
+				{Name: "buildkitd", MountPath: "/home/user/.local/share/buildkit"},
+			},
+		}
+	default:
+		container = coreV1.Container{
+			Image: defaultKanikoImage,
+			Args: []string{
+				"--context=dir://" + builderWorkspace,
+				"--dockerfile=" + filepath.Join(builderWorkspace, dockerfileName),
+				"--destination=" + imageName,
+				"--cache=true",
+				"--cache-repo=" + cacheRef,
+			},
+			VolumeMounts: []coreV1.VolumeMount{
+				{Name: "workspace", MountPath: builderWorkspace},
+				{Name: "docker-config", MountPath: "/kaniko/.docker"},
+			},
+		}
+	}
+	container.Name = builderContainerName
+	if builder.Image != "" {
+		container.Image = builder.Image
+	}
+
+	return &batchV1.Job{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   jobName,
+			Labels: labels,
+		},
+		Spec: batchV1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   &deadlineSeconds,
+			TTLSecondsAfterFinished: &ttlSeconds,
+			Template: coreV1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+				Spec: coreV1.PodSpec{
+					RestartPolicy: coreV1.RestartPolicyNever,
+					InitContainers: []coreV1.Container{
+						{
+							Name:         contextContainerName,
+							Image:        builderHelperImage,
+							Command:      []string{"sh", "-c", fmt.Sprintf("until [ -f %s ]; do sleep 1; done; rm %s", builderReadyFile, builderReadyFile)},
+							VolumeMounts: []coreV1.VolumeMount{{Name: "workspace", MountPath: builderWorkspace}},
+						},
+					},
+					Containers: []coreV1.Container{container},
+					Volumes:    volumes,
+				},
+			},
+		},
+	}
+}
+
+// buildCacheRef is the cache of a space, kaniko takes a repository while buildkit takes a reference
+func buildCacheRef(builder conf.Builder, spaceName string) string {
+	cacheRepo := builder.GetCacheRepo(conf.GetConfig().Registry.ServerAddress)
+	if builder.GetMode() == conf.BuilderModeBuildkit {
+		return cacheRepo + ":" + invalidTagChars.ReplaceAllString(strings.ToLower(spaceName), "-")
+	}
+	return cacheRepo
+}
+
+func applyBuilderRegistrySecret(ctx context.Context, namespace string) error {
+	registry := conf.GetConfig().Registry
+	server := strings.Split(strings.TrimSpace(registry.ServerAddress), "/")[0]
+	auths := map[string]interface{}{}
+	if registry.UserName != "" {
+		auths[server] = map[string]string{
+			"auth": base64.StdEncoding.EncodeToString([]byte(registry.UserName + ":" + registry.Password)),
+		}
+	}
+	dockerConfig, err := json.Marshal(map[string]interface{}{"auths": auths})
+	if err != nil {
+		return err
+	}
+
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: builderRegistrySecret},
+		Type:       coreV1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{coreV1.DockerConfigJsonKey: dockerConfig},
+	}
+	secrets := NewK8sService().k8sClient.CoreV1().Secrets(namespace)
+	if _, err = secrets.Create(ctx, secret, metaV1.CreateOptions{}); errors.IsAlreadyExists(err) {
+		_, err = secrets.Update(ctx, secret, metaV1.UpdateOptions{})
+	}
+	return err
+}
+
+func waitForBuildPod(ctx context.Context, namespace, jobName string, ready func(pod coreV1.Pod) bool) (*coreV1.Pod, error) {
+	k8sService := NewK8sService()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		pods, err := k8sService.k8sClient.CoreV1().Pods(namespace).List(ctx, metaV1.ListOptions{
+			LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods.Items {
+			if ready(pod) {
+				return &pod, nil
+			}
+			if err = buildPodFailure(pod); err != nil {
+				return &pod, err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// buildPodFailure returns why the build pod can not go on, e.g. the context container failed or its image can not be
+// pulled, so the build does not wait for its timeout
+func buildPodFailure(pod coreV1.Pod) error {
+	statuses := append(append([]coreV1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return fmt.Errorf("the container %s of the build pod failed, exit code: %d, reason: %s, %s", status.Name, terminated.ExitCode, terminated.Reason, terminated.Message)
+		}
+		if waiting := status.State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError":
+				return fmt.Errorf("the container %s of the build pod can not start, reason: %s, %s", status.Name, waiting.Reason, waiting.Message)
+			}
+		}
+	}
+	if pod.Status.Phase == coreV1.PodFailed {
+		return fmt.Errorf("the build pod failed, reason: %s, %s", pod.Status.Reason, pod.Status.Message)
+	}
+	return nil
+}
+
+func streamBuildLog(ctx context.Context, namespace, podName, logPath string) error {
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	podLogs, err := NewK8sService().k8sClient.CoreV1().Pods(namespace).GetLogs(podName, &coreV1.PodLogOptions{
+		Container: builderContainerName,
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer podLogs.Close()
+
+	_, err = io.Copy(logFile, podLogs)
+	return err
+}
+
+// tarBuildContext writes the build context as a gzipped tar, the build log is left out
+func tarBuildContext(buildPath string, w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err := filepath.Walk(buildPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(buildPath, path)
+		if err != nil || relPath == "." || relPath == BuildFileName {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(tw, file)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// buildLogReader reads the build log of a job, and waits for more lines while the image of the job is being built
+type buildLogReader struct {
+	file    *os.File
+	jobUuid string
+}
+
+func (r *buildLogReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if _, building := activeBuilds.Load(r.jobUuid); !building {
+			return 0, io.EOF
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,282 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"syscall"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/build"
+	"github.com/swanchain/go-computing-provider/conf"
+	appV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// prePullDaemonSet pulls the images of ImageCache.PrePull on every node of a k8s cluster
+const prePullDaemonSet = "image-prepull"
+
+// ImageCacheManager evicts the least recently used images of docker when its disk is filling up,
+// the images of UBI tasks, the resource exporter and the configured ones are protected.
+type ImageCacheManager struct {
+	ds *DockerService
+}
+
+func NewImageCacheManager() *ImageCacheManager {
+	return &ImageCacheManager{ds: NewDockerService()}
+}
+
+// touchImage records the last use of the image, which decides the order of eviction
+func touchImage(imageName string) {
+	if err := NewImageUsageService().TouchImage(normalizeImageName(imageName)); err != nil {
+		logs.GetLogger().Warnf("failed to record the use of image %s, error: %v", imageName, err)
+	}
+}
+
+func normalizeImageName(imageName string) string {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return imageName
+	}
+	return reference.FamiliarString(reference.TagNameOnly(named))
+}
+
+func (m *ImageCacheManager) protectedImages() map[string]bool {
+	cacheConf := conf.GetConfig().ImageCache
+	protected := make(map[string]bool)
+	for _, imageName := range []string{
+		build.UBITaskImageIntelCpu,
+		build.UBITaskImageIntelGpu,
+		build.UBITaskImageAmdCpu,
+		build.UBITaskImageAmdGpu,
+		build.UBIResourceExporterDockerImage,
+	} {
+		protected[normalizeImageName(imageName)] = true
+	}
+	for _, imageName := range append(append([]string{}, cacheConf.Pinned...), cacheConf.PrePull...) {
+		protected[normalizeImageName(imageName)] = true
+	}
+	return protected
+}
+
+// PrePull pulls the configured images which are not on this host yet, the ecp runs the jobs on this host
+func (m *ImageCacheManager) PrePull() {
+	for _, imageName := range conf.GetConfig().ImageCache.PrePull {
+		if err := m.ds.PullImage(imageName); err != nil {
+			logs.GetLogger().Errorf("failed to pre-pull image %s, error: %v", imageName, err)
+		}
+	}
+}
+
+// PrePullOnNodes pulls the configured images on every node of the k8s clusters, the jobs run on the nodes and not on this host.
+// Every image is an init container of a daemonset, it runs a static busybox copied from the first one, so an image without shell is pulled as well.
+func (m *ImageCacheManager) PrePullOnNodes() {
+	images := conf.GetConfig().ImageCache.PrePull
+	for _, k8sService := range K8sServices() {
+		if err := applyPrePullDaemonSet(k8sService, images); err != nil {
+			logs.GetLogger().Errorf("failed to pre-pull images on the nodes of cluster %s, error: %v", k8sService.Cluster, err)
+		}
+	}
+}
+
+func applyPrePullDaemonSet(k8sService *K8sService, images []string) error {
+	daemonSets := k8sService.k8sClient.AppsV1().DaemonSets(metaV1.NamespaceSystem)
+	if len(images) == 0 {
+		if err := daemonSets.Delete(context.TODO(), prePullDaemonSet, metaV1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	toolVolume := coreV1.VolumeMount{Name: "prepull-tool", MountPath: "/prepull"}
+	initContainers := []coreV1.Container{
+		{
+			Name:         "prepull-tool",
+			Image:        builderHelperImage,
+			Command:      []string{"cp", "/bin/busybox", "/prepull/busybox"},
+			VolumeMounts: []coreV1.VolumeMount{toolVolume},
+		},
+	}
+	for i, imageName := range images {
+		initContainers = append(initContainers, coreV1.Container{
+			Name:            fmt.Sprintf("prepull-%d", i),
+			Image:           imageName,
+			ImagePullPolicy: coreV1.PullIfNotPresent,
+			Command:         []string{"/prepull/busybox", "true"},
+			VolumeMounts:    []coreV1.VolumeMount{toolVolume},
+		})
+	}
+	labels := map[string]string{"app": prePullDaemonSet}
+	daemonSet := &appV1.DaemonSet{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      prePullDaemonSet,
+			Namespace: metaV1.NamespaceSystem,
+			Labels:    labels,
+		},
+		Spec: appV1.DaemonSetSpec{
+			Selector: &metaV1.LabelSelector{MatchLabels: labels},
+			Template: coreV1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+				Spec: coreV1.PodSpec{
+					InitContainers: initContainers,
+					Containers: []coreV1.Container{
+						{
+							Name:    "pause",
+							Image:   builderHelperImage,
+							Command: []string{"sleep", "2147483647"},
+							Resources: coreV1.ResourceRequirements{
+								Requests: coreV1.ResourceList{
+									coreV1.ResourceCPU:    resource.MustParse("1m"),
+									coreV1.ResourceMemory: resource.MustParse("8Mi"),
+								},
+								Limits: coreV1.ResourceList{
+									coreV1.ResourceCPU:    resource.MustParse("10m"),
+									coreV1.ResourceMemory: resource.MustParse("16Mi"),
+								},
+							},
+						},
+					},
+					Volumes: []coreV1.Volume{
+						{
+							Name:         toolVolume.Name,
+							VolumeSource: coreV1.VolumeSource{EmptyDir: &coreV1.EmptyDirVolumeSource{}},
+						},
+					},
+					Tolerations: []coreV1.Toleration{{Operator: coreV1.TolerationOpExists}},
+				},
+			},
+		},
+	}
+
+	current, err := daemonSets.Get(context.TODO(), prePullDaemonSet, metaV1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = daemonSets.Create(context.TODO(), daemonSet, metaV1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	current.Spec.Template = daemonSet.Spec.Template
+	_, err = daemonSets.Update(context.TODO(), current, metaV1.UpdateOptions{})
+	return err
+}
+
+// Evict removes the least recently used images until the disk usage of docker is below the low watermark,
+// it does nothing until the usage reaches the high watermark.
+func (m *ImageCacheManager) Evict() error {
+	cacheConf := conf.GetConfig().ImageCache
+	info, err := m.ds.c.Info(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get docker info, error: %v", err)
+	}
+	usage, err := diskUsagePercent(info.DockerRootDir)
+	if err != nil {
+		return err
+	}
+	if usage < cacheConf.GetHighWatermark() {
+		return nil
+	}
+	logs.GetLogger().Infof("the disk usage of docker is %.1f%%, start to evict images", usage)
+
+	containers, err := m.ds.c.ContainerList(context.Background(), container.ListOptions{All: true})
+	if err != nil {
+		return fmt.Errorf("failed to list containers, error: %v", err)
+	}
+	inUse := make(map[string]bool)
+	for _, c := range containers {
+		inUse[c.ImageID] = true
+		if c.State == "running" {
+			touchImage(c.Image)
+		}
+	}
+
+	usages, err := NewImageUsageService().GetImageUsages()
+	if err != nil {
+		return fmt.Errorf("failed to get image usages, error: %v", err)
+	}
+	lastUsed := make(map[string]int64)
+	for _, u := range usages {
+		lastUsed[u.ImageName] = u.LastUsedTime
+	}
+
+	images, err := m.ds.c.ImageList(context.Background(), image.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list images, error: %v", err)
+	}
+	protected := m.protectedImages()
+	type candidate struct {
+		id       string
+		names    []string
+		lastUsed int64
+	}
+	var candidates []candidate
+	for _, img := range images {
+		if inUse[img.ID] {
+			continue
+		}
+		c := candidate{id: img.ID, lastUsed: img.Created}
+		isProtected := false
+		for _, name := range append(append([]string{}, img.RepoTags...), img.RepoDigests...) {
+			name = normalizeImageName(name)
+			if protected[name] {
+				isProtected = true
+				break
+			}
+			c.names = append(c.names, name)
+			if used, ok := lastUsed[name]; ok && used > c.lastUsed {
+				c.lastUsed = used
+			}
+		}
+		if !isProtected {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed < candidates[j].lastUsed
+	})
+
+	for _, c := range candidates {
+		if usage < cacheConf.GetLowWatermark() {
+			break
+		}
+		if _, err = m.ds.c.ImageRemove(context.Background(), c.id, image.RemoveOptions{
+			Force:         true,
+			PruneChildren: true,
+		}); err != nil {
+			logs.GetLogger().Warnf("failed to evict image %v, error: %v", c.names, err)
+			continue
+		}
+		logs.GetLogger().Infof("evicted image %v, last used at %d", c.names, c.lastUsed)
+		if err = NewImageUsageService().DeleteImageUsage(c.names); err != nil {
+			logs.GetLogger().Warnf("failed to delete the usage of image %v, error: %v", c.names, err)
+		}
+		if usage, err = diskUsagePercent(info.DockerRootDir); err != nil {
+			return err
+		}
+	}
+
+	danglingFilters := filters.NewArgs()
+	danglingFilters.Add("dangling", "true")
+	m.ds.c.ImagesPrune(context.Background(), danglingFilters)
+	return nil
+}
+
+func diskUsagePercent(path string) (float64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("failed to get the disk usage of %s, error: %v", path, err)
+	}
+	total := stat.Blocks * uint64(stat.Bsize)
+	if total == 0 {
+		return 0, nil
+	}
+	free := stat.Bavail * uint64(stat.Bsize)
+	return float64(total-free) / float64(total) * 100, nil
+}
@@ -0,0 +1,347 @@
+package computing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/yaml"
+)
+
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOciManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOciIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// ImagePolicyError is returned when an image violates the image policy
+type ImagePolicyError struct {
+	Image  string
+	Reason string
+}
+
+func (e *ImagePolicyError) Error() string {
+	return fmt.Sprintf("image %s is not allowed: %s", e.Image, e.Reason)
+}
+
+// CheckImagePolicy checks the image against the configured policy, and returns the image pinned to the digest of its manifest.
+// The image is returned as it is when the policy is not enabled.
+func CheckImagePolicy(ctx context.Context, image string) (string, error) {
+	policy := conf.GetConfig().ImagePolicy
+	if !policy.Enable {
+		return image, nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(image))
+	if err != nil {
+		return "", &ImagePolicyError{Image: image, Reason: fmt.Sprintf("invalid reference: %v", err)}
+	}
+	named = reference.TagNameOnly(named)
+
+	if pattern, matched := matchRegistry(policy.BlockedRegistries, named); matched {
+		return "", &ImagePolicyError{Image: image, Reason: fmt.Sprintf("the registry is blocked by %s", pattern)}
+	}
+	if len(policy.AllowedRegistries) > 0 {
+		if _, matched := matchRegistry(policy.AllowedRegistries, named); !matched {
+			return "", &ImagePolicyError{Image: image, Reason: "the registry is not in the allowed registries"}
+		}
+	}
+
+	digest, size, err := resolveImageManifest(ctx, named)
+	if err != nil {
+		return "", &ImagePolicyError{Image: image, Reason: fmt.Sprintf("failed to resolve the digest: %v", err)}
+	}
+	if policy.MaxImageSizeGB > 0 && float64(size) > policy.MaxImageSizeGB*1024*1024*1024 {
+		return "", &ImagePolicyError{Image: image, Reason: fmt.Sprintf("the size %.2fGB exceeds the max size %.2fGB", float64(size)/1024/1024/1024, policy.MaxImageSizeGB)}
+	}
+
+	pinned := named.Name() + "@" + digest
+	if len(policy.CosignKeys) > 0 {
+		if err = verifyCosignSignature(ctx, pinned, policy.CosignKeys); err != nil {
+			return "", &ImagePolicyError{Image: image, Reason: err.Error()}
+		}
+	}
+	logs.GetLogger().Infof("image %s is pinned to %s", image, pinned)
+	return pinned, nil
+}
+
+// applyImagePolicy checks all images of the containers of a space, and pins them to their digests
+func applyImagePolicy(containerResources []yaml.ContainerResource) error {
+	for i := range containerResources {
+		cr := &containerResources[i]
+		pinned, err := CheckImagePolicy(context.TODO(), cr.ImageName)
+		if err != nil {
+			return err
+		}
+		cr.ImageName = pinned
+		for j := range cr.InitContainers {
+			if pinned, err = CheckImagePolicy(context.TODO(), cr.InitContainers[j].Image); err != nil {
+				return err
+			}
+			cr.InitContainers[j].Image = pinned
+		}
+		if err = applyImagePolicy(cr.Depends); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var dockerfileFrom = regexp.MustCompile(`(?i)^\s*FROM\s+(?:--\S+\s+)*(\S+)(?:\s+AS\s+(\S+))?`)
+
+// checkDockerfileBaseImages checks the base images of a Dockerfile, the build stages, scratch and the images given by ARG are skipped
+func checkDockerfileBaseImages(dockerfile string) error {
+	if !conf.GetConfig().ImagePolicy.Enable {
+		return nil
+	}
+	stages := map[string]bool{"scratch": true}
+	for _, line := range strings.Split(dockerfile, "\n") {
+		matches := dockerfileFrom.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		baseImage := matches[1]
+		if !stages[strings.ToLower(baseImage)] && !strings.Contains(baseImage, "$") {
+			if _, err := CheckImagePolicy(context.TODO(), baseImage); err != nil {
+				return err
+			}
+		}
+		if matches[2] != "" {
+			stages[strings.ToLower(matches[2])] = true
+		}
+	}
+	return nil
+}
+
+// matchRegistry matches the patterns against the registry, and the repository of the image
+func matchRegistry(patterns []string, named reference.Named) (string, bool) {
+	domain := reference.Domain(named)
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+		if ok, _ := path.Match(pattern, domain); ok {
+			return pattern, true
+		}
+		if ok, _ := path.Match(pattern, named.Name()); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func verifyCosignSignature(ctx context.Context, image string, keys []string) error {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return fmt.Errorf("cosign is required to verify the signature: %v", err)
+	}
+	for _, key := range keys {
+		cmd := exec.CommandContext(ctx, "cosign", "verify", "--key", key, image)
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		logs.GetLogger().Debugf("image %s is not signed by %s: %s", image, key, strings.TrimSpace(string(output)))
+	}
+	return fmt.Errorf("the signature is not verified by any of the cosign keys")
+}
+
+type imageManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Size int64 `json:"size"`
+	} `json:"config"`
+	Layers []struct {
+		Size int64 `json:"size"`
+	} `json:"layers"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// resolveImageManifest gets the digest of the image from its registry, and the compressed size of the image for the platform of this host
+func resolveImageManifest(ctx context.Context, named reference.Named) (string, int64, error) {
+	ref := ""
+	if digested, ok := named.(reference.Digested); ok {
+		ref = digested.Digest().String()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		ref = tagged.Tag()
+	}
+
+	client := &registryClient{domain: reference.Domain(named), repository: reference.Path(named)}
+	manifest, digest, err := client.getManifest(ctx, ref)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if len(manifest.Manifests) > 0 {
+		platformDigest := ""
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS == "linux" && m.Platform.Architecture == runtime.GOARCH {
+				platformDigest = m.Digest
+				break
+			}
+		}
+		if platformDigest == "" {
+			return "", 0, fmt.Errorf("no manifest for linux/%s", runtime.GOARCH)
+		}
+		if manifest, _, err = client.getManifest(ctx, platformDigest); err != nil {
+			return "", 0, err
+		}
+	}
+
+	size := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+	return digest, size, nil
+}
+
+// registryClient reads the manifests by the registry API v2, with the bearer token of the registry when it asks for one
+type registryClient struct {
+	domain     string
+	repository string
+	token      string
+}
+
+func (rc *registryClient) getManifest(ctx context.Context, ref string) (*imageManifest, string, error) {
+	host := rc.domain
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	scheme := "https"
+	if insecureRegistry(rc.domain) {
+		scheme = "http"
+	}
+	manifestUrl := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, host, rc.repository, ref)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var resp *http.Response
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestUrl, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Accept", strings.Join([]string{mediaTypeOciIndex, mediaTypeDockerManifestList, mediaTypeOciManifest, mediaTypeDockerManifest}, ","))
+		if rc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+rc.token)
+		} else if username, password := rc.credentials(); username != "" {
+			req.SetBasicAuth(username, password)
+		}
+
+		if resp, err = client.Do(req); err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			break
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err = rc.fetchToken(ctx, challenge); err != nil {
+			return nil, "", err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to get manifest %s, status code: %d", ref, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+
+	var manifest imageManifest
+	if err = json.Unmarshal(body, &manifest); err != nil {
+		return nil, "", fmt.Errorf("failed to parse manifest, error: %v", err)
+	}
+	return &manifest, digest, nil
+}
+
+// fetchToken gets the token by the bearer challenge of the registry
+func (rc *registryClient) fetchToken(ctx context.Context, challenge string) error {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return fmt.Errorf("unsupported authentication challenge: %s", challenge)
+	}
+	params := make(map[string]string)
+	for _, param := range regexp.MustCompile(`(\w+)="([^"]*)"`).FindAllStringSubmatch(challenge, -1) {
+		params[param[1]] = param[2]
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("no realm in the authentication challenge")
+	}
+
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", rc.repository))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if username, password := rc.credentials(); username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get registry token, status code: %d", resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	rc.token = token.Token
+	if rc.token == "" {
+		rc.token = token.AccessToken
+	}
+	return nil
+}
+
+// insecureRegistry reports whether the registry is served over plain http, as the insecure registries of docker
+func insecureRegistry(domain string) bool {
+	for _, registry := range conf.GetConfig().ImagePolicy.InsecureRegistries {
+		if strings.TrimSuffix(strings.TrimSpace(registry), "/") == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// credentials returns the account of the configured registry, when the image is on it
+func (rc *registryClient) credentials() (string, string) {
+	registry := conf.GetConfig().Registry
+	server := strings.Split(strings.TrimSpace(registry.ServerAddress), "/")[0]
+	if server == "" || server != rc.domain {
+		return "", ""
+	}
+	return registry.UserName, registry.Password
+}
@@ -0,0 +1,91 @@
+package computing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/distribution/reference"
+)
+
+func TestMatchRegistry(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		image    string
+		matched  string
+		ok       bool
+	}{
+		{"docker hub by domain", []string{"docker.io"}, "nginx:1.25", "docker.io", true},
+		{"docker hub library repository", []string{"docker.io/library/*"}, "nginx", "docker.io/library/*", true},
+		{"repository wildcard", []string{"ghcr.io/swanchain/*"}, "ghcr.io/swanchain/ubi-worker:latest", "ghcr.io/swanchain/*", true},
+		{"repository wildcard of another owner", []string{"ghcr.io/swanchain/*"}, "ghcr.io/other/ubi-worker", "", false},
+		{"trailing slash and spaces", []string{" quay.io/ "}, "quay.io/prometheus/node-exporter", "quay.io", true},
+		{"registry with port", []string{"registry.local:5000"}, "registry.local:5000/app:v1", "registry.local:5000", true},
+		{"domain wildcard", []string{"*.example.com"}, "cr.example.com/app", "*.example.com", true},
+		{"no pattern", nil, "nginx", "", false},
+		{"second pattern", []string{"ghcr.io", "docker.io"}, "busybox", "docker.io", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			named, err := reference.ParseNormalizedNamed(tt.image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			matched, ok := matchRegistry(tt.patterns, named)
+			if matched != tt.matched || ok != tt.ok {
+				t.Errorf("matchRegistry(%v, %s) = %q, %v, want %q, %v", tt.patterns, tt.image, matched, ok, tt.matched, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCheckDockerfileBaseImages(t *testing.T) {
+	initTestConfig(t, `
+[ImagePolicy]
+Enable = true
+BlockedRegistries = ["docker.io", "blocked.example.com"]
+`)
+	tests := []struct {
+		name       string
+		dockerfile string
+		errPart    string
+	}{
+		{"scratch", "FROM scratch\nCOPY app /app", ""},
+		{"image from an arg", "ARG BASE=nginx\nFROM $BASE\nFROM ${BASE} AS final", ""},
+		{"stage of the same file", "FROM scratch AS build\nFROM build\nFROM BUILD", ""},
+		{"blocked base image", "FROM nginx:1.25\nRUN echo hi", "docker.io"},
+		{"blocked base image with platform", "FROM --platform=linux/amd64 blocked.example.com/app AS build", "blocked.example.com"},
+		{"blocked image after a stage", "FROM scratch AS build\nFROM blocked.example.com/app", "blocked.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDockerfileBaseImages(tt.dockerfile)
+			if tt.errPart == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+				t.Errorf("error = %v, want it to mention %s", err, tt.errPart)
+			}
+		})
+	}
+}
+
+func TestInsecureRegistry(t *testing.T) {
+	initTestConfig(t, `
+[ImagePolicy]
+InsecureRegistries = ["registry.local:5000/", " 10.0.0.2:5000"]
+`)
+	for domain, want := range map[string]bool{
+		"registry.local:5000": true,
+		"10.0.0.2:5000":       true,
+		"registry.local":      false,
+		"docker.io":           false,
+	} {
+		if got := insecureRegistry(domain); got != want {
+			t.Errorf("insecureRegistry(%s) = %v, want %v", domain, got, want)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	coreV1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	traefikMiddlewareResource    = schema.GroupVersionResource{Group: "traefik.io", Version: "v1alpha1", Resource: "middlewares"}
+	httpRouteResource            = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+	envoySecurityPolicyResource  = schema.GroupVersionResource{Group: "gateway.envoyproxy.io", Version: "v1alpha1", Resource: "securitypolicies"}
+	certManagerIssuerAnnotation  = "cert-manager.io/cluster-issuer"
+	traefikMiddlewaresAnnotation = "traefik.ingress.kubernetes.io/router.middlewares"
+
+	// the copies of the wildcard secret are labeled, and annotated with the resourceVersion of the source they were copied from
+	wildcardCopyLabel               = "swanchain.io/wildcard-copy"
+	wildcardSourceVersionAnnotation = "swanchain.io/wildcard-source-version"
+)
+
+// IngressBackend exposes the service of a space on its hostname, and translates the ip whitelist of the space
+type IngressBackend interface {
+	Create(ctx context.Context, namespace, jobUuid, hostName string, port int32, ipWhiteList []string) error
+	Delete(ctx context.Context, namespace, jobUuid string) error
+}
+
+// NewIngressBackend returns the backend configured in the Ingress section
+func NewIngressBackend() IngressBackend {
+	return ingressBackendOf(conf.GetConfig().Ingress.GetBackend())
+}
+
+func ingressBackendOf(backend string) IngressBackend {
+	ingressConf := conf.GetConfig().Ingress
+	switch backend {
+	case conf.IngressBackendTraefik:
+		return &traefikIngress{ingressConf: ingressConf}
+	case conf.IngressBackendGateway:
+		return &gatewayRoute{ingressConf: ingressConf}
+	default:
+		return &nginxIngress{ingressConf: ingressConf}
+	}
+}
+
+// DeleteJobIngress deletes the ingress of a space and the objects created along with it, by the backend the space was
+// exposed by
+func DeleteJobIngress(ctx context.Context, namespace, jobUuid string) error {
+	var job models.JobEntity
+	err := NewJobService().Model(&models.JobEntity{}).Where("lower(job_uuid)=?", strings.ToLower(jobUuid)).Order("id desc").Limit(1).Find(&job).Error
+	if err != nil {
+		return err
+	}
+	if job.IngressBackend == "" {
+		return NewIngressBackend().Delete(ctx, namespace, jobUuid)
+	}
+	return ingressBackendOf(job.IngressBackend).Delete(ctx, namespace, jobUuid)
+}
+
+type nginxIngress struct {
+	ingressConf conf.Ingress
+}
+
+func (n *nginxIngress) Create(ctx context.Context, namespace, jobUuid, hostName string, port int32, ipWhiteList []string) error {
+	var annotations = map[string]string{
+		"nginx.ingress.kubernetes.io/use-regex": "true",
+	}
+	if len(ipWhiteList) > 0 {
+		annotations["nginx.ingress.kubernetes.io/use-forwarded-headers"] = "true"
+		annotations["nginx.ingress.kubernetes.io/whitelist-source-range"] = strings.Join(ipWhiteList, ",")
+	}
+
+	ingress := newSpaceIngress(jobUuid, hostName, n.ingressConf.GetClassName(), "/*", port, annotations)
+	if err := applyIngressTLS(ctx, n.ingressConf, namespace, jobUuid, hostName, ingress); err != nil {
+		return err
+	}
+	_, err := NewK8sServiceForJob(jobUuid).CreateIngress(ctx, namespace, ingress)
+	return err
+}
+
+func (n *nginxIngress) Delete(ctx context.Context, namespace, jobUuid string) error {
+	return deleteSpaceIngress(ctx, namespace, jobUuid)
+}
+
+// traefikIngress allows the ip whitelist by an ipAllowList middleware, which is referenced by the annotation of the ingress
+type traefikIngress struct {
+	ingressConf conf.Ingress
+}
+
+func (t *traefikIngress) Create(ctx context.Context, namespace, jobUuid, hostName string, port int32, ipWhiteList []string) error {
+	annotations := make(map[string]string)
+	if len(ipWhiteList) > 0 {
+		dynamicClient, err := NewK8sServiceForJob(jobUuid).DynamicClient()
+		if err != nil {
+			return err
+		}
+		middlewareName := constants.K8S_INGRESS_NAME_PREFIX + jobUuid
+		middleware := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "traefik.io/v1alpha1",
+			"kind":       "Middleware",
+			"metadata": map[string]interface{}{
+				"name":   middlewareName,
+				"labels": map[string]interface{}{"lad_app": jobUuid},
+			},
+			"spec": map[string]interface{}{
+				"ipAllowList": map[string]interface{}{
+					"sourceRange": toInterfaceSlice(ipWhiteList),
+				},
+			},
+		}}
+		if _, err = dynamicClient.Resource(traefikMiddlewareResource).Namespace(namespace).Create(ctx, middleware, metaV1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create traefik middleware, error: %w", err)
+		}
+		annotations[traefikMiddlewaresAnnotation] = fmt.Sprintf("%s-%s@kubernetescrd", namespace, middlewareName)
+	}
+
+	ingress := newSpaceIngress(jobUuid, hostName, t.ingressConf.GetClassName(), "/", port, annotations)
+	if err := applyIngressTLS(ctx, t.ingressConf, namespace, jobUuid, hostName, ingress); err != nil {
+		return err
+	}
+	if len(ingress.Spec.TLS) > 0 {
+		ingress.Annotations["traefik.ingress.kubernetes.io/router.tls"] = "true"
+	}
+	_, err := NewK8sServiceForJob(jobUuid).CreateIngress(ctx, namespace, ingress)
+	return err
+}
+
+func (t *traefikIngress) Delete(ctx context.Context, namespace, jobUuid string) error {
+	if err := deleteSpaceIngress(ctx, namespace, jobUuid); err != nil {
+		return err
+	}
+	dynamicClient, err := NewK8sServiceForJob(jobUuid).DynamicClient()
+	if err != nil {
+		return err
+	}
+	err = dynamicClient.Resource(traefikMiddlewareResource).Namespace(namespace).Delete(ctx, constants.K8S_INGRESS_NAME_PREFIX+jobUuid, metaV1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// gatewayRoute attaches an HTTPRoute to the configured Gateway. The Gateway API has no standard ip filter,
+// so the ip whitelist is translated to a SecurityPolicy of Envoy Gateway.
+type gatewayRoute struct {
+	ingressConf conf.Ingress
+}
+
+func (g *gatewayRoute) Create(ctx context.Context, namespace, jobUuid, hostName string, port int32, ipWhiteList []string) error {
+	k8sService := NewK8sServiceForJob(jobUuid)
+	dynamicClient, err := k8sService.DynamicClient()
+	if err != nil {
+		return err
+	}
+	// the route must not be exposed without the ip whitelist, so the policy is checked before the route is created
+	if len(ipWhiteList) > 0 {
+		if err = requireResource(k8sService, envoySecurityPolicyResource); err != nil {
+			return fmt.Errorf("the ip whitelist can not be applied, %w", err)
+		}
+	}
+
+	routeName := constants.K8S_INGRESS_NAME_PREFIX + jobUuid
+	parentRef := map[string]interface{}{"name": g.ingressConf.GatewayName}
+	if g.ingressConf.GatewayNamespace != "" {
+		parentRef["namespace"] = g.ingressConf.GatewayNamespace
+	}
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata": map[string]interface{}{
+			"name":   routeName,
+			"labels": map[string]interface{}{"lad_app": jobUuid},
+		},
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{parentRef},
+			"hostnames":  []interface{}{hostName},
+			"rules": []interface{}{
+				map[string]interface{}{
+					"matches": []interface{}{
+						map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/"}},
+					},
+					"backendRefs": []interface{}{
+						map[string]interface{}{"name": constants.K8S_SERVICE_NAME_PREFIX + jobUuid, "port": int64(port)},
+					},
+				},
+			},
+		},
+	}}
+	if _, err = dynamicClient.Resource(httpRouteResource).Namespace(namespace).Create(ctx, route, metaV1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create http route, error: %w", err)
+	}
+
+	if len(ipWhiteList) > 0 {
+		policy := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "gateway.envoyproxy.io/v1alpha1",
+			"kind":       "SecurityPolicy",
+			"metadata": map[string]interface{}{
+				"name":   routeName,
+				"labels": map[string]interface{}{"lad_app": jobUuid},
+			},
+			"spec": map[string]interface{}{
+				"targetRefs": []interface{}{
+					map[string]interface{}{"group": "gateway.networking.k8s.io", "kind": "HTTPRoute", "name": routeName},
+				},
+				"authorization": map[string]interface{}{
+					"defaultAction": "Deny",
+					"rules": []interface{}{
+						map[string]interface{}{
+							"action":    "Allow",
+							"principal": map[string]interface{}{"clientCIDRs": toInterfaceSlice(ipWhiteList)},
+						},
+					},
+				},
+			},
+		}}
+		if _, err = dynamicClient.Resource(envoySecurityPolicyResource).Namespace(namespace).Create(ctx, policy, metaV1.CreateOptions{}); err != nil {
+			if deleteErr := dynamicClient.Resource(httpRouteResource).Namespace(namespace).Delete(ctx, routeName, metaV1.DeleteOptions{}); deleteErr != nil && !errors.IsNotFound(deleteErr) {
+				logs.GetLogger().Errorf("failed to roll back http route, name: %s, error: %v", routeName, deleteErr)
+			}
+			return fmt.Errorf("failed to create security policy for the ip whitelist, error: %w", err)
+		}
+	}
+	return nil
+}
+
+func (g *gatewayRoute) Delete(ctx context.Context, namespace, jobUuid string) error {
+	dynamicClient, err := NewK8sServiceForJob(jobUuid).DynamicClient()
+	if err != nil {
+		return err
+	}
+	name := constants.K8S_INGRESS_NAME_PREFIX + jobUuid
+	if err = dynamicClient.Resource(envoySecurityPolicyResource).Namespace(namespace).Delete(ctx, name, metaV1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		logs.GetLogger().Warnf("failed to delete security policy, name: %s, error: %v", name, err)
+	}
+	if err = dynamicClient.Resource(httpRouteResource).Namespace(namespace).Delete(ctx, name, metaV1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// requireResource returns an error if the custom resource is not served by the cluster, e.g. its CRD is not installed
+func requireResource(k8sService *K8sService, gvr schema.GroupVersionResource) error {
+	resources, err := k8sService.k8sClient.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to discover %s, error: %w", gvr.GroupVersion().String(), err)
+	}
+	if resources != nil {
+		for _, r := range resources.APIResources {
+			if r.Name == gvr.Resource {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s of %s is not installed in the cluster", gvr.Resource, gvr.GroupVersion().String())
+}
+
+func newSpaceIngress(jobUuid, hostName, className, path string, port int32, annotations map[string]string) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	return &networkingv1.Ingress{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        constants.K8S_INGRESS_NAME_PREFIX + jobUuid,
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &className,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: hostName,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     path,
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: constants.K8S_SERVICE_NAME_PREFIX + jobUuid,
+											Port: networkingv1.ServiceBackendPort{
+												Number: port,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// deleteSpaceIngress deletes the ingress and the certificate cert-manager issued for it, cert-manager keeps the secret
+// after its ingress is gone
+func deleteSpaceIngress(ctx context.Context, namespace, jobUuid string) error {
+	k8sService := NewK8sServiceForJob(jobUuid)
+	err := k8sService.DeleteIngress(ctx, namespace, constants.K8S_INGRESS_NAME_PREFIX+jobUuid)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	tlsSecretName := constants.K8S_INGRESS_NAME_PREFIX + jobUuid + "-tls"
+	err = k8sService.k8sClient.CoreV1().Secrets(namespace).Delete(ctx, tlsSecretName, metaV1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		logs.GetLogger().Warnf("failed to delete tls secret, name: %s, error: %v", tlsSecretName, err)
+	}
+	return nil
+}
+
+// applyIngressTLS terminates TLS on the hostname of the space. cert-manager issues a certificate for each space,
+// the wildcard certificate is copied into the namespace of the space since an ingress only reads the secrets of its namespace.
+func applyIngressTLS(ctx context.Context, ingressConf conf.Ingress, namespace, jobUuid, hostName string, ingress *networkingv1.Ingress) error {
+	switch ingressConf.TLS {
+	case conf.IngressTLSCertManager:
+		ingress.Annotations[certManagerIssuerAnnotation] = ingressConf.ClusterIssuer
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{
+			Hosts:      []string{hostName},
+			SecretName: constants.K8S_INGRESS_NAME_PREFIX + jobUuid + "-tls",
+		}}
+	case conf.IngressTLSWildcard:
+		secretName, err := copyWildcardSecret(ctx, ingressConf.WildcardSecret, namespace, jobUuid)
+		if err != nil {
+			return err
+		}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{
+			Hosts:      []string{hostName},
+			SecretName: secretName,
+		}}
+	}
+	return nil
+}
+
+// copyWildcardSecret copies the wildcard secret within the cluster of the job, each cluster keeps its own wildcard secret.
+// A copy older than the source, e.g. before the certificate was renewed, is refreshed.
+func copyWildcardSecret(ctx context.Context, wildcardSecret, namespace, jobUuid string) (string, error) {
+	sourceNamespace, secretName, _ := strings.Cut(wildcardSecret, "/")
+	if sourceNamespace == namespace {
+		return secretName, nil
+	}
+	k8sService := NewK8sServiceForJob(jobUuid)
+	source, err := k8sService.GetSecret(ctx, sourceNamespace, secretName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get wildcard secret %s, error: %w", wildcardSecret, err)
+	}
+
+	secret, err := k8sService.GetSecret(ctx, namespace, secretName)
+	if err == nil {
+		if err = refreshWildcardCopy(ctx, k8sService, source, secret); err != nil {
+			return "", err
+		}
+		return secretName, nil
+	} else if !errors.IsNotFound(err) {
+		return "", err
+	}
+
+	secret = &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        secretName,
+			Namespace:   namespace,
+			Labels:      map[string]string{wildcardCopyLabel: "true"},
+			Annotations: map[string]string{wildcardSourceVersionAnnotation: source.ResourceVersion},
+		},
+		Type: source.Type,
+		Data: source.Data,
+	}
+	if _, err = k8sService.k8sClient.CoreV1().Secrets(namespace).Create(ctx, secret, metaV1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("failed to copy wildcard secret to namespace %s, error: %w", namespace, err)
+	}
+	return secretName, nil
+}
+
+func refreshWildcardCopy(ctx context.Context, k8sService *K8sService, source, secret *coreV1.Secret) error {
+	if secret.Annotations[wildcardSourceVersionAnnotation] == source.ResourceVersion {
+		return nil
+	}
+	if secret.Labels == nil {
+		secret.Labels = make(map[string]string)
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Labels[wildcardCopyLabel] = "true"
+	secret.Annotations[wildcardSourceVersionAnnotation] = source.ResourceVersion
+	secret.Data = source.Data
+	if _, err := k8sService.k8sClient.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metaV1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to refresh wildcard secret in namespace %s, error: %w", secret.Namespace, err)
+	}
+	logs.GetLogger().Infof("refreshed wildcard secret %s in namespace %s", secret.Name, secret.Namespace)
+	return nil
+}
+
+// refreshWildcardSecrets updates the copies of the wildcard secret in every cluster after the certificate is renewed
+func refreshWildcardSecrets() {
+	ingressConf := conf.GetConfig().Ingress
+	if ingressConf.TLS != conf.IngressTLSWildcard {
+		return
+	}
+	sourceNamespace, secretName, _ := strings.Cut(ingressConf.WildcardSecret, "/")
+	for _, k8sService := range K8sServices() {
+		if k8sService.k8sClient == nil {
+			continue
+		}
+		source, err := k8sService.GetSecret(context.TODO(), sourceNamespace, secretName)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get wildcard secret %s, cluster: %s, error: %v", ingressConf.WildcardSecret, k8sService.Cluster, err)
+			continue
+		}
+		copies, err := k8sService.k8sClient.CoreV1().Secrets("").List(context.TODO(), metaV1.ListOptions{LabelSelector: wildcardCopyLabel + "=true"})
+		if err != nil {
+			logs.GetLogger().Errorf("failed to list the copies of wildcard secret, cluster: %s, error: %v", k8sService.Cluster, err)
+			continue
+		}
+		for i := range copies.Items {
+			if copies.Items[i].Name != secretName {
+				continue
+			}
+			if err = refreshWildcardCopy(context.TODO(), k8sService, source, &copies.Items[i]); err != nil {
+				logs.GetLogger().Error(err)
+			}
+		}
+	}
+}
+
+func toInterfaceSlice(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
@@ -2,16 +2,19 @@ package computing
 
 import "C"
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	calicov3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
 	calicoclientset "github.com/projectcalico/api/pkg/client/clientset_generated/clientset"
+	"github.com/swanchain/go-computing-provider/conf"
 	"github.com/swanchain/go-computing-provider/constants"
 	"github.com/swanchain/go-computing-provider/internal/models"
 	"io"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/client-go/util/retry"
@@ -23,10 +26,12 @@ import (
 	"time"
 
 	appV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
 	coreV1 "k8s.io/api/core/v1"
 
 	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -34,51 +39,156 @@ import (
 	"k8s.io/client-go/util/homedir"
 )
 
-var clientSet *kubernetes.Clientset
-var k8sOnce sync.Once
-var config *rest.Config
-var version string
+// k8sClusters keeps the service of each cluster once it is connected, a cluster which fails to connect is kept
+// with no client like the single cluster before
+var k8sClusters = struct {
+	sync.Mutex
+	services map[string]*K8sService
+}{services: make(map[string]*K8sService)}
 
 type K8sService struct {
 	k8sClient *kubernetes.Clientset
 	Version   string
 	config    *rest.Config
+	Cluster   string
 }
 
+// NewK8sService returns the service of the default cluster, the first of the clusters of config.toml
 func NewK8sService() *K8sService {
-	var err error
-	k8sOnce.Do(func() {
-		kubeConfig := filepath.Join(homedir.HomeDir(), ".kube/config")
-		config, err = clientcmd.BuildConfigFromFlags("", kubeConfig)
-		if err != nil {
-			return
+	return NewK8sServiceFor(DefaultCluster())
+}
+
+// NewK8sServiceFor returns the service of the named cluster, the default cluster for an empty name
+func NewK8sServiceFor(cluster string) *K8sService {
+	if cluster == "" {
+		cluster = DefaultCluster()
+	}
+	k8sClusters.Lock()
+	defer k8sClusters.Unlock()
+	if service, ok := k8sClusters.services[cluster]; ok {
+		return service
+	}
+
+	service := &K8sService{Cluster: cluster}
+	k8sClusters.services[cluster] = service
+	kubeConfig := filepath.Join(homedir.HomeDir(), ".kube/config")
+	if conf.GetConfig() != nil {
+		for _, c := range conf.GetConfig().Clusters {
+			if c.Name == cluster && c.KubeConfig != "" {
+				kubeConfig = c.KubeConfig
+			}
 		}
-		config.QPS = 30
-		config.Burst = 200
-		clientSet, err = kubernetes.NewForConfig(config)
-		if err != nil {
-			logs.GetLogger().Errorf("Failed create k8s clientset, error: %v", err)
-			return
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if err != nil {
+		return service
+	}
+	config.QPS = 30
+	config.Burst = 200
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logs.GetLogger().Errorf("Failed create k8s clientset, cluster: %s, error: %v", cluster, err)
+		return service
+	}
+	service.k8sClient = clientSet
+	service.config = config
+
+	versionInfo, err := clientSet.Discovery().ServerVersion()
+	if err != nil {
+		return service
+	}
+	service.Version = versionInfo.String()
+	return service
+}
+
+// NewK8sServiceForJob returns the service of the cluster a space job is deployed to, the jobs deployed before the
+// clusters were configured run in the default cluster
+func NewK8sServiceForJob(jobUuid string) *K8sService {
+	return NewK8sServiceFor(NewJobService().GetJobCluster(jobUuid))
+}
+
+// ClusterNames returns the names of the clusters in the order of config.toml, or the unnamed cluster of
+// ~/.kube/config when no cluster is configured
+func ClusterNames() []string {
+	var names []string
+	if conf.GetConfig() != nil {
+		for _, cluster := range conf.GetConfig().Clusters {
+			names = append(names, cluster.Name)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, "")
+	}
+	return names
+}
+
+// DefaultCluster returns the first cluster, the ubi tasks and the cluster wide settings go to it
+func DefaultCluster() string {
+	return ClusterNames()[0]
+}
+
+// K8sServices returns the service of every cluster
+func K8sServices() []*K8sService {
+	var services []*K8sService
+	for _, name := range ClusterNames() {
+		services = append(services, NewK8sServiceFor(name))
+	}
+	return services
+}
+
+// ClusterPublicIp returns the ip the node ports of the cluster are reached by
+func ClusterPublicIp(cluster string) string {
+	for _, c := range conf.GetConfig().Clusters {
+		if c.Name == cluster && c.PublicIp != "" {
+			return c.PublicIp
 		}
+	}
+	multiAddressSplit := strings.Split(conf.GetConfig().API.MultiAddress, "/")
+	if len(multiAddressSplit) < 3 {
+		return ""
+	}
+	return multiAddressSplit[2]
+}
 
-		versionInfo, err := clientSet.Discovery().ServerVersion()
+// StatisticalSourcesOfClusters collects the resources of the nodes of every cluster, a cluster which fails is left out
+func StatisticalSourcesOfClusters(ctx context.Context) ([]*models.NodeResource, error) {
+	var nodes []*models.NodeResource
+	var lastErr error
+	for _, service := range K8sServices() {
+		if service.k8sClient == nil {
+			lastErr = fmt.Errorf("cluster %q is not connected", service.Cluster)
+			logs.GetLogger().Error(lastErr)
+			continue
+		}
+		clusterNodes, err := service.StatisticalSources(ctx)
 		if err != nil {
-			return
+			lastErr = fmt.Errorf("failed to collect the resources of cluster %q, error: %v", service.Cluster, err)
+			logs.GetLogger().Error(lastErr)
+			continue
 		}
-		version = versionInfo.String()
-	})
-
-	return &K8sService{
-		k8sClient: clientSet,
-		Version:   version,
-		config:    config,
+		for _, node := range clusterNodes {
+			node.Cluster = service.Cluster
+		}
+		nodes = append(nodes, clusterNodes...)
 	}
+	if len(nodes) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return nodes, nil
 }
 
 func (s *K8sService) CreateDeployment(ctx context.Context, nameSpace string, deploy *appV1.Deployment) (result *appV1.Deployment, err error) {
 	return s.k8sClient.AppsV1().Deployments(nameSpace).Create(ctx, deploy, metaV1.CreateOptions{})
 }
 
+func (s *K8sService) GetDeployment(ctx context.Context, namespace, deploymentName string) (*appV1.Deployment, error) {
+	return s.k8sClient.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metaV1.GetOptions{})
+}
+
+func (s *K8sService) UpdateDeployment(ctx context.Context, namespace string, deploy *appV1.Deployment) (*appV1.Deployment, error) {
+	return s.k8sClient.AppsV1().Deployments(namespace).Update(ctx, deploy, metaV1.UpdateOptions{})
+}
+
 func (s *K8sService) DeleteDeployment(ctx context.Context, namespace, deploymentName string) error {
 	return s.k8sClient.AppsV1().Deployments(namespace).Delete(ctx, deploymentName, metaV1.DeleteOptions{})
 }
@@ -192,50 +302,7 @@ func (s *K8sService) DeleteService(ctx context.Context, namespace, serviceName s
 	return s.k8sClient.CoreV1().Services(namespace).Delete(ctx, serviceName, metaV1.DeleteOptions{})
 }
 
-func (s *K8sService) CreateIngress(ctx context.Context, k8sNameSpace, spaceUuid, hostName string, port int32, ipWhiteList []string) (*networkingv1.Ingress, error) {
-	var ingressClassName = "nginx"
-
-	var annotations = map[string]string{
-		"nginx.ingress.kubernetes.io/use-regex": "true",
-	}
-	if len(ipWhiteList) > 0 {
-		annotations["nginx.ingress.kubernetes.io/use-forwarded-headers"] = "true"
-		annotations["nginx.ingress.kubernetes.io/whitelist-source-range"] = strings.Join(ipWhiteList, ",")
-	}
-
-	ingress := &networkingv1.Ingress{
-		ObjectMeta: metaV1.ObjectMeta{
-			Name:        constants.K8S_INGRESS_NAME_PREFIX + spaceUuid,
-			Annotations: annotations,
-		},
-		Spec: networkingv1.IngressSpec{
-			IngressClassName: &ingressClassName,
-			Rules: []networkingv1.IngressRule{
-				{
-					Host: hostName,
-					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: []networkingv1.HTTPIngressPath{
-								{
-									Path:     "/*",
-									PathType: func() *networkingv1.PathType { t := networkingv1.PathTypePrefix; return &t }(),
-									Backend: networkingv1.IngressBackend{
-										Service: &networkingv1.IngressServiceBackend{
-											Name: constants.K8S_SERVICE_NAME_PREFIX + spaceUuid,
-											Port: networkingv1.ServiceBackendPort{
-												Number: port,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-
+func (s *K8sService) CreateIngress(ctx context.Context, k8sNameSpace string, ingress *networkingv1.Ingress) (*networkingv1.Ingress, error) {
 	return s.k8sClient.NetworkingV1().Ingresses(k8sNameSpace).Create(ctx, ingress, metaV1.CreateOptions{})
 }
 
@@ -243,6 +310,15 @@ func (s *K8sService) DeleteIngress(ctx context.Context, nameSpace, ingressName s
 	return s.k8sClient.NetworkingV1().Ingresses(nameSpace).Delete(ctx, ingressName, metaV1.DeleteOptions{})
 }
 
+// DynamicClient is used for the custom resources of the ingress backends, which have no typed client here
+func (s *K8sService) DynamicClient() (dynamic.Interface, error) {
+	return dynamic.NewForConfig(s.config)
+}
+
+func (s *K8sService) GetSecret(ctx context.Context, namespace, secretName string) (*coreV1.Secret, error) {
+	return s.k8sClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metaV1.GetOptions{})
+}
+
 func (s *K8sService) CreateConfigMap(ctx context.Context, k8sNameSpace, jobUuid, basePath, configName string) (*coreV1.ConfigMap, error) {
 	configFilePath := filepath.Join(basePath, configName)
 
@@ -264,6 +340,75 @@ func (s *K8sService) CreateConfigMap(ctx context.Context, k8sNameSpace, jobUuid,
 	return s.k8sClient.CoreV1().ConfigMaps(k8sNameSpace).Create(ctx, configMap, metaV1.CreateOptions{})
 }
 
+func (s *K8sService) CreateSecret(ctx context.Context, namespace, jobUuid, secretName string, data map[string]string) (*coreV1.Secret, error) {
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   secretName,
+			Labels: map[string]string{"lad_app": jobUuid},
+		},
+		Type:       coreV1.SecretTypeOpaque,
+		StringData: data,
+	}
+	return s.k8sClient.CoreV1().Secrets(namespace).Create(ctx, secret, metaV1.CreateOptions{})
+}
+
+func (s *K8sService) DeleteSecrets(ctx context.Context, namespace, jobUuid string) error {
+	return s.k8sClient.CoreV1().Secrets(namespace).DeleteCollection(ctx, metaV1.DeleteOptions{}, metaV1.ListOptions{
+		LabelSelector: fmt.Sprintf("lad_app=%s", jobUuid),
+	})
+}
+
+func (s *K8sService) CreateBatchJob(ctx context.Context, namespace string, job *batchV1.Job) (*batchV1.Job, error) {
+	return s.k8sClient.BatchV1().Jobs(namespace).Create(ctx, job, metaV1.CreateOptions{})
+}
+
+func (s *K8sService) DeleteBatchJob(ctx context.Context, namespace, jobName string) error {
+	propagation := metaV1.DeletePropagationBackground
+	return s.k8sClient.BatchV1().Jobs(namespace).Delete(ctx, jobName, metaV1.DeleteOptions{PropagationPolicy: &propagation})
+}
+
+func (s *K8sService) CreatePvc(ctx context.Context, namespace, jobUuid, storageClass string, size resource.Quantity) (*coreV1.PersistentVolumeClaim, error) {
+	pvc := &coreV1.PersistentVolumeClaim{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      constants.K8S_PVC_NAME_PREFIX + jobUuid,
+			Namespace: namespace,
+			Labels:    map[string]string{"lad_app": jobUuid},
+		},
+		Spec: coreV1.PersistentVolumeClaimSpec{
+			AccessModes: []coreV1.PersistentVolumeAccessMode{coreV1.ReadWriteOnce},
+			Resources: coreV1.VolumeResourceRequirements{
+				Requests: coreV1.ResourceList{
+					coreV1.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	if storageClass != "" {
+		pvc.Spec.StorageClassName = &storageClass
+	}
+	return s.k8sClient.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metaV1.CreateOptions{})
+}
+
+func (s *K8sService) GetPvc(ctx context.Context, namespace, pvcName string) (*coreV1.PersistentVolumeClaim, error) {
+	return s.k8sClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metaV1.GetOptions{})
+}
+
+func (s *K8sService) ListPvc(ctx context.Context, namespace string) ([]coreV1.PersistentVolumeClaim, error) {
+	pvcList, err := s.k8sClient.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pvcList.Items, nil
+}
+
+func (s *K8sService) UpdatePvc(ctx context.Context, pvc *coreV1.PersistentVolumeClaim) (*coreV1.PersistentVolumeClaim, error) {
+	return s.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Update(ctx, pvc, metaV1.UpdateOptions{})
+}
+
+func (s *K8sService) DeletePvc(ctx context.Context, namespace, pvcName string) error {
+	return s.k8sClient.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvcName, metaV1.DeleteOptions{})
+}
+
 func (s *K8sService) GetPods(namespace, jobUuid string) (bool, error) {
 	listOption := metaV1.ListOptions{}
 	if jobUuid != "" {
@@ -411,7 +556,7 @@ func (s *K8sService) StatisticalSources(ctx context.Context) ([]*models.NodeReso
 		return nil, err
 	}
 
-	nodeGpuInfoMap, err := s.GetResourceExporterPodLog(ctx)
+	nodeGpuInfoMap, err := s.GetNodeInfos(ctx)
 	if err != nil {
 		logs.GetLogger().Errorf("failed to collect cluster gpu info, if have available gpu, please check resource-exporter. error: %+v", err)
 	}
@@ -468,6 +613,7 @@ func (s *K8sService) StatisticalSources(ctx context.Context) ([]*models.NodeReso
 			}
 		}
 
+		nodeResource.Gpu.Slices = nodeGpuSlices(&node, activePods)
 		nodeList = append(nodeList, nodeResource)
 	}
 
@@ -493,6 +639,61 @@ func (s *K8sService) StatisticalSources(ctx context.Context) ([]*models.NodeReso
 	return nodeList, nil
 }
 
+// CordonNode marks the node unschedulable or schedulable again, it reports whether the node is changed
+func (s *K8sService) CordonNode(ctx context.Context, nodeName string, unschedulable bool) (bool, error) {
+	var changed bool
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := s.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if node.Spec.Unschedulable == unschedulable {
+			return nil
+		}
+		node.Spec.Unschedulable = unschedulable
+		if _, err = s.k8sClient.CoreV1().Nodes().Update(ctx, node, metaV1.UpdateOptions{}); err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	return changed, err
+}
+
+// GetNodeInfos returns the cpu and gpu information of the nodes, the native collector reads them from the labels of the nodes,
+// the logs of the resource-exporter pods are the fallback for the nodes whose labels are not complete
+func (s *K8sService) GetNodeInfos(ctx context.Context) (map[string]models.CollectNodeInfo, error) {
+	if conf.GetConfig().Collector.GetMode() != conf.CollectorNative {
+		return s.GetResourceExporterPodLog(ctx)
+	}
+
+	nodes, err := s.k8sClient.CoreV1().Nodes().List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]models.CollectNodeInfo)
+	for _, node := range nodes.Items {
+		if nodeInfo, ok := nodeInfoFromLabels(&node); ok {
+			result[node.Name] = nodeInfo
+		}
+	}
+	if len(result) == len(nodes.Items) {
+		return result, nil
+	}
+
+	exporterInfos, err := s.GetResourceExporterPodLog(ctx)
+	if err != nil {
+		logs.GetLogger().Warnf("failed to collect the nodes without the gpu feature discovery labels from the resource-exporter, error: %v", err)
+		return result, nil
+	}
+	for nodeName, nodeInfo := range exporterInfos {
+		if _, ok := result[nodeName]; !ok {
+			result[nodeName] = nodeInfo
+		}
+	}
+	return result, nil
+}
+
 func (s *K8sService) GetResourceExporterPodLog(ctx context.Context) (map[string]models.CollectNodeInfo, error) {
 	var num int64 = 1
 	podLogOptions := coreV1.PodLogOptions{
@@ -650,8 +851,41 @@ func (s *K8sService) PodDoCommand(namespace, podName, containerName string, podC
 	return nil
 }
 
+// ExecWithStdin runs the command in the container and streams stdin to it, the stderr is returned in the error when the command fails
+func (s *K8sService) ExecWithStdin(ctx context.Context, namespace, podName, containerName string, podCmd []string, stdin io.Reader) error {
+	req := s.k8sClient.CoreV1().RESTClient().
+		Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec").
+		VersionedParams(&coreV1.PodExecOptions{
+			Container: containerName,
+			Command:   podCmd,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(s.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create spdy client: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: io.Discard,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to exec in pod %s: %w, stderr: %s", podName, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
 func (s *K8sService) GetNodeGpuSummary(ctx context.Context) (map[string]map[string]int64, error) {
-	nodeGpuInfoMap, err := s.GetResourceExporterPodLog(ctx)
+	nodeGpuInfoMap, err := s.GetNodeInfos(ctx)
 	if err != nil {
 		logs.GetLogger().Errorf("Collect cluster gpu info Failed, if have available gpu, please check resource-exporter. error: %+v", err)
 		return map[string]map[string]int64{}, err
@@ -674,8 +908,84 @@ func (s *K8sService) GetNodeGpuSummary(ctx context.Context) (map[string]map[stri
 	return nodeGpuSummary, nil
 }
 
+// podUsage is the usage of a pod, the network counters are cumulative
+type podUsage struct {
+	cpuCores    float64
+	memoryBytes int64
+	rxBytes     int64
+	txBytes     int64
+	hasNetwork  bool
+}
+
+// GetPodMetrics returns the cpu and memory usage of the pods by the metrics API, keyed by namespace/name
+func (s *K8sService) GetPodMetrics(ctx context.Context) (map[string]podUsage, error) {
+	data, err := s.k8sClient.CoreV1().RESTClient().Get().AbsPath("/apis/metrics.k8s.io/v1beta1/pods").DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the pod metrics, please check the metrics-server, error: %v", err)
+	}
+	var podMetrics struct {
+		Items []struct {
+			Metadata   metaV1.ObjectMeta `json:"metadata"`
+			Containers []struct {
+				Usage coreV1.ResourceList `json:"usage"`
+			} `json:"containers"`
+		} `json:"items"`
+	}
+	if err = json.Unmarshal(data, &podMetrics); err != nil {
+		return nil, fmt.Errorf("failed to parse the pod metrics, error: %v", err)
+	}
+
+	result := make(map[string]podUsage)
+	for _, item := range podMetrics.Items {
+		var usage podUsage
+		for _, c := range item.Containers {
+			usage.cpuCores += float64(c.Usage.Cpu().MilliValue()) / 1000
+			usage.memoryBytes += c.Usage.Memory().Value()
+		}
+		result[item.Metadata.Namespace+"/"+item.Metadata.Name] = usage
+	}
+	return result, nil
+}
+
+// GetPodNetworkStats returns the cumulative network counters of the pods on the node by the stats summary of the kubelet,
+// keyed by namespace/name
+func (s *K8sService) GetPodNetworkStats(ctx context.Context, nodeName string) (map[string]podUsage, error) {
+	data, err := s.k8sClient.CoreV1().RESTClient().Get().AbsPath("/api/v1/nodes", nodeName, "proxy/stats/summary").DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the stats summary of node %s, error: %v", nodeName, err)
+	}
+	var summary struct {
+		Pods []struct {
+			PodRef struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"podRef"`
+			Network *struct {
+				RxBytes *int64 `json:"rxBytes"`
+				TxBytes *int64 `json:"txBytes"`
+			} `json:"network"`
+		} `json:"pods"`
+	}
+	if err = json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse the stats summary of node %s, error: %v", nodeName, err)
+	}
+
+	result := make(map[string]podUsage)
+	for _, pod := range summary.Pods {
+		if pod.Network == nil || pod.Network.RxBytes == nil || pod.Network.TxBytes == nil {
+			continue
+		}
+		result[pod.PodRef.Namespace+"/"+pod.PodRef.Name] = podUsage{
+			rxBytes:    *pod.Network.RxBytes,
+			txBytes:    *pod.Network.TxBytes,
+			hasNetwork: true,
+		}
+	}
+	return result, nil
+}
+
 func (s *K8sService) GetAllActivePod(ctx context.Context) ([]coreV1.Pod, error) {
-	allPods, err := clientSet.CoreV1().Pods("").List(ctx, metaV1.ListOptions{
+	allPods, err := s.k8sClient.CoreV1().Pods("").List(ctx, metaV1.ListOptions{
 		FieldSelector: "status.phase=Running",
 	})
 	if err != nil {
@@ -719,7 +1029,7 @@ func (s *K8sService) GetDeploymentActiveCount() (int, error) {
 }
 
 func (s *K8sService) GetGlobalNetworkSet(gnsName string) (*calicov3.GlobalNetworkSet, error) {
-	calicoCs, err := calicoclientset.NewForConfig(config)
+	calicoCs, err := calicoclientset.NewForConfig(s.config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create calico client, error: %v", err)
 	}
@@ -738,7 +1048,7 @@ func (s *K8sService) GetGlobalNetworkSet(gnsName string) (*calicov3.GlobalNetwor
 }
 
 func (s *K8sService) GetGlobalNetworkPolicy(gnpName string) (*calicov3.GlobalNetworkPolicy, error) {
-	calicoCs, err := calicoclientset.NewForConfig(config)
+	calicoCs, err := calicoclientset.NewForConfig(s.config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create calico client, error: %v", err)
 	}
@@ -0,0 +1,105 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// background is the work the daemon runs besides the requests: the deployments and the proof submissions started
+// by the requests, the cron tasks and the tickers. The shutdown stops the schedules and waits for the work in flight.
+var background = struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running atomic.Int64
+
+	mu    sync.Mutex
+	crons []*cron.Cron
+}{}
+
+func init() {
+	background.ctx, background.cancel = context.WithCancel(context.Background())
+}
+
+// shuttingDown reports whether the daemon is shutting down, the long work checks it between its stages and stops
+// early, its checkpoint is resumed on the next start
+func shuttingDown() bool {
+	return background.ctx.Err() != nil
+}
+
+// runInBackground runs fn in a goroutine which the shutdown waits for
+func runInBackground(fn func()) {
+	background.wg.Add(1)
+	background.running.Add(1)
+	go func() {
+		defer func() {
+			background.running.Add(-1)
+			background.wg.Done()
+		}()
+		fn()
+	}()
+}
+
+// runEvery calls fn at every tick until the daemon shuts down, the shutdown waits for a call in progress
+func runEvery(interval time.Duration, fn func(now time.Time)) {
+	runInBackground(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-background.ctx.Done():
+				return
+			case now := <-ticker.C:
+				fn(now)
+			}
+		}
+	})
+}
+
+// startCron starts the schedule of a cron task, it is stopped by the shutdown
+func startCron(c *cron.Cron) {
+	background.mu.Lock()
+	defer background.mu.Unlock()
+	background.crons = append(background.crons, c)
+	c.Start()
+}
+
+// StopBackground stops the cron tasks and the tickers, and waits for the work in flight until ctx is done.
+// The deployments and the proof submissions which do not finish in time keep their checkpoints and are resumed
+// by ResumeCheckpoints on the next start.
+func StopBackground(ctx context.Context) error {
+	background.cancel()
+
+	background.mu.Lock()
+	var stopped []context.Context
+	for _, c := range background.crons {
+		stopped = append(stopped, c.Stop())
+	}
+	background.mu.Unlock()
+
+	for _, stopCtx := range stopped {
+		select {
+		case <-stopCtx.Done():
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the cron tasks to finish")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		background.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d background tasks are still running, the interrupted deployments and proofs are resumed on the next start",
+			background.running.Load())
+	}
+}
@@ -0,0 +1,245 @@
+package computing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const maintenanceFile = "maintenance.json"
+
+// maintenanceCache keeps the state of maintenance.json, the file is written by node drain and node undrain in
+// another process and read again once it is modified
+var maintenanceCache struct {
+	sync.Mutex
+	loaded  bool
+	modTime time.Time
+	state   models.Maintenance
+}
+
+func currentMaintenance() models.Maintenance {
+	maintenanceCache.Lock()
+	defer maintenanceCache.Unlock()
+
+	cpPath, _ := os.LookupEnv("CP_PATH")
+	var modTime time.Time
+	if info, err := os.Stat(filepath.Join(cpPath, maintenanceFile)); err == nil {
+		modTime = info.ModTime()
+	}
+	if maintenanceCache.loaded && modTime.Equal(maintenanceCache.modTime) {
+		return maintenanceCache.state
+	}
+
+	state, err := loadMaintenance()
+	if err != nil {
+		logs.GetLogger().Errorf("failed to reload %s, the last state is kept, error: %v", maintenanceFile, err)
+		maintenanceCache.modTime = modTime
+		maintenanceCache.loaded = true
+		return maintenanceCache.state
+	}
+	if maintenanceCache.loaded && state.Enabled != maintenanceCache.state.Enabled {
+		logs.GetLogger().Warnf("%s is reloaded, maintenance: %v, reason: %s", maintenanceFile, state.Enabled, state.Reason)
+	}
+	maintenanceCache.state = state
+	maintenanceCache.modTime = modTime
+	maintenanceCache.loaded = true
+	return state
+}
+
+func loadMaintenance() (models.Maintenance, error) {
+	var state models.Maintenance
+	cpPath, _ := os.LookupEnv("CP_PATH")
+	bytes, err := os.ReadFile(filepath.Join(cpPath, maintenanceFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err = json.Unmarshal(bytes, &state); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// saveMaintenance replaces the file by a rename, so the daemon never reads a partly written state
+func saveMaintenance(state models.Maintenance) error {
+	bytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	cpPath, _ := os.LookupEnv("CP_PATH")
+	tmpFile := filepath.Join(cpPath, maintenanceFile+".tmp")
+	if err = os.WriteFile(tmpFile, bytes, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filepath.Join(cpPath, maintenanceFile))
+}
+
+// rejectInMaintenance answers the request with MaintenanceError while the cp is under maintenance
+func rejectInMaintenance(c *gin.Context) bool {
+	state := currentMaintenance()
+	if !state.Enabled {
+		return false
+	}
+	if state.Reason != "" {
+		c.JSON(http.StatusServiceUnavailable, util.CreateErrorResponse(util.MaintenanceError, fmt.Sprintf("The cp is under maintenance: %s", state.Reason)))
+	} else {
+		c.JSON(http.StatusServiceUnavailable, util.CreateErrorResponse(util.MaintenanceError))
+	}
+	return true
+}
+
+// DrainNode cordons the node so no new task is placed on it. Without a node the whole cp stops accepting new tasks,
+// and cordon also cordons every node of the default cluster, the nodes of the other clusters are not cordoned.
+// The running tasks are kept until they expire.
+func DrainNode(nodeName, reason string, cordon bool) (models.Maintenance, error) {
+	state, err := loadMaintenance()
+	if err != nil {
+		return state, fmt.Errorf("failed to read %s, error: %v", maintenanceFile, err)
+	}
+
+	if nodeName == "" {
+		if !state.Enabled {
+			state.Since = time.Now().Unix()
+		}
+		state.Enabled = true
+		state.Reason = reason
+	}
+
+	var nodes []string
+	if nodeName != "" {
+		nodes = append(nodes, nodeName)
+	} else if cordon {
+		k8sService := NewK8sService()
+		if k8sService.k8sClient == nil {
+			return state, fmt.Errorf("no kubernetes cluster is configured to cordon the nodes")
+		}
+		nodeList, err := k8sService.k8sClient.CoreV1().Nodes().List(context.TODO(), metaV1.ListOptions{})
+		if err != nil {
+			return state, fmt.Errorf("failed to list the nodes, error: %v", err)
+		}
+		for _, node := range nodeList.Items {
+			nodes = append(nodes, node.Name)
+		}
+	}
+
+	k8sService := NewK8sService()
+	for _, name := range nodes {
+		if k8sService.k8sClient == nil {
+			return state, fmt.Errorf("no kubernetes cluster is configured to cordon node %s", name)
+		}
+		changed, err := k8sService.CordonNode(context.TODO(), name, true)
+		if err != nil {
+			// the nodes cordoned so far are kept in the state, so node undrain can uncordon them
+			if saveErr := saveMaintenance(state); saveErr != nil {
+				logs.GetLogger().Errorf("failed to save %s, error: %v", maintenanceFile, saveErr)
+			}
+			return state, fmt.Errorf("failed to cordon node %s, error: %v", name, err)
+		}
+		// a node which was already cordoned by someone else is only taken over when it is drained by its name
+		if (changed || nodeName != "") && !containsString(state.DrainedNodes, name) {
+			state.DrainedNodes = append(state.DrainedNodes, name)
+		}
+	}
+	sort.Strings(state.DrainedNodes)
+
+	if err = saveMaintenance(state); err != nil {
+		return state, fmt.Errorf("failed to save %s, error: %v", maintenanceFile, err)
+	}
+	return state, nil
+}
+
+// UndrainNode uncordons the node of the default cluster. Without a node the cp accepts new tasks again and the
+// nodes cordoned by DrainNode are uncordoned.
+func UndrainNode(nodeName string) (models.Maintenance, error) {
+	state, err := loadMaintenance()
+	if err != nil {
+		return state, fmt.Errorf("failed to read %s, error: %v", maintenanceFile, err)
+	}
+
+	var nodes []string
+	if nodeName != "" {
+		nodes = append(nodes, nodeName)
+	} else {
+		state.Enabled = false
+		state.Reason = ""
+		state.Since = 0
+		nodes = append(nodes, state.DrainedNodes...)
+	}
+
+	var undrainErr error
+	var failed []string
+	k8sService := NewK8sService()
+	for _, name := range nodes {
+		if k8sService.k8sClient == nil {
+			undrainErr = fmt.Errorf("no kubernetes cluster is configured to uncordon node %s", name)
+			failed = append(failed, name)
+			continue
+		}
+		if _, err := k8sService.CordonNode(context.TODO(), name, false); err != nil {
+			undrainErr = fmt.Errorf("failed to uncordon node %s, error: %v", name, err)
+			failed = append(failed, name)
+		}
+	}
+
+	// the nodes failed to uncordon are kept, so node undrain can be run again
+	var drainedNodes []string
+	for _, name := range state.DrainedNodes {
+		if (nodeName != "" && name != nodeName) || containsString(failed, name) {
+			drainedNodes = append(drainedNodes, name)
+		}
+	}
+	state.DrainedNodes = drainedNodes
+
+	if err = saveMaintenance(state); err != nil {
+		return state, fmt.Errorf("failed to save %s, error: %v", maintenanceFile, err)
+	}
+	return state, undrainErr
+}
+
+// JobsOnNode returns the uuids of the space jobs which are still running on the node of the default cluster
+func JobsOnNode(nodeName string) ([]string, error) {
+	k8sService := NewK8sService()
+	if k8sService.k8sClient == nil {
+		return nil, fmt.Errorf("no kubernetes cluster is configured")
+	}
+	podList, err := k8sService.k8sClient.CoreV1().Pods("").List(context.TODO(), metaV1.ListOptions{
+		FieldSelector: "spec.nodeName=" + nodeName,
+		LabelSelector: "lad_app",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var jobs []string
+	seen := make(map[string]bool)
+	for _, pod := range podList.Items {
+		if jobUuid := pod.Labels["lad_app"]; !seen[jobUuid] {
+			seen[jobUuid] = true
+			jobs = append(jobs, jobUuid)
+		}
+	}
+	sort.Strings(jobs)
+	return jobs, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
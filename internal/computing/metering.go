@@ -0,0 +1,377 @@
+package computing
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
+)
+
+// The usage of the running jobs is sampled every minute and rolled up into windows of five minutes per job
+const (
+	usageSampleSeconds = 60
+	usageWindowSeconds = 300
+	usageRetention     = 30 * 24 * time.Hour
+
+	usageSourceEcp   = "ecp"
+	usageSourceSpace = "space"
+)
+
+// usageSample is one sample of the usage of a job, the network counters are cumulative
+type usageSample struct {
+	cpuCores       float64
+	hasCpu         bool
+	memoryBytes    int64
+	gpuUtil        float64
+	gpuMemoryBytes int64
+	rxBytes        int64
+	txBytes        int64
+	hasNetwork     bool
+}
+
+// usageCounters are the cumulative counters of the previous sample of a job, a counter is only metered from its second sample
+type usageCounters struct {
+	cpuNanos   uint64
+	read       time.Time
+	rxBytes    int64
+	txBytes    int64
+	hasNetwork bool
+}
+
+var usageMeter = struct {
+	sync.Mutex
+	last map[string]usageCounters
+}{last: make(map[string]usageCounters)}
+
+// cpuCoresSince returns the cores used by a container since its previous sample, false for the first sample
+// or when the counter starts again after a restart
+func cpuCoresSince(jobUuid string, cpuNanos uint64, read time.Time) (float64, bool) {
+	usageMeter.Lock()
+	defer usageMeter.Unlock()
+	last, ok := usageMeter.last[jobUuid]
+	var cores float64
+	ok = ok && !last.read.IsZero() && read.After(last.read) && cpuNanos >= last.cpuNanos
+	if ok {
+		cores = float64(cpuNanos-last.cpuNanos) / float64(read.Sub(last.read).Nanoseconds())
+	}
+	last.cpuNanos = cpuNanos
+	last.read = read
+	usageMeter.last[jobUuid] = last
+	return cores, ok
+}
+
+// networkSince returns the bytes received and sent by a job since its previous sample
+func networkSince(jobUuid string, sample usageSample) (int64, int64) {
+	if !sample.hasNetwork {
+		return 0, 0
+	}
+	usageMeter.Lock()
+	defer usageMeter.Unlock()
+	last := usageMeter.last[jobUuid]
+	var rx, tx int64
+	// the counters start again when a container or a pod is restarted
+	if last.hasNetwork && sample.rxBytes >= last.rxBytes && sample.txBytes >= last.txBytes {
+		rx, tx = sample.rxBytes-last.rxBytes, sample.txBytes-last.txBytes
+	}
+	last.rxBytes, last.txBytes, last.hasNetwork = sample.rxBytes, sample.txBytes, true
+	usageMeter.last[jobUuid] = last
+	return rx, tx
+}
+
+// forgetUsageCounters drops the counters of the jobs which are no longer running
+func forgetUsageCounters(running map[string]bool) {
+	usageMeter.Lock()
+	defer usageMeter.Unlock()
+	for jobUuid := range usageMeter.last {
+		if !running[jobUuid] {
+			delete(usageMeter.last, jobUuid)
+		}
+	}
+}
+
+// recordUsage rolls the sample up into the window of the job
+func recordUsage(jobUuid, source string, sample usageSample, now time.Time) error {
+	rx, tx := networkSince(jobUuid, sample)
+
+	usageService := NewJobUsageService()
+	windowStart := now.Unix() - now.Unix()%usageWindowSeconds
+	usage, err := usageService.GetJobUsage(jobUuid, windowStart)
+	if err != nil {
+		return err
+	}
+	if usage.Id == 0 {
+		usage = &models.JobUsageEntity{
+			JobUuid:       jobUuid,
+			WindowStart:   windowStart,
+			WindowSeconds: usageWindowSeconds,
+			Source:        source,
+			SampleSeconds: usageSampleSeconds,
+		}
+	}
+
+	if sample.hasCpu {
+		n := float64(usage.CpuSamples)
+		usage.CpuCoresAvg = (usage.CpuCoresAvg*n + sample.cpuCores) / (n + 1)
+		usage.CpuCoresMax = max(usage.CpuCoresMax, sample.cpuCores)
+		usage.CpuSamples++
+	}
+	n := float64(usage.Samples)
+	usage.MemoryBytesAvg = int64((float64(usage.MemoryBytesAvg)*n + float64(sample.memoryBytes)) / (n + 1))
+	usage.MemoryBytesMax = max(usage.MemoryBytesMax, sample.memoryBytes)
+	usage.GpuUtilAvg = (usage.GpuUtilAvg*n + sample.gpuUtil) / (n + 1)
+	usage.GpuMemoryBytesMax = max(usage.GpuMemoryBytesMax, sample.gpuMemoryBytes)
+	usage.NetworkRxBytes += rx
+	usage.NetworkTxBytes += tx
+	usage.Samples++
+	usage.UpdateTime = now.Unix()
+	return usageService.SaveJobUsage(usage)
+}
+
+// meterEcpUsage samples the containers of the ECP jobs by the stats API of docker
+func meterEcpUsage() {
+	jobs, err := NewEcpJobService().GetEcpJobs("")
+	if err != nil {
+		logs.GetLogger().Errorf("failed to get ecp jobs for metering, error: %v", err)
+		return
+	}
+
+	dockerService := NewDockerService()
+	gpus := readGpuUsage()
+	now := time.Now()
+	running := make(map[string]bool)
+	for _, job := range jobs {
+		if job.ContainerName == "" {
+			continue
+		}
+		inspect, err := dockerService.c.ContainerInspect(context.Background(), job.ContainerName)
+		if err != nil || inspect.State == nil || !inspect.State.Running {
+			continue
+		}
+		stats, err := dockerService.ContainerStats(job.ContainerName)
+		if err != nil {
+			logs.GetLogger().Warnf("failed to get the stats of container %s, error: %v", job.ContainerName, err)
+			continue
+		}
+
+		jobUuid := strings.ToLower(job.Uuid)
+		running[jobUuid] = true
+		sample := usageSample{memoryBytes: int64(stats.MemoryStats.Usage)}
+		sample.cpuCores, sample.hasCpu = cpuCoresSince(jobUuid, stats.CPUStats.CPUUsage.TotalUsage, stats.Read)
+		// the page cache is not counted, as docker stats does
+		for _, key := range []string{"inactive_file", "total_inactive_file"} {
+			if cache, ok := stats.MemoryStats.Stats[key]; ok && cache < stats.MemoryStats.Usage {
+				sample.memoryBytes = int64(stats.MemoryStats.Usage - cache)
+				break
+			}
+		}
+		for _, network := range stats.Networks {
+			sample.rxBytes += int64(network.RxBytes)
+			sample.txBytes += int64(network.TxBytes)
+			sample.hasNetwork = true
+		}
+
+		// the gpus are handed to one container each, so the whole gpu is metered for it
+		if inspect.HostConfig != nil {
+			var count float64
+			for _, request := range inspect.HostConfig.DeviceRequests {
+				for _, id := range request.DeviceIDs {
+					if gpu, ok := gpus[id]; ok {
+						sample.gpuUtil += gpu.util
+						sample.gpuMemoryBytes += gpu.memoryBytes
+						count++
+					}
+				}
+			}
+			if count > 0 {
+				sample.gpuUtil /= count
+			}
+		}
+
+		if err = recordUsage(jobUuid, usageSourceEcp, sample, now); err != nil {
+			logs.GetLogger().Errorf("failed to record the usage of job %s, error: %v", jobUuid, err)
+		}
+	}
+	forgetUsageCounters(running)
+}
+
+// meterSpaceUsage meters the space jobs of every cluster
+func meterSpaceUsage() {
+	for _, k8sService := range K8sServices() {
+		if k8sService.k8sClient == nil {
+			continue
+		}
+		meterClusterUsage(k8sService)
+	}
+}
+
+// meterClusterUsage samples the pods of the space jobs by the metrics API, and their network by the stats summary of the kubelet.
+// The usage of the gpus of a pod is not exposed by the cluster, so it is not metered.
+func meterClusterUsage(k8sService *K8sService) {
+	pods, err := k8sService.GetAllActivePod(context.TODO())
+	if err != nil {
+		logs.GetLogger().Errorf("failed to get pods for metering, cluster: %s, error: %v", k8sService.Cluster, err)
+		return
+	}
+	metrics, err := k8sService.GetPodMetrics(context.TODO())
+	if err != nil {
+		logs.GetLogger().Errorf("failed to meter the space jobs, error: %v", err)
+		return
+	}
+
+	networks := make(map[string]map[string]podUsage)
+	samples := make(map[string]*usageSample)
+	for _, pod := range pods {
+		jobUuid := strings.ToLower(pod.Labels["lad_app"])
+		if jobUuid == "" {
+			continue
+		}
+		key := pod.Namespace + "/" + pod.Name
+		usage, ok := metrics[key]
+		if !ok {
+			continue
+		}
+		sample, ok := samples[jobUuid]
+		if !ok {
+			// the metrics API reports the cores as a rate, so every sample has the cpu
+			sample = &usageSample{hasCpu: true}
+			samples[jobUuid] = sample
+		}
+		sample.cpuCores += usage.cpuCores
+		sample.memoryBytes += usage.memoryBytes
+
+		nodeNetwork, ok := networks[pod.Spec.NodeName]
+		if !ok {
+			if nodeNetwork, err = k8sService.GetPodNetworkStats(context.TODO(), pod.Spec.NodeName); err != nil {
+				logs.GetLogger().Warnf("failed to meter the network of the pods, error: %v", err)
+			}
+			networks[pod.Spec.NodeName] = nodeNetwork
+		}
+		if network, ok := nodeNetwork[key]; ok {
+			sample.rxBytes += network.rxBytes
+			sample.txBytes += network.txBytes
+			sample.hasNetwork = true
+		}
+	}
+
+	now := time.Now()
+	running := make(map[string]bool)
+	for jobUuid, sample := range samples {
+		running[jobUuid] = true
+		if err = recordUsage(jobUuid, usageSourceSpace, *sample, now); err != nil {
+			logs.GetLogger().Errorf("failed to record the usage of job %s, error: %v", jobUuid, err)
+		}
+	}
+	forgetUsageCounters(running)
+}
+
+func deleteExpiredUsage() {
+	deleted, err := NewJobUsageService().DeleteJobUsagesBefore(time.Now().Add(-usageRetention).Unix())
+	if err != nil {
+		logs.GetLogger().Errorf("failed to delete expired job usage, error: %v", err)
+		return
+	}
+	if deleted > 0 {
+		logs.GetLogger().Infof("deleted %d expired job usage windows", deleted)
+	}
+}
+
+type gpuUsage struct {
+	util        float64
+	memoryBytes int64
+}
+
+// readGpuUsage returns the utilization and the used memory of the gpus of this host, keyed by both index and uuid
+func readGpuUsage() map[string]gpuUsage {
+	result := make(map[string]gpuUsage)
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return result
+	}
+	output, err := exec.Command("nvidia-smi", "--query-gpu=index,uuid,utilization.gpu,memory.used", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		logs.GetLogger().Warnf("failed to query the gpu usage by nvidia-smi, error: %v", err)
+		return result
+	}
+	records, err := csv.NewReader(bytes.NewReader(output)).ReadAll()
+	if err != nil {
+		return result
+	}
+	for _, record := range records {
+		if len(record) != 4 {
+			continue
+		}
+		util, _ := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		memoryMiB, _ := strconv.ParseInt(strings.TrimSpace(record[3]), 10, 64)
+		usage := gpuUsage{util: util, memoryBytes: memoryMiB * 1024 * 1024}
+		result[strings.TrimSpace(record[0])] = usage
+		result[strings.TrimSpace(record[1])] = usage
+	}
+	return result
+}
+
+// GetJobUsageReport returns the metered windows of the job since the time, and their summary
+func GetJobUsageReport(jobUuid string, since int64) (models.JobUsageReport, error) {
+	report := models.JobUsageReport{JobUuid: strings.ToLower(jobUuid)}
+	windows, err := NewJobUsageService().GetJobUsages(report.JobUuid, since)
+	if err != nil {
+		return report, err
+	}
+	report.Windows = windows
+
+	var gpuSeconds float64
+	for i, w := range windows {
+		if i == 0 {
+			report.Summary.From = w.WindowStart
+		}
+		report.Summary.To = max(report.Summary.To, w.UpdateTime)
+
+		seconds := w.Samples * w.SampleSeconds
+		report.Summary.MeteredSeconds += seconds
+		report.Summary.CpuCoreHours += w.CpuCoresAvg * float64(seconds) / 3600
+		report.Summary.CpuCoresMax = max(report.Summary.CpuCoresMax, w.CpuCoresMax)
+		report.Summary.MemoryGiBHours += float64(w.MemoryBytesAvg) / 1024 / 1024 / 1024 * float64(seconds) / 3600
+		report.Summary.MemoryBytesMax = max(report.Summary.MemoryBytesMax, w.MemoryBytesMax)
+		gpuSeconds += w.GpuUtilAvg * float64(seconds)
+		report.Summary.GpuMemoryBytesMax = max(report.Summary.GpuMemoryBytesMax, w.GpuMemoryBytesMax)
+		report.Summary.NetworkRxBytes += w.NetworkRxBytes
+		report.Summary.NetworkTxBytes += w.NetworkTxBytes
+	}
+	if report.Summary.MeteredSeconds > 0 {
+		report.Summary.GpuUtilAvg = gpuSeconds / float64(report.Summary.MeteredSeconds)
+	}
+	return report, nil
+}
+
+// GetJobUsage returns the metered usage of a job, the optional since is in unix seconds
+func GetJobUsage(c *gin.Context) {
+	jobUuid := strings.TrimSpace(c.Param("job_uuid"))
+	if jobUuid == "" {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "missing required field: job_uuid"))
+		return
+	}
+	var since int64
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		var err error
+		if since, err = strconv.ParseInt(sinceStr, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "since must be unix seconds"))
+			return
+		}
+	}
+
+	report, err := GetJobUsageReport(jobUuid, since)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to get the usage of job %s, error: %v", jobUuid, err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.ServerError))
+		return
+	}
+	c.JSON(http.StatusOK, util.CreateSuccessResponse(report))
+}
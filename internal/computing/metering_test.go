@@ -0,0 +1,128 @@
+package computing
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCpuCoresSince(t *testing.T) {
+	forgetUsageCounters(nil)
+	t.Cleanup(func() {
+		forgetUsageCounters(nil)
+	})
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		cpuNanos uint64
+		read     time.Time
+		cores    float64
+		ok       bool
+	}{
+		{"first sample", 5e9, start, 0, false},
+		{"two cores", 5e9 + 120e9, start.Add(time.Minute), 2, true},
+		{"same read", 5e9 + 130e9, start.Add(time.Minute), 0, false},
+		{"half a core", 5e9 + 160e9, start.Add(2 * time.Minute), 0.5, true},
+		{"restarted", 1e9, start.Add(3 * time.Minute), 0, false},
+		{"after the restart", 61e9, start.Add(4 * time.Minute), 1, true},
+	}
+	for _, tt := range tests {
+		cores, ok := cpuCoresSince("job", tt.cpuNanos, tt.read)
+		if ok != tt.ok || math.Abs(cores-tt.cores) > 1e-9 {
+			t.Errorf("%s: cpuCoresSince() = %v, %v, want %v, %v", tt.name, cores, ok, tt.cores, tt.ok)
+		}
+	}
+}
+
+func TestNetworkSince(t *testing.T) {
+	forgetUsageCounters(nil)
+	t.Cleanup(func() {
+		forgetUsageCounters(nil)
+	})
+	tests := []struct {
+		name   string
+		sample usageSample
+		rx     int64
+		tx     int64
+	}{
+		{"first sample", usageSample{rxBytes: 100, txBytes: 50, hasNetwork: true}, 0, 0},
+		{"grown", usageSample{rxBytes: 300, txBytes: 80, hasNetwork: true}, 200, 30},
+		{"no network", usageSample{}, 0, 0},
+		{"restarted", usageSample{rxBytes: 10, txBytes: 10, hasNetwork: true}, 0, 0},
+		{"after the restart", usageSample{rxBytes: 25, txBytes: 40, hasNetwork: true}, 15, 30},
+	}
+	for _, tt := range tests {
+		rx, tx := networkSince("job", tt.sample)
+		if rx != tt.rx || tx != tt.tx {
+			t.Errorf("%s: networkSince() = %d, %d, want %d, %d", tt.name, rx, tx, tt.rx, tt.tx)
+		}
+	}
+
+	forgetUsageCounters(map[string]bool{"other": true})
+	if rx, _ := networkSince("job", usageSample{rxBytes: 50, hasNetwork: true}); rx != 0 {
+		t.Errorf("networkSince() after the job stopped = %d, want 0", rx)
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	initTestDb(t)
+	forgetUsageCounters(nil)
+	t.Cleanup(func() {
+		forgetUsageCounters(nil)
+	})
+	window := time.Unix(1700000100, 0) // the start of a window
+	samples := []usageSample{
+		// the first sample of a container has no cpu, it must not pull the average down
+		{memoryBytes: 100, gpuUtil: 50, gpuMemoryBytes: 10, rxBytes: 1000, hasNetwork: true},
+		{cpuCores: 2, hasCpu: true, memoryBytes: 300, gpuUtil: 100, gpuMemoryBytes: 30, rxBytes: 1500, txBytes: 100, hasNetwork: true},
+		{cpuCores: 1, hasCpu: true, memoryBytes: 200, gpuUtil: 0, gpuMemoryBytes: 20, rxBytes: 1600, txBytes: 300, hasNetwork: true},
+	}
+	for i, sample := range samples {
+		if err := recordUsage("job", usageSourceEcp, sample, window.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the next window starts a new row
+	if err := recordUsage("job", usageSourceEcp, usageSample{cpuCores: 4, hasCpu: true, memoryBytes: 400}, window.Add(usageWindowSeconds*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := NewJobUsageService().GetJobUsage("job", window.Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Samples != 3 || usage.CpuSamples != 2 {
+		t.Fatalf("samples = %d, cpu samples = %d, want 3 and 2", usage.Samples, usage.CpuSamples)
+	}
+	if math.Abs(usage.CpuCoresAvg-1.5) > 1e-9 || usage.CpuCoresMax != 2 {
+		t.Errorf("cpu = %v avg %v max, want 1.5 avg 2 max", usage.CpuCoresAvg, usage.CpuCoresMax)
+	}
+	if usage.MemoryBytesAvg != 200 || usage.MemoryBytesMax != 300 {
+		t.Errorf("memory = %d avg %d max, want 200 avg 300 max", usage.MemoryBytesAvg, usage.MemoryBytesMax)
+	}
+	if math.Abs(usage.GpuUtilAvg-50) > 1e-9 || usage.GpuMemoryBytesMax != 30 {
+		t.Errorf("gpu = %v avg %d memory max, want 50 avg 30 memory max", usage.GpuUtilAvg, usage.GpuMemoryBytesMax)
+	}
+	if usage.NetworkRxBytes != 600 || usage.NetworkTxBytes != 300 {
+		t.Errorf("network = %d rx %d tx, want 600 rx 300 tx", usage.NetworkRxBytes, usage.NetworkTxBytes)
+	}
+
+	report, err := GetJobUsageReport("JOB", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Windows) != 2 {
+		t.Fatalf("report has %d windows, want 2", len(report.Windows))
+	}
+	summary := report.Summary
+	if summary.From != window.Unix() || summary.MeteredSeconds != 4*usageSampleSeconds {
+		t.Errorf("summary from %d metered %d seconds, want from %d metered %d seconds", summary.From, summary.MeteredSeconds, window.Unix(), 4*usageSampleSeconds)
+	}
+	// 1.5 cores for the 3 minutes of the first window and 4 cores for the minute of the second one
+	if math.Abs(summary.CpuCoreHours-(1.5*3+4)/60) > 1e-9 || summary.CpuCoresMax != 4 {
+		t.Errorf("summary cpu = %v core hours %v max", summary.CpuCoreHours, summary.CpuCoresMax)
+	}
+	if math.Abs(summary.GpuUtilAvg-37.5) > 1e-9 {
+		t.Errorf("summary gpu util = %v, want 37.5", summary.GpuUtilAvg)
+	}
+}
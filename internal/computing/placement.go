@@ -0,0 +1,392 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// nodePoolLabelPrefix is the label of the nodes of a pool, the pods of the jobs confined to the pool require it
+const nodePoolLabelPrefix = "pool.swanchain.io/"
+
+// spacePlacement is where the replicas of a space job are placed at admission
+type spacePlacement struct {
+	gpuProductName string
+	nodes          []string // the node chosen for each replica
+	pools          []string // the node pools the job is confined to, empty for any node
+	cluster        string   // the cluster of the nodes, empty for the default cluster
+}
+
+// nodeNames returns the chosen nodes without repetition, in the order they were chosen
+func (p spacePlacement) nodeNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, node := range p.nodes {
+		if !seen[node] {
+			seen[node] = true
+			names = append(names, node)
+		}
+	}
+	return names
+}
+
+// placementCandidate is a node which has room for at least one replica
+type placementCandidate struct {
+	node           string
+	replicas       int64
+	freeCpu        int64
+	freeGpu        int64 // the free gpus of the product or the free gpu slices of the profile
+	hasGpu         bool
+	gpuProductName string
+}
+
+func (c placementCandidate) lessFree(o placementCandidate) bool {
+	if c.freeGpu != o.freeGpu {
+		return c.freeGpu < o.freeGpu
+	}
+	return c.freeCpu < o.freeCpu
+}
+
+// rankCandidates orders the nodes by the strategy: binpack fills the busiest nodes first, spread the idlest ones,
+// gpu-affinity keeps the cpu spaces off the gpu nodes and packs the gpu spaces
+func rankCandidates(strategy, taskType string, candidates []placementCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch strategy {
+		case conf.SchedulerBinpack:
+			return a.lessFree(b)
+		case conf.SchedulerGpuAffinity:
+			if taskType == "CPU" && a.hasGpu != b.hasGpu {
+				return !a.hasGpu
+			}
+			return a.lessFree(b)
+		default:
+			return b.lessFree(a)
+		}
+	})
+}
+
+// placeReplicas chooses a node for each replica from the ranked nodes, the spread strategy takes one node in turn
+// and the others fill a node before taking the next. The replicas of a gpu space share one gpu product.
+func placeReplicas(strategy string, candidates []placementCandidate, replicas int) spacePlacement {
+	placement := spacePlacement{gpuProductName: placementGpuProduct(candidates, replicas)}
+	var chosen []placementCandidate
+	for _, c := range candidates {
+		if c.gpuProductName != "" && c.gpuProductName != placement.gpuProductName {
+			continue
+		}
+		chosen = append(chosen, c)
+	}
+
+	if strategy == conf.SchedulerSpread {
+		for placed := true; placed && len(placement.nodes) < replicas; {
+			placed = false
+			for i := range chosen {
+				if chosen[i].replicas > 0 && len(placement.nodes) < replicas {
+					placement.nodes = append(placement.nodes, chosen[i].node)
+					chosen[i].replicas--
+					placed = true
+				}
+			}
+		}
+		return placement
+	}
+
+	for _, c := range chosen {
+		for n := int64(0); n < c.replicas && len(placement.nodes) < replicas; n++ {
+			placement.nodes = append(placement.nodes, c.node)
+		}
+	}
+	return placement
+}
+
+// placementGpuProduct picks the gpu product of the replicas, the first one in the ranked nodes which has room for all
+// of them, or the first one ranked when none has
+func placementGpuProduct(candidates []placementCandidate, replicas int) string {
+	var first string
+	room := make(map[string]int64)
+	for _, c := range candidates {
+		if c.gpuProductName == "" {
+			continue
+		}
+		if first == "" {
+			first = c.gpuProductName
+		}
+		room[c.gpuProductName] += c.replicas
+	}
+	for _, c := range candidates {
+		if c.gpuProductName != "" && room[c.gpuProductName] >= int64(replicas) {
+			return c.gpuProductName
+		}
+	}
+	return first
+}
+
+// schedulableNode reports whether new pods with the tolerations can be placed on the node, a cordoned node or a node
+// tainted with NoSchedule or NoExecute which the pods do not tolerate is skipped
+func schedulableNode(node *coreV1.Node, tolerations []coreV1.Toleration) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect != coreV1.TaintEffectNoSchedule && taint.Effect != coreV1.TaintEffectNoExecute {
+			continue
+		}
+		if !toleratesTaint(tolerations, &taint) {
+			return false
+		}
+	}
+	return true
+}
+
+func toleratesTaint(tolerations []coreV1.Toleration, taint *coreV1.Taint) bool {
+	for _, toleration := range tolerations {
+		if toleration.ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// gpuTaintKey is the taint the gpu operator and the cloud providers put on the gpu nodes
+const gpuTaintKey = "nvidia.com/gpu"
+
+// jobTolerations returns the tolerations of the pods of a job confined to the pools, the pods of a gpu job
+// also tolerate the taint of the gpu nodes
+func jobTolerations(pools []conf.NodePool, requestsGpu bool) []coreV1.Toleration {
+	var tolerations []coreV1.Toleration
+	for _, pool := range pools {
+		for _, t := range pool.Tolerations {
+			tolerations = append(tolerations, coreV1.Toleration{
+				Key:      t.Key,
+				Operator: coreV1.TolerationOperator(t.Operator),
+				Value:    t.Value,
+				Effect:   coreV1.TaintEffect(t.Effect),
+			})
+		}
+	}
+	if requestsGpu {
+		tolerations = append(tolerations, coreV1.Toleration{Key: gpuTaintKey, Operator: coreV1.TolerationOpExists})
+	}
+	return tolerations
+}
+
+// namedPools returns the configured pools of the names
+func namedPools(names []string) []conf.NodePool {
+	var pools []conf.NodePool
+	for _, pool := range conf.GetConfig().Scheduler.NodePools {
+		for _, name := range names {
+			if pool.Name == name {
+				pools = append(pools, pool)
+				break
+			}
+		}
+	}
+	return pools
+}
+
+func nodeInPool(node *coreV1.Node, pool conf.NodePool) bool {
+	for _, name := range pool.Nodes {
+		if name == node.Name {
+			return true
+		}
+	}
+	if len(pool.Labels) == 0 {
+		return false
+	}
+	for key, value := range pool.Labels {
+		if v, ok := node.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func nodeInPools(node *coreV1.Node, pools []conf.NodePool) bool {
+	for _, pool := range pools {
+		if nodeInPool(node, pool) {
+			return true
+		}
+	}
+	return false
+}
+
+func poolNames(pools []conf.NodePool) []string {
+	var names []string
+	for _, pool := range pools {
+		names = append(names, pool.Name)
+	}
+	return names
+}
+
+func poolLabel(name string) string {
+	return nodePoolLabelPrefix + name
+}
+
+// spaceTypeName returns the space type of a job entity for the node pools
+func spaceTypeName(spaceType int) string {
+	if spaceType == 1 {
+		return constants.SPACE_TYPE_PRIVATE
+	}
+	return constants.SPACE_TYPE_PUBLIC
+}
+
+// labelNodePools keeps the pool labels of the nodes in line with the configured pools
+func labelNodePools(k8sService *K8sService, nodes []coreV1.Node) {
+	pools := conf.GetConfig().Scheduler.NodePools
+	for _, node := range nodes {
+		want := make(map[string]bool)
+		for _, pool := range pools {
+			if nodeInPool(&node, pool) {
+				want[poolLabel(pool.Name)] = true
+			}
+		}
+
+		changed := false
+		for key := range node.Labels {
+			if strings.HasPrefix(key, nodePoolLabelPrefix) && !want[key] {
+				changed = true
+			}
+		}
+		for key := range want {
+			if node.Labels[key] != "true" {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			current, err := k8sService.k8sClient.CoreV1().Nodes().Get(context.TODO(), node.Name, metaV1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if current.Labels == nil {
+				current.Labels = make(map[string]string)
+			}
+			for key := range current.Labels {
+				if strings.HasPrefix(key, nodePoolLabelPrefix) && !want[key] {
+					delete(current.Labels, key)
+				}
+			}
+			for key := range want {
+				current.Labels[key] = "true"
+			}
+			_, err = k8sService.k8sClient.CoreV1().Nodes().Update(context.TODO(), current, metaV1.UpdateOptions{})
+			return err
+		})
+		if err != nil {
+			logs.GetLogger().Errorf("failed to update the pool labels of node %s, error: %v", node.Name, err)
+		}
+	}
+}
+
+// jobPodNodes returns the nodes where the pods of the job are running
+func jobPodNodes(namespace, jobUuid string) ([]string, error) {
+	podList, err := NewK8sServiceForJob(jobUuid).k8sClient.CoreV1().Pods(namespace).List(context.TODO(), metaV1.ListOptions{
+		LabelSelector: fmt.Sprintf("lad_app==%s", strings.ToLower(jobUuid)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	seen := make(map[string]bool)
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName != "" && !seen[pod.Spec.NodeName] {
+			seen[pod.Spec.NodeName] = true
+			nodes = append(nodes, pod.Spec.NodeName)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// refreshJobNodeName records the nodes where the pods of the job run when they are not the recorded ones, the scheduler
+// may place the replicas on other nodes than the ones chosen at admission
+func refreshJobNodeName(namespace, jobUuid, nodeName string) {
+	nodes, err := jobPodNodes(namespace, jobUuid)
+	if err != nil || len(nodes) == 0 || strings.Join(nodes, ",") == nodeName {
+		return
+	}
+	if err = NewJobService().UpdateJobEntityByJobUuid(&models.JobEntity{JobUuid: jobUuid, NodeName: strings.Join(nodes, ",")}); err != nil {
+		logs.GetLogger().Errorf("failed to update the nodes of job %s, error: %v", jobUuid, err)
+	}
+}
+
+// tolerations are the tolerations of the pods, the same ones the nodes were chosen with at admission
+func (d *Deploy) tolerations() []coreV1.Toleration {
+	return jobTolerations(namedPools(d.placement.pools), d.hardwareResource.Gpu.Quantity > 0)
+}
+
+// nodeAffinity requires the pool labels of the job and prefers the nodes chosen at admission
+func (d *Deploy) nodeAffinity() *coreV1.NodeAffinity {
+	var nodeAffinity coreV1.NodeAffinity
+	if len(d.placement.pools) > 0 {
+		selector := &coreV1.NodeSelector{}
+		for _, pool := range d.placement.pools {
+			selector.NodeSelectorTerms = append(selector.NodeSelectorTerms, coreV1.NodeSelectorTerm{
+				MatchExpressions: []coreV1.NodeSelectorRequirement{{
+					Key:      poolLabel(pool),
+					Operator: coreV1.NodeSelectorOpExists,
+				}},
+			})
+		}
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = selector
+	}
+	if nodes := d.placement.nodeNames(); len(nodes) > 0 {
+		nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []coreV1.PreferredSchedulingTerm{{
+			Weight: 50,
+			Preference: coreV1.NodeSelectorTerm{
+				MatchFields: []coreV1.NodeSelectorRequirement{{
+					Key:      "metadata.name",
+					Operator: coreV1.NodeSelectorOpIn,
+					Values:   nodes,
+				}},
+			},
+		}}
+	}
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil && nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	return &nodeAffinity
+}
+
+// placementAffinity confines the pods to the node pools of the job, and spreads the replicas across the nodes or
+// packs them by the strategy, the scheduler still places them elsewhere when the preferred nodes have no room.
+// It is also set for one replica, so the job can be scaled without restarting its pods.
+// A ReadWriteOnce volume can only be mounted on one node, so the replicas stay together.
+func (d *Deploy) placementAffinity(readWriteOnceVolume bool) *coreV1.Affinity {
+	affinity := &coreV1.Affinity{NodeAffinity: d.nodeAffinity()}
+	if !readWriteOnceVolume {
+		terms := []coreV1.WeightedPodAffinityTerm{
+			{
+				Weight: 100,
+				PodAffinityTerm: coreV1.PodAffinityTerm{
+					LabelSelector: &metaV1.LabelSelector{
+						MatchLabels: map[string]string{"lad_app": d.jobUuid},
+					},
+					TopologyKey: "kubernetes.io/hostname",
+				},
+			},
+		}
+		if conf.GetConfig().Scheduler.GetStrategy() == conf.SchedulerSpread {
+			affinity.PodAntiAffinity = &coreV1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: terms}
+		} else {
+			affinity.PodAffinity = &coreV1.PodAffinity{PreferredDuringSchedulingIgnoredDuringExecution: terms}
+		}
+	}
+	if affinity.NodeAffinity == nil && affinity.PodAffinity == nil && affinity.PodAntiAffinity == nil {
+		return nil
+	}
+	return affinity
+}
@@ -0,0 +1,147 @@
+package computing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/swanchain/go-computing-provider/conf"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSchedulableNode(t *testing.T) {
+	dedicated := coreV1.Taint{Key: "dedicated", Value: "pool-a", Effect: coreV1.TaintEffectNoSchedule}
+	gpu := coreV1.Taint{Key: gpuTaintKey, Value: "present", Effect: coreV1.TaintEffectNoSchedule}
+	poolA := conf.NodePool{
+		Name:        "pool-a",
+		Tolerations: []conf.NodeToleration{{Key: "dedicated", Operator: "Equal", Value: "pool-a", Effect: "NoSchedule"}},
+	}
+	tests := []struct {
+		name          string
+		unschedulable bool
+		taints        []coreV1.Taint
+		tolerations   []coreV1.Toleration
+		want          bool
+	}{
+		{"untainted", false, nil, nil, true},
+		{"cordoned", true, nil, jobTolerations([]conf.NodePool{poolA}, true), false},
+		{"prefer no schedule", false, []coreV1.Taint{{Key: "spot", Effect: coreV1.TaintEffectPreferNoSchedule}}, nil, true},
+		{"no schedule not tolerated", false, []coreV1.Taint{dedicated}, nil, false},
+		{"no execute not tolerated", false, []coreV1.Taint{{Key: "maintenance", Effect: coreV1.TaintEffectNoExecute}}, nil, false},
+		{"tolerated by the pool", false, []coreV1.Taint{dedicated}, jobTolerations([]conf.NodePool{poolA}, false), true},
+		{"gpu taint of a cpu job", false, []coreV1.Taint{gpu}, jobTolerations(nil, false), false},
+		{"gpu taint of a gpu job", false, []coreV1.Taint{gpu}, jobTolerations(nil, true), true},
+		{"one of the taints not tolerated", false, []coreV1.Taint{gpu, dedicated}, jobTolerations(nil, true), false},
+		{"all the taints tolerated", false, []coreV1.Taint{gpu, dedicated}, jobTolerations([]conf.NodePool{poolA}, true), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &coreV1.Node{Spec: coreV1.NodeSpec{Unschedulable: tt.unschedulable, Taints: tt.taints}}
+			if got := schedulableNode(node, tt.tolerations); got != tt.want {
+				t.Errorf("schedulableNode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	candidates := []placementCandidate{
+		{node: "gpu-busy", freeCpu: 4, freeGpu: 1, hasGpu: true},
+		{node: "cpu-idle", freeCpu: 32},
+		{node: "gpu-idle", freeCpu: 16, freeGpu: 4, hasGpu: true},
+		{node: "cpu-busy", freeCpu: 2},
+	}
+	tests := []struct {
+		strategy string
+		taskType string
+		want     string
+	}{
+		{conf.SchedulerSpread, "GPU", "gpu-idle,gpu-busy,cpu-idle,cpu-busy"},
+		{conf.SchedulerBinpack, "GPU", "cpu-busy,cpu-idle,gpu-busy,gpu-idle"},
+		{conf.SchedulerGpuAffinity, "GPU", "cpu-busy,cpu-idle,gpu-busy,gpu-idle"},
+		{conf.SchedulerGpuAffinity, "CPU", "cpu-busy,cpu-idle,gpu-busy,gpu-idle"},
+		{"", "CPU", "gpu-idle,gpu-busy,cpu-idle,cpu-busy"},
+	}
+	for _, tt := range tests {
+		ranked := append([]placementCandidate{}, candidates...)
+		rankCandidates(tt.strategy, tt.taskType, ranked)
+		var nodes []string
+		for _, c := range ranked {
+			nodes = append(nodes, c.node)
+		}
+		if got := strings.Join(nodes, ","); got != tt.want {
+			t.Errorf("rankCandidates(%s, %s) = %s, want %s", tt.strategy, tt.taskType, got, tt.want)
+		}
+	}
+
+	// gpu-affinity keeps a cpu space off a gpu node even when the gpu node is busier
+	ranked := []placementCandidate{{node: "gpu", freeCpu: 1, hasGpu: true}, {node: "cpu", freeCpu: 64}}
+	rankCandidates(conf.SchedulerGpuAffinity, "CPU", ranked)
+	if ranked[0].node != "cpu" {
+		t.Errorf("gpu-affinity ranked %s first for a cpu space, want cpu", ranked[0].node)
+	}
+}
+
+func TestPlaceReplicas(t *testing.T) {
+	candidates := []placementCandidate{
+		{node: "a", replicas: 2, gpuProductName: "NVIDIA A100"},
+		{node: "b", replicas: 1, gpuProductName: "NVIDIA H100"},
+		{node: "c", replicas: 3, gpuProductName: "NVIDIA A100"},
+	}
+	tests := []struct {
+		name       string
+		strategy   string
+		candidates []placementCandidate
+		replicas   int
+		nodes      string
+		product    string
+	}{
+		{"spread takes the nodes in turn", conf.SchedulerSpread, candidates, 4, "a,c,a,c", "NVIDIA A100"},
+		{"binpack fills a node first", conf.SchedulerBinpack, candidates, 4, "a,a,c,c", "NVIDIA A100"},
+		{"not enough room", conf.SchedulerBinpack, candidates, 9, "a,a,c,c,c", "NVIDIA A100"},
+		{"spread without room", conf.SchedulerSpread, candidates, 9, "a,c,a,c,c", "NVIDIA A100"},
+		{"cpu nodes", conf.SchedulerSpread, []placementCandidate{{node: "x", replicas: 1}, {node: "y", replicas: 1}}, 2, "x,y", ""},
+		{"no replicas", conf.SchedulerSpread, candidates, 0, "", "NVIDIA A100"},
+		{"the first product has no room for all", conf.SchedulerBinpack, []placementCandidate{
+			{node: "b", replicas: 1, gpuProductName: "NVIDIA H100"},
+			{node: "a", replicas: 2, gpuProductName: "NVIDIA A100"},
+			{node: "c", replicas: 1, gpuProductName: "NVIDIA A100"},
+		}, 3, "a,a,c", "NVIDIA A100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placement := placeReplicas(tt.strategy, tt.candidates, tt.replicas)
+			if got := strings.Join(placement.nodes, ","); got != tt.nodes {
+				t.Errorf("nodes = %s, want %s", got, tt.nodes)
+			}
+			if placement.gpuProductName != tt.product {
+				t.Errorf("gpu product = %q, want %q", placement.gpuProductName, tt.product)
+			}
+		})
+	}
+
+	placement := spacePlacement{nodes: []string{"a", "c", "a", "c"}}
+	if got := strings.Join(placement.nodeNames(), ","); got != "a,c" {
+		t.Errorf("nodeNames() = %s, want a,c", got)
+	}
+}
+
+func TestNodeInPool(t *testing.T) {
+	node := &coreV1.Node{ObjectMeta: metaV1.ObjectMeta{Name: "node-1", Labels: map[string]string{"zone": "a", "disk": "ssd"}}}
+	tests := []struct {
+		name string
+		pool conf.NodePool
+		want bool
+	}{
+		{"by name", conf.NodePool{Nodes: []string{"node-0", "node-1"}}, true},
+		{"by labels", conf.NodePool{Labels: map[string]string{"zone": "a", "disk": "ssd"}}, true},
+		{"one label differs", conf.NodePool{Labels: map[string]string{"zone": "a", "disk": "hdd"}}, false},
+		{"label missing", conf.NodePool{Labels: map[string]string{"gpu": "true"}}, false},
+		{"empty pool", conf.NodePool{}, false},
+	}
+	for _, tt := range tests {
+		if got := nodeInPool(node, tt.pool); got != tt.want {
+			t.Errorf("%s: nodeInPool() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
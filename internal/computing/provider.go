@@ -65,6 +65,14 @@ func GenerateNodeID(cpRepoPath string) (string, string, string) {
 	return nodeID, peerID, address
 }
 
+func loadNodePrivateKey(cpRepoPath string) (*ecdsa.PrivateKey, error) {
+	privateKeyBytes, err := os.ReadFile(filepath.Join(cpRepoPath, "private_key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node private key, error: %v", err)
+	}
+	return crypto.ToECDSA(privateKeyBytes)
+}
+
 func hashPublicKey(publicKey *ecdsa.PublicKey) string {
 	publicKeyBytes := crypto.FromECDSAPub(publicKey)
 	hash := sha256.Sum256(publicKeyBytes)
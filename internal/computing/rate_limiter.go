@@ -0,0 +1,101 @@
+package computing
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/util"
+	"golang.org/x/time/rate"
+)
+
+const (
+	rateLimitGroupKey = "rate_limit_group"
+	bucketIdleTimeout = 10 * time.Minute
+)
+
+var requestLimiter = newRateLimiter()
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	once    sync.Once
+}
+
+type tokenBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+func (r *rateLimiter) allow(key string, limit float64, burst int) bool {
+	if limit <= 0 {
+		return true
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	r.once.Do(func() {
+		go r.cleanup()
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.buckets[key]
+	if !ok || b.limiter.Limit() != rate.Limit(limit) || b.limiter.Burst() != burst {
+		b = &tokenBucket{limiter: rate.NewLimiter(rate.Limit(limit), burst)}
+		r.buckets[key] = b
+	}
+	b.lastSeen = time.Now()
+	return b.limiter.Allow()
+}
+
+func (r *rateLimiter) cleanup() {
+	ticker := time.NewTicker(bucketIdleTimeout)
+	for range ticker.C {
+		r.mu.Lock()
+		for key, b := range r.buckets {
+			if time.Since(b.lastSeen) > bucketIdleTimeout {
+				delete(r.buckets, key)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// RateLimit throttles the requests of the route group by client ip, and records the group
+// so that the handler can throttle by signing key after the signature is verified.
+func RateLimit(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(rateLimitGroupKey, group)
+		rule := conf.GetConfig().RateLimit.GetRule(group)
+		if !requestLimiter.allow(group+"|ip|"+c.ClientIP(), rule.IpRate, rule.IpBurst) {
+			logs.GetLogger().Warnf("too many requests, group: %s, client: %s, path: %s", group, c.ClientIP(), c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, util.CreateErrorResponse(util.TooManyRequestsError))
+			return
+		}
+		c.Next()
+	}
+}
+
+// allowSigner takes a token from the bucket of the signing key, it writes the error response when throttled
+func allowSigner(c *gin.Context, signer string) bool {
+	group := c.GetString(rateLimitGroupKey)
+	if group == "" {
+		return true
+	}
+	rule := conf.GetConfig().RateLimit.GetRule(group)
+	if !requestLimiter.allow(group+"|key|"+strings.ToLower(signer), rule.KeyRate, rule.KeyBurst) {
+		logs.GetLogger().Warnf("too many requests, group: %s, signer: %s, path: %s", group, signer, c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, util.CreateErrorResponse(util.TooManyRequestsError))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package computing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   float64
+		burst   int
+		allowed int // of 5 requests at once
+	}{
+		{"unlimited", 0, 0, 5},
+		{"burst", 0.001, 3, 3},
+		{"burst defaults to one", 0.001, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter()
+			var allowed int
+			for i := 0; i < 5; i++ {
+				if limiter.allow("key", tt.limit, tt.burst) {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d requests, want %d", allowed, tt.allowed)
+			}
+		})
+	}
+
+	// the buckets of the keys are apart, and a changed rule starts a new bucket
+	limiter := newRateLimiter()
+	if !limiter.allow("a", 0.001, 1) || limiter.allow("a", 0.001, 1) {
+		t.Fatal("the bucket of a should allow exactly one request")
+	}
+	if !limiter.allow("b", 0.001, 1) {
+		t.Error("the bucket of b should not be taken by a")
+	}
+	if !limiter.allow("a", 0.001, 2) {
+		t.Error("a changed burst should start a new bucket")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	initTestConfig(t, `
+[RateLimit.Rules.check]
+IpRate = 0.001
+IpBurst = 2
+`)
+	gin.SetMode(gin.TestMode)
+	requestLimiter = newRateLimiter()
+	r := gin.New()
+	r.GET("/check", RateLimit("check"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/check", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("request %d status = %d, want %d", i, w.Code, want)
+		}
+	}
+
+	// another client has its own bucket
+	req := httptest.NewRequest(http.MethodGet, "/check", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("status of another client = %d, want %d", w.Code, http.StatusOK)
+	}
+}
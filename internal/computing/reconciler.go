@@ -0,0 +1,380 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	appV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileGracePeriod is how long a job which is still deploying may have no deployment yet
+const reconcileGracePeriod = 10 * time.Minute
+
+// reconciler compares the database with the cluster or the containers, the work which has a checkpoint is
+// left to ResumeCheckpoints
+type reconciler struct {
+	report      models.ReconcileReport
+	checkpoints map[string]bool
+}
+
+func newReconciler(dryRun bool, policy string) (*reconciler, error) {
+	if err := conf.ValidateOrphanPolicy(policy); err != nil {
+		return nil, err
+	}
+	checkpoints, err := NewCheckpointService().GetCheckpoints()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the checkpoints, error: %v", err)
+	}
+	r := &reconciler{
+		report: models.ReconcileReport{
+			Time:   time.Now().Unix(),
+			DryRun: dryRun,
+			Policy: policy,
+		},
+		checkpoints: make(map[string]bool),
+	}
+	for _, entity := range checkpoints {
+		r.checkpoints[entity.Kind+"/"+entity.WorkKey] = true
+	}
+	return r, nil
+}
+
+func (r *reconciler) inFlight(kind, workKey string) bool {
+	return r.checkpoints[kind+"/"+workKey]
+}
+
+// fix records the item and runs its fix unless it is a dry run, an item without a fix is only reported
+func (r *reconciler) fix(kind, id, found, action string, fn func() error) {
+	if fn != nil {
+		if r.report.DryRun {
+			action = "would " + action
+		} else if err := fn(); err != nil {
+			action = fmt.Sprintf("failed to %s, error: %v", action, err)
+		}
+	}
+	r.report.Items = append(r.report.Items, models.ReconcileItem{
+		Kind:   kind,
+		Id:     id,
+		Found:  found,
+		Action: action,
+	})
+}
+
+// ReconcileForK8s compares the space jobs and the ubi tasks in the database with the deployments and the namespaces
+// of the cluster. The rows which claim a deployment which does not exist are closed, the status of the available
+// deployments is corrected, and the deployments of no job are kept, adopted or removed by the policy.
+func ReconcileForK8s(dryRun bool, policy string) (models.ReconcileReport, error) {
+	r, err := newReconciler(dryRun, policy)
+	if err != nil {
+		return models.ReconcileReport{}, err
+	}
+
+	ctx := context.TODO()
+	// every cluster must be listed, otherwise the jobs of a missing cluster would be closed
+	deployOnK8s := make(map[string]appV1.Deployment)
+	deployCluster := make(map[string]string)
+	for _, service := range K8sServices() {
+		if service.k8sClient == nil {
+			return models.ReconcileReport{}, fmt.Errorf("the kubernetes cluster %q is not connected", service.Cluster)
+		}
+		deployments, err := service.k8sClient.AppsV1().Deployments(metaV1.NamespaceAll).List(ctx, metaV1.ListOptions{})
+		if err != nil {
+			return models.ReconcileReport{}, fmt.Errorf("failed to list the deployments of cluster %q, error: %v", service.Cluster, err)
+		}
+		for _, deploy := range deployments.Items {
+			if strings.HasPrefix(deploy.Namespace, constants.K8S_NAMESPACE_NAME_PREFIX) && strings.HasPrefix(deploy.Name, constants.K8S_DEPLOY_NAME_PREFIX) {
+				uuid := strings.TrimPrefix(deploy.Name, constants.K8S_DEPLOY_NAME_PREFIX)
+				deployOnK8s[uuid] = deploy
+				deployCluster[uuid] = service.Cluster
+			}
+		}
+	}
+
+	jobList, err := NewJobService().GetJobList(models.All_FLAG)
+	if err != nil {
+		return models.ReconcileReport{}, fmt.Errorf("failed to get the jobs, error: %v", err)
+	}
+	now := time.Now()
+	known := make(map[string]bool)
+	deleted := make(map[string]*models.JobEntity)
+	for _, job := range jobList {
+		jobUuid := strings.ToLower(job.JobUuid)
+		if job.DeleteAt == models.DELETED_FLAG {
+			deleted[jobUuid] = job
+			continue
+		}
+		known[jobUuid] = true
+
+		// compatible with the deployments named by the space_uuid
+		deploy, ok := deployOnK8s[jobUuid]
+		if job.SpaceUuid != "" {
+			known[strings.ToLower(job.SpaceUuid)] = true
+			if !ok {
+				deploy, ok = deployOnK8s[strings.ToLower(job.SpaceUuid)]
+			}
+		}
+		if r.inFlight(checkpointSpaceDeploy, job.JobUuid) {
+			continue
+		}
+
+		switch {
+		case ok && deploy.Status.AvailableReplicas > 0:
+			if job.Status != models.JOB_RUNNING_STATUS {
+				r.fix("job", job.JobUuid, fmt.Sprintf("%s in the database, %d replicas available", models.GetJobStatus(job.Status), deploy.Status.AvailableReplicas),
+					"mark running", func() error {
+						return NewJobService().UpdateJobEntityByJobUuid(&models.JobEntity{
+							JobUuid:      job.JobUuid,
+							DeployStatus: models.DEPLOY_TO_K8S,
+							PodStatus:    models.POD_RUNNING_STATUS,
+							Status:       models.JOB_RUNNING_STATUS,
+						})
+					})
+			}
+		case ok:
+			// the replicas are still starting, watchExpiredTask deletes the deployment which never becomes available.
+			// TaskMap of the deploy interrupted after its deployment was created is restored for checkJobStatus, the
+			// doctor runs without the cp, so its entry is restored by the next start.
+			if job.DeployStatus < models.DEPLOY_TO_K8S {
+				r.fix("job", job.JobUuid, fmt.Sprintf("%s in the database, the replicas are starting", models.GetDeployStatusStr(job.DeployStatus)),
+					"restore the deploy status report", func() error {
+						TaskMap.Store(job.JobUuid, &models.Job{Uuid: job.JobUuid, Status: models.DEPLOY_TO_K8S, Url: job.RealUrl})
+						return nil
+					})
+			}
+		default:
+			if job.Status != models.JOB_RUNNING_STATUS && now.Sub(time.Unix(job.CreateTime, 0)) < reconcileGracePeriod {
+				continue
+			}
+			status := models.JOB_TERMINATED_STATUS
+			if job.ExpireTime > 0 && now.Unix() > job.ExpireTime {
+				status = models.JOB_COMPLETED_STATUS
+			}
+			r.fix("job", job.JobUuid, fmt.Sprintf("%s in the database, no deployment", models.GetJobStatus(job.Status)),
+				"mark "+models.GetJobStatus(status), func() error {
+					return NewJobService().DeleteJobEntityByJobUuId(job.JobUuid, status)
+				})
+		}
+	}
+
+	var orphans []string
+	for uuid := range deployOnK8s {
+		if !known[uuid] {
+			orphans = append(orphans, uuid)
+		}
+	}
+	sort.Strings(orphans)
+	for _, uuid := range orphans {
+		deploy := deployOnK8s[uuid]
+		id := deploy.Namespace + "/" + deploy.Name
+		switch r.report.Policy {
+		case conf.OrphanAdopt:
+			job, ok := deleted[uuid]
+			if !ok || job.ExpireTime <= now.Unix() {
+				r.fix("orphan", id, "deployment of no job", "keep, no unexpired job to adopt it", nil)
+				continue
+			}
+			r.fix("orphan", id, "deployment of a deleted job", "restore the job", func() error {
+				return NewJobService().RestoreJobEntity(job.JobUuid)
+			})
+		case conf.OrphanRemove:
+			// DeleteJob finds the cluster by the job, so a deployment outside the cluster recorded on its job is kept.
+			// A job of no cluster, or no job at all, is in the default cluster.
+			jobCluster := NewJobService().GetJobCluster(uuid)
+			if jobCluster == "" {
+				jobCluster = DefaultCluster()
+			}
+			if cluster := deployCluster[uuid]; cluster != jobCluster {
+				r.fix("orphan", id, "deployment of no job", fmt.Sprintf("keep, remove it from cluster %q by hand", cluster), nil)
+				continue
+			}
+			r.fix("orphan", id, "deployment of no job", "remove the deployment", func() error {
+				return DeleteJob(deploy.Namespace, uuid, "reconcile the orphan deployment")
+			})
+		default:
+			r.fix("orphan", id, "deployment of no job", "keep", nil)
+		}
+	}
+
+	// the ubi tasks run in the default cluster
+	namespaces, err := NewK8sService().k8sClient.CoreV1().Namespaces().List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		return r.report, fmt.Errorf("failed to list the namespaces, error: %v", err)
+	}
+	ubiNamespaces := make(map[string]bool)
+	for _, namespace := range namespaces.Items {
+		if strings.HasPrefix(namespace.Name, "ubi-task-") {
+			ubiNamespaces[namespace.Name] = true
+		}
+	}
+	err = r.reconcileTasks(func(task *models.TaskEntity) bool {
+		return ubiNamespaces["ubi-task-"+strconv.FormatInt(task.Id, 10)]
+	})
+	return r.report, err
+}
+
+// ReconcileForDocker compares the ecp jobs and the ubi tasks in the database with the containers of this host. The
+// jobs whose containers are all gone are closed, the status of the containers is corrected, and the containers of
+// no job are kept, adopted or removed by the policy.
+func ReconcileForDocker(dryRun bool, policy string) (models.ReconcileReport, error) {
+	r, err := newReconciler(dryRun, policy)
+	if err != nil {
+		return models.ReconcileReport{}, err
+	}
+
+	containers, err := NewDockerService().c.ContainerList(context.TODO(), container.ListOptions{All: true})
+	if err != nil {
+		return models.ReconcileReport{}, fmt.Errorf("failed to list the containers, error: %v", err)
+	}
+	containerStatus := make(map[string]string)
+	jobContainers := make(map[string][]string)
+	for _, c := range containers {
+		for _, name := range c.Names {
+			name = strings.TrimPrefix(name, "/")
+			containerStatus[name] = c.State
+			if jobUuid := c.Labels[ecpJobLabel]; jobUuid != "" {
+				jobContainers[jobUuid] = append(jobContainers[jobUuid], name)
+			}
+		}
+	}
+
+	ecpJobs, err := NewEcpJobService().GetEcpJobs("")
+	if err != nil {
+		return models.ReconcileReport{}, fmt.Errorf("failed to get the ecp jobs, error: %v", err)
+	}
+	// a compose job has one entity for each of its containers
+	var jobUuids []string
+	entities := make(map[string][]models.EcpJobEntity)
+	for _, job := range ecpJobs {
+		if _, ok := entities[job.Uuid]; !ok {
+			jobUuids = append(jobUuids, job.Uuid)
+		}
+		entities[job.Uuid] = append(entities[job.Uuid], job)
+	}
+
+	for _, jobUuid := range jobUuids {
+		if r.inFlight(checkpointEcpDeploy, jobUuid) {
+			continue
+		}
+		jobEntities := entities[jobUuid]
+		var alive []string
+		for _, entity := range jobEntities {
+			if status, ok := containerStatus[entity.ContainerName]; ok {
+				alive = append(alive, status)
+			}
+		}
+
+		switch {
+		case len(alive) == 0:
+			r.fix("ecp_job", jobUuid, fmt.Sprintf("%s in the database, no container", jobEntities[0].Status), "mark terminated", func() error {
+				return NewEcpJobService().DeleteContainerByUuid(jobUuid)
+			})
+		case len(alive) < len(jobEntities):
+			r.fix("ecp_job", jobUuid, fmt.Sprintf("%d of %d containers", len(alive), len(jobEntities)),
+				"keep, the job is removed when it is deleted or expires", nil)
+		default:
+			for _, entity := range jobEntities {
+				status := containerStatus[entity.ContainerName]
+				if status == entity.Status {
+					continue
+				}
+				r.fix("ecp_job", jobUuid, fmt.Sprintf("%s in the database, %s container %s", entity.Status, status, entity.ContainerName), "mark "+status, func() error {
+					return NewEcpJobService().UpdateEcpJobContainerStatus(entity.ContainerName, status)
+				})
+			}
+		}
+	}
+
+	var orphans []string
+	for jobUuid := range jobContainers {
+		if _, ok := entities[jobUuid]; !ok && !r.inFlight(checkpointEcpDeploy, jobUuid) {
+			orphans = append(orphans, jobUuid)
+		}
+	}
+	sort.Strings(orphans)
+	now := time.Now().Unix()
+	for _, jobUuid := range orphans {
+		containerNames := jobContainers[jobUuid]
+		found := fmt.Sprintf("containers of no job: %s", strings.Join(containerNames, ", "))
+		switch r.report.Policy {
+		case conf.OrphanAdopt:
+			deletedJobs, err := NewEcpJobService().GetDeletedEcpJobs(jobUuid)
+			if err != nil {
+				r.fix("orphan", jobUuid, found, fmt.Sprintf("keep, failed to get its deleted job, error: %v", err), nil)
+				continue
+			}
+			// an ecp job without duration never expires
+			if len(deletedJobs) == 0 || (deletedJobs[0].ExpireTime > 0 && deletedJobs[0].ExpireTime <= now) {
+				r.fix("orphan", jobUuid, found, "keep, no unexpired job to adopt them", nil)
+				continue
+			}
+			r.fix("orphan", jobUuid, found, "restore the job", func() error {
+				return NewEcpJobService().RestoreEcpJobs(jobUuid)
+			})
+		case conf.OrphanRemove:
+			r.fix("orphan", jobUuid, found, "remove the containers", func() error {
+				return removeComposeResources(jobUuid, containerNames)
+			})
+		default:
+			r.fix("orphan", jobUuid, found, "keep", nil)
+		}
+	}
+
+	err = r.reconcileTasks(func(task *models.TaskEntity) bool {
+		jobName := strings.ToLower(models.UbiTaskTypeStr(task.Type)) + "-" + strconv.FormatInt(task.Id, 10)
+		for name := range containerStatus {
+			if strings.HasPrefix(name, jobName) {
+				return true
+			}
+		}
+		return false
+	})
+	return r.report, err
+}
+
+// reconcileTasks settles the ubi tasks which are received or running without their job, like the tasks which time out
+func (r *reconciler) reconcileTasks(running func(task *models.TaskEntity) bool) error {
+	taskList, err := NewTaskService().GetTaskList(0, models.TASK_RECEIVED_STATUS, models.TASK_RUNNING_STATUS)
+	if err != nil {
+		return fmt.Errorf("failed to get the ubi tasks, error: %v", err)
+	}
+	for _, task := range taskList {
+		taskId := strconv.FormatInt(task.Id, 10)
+		if r.inFlight(checkpointUbiProof, taskId) || time.Since(time.Unix(task.CreateTime, 0)) < reconcileGracePeriod || running(task) {
+			continue
+		}
+		status := models.TASK_FAILED_STATUS
+		if task.Contract != "" || task.BlockHash != "" {
+			status = models.TASK_SUBMITTED_STATUS
+		}
+		r.fix("task", taskId, fmt.Sprintf("%s in the database, no ubi job", models.TaskStatusStr(task.Status)), "mark "+models.TaskStatusStr(status), func() error {
+			task.Status = status
+			return NewTaskService().SaveTaskEntity(task)
+		})
+	}
+	return nil
+}
+
+// ReconcileOnStart reconciles the database with the configured orphan policy before the interrupted work is resumed
+func ReconcileOnStart(reconcile func(dryRun bool, policy string) (models.ReconcileReport, error)) {
+	policy := conf.GetConfig().Reconciler.GetOrphanPolicy()
+	report, err := reconcile(false, policy)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to reconcile the database, error: %v", err)
+	}
+	for _, item := range report.Items {
+		logs.GetLogger().Warnf("reconcile %s %s, found: %s, action: %s", item.Kind, item.Id, item.Found, item.Action)
+	}
+	if len(report.Items) > 0 {
+		RecordAudit(AuditActorSystem, "reconcile", map[string]interface{}{"policy": policy, "items": len(report.Items)}, "", err)
+	}
+}
@@ -0,0 +1,141 @@
+package computing
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/internal/models"
+)
+
+func TestReconcilerFix(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+		fn     func() error
+		called bool
+		action string
+	}{
+		{"fixed", false, func() error { return nil }, true, "mark running"},
+		{"dry run", true, func() error { return nil }, false, "would mark running"},
+		{"failed", false, func() error { return errors.New("locked") }, true, "failed to mark running, error: locked"},
+		{"report only", false, nil, false, "mark running"},
+		{"report only in a dry run", true, nil, false, "mark running"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &reconciler{report: models.ReconcileReport{DryRun: tt.dryRun}}
+			var called bool
+			var fn func() error
+			if tt.fn != nil {
+				fn = func() error {
+					called = true
+					return tt.fn()
+				}
+			}
+			r.fix("job", "uuid", "deploying in the database", "mark running", fn)
+			if called != tt.called {
+				t.Errorf("fix called = %v, want %v", called, tt.called)
+			}
+			if len(r.report.Items) != 1 {
+				t.Fatalf("got %d items, want 1", len(r.report.Items))
+			}
+			item := r.report.Items[0]
+			if item.Kind != "job" || item.Id != "uuid" || item.Found != "deploying in the database" || item.Action != tt.action {
+				t.Errorf("item = %+v, want action %q", item, tt.action)
+			}
+		})
+	}
+}
+
+func TestNewReconciler(t *testing.T) {
+	initTestDb(t)
+	if _, err := newReconciler(false, "delete-everything"); err == nil {
+		t.Error("newReconciler() with an unknown policy should fail")
+	}
+	if err := NewCheckpointService().SaveCheckpoint(&models.CheckpointEntity{Kind: checkpointUbiProof, WorkKey: "7"}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := newReconciler(true, conf.OrphanRemove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.report.DryRun || r.report.Policy != conf.OrphanRemove {
+		t.Errorf("report = %+v, want a dry run of policy %s", r.report, conf.OrphanRemove)
+	}
+	if !r.inFlight(checkpointUbiProof, "7") || r.inFlight(checkpointUbiProof, "8") || r.inFlight(checkpointEcpDeploy, "7") {
+		t.Error("inFlight() should only report the work of the checkpoints")
+	}
+}
+
+func TestReconcileTasks(t *testing.T) {
+	old := time.Now().Add(-2 * reconcileGracePeriod).Unix()
+	tasks := []*models.TaskEntity{
+		{Id: 1, Status: models.TASK_RUNNING_STATUS, CreateTime: old},                    // no job, failed
+		{Id: 2, Status: models.TASK_RECEIVED_STATUS, CreateTime: old, Contract: "0x01"}, // no job but on chain, submitted
+		{Id: 3, Status: models.TASK_RUNNING_STATUS, CreateTime: old},                    // still running
+		{Id: 4, Status: models.TASK_RUNNING_STATUS, CreateTime: old},                    // has a checkpoint
+		{Id: 5, Status: models.TASK_RECEIVED_STATUS, CreateTime: time.Now().Unix()},     // in the grace period
+		{Id: 6, Status: models.TASK_SUBMITTED_STATUS, CreateTime: old},                  // settled
+	}
+	running := func(task *models.TaskEntity) bool {
+		return task.Id == 3
+	}
+	tests := []struct {
+		name   string
+		dryRun bool
+		want   map[int64]int // the status of each task after the reconcile
+		items  map[string]string
+	}{
+		{"fix", false,
+			map[int64]int{1: models.TASK_FAILED_STATUS, 2: models.TASK_SUBMITTED_STATUS, 3: models.TASK_RUNNING_STATUS, 4: models.TASK_RUNNING_STATUS,
+				5: models.TASK_RECEIVED_STATUS, 6: models.TASK_SUBMITTED_STATUS},
+			map[string]string{"1": "mark failed", "2": "mark submitted"}},
+		{"dry run", true,
+			map[int64]int{1: models.TASK_RUNNING_STATUS, 2: models.TASK_RECEIVED_STATUS, 3: models.TASK_RUNNING_STATUS, 4: models.TASK_RUNNING_STATUS,
+				5: models.TASK_RECEIVED_STATUS, 6: models.TASK_SUBMITTED_STATUS},
+			map[string]string{"1": "would mark failed", "2": "would mark submitted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDb(t)
+			for _, task := range tasks {
+				saved := *task
+				if err := NewTaskService().Create(&saved).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := NewCheckpointService().SaveCheckpoint(&models.CheckpointEntity{Kind: checkpointUbiProof, WorkKey: "4"}); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := newReconciler(tt.dryRun, conf.OrphanKeep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.reconcileTasks(running); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(r.report.Items) != len(tt.items) {
+				t.Errorf("items = %+v, want %v", r.report.Items, tt.items)
+			}
+			for _, item := range r.report.Items {
+				if item.Kind != "task" || item.Action != tt.items[item.Id] {
+					t.Errorf("item = %+v, want action %q", item, tt.items[item.Id])
+				}
+			}
+			for id, status := range tt.want {
+				task, err := NewTaskService().GetTaskEntity(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if task.Status != status {
+					t.Errorf("task %s status = %s, want %s", strconv.FormatInt(id, 10), models.TaskStatusStr(task.Status), models.TaskStatusStr(status))
+				}
+			}
+		})
+	}
+}
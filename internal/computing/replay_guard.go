@@ -0,0 +1,89 @@
+package computing
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
+	"gorm.io/gorm"
+)
+
+const (
+	NonceSourceHub = "hub"
+	NonceSourceUbi = "ubi"
+
+	signedRequestTTL = 5 * time.Minute
+	maxNonceLength   = 128
+)
+
+// signedMessage appends the envelope to the payload, the result is the message the sender signs
+func signedMessage(payload string, envelope models.SignedEnvelope) string {
+	return fmt.Sprintf("%s%d%s", payload, envelope.Timestamp, envelope.Nonce)
+}
+
+// checkSignedEnvelope rejects stale requests and consumes the nonce, so a captured request can only be used once.
+// It must be called after the signature has been verified, otherwise forged requests could burn valid nonces.
+func checkSignedEnvelope(source string, envelope models.SignedEnvelope) error {
+	if envelope.Timestamp == 0 || strings.TrimSpace(envelope.Nonce) == "" {
+		return fmt.Errorf("missing required field: timestamp or nonce")
+	}
+	if len(envelope.Nonce) > maxNonceLength {
+		return fmt.Errorf("nonce is too long, the max length is %d", maxNonceLength)
+	}
+
+	requestTime := time.Unix(envelope.Timestamp, 0)
+	if diff := time.Since(requestTime); diff > signedRequestTTL || diff < -signedRequestTTL {
+		return fmt.Errorf("request is expired, timestamp: %d", envelope.Timestamp)
+	}
+
+	expireTime := requestTime.Add(signedRequestTTL).Unix()
+	if err := NewNonceService().SaveNonce(source+":"+envelope.Nonce, expireTime); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("request has already been processed, nonce: %s", envelope.Nonce)
+		}
+		logs.GetLogger().Errorf("failed to save nonce, source: %s, nonce: %s, error: %v", source, envelope.Nonce, err)
+		return &nonceStoreError{err: err}
+	}
+	return nil
+}
+
+// nonceStoreError is a failure of the nonce store, the request is not known to be replayed
+type nonceStoreError struct {
+	err error
+}
+
+func (e *nonceStoreError) Error() string {
+	return fmt.Sprintf("failed to record the nonce, error: %v", e.err)
+}
+
+// envelopeErrorResponse is the response to a request rejected by checkSignedEnvelope
+func envelopeErrorResponse(err error) (int, util.BasicResponse) {
+	var storeErr *nonceStoreError
+	if errors.As(err, &storeErr) {
+		return http.StatusInternalServerError, util.CreateErrorResponse(util.ServerError, err.Error())
+	}
+	return http.StatusBadRequest, util.CreateErrorResponse(util.ReplayRequestError, err.Error())
+}
+
+// startNonceCleaner deletes the expired nonces periodically, both the k8s and the ecp daemons use it
+func startNonceCleaner() {
+	runEvery(10*time.Minute, func(now time.Time) {
+		cleanExpiredNonce()
+	})
+}
+
+func cleanExpiredNonce() {
+	count, err := NewNonceService().DeleteExpiredNonce()
+	if err != nil {
+		logs.GetLogger().Errorf("failed to clean expired nonce, error: %v", err)
+		return
+	}
+	if count > 0 {
+		logs.GetLogger().Debugf("cleaned %d expired nonce", count)
+	}
+}
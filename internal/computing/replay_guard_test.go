@@ -0,0 +1,77 @@
+package computing
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/swanchain/go-computing-provider/internal/db"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
+)
+
+func TestCheckSignedEnvelope(t *testing.T) {
+	initTestDb(t)
+	now := time.Now().Unix()
+	tests := []struct {
+		name     string
+		source   string
+		envelope models.SignedEnvelope
+		wantErr  string
+	}{
+		{"missing nonce", NonceSourceHub, models.SignedEnvelope{Timestamp: now}, "missing required field"},
+		{"missing timestamp", NonceSourceHub, models.SignedEnvelope{Nonce: "n1"}, "missing required field"},
+		{"long nonce", NonceSourceHub, models.SignedEnvelope{Timestamp: now, Nonce: strings.Repeat("n", maxNonceLength+1)}, "too long"},
+		{"stale", NonceSourceHub, models.SignedEnvelope{Timestamp: now - 600, Nonce: "n1"}, "expired"},
+		{"from the future", NonceSourceHub, models.SignedEnvelope{Timestamp: now + 600, Nonce: "n1"}, "expired"},
+		{"first use", NonceSourceHub, models.SignedEnvelope{Timestamp: now, Nonce: "n1"}, ""},
+		{"replayed", NonceSourceHub, models.SignedEnvelope{Timestamp: now, Nonce: "n1"}, "already been processed"},
+		{"same nonce of another source", NonceSourceUbi, models.SignedEnvelope{Timestamp: now, Nonce: "n1"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSignedEnvelope(tt.source, tt.envelope)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkSignedEnvelope() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkSignedEnvelope() error = %v, want %q", err, tt.wantErr)
+			}
+			if status, _ := envelopeErrorResponse(err); status != http.StatusBadRequest {
+				t.Errorf("envelopeErrorResponse() status = %d, want %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestCleanExpiredNonce(t *testing.T) {
+	initTestDb(t)
+	nonceService := NewNonceService()
+	if err := nonceService.SaveNonce("hub:old", time.Now().Add(-time.Minute).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if err := nonceService.SaveNonce("hub:new", time.Now().Add(time.Minute).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	cleanExpiredNonce()
+
+	var nonces []models.RequestNonceEntity
+	if err := db.DB.Find(&nonces).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(nonces) != 1 || nonces[0].Nonce != "hub:new" {
+		t.Errorf("nonces left = %v, want hub:new", nonces)
+	}
+}
+
+func TestEnvelopeErrorResponse(t *testing.T) {
+	status, resp := envelopeErrorResponse(&nonceStoreError{err: errors.New("disk full")})
+	if status != http.StatusInternalServerError || resp.Code != util.ServerError {
+		t.Errorf("envelopeErrorResponse() = %d, %d, want %d, %d", status, resp.Code, http.StatusInternalServerError, util.ServerError)
+	}
+}
@@ -0,0 +1,449 @@
+package computing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+const resourceExporterContainerName = "resource-exporter"
+
+// GpuReader reads the gpus of this host, nvidia-smi is used by default and a fake one can take its place
+type GpuReader interface {
+	ReadGpus() (models.Gpu, error)
+}
+
+// ResourceCollector reads the resources of this host from /proc, the cgroup of this process and the disk stats,
+// it produces the same models.NodeResource as the resource-exporter container
+type ResourceCollector struct {
+	procPath    string
+	cgroupPath  string
+	cpuInterval time.Duration // the least time between two samples of /proc/stat
+	gpuReader   GpuReader
+}
+
+func NewResourceCollector() *ResourceCollector {
+	return &ResourceCollector{
+		procPath:    "/proc",
+		cgroupPath:  "/sys/fs/cgroup",
+		cpuInterval: 500 * time.Millisecond,
+		gpuReader:   nvidiaSmiReader{},
+	}
+}
+
+func (rc *ResourceCollector) WithGpuReader(reader GpuReader) *ResourceCollector {
+	rc.gpuReader = reader
+	return rc
+}
+
+func (rc *ResourceCollector) WithPaths(procPath, cgroupPath string) *ResourceCollector {
+	rc.procPath = procPath
+	rc.cgroupPath = cgroupPath
+	return rc
+}
+
+// Collect reads the resources of this host, the storage is the one of the file system of storagePath
+func (rc *ResourceCollector) Collect(storagePath string) (models.NodeResource, error) {
+	var nodeResource models.NodeResource
+	if machineId, err := os.ReadFile("/etc/machine-id"); err == nil {
+		nodeResource.MachineId = strings.TrimSpace(string(machineId))
+	}
+
+	cpuName, totalCpu, err := rc.readCpuInfo()
+	if err != nil {
+		return nodeResource, err
+	}
+	if limit := rc.cgroupCpuLimit(); limit > 0 && limit < totalCpu {
+		totalCpu = limit
+	}
+	busy, err := rc.cpuBusy()
+	if err != nil {
+		return nodeResource, err
+	}
+	usedCpu := min(int64(math.Ceil(busy*float64(totalCpu))), totalCpu)
+	nodeResource.CpuName = cpuName
+	nodeResource.Cpu = models.Common{
+		Total:        strconv.FormatInt(totalCpu, 10),
+		Used:         strconv.FormatInt(usedCpu, 10),
+		Free:         strconv.FormatInt(totalCpu-usedCpu, 10),
+		RemainderNum: totalCpu - usedCpu,
+	}
+	nodeResource.Vcpu = nodeResource.Cpu
+
+	totalMemory, freeMemory, err := rc.readMemory()
+	if err != nil {
+		return nodeResource, err
+	}
+	nodeResource.Memory = gibCommon(totalMemory, freeMemory)
+
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(storagePath, &stat); err != nil {
+		return nodeResource, fmt.Errorf("failed to get the disk stats of %s, error: %v", storagePath, err)
+	}
+	nodeResource.Storage = gibCommon(int64(stat.Blocks*uint64(stat.Bsize)), int64(stat.Bavail*uint64(stat.Bsize)))
+
+	if nodeResource.Gpu, err = rc.gpuReader.ReadGpus(); err != nil {
+		return nodeResource, err
+	}
+	return nodeResource, nil
+}
+
+func gibCommon(total, free int64) models.Common {
+	const gib = 1024 * 1024 * 1024
+	return models.Common{
+		Total:        fmt.Sprintf("%.2f GiB", float64(total)/gib),
+		Used:         fmt.Sprintf("%.2f GiB", float64(total-free)/gib),
+		Free:         fmt.Sprintf("%.2f GiB", float64(free)/gib),
+		RemainderNum: free,
+	}
+}
+
+// readCpuInfo returns the vendor of the cpu as INTEL or AMD, and the count of the logical processors
+func (rc *ResourceCollector) readCpuInfo() (string, int64, error) {
+	data, err := os.ReadFile(filepath.Join(rc.procPath, "cpuinfo"))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read cpuinfo, error: %v", err)
+	}
+	var cpuName string
+	var count int64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "processor":
+			count++
+		case "vendor_id":
+			switch strings.TrimSpace(value) {
+			case "GenuineIntel":
+				cpuName = constants.CPU_INTEL
+			case "AuthenticAMD":
+				cpuName = constants.CPU_AMD
+			}
+		}
+	}
+	if count == 0 {
+		return "", 0, fmt.Errorf("no processor found in cpuinfo")
+	}
+	return cpuName, count, nil
+}
+
+// cgroupCpuLimit returns the cpus allowed by the cgroup v2 cpu.max or the cgroup v1 cfs quota, 0 if unlimited
+func (rc *ResourceCollector) cgroupCpuLimit() int64 {
+	var quota, period float64
+	if data, err := os.ReadFile(filepath.Join(rc.cgroupPath, "cpu.max")); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0
+		}
+		quota, _ = strconv.ParseFloat(fields[0], 64)
+		period, _ = strconv.ParseFloat(fields[1], 64)
+	} else {
+		quota = readCgroupNumber(filepath.Join(rc.cgroupPath, "cpu", "cpu.cfs_quota_us"))
+		period = readCgroupNumber(filepath.Join(rc.cgroupPath, "cpu", "cpu.cfs_period_us"))
+	}
+	if quota <= 0 || period <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(quota / period))
+}
+
+// cpuSample is the last sample of /proc/stat of a proc path, and the busy part of the cpu time computed from it
+type cpuSample struct {
+	idle, total uint64
+	at          time.Time
+	busy        float64
+}
+
+var cpuSamples = struct {
+	sync.Mutex
+	last map[string]cpuSample
+}{last: make(map[string]cpuSample)}
+
+// cpuBusy returns the busy part of the cpu time since the last sample of /proc/stat without waiting for another one,
+// the first sample is compared with the boot. A sample taken too soon after the last one returns the last result.
+func (rc *ResourceCollector) cpuBusy() (float64, error) {
+	idle, total, err := rc.readCpuStat()
+	if err != nil {
+		return 0, err
+	}
+	sample := cpuSample{idle: idle, total: total, at: time.Now()}
+
+	cpuSamples.Lock()
+	defer cpuSamples.Unlock()
+	last, ok := cpuSamples.last[rc.procPath]
+	switch {
+	case !ok || total <= last.total || idle < last.idle:
+		if total > 0 {
+			sample.busy = 1 - float64(idle)/float64(total)
+		}
+	case sample.at.Sub(last.at) < rc.cpuInterval:
+		return last.busy, nil
+	default:
+		sample.busy = 1 - float64(idle-last.idle)/float64(total-last.total)
+	}
+	cpuSamples.last[rc.procPath] = sample
+	return sample.busy, nil
+}
+
+func (rc *ResourceCollector) readCpuStat() (uint64, uint64, error) {
+	data, err := os.ReadFile(filepath.Join(rc.procPath, "stat"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read stat, error: %v", err)
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected cpu line of stat: %q", line)
+	}
+	var idle, total uint64
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unexpected cpu line of stat: %q", line)
+		}
+		total += value
+		// idle and iowait
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	return idle, total, nil
+}
+
+// readMemory returns the total and the available memory in bytes, both are limited by the memory limit of the cgroup
+func (rc *ResourceCollector) readMemory() (int64, int64, error) {
+	data, err := os.ReadFile(filepath.Join(rc.procPath, "meminfo"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read meminfo, error: %v", err)
+	}
+	var total, available int64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, _ := strconv.ParseInt(fields[1], 10, 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = value * 1024
+		case "MemAvailable:":
+			available = value * 1024
+		}
+	}
+	if total == 0 {
+		return 0, 0, fmt.Errorf("no MemTotal found in meminfo")
+	}
+
+	limit := readCgroupNumber(filepath.Join(rc.cgroupPath, "memory.max"))
+	usage := readCgroupNumber(filepath.Join(rc.cgroupPath, "memory.current"))
+	if limit <= 0 {
+		limit = readCgroupNumber(filepath.Join(rc.cgroupPath, "memory", "memory.limit_in_bytes"))
+		usage = readCgroupNumber(filepath.Join(rc.cgroupPath, "memory", "memory.usage_in_bytes"))
+	}
+	if limit > 0 && int64(limit) < total {
+		total = int64(limit)
+		available = min(available, max(total-int64(usage), 0))
+	}
+	return total, available, nil
+}
+
+// readCgroupNumber returns the number in a cgroup file, 0 if the file is missing or unlimited
+func readCgroupNumber(path string) float64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+var cudaVersionPattern = regexp.MustCompile(`CUDA Version:\s*([\d.]+)`)
+
+// nvidiaSmiReader reads the gpus by nvidia-smi, a host without nvidia-smi has no gpu
+type nvidiaSmiReader struct{}
+
+func (nvidiaSmiReader) ReadGpus() (models.Gpu, error) {
+	var gpu models.Gpu
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return gpu, nil
+	}
+
+	output, err := exec.Command("nvidia-smi", "--query-gpu=index,name,uuid,memory.total,memory.used,memory.free,driver_version",
+		"--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return gpu, fmt.Errorf("failed to query gpus by nvidia-smi, error: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(output)).ReadAll()
+	if err != nil {
+		return gpu, fmt.Errorf("failed to parse the output of nvidia-smi, error: %v", err)
+	}
+
+	busy := make(map[string]bool)
+	if apps, err := exec.Command("nvidia-smi", "--query-compute-apps=gpu_uuid", "--format=csv,noheader").Output(); err == nil {
+		for _, uuid := range strings.Fields(string(apps)) {
+			busy[uuid] = true
+		}
+	}
+
+	for _, record := range records {
+		if len(record) != 7 {
+			continue
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		detail := models.GpuDetail{
+			Index:        record[0],
+			ProductName:  record[1],
+			OriginalName: record[1],
+			Status:       models.Available,
+			FbMemoryUsage: models.Common{
+				Total: record[3] + " MiB",
+				Used:  record[4] + " MiB",
+				Free:  record[5] + " MiB",
+			},
+		}
+		if busy[record[2]] {
+			detail.Status = models.Occupied
+		}
+		gpu.DriverVersion = record[6]
+		gpu.Details = append(gpu.Details, detail)
+	}
+	gpu.AttachedGpus = len(gpu.Details)
+
+	if summary, err := exec.Command("nvidia-smi").Output(); err == nil {
+		if matches := cudaVersionPattern.FindSubmatch(summary); matches != nil {
+			gpu.CudaVersion = string(matches[1])
+		}
+	}
+	return gpu, nil
+}
+
+// collectHostResource returns the resources of this host in the docker mode, from the native collector or from the
+// log of the resource-exporter container when the collector is disabled or fails
+func collectHostResource() (models.NodeResource, error) {
+	if conf.GetConfig().Collector.GetMode() == conf.CollectorNative {
+		dockerService := NewDockerService()
+		storagePath := "/"
+		if info, err := dockerService.c.Info(context.Background()); err == nil && info.DockerRootDir != "" {
+			storagePath = info.DockerRootDir
+		}
+		nodeResource, err := NewResourceCollector().Collect(storagePath)
+		if err == nil {
+			// the gpus handed to the containers are occupied even if no process runs on them yet
+			used := usedDockerDevices()
+			for i, detail := range nodeResource.Gpu.Details {
+				if used[detail.Index] {
+					nodeResource.Gpu.Details[i].Status = models.Occupied
+				}
+			}
+			return nodeResource, nil
+		}
+		logs.GetLogger().Warnf("failed to collect the resources of this host, fall back to the resource-exporter, error: %v", err)
+	}
+	return exporterNodeResource()
+}
+
+// exporterNodeResource parses the last output of the resource-exporter container, which is restarted when it is broken
+func exporterNodeResource() (models.NodeResource, error) {
+	var nodeResource models.NodeResource
+	containerLogStr, err := NewDockerService().ContainerLogs(resourceExporterContainerName)
+	if err != nil {
+		if restartErr := RestartResourceExporter(); restartErr != nil {
+			logs.GetLogger().Errorf("restartResourceExporter failed, error: %v", restartErr)
+		}
+		return nodeResource, err
+	}
+
+	if err = json.Unmarshal([]byte(containerLogStr), &nodeResource); err != nil {
+		logs.GetLogger().Errorf("failed to convert json, container log: %s, error: %v", containerLogStr, err)
+		if restartErr := RestartResourceExporter(); restartErr != nil {
+			logs.GetLogger().Errorf("restartResourceExporter failed, error: %v", restartErr)
+		}
+		return nodeResource, err
+	}
+	return nodeResource, nil
+}
+
+// gpuProductName converts the product label of the gpu feature discovery to the name of nvidia-smi, the label replaces
+// every space by a dash, and only the one after the vendor is known to be a space: NVIDIA-A100-SXM4-40GB is NVIDIA A100-SXM4-40GB
+func gpuProductName(product string) string {
+	product = strings.TrimSuffix(product, "-SHARED")
+	if vendor, model, found := strings.Cut(product, "-"); found {
+		return vendor + " " + model
+	}
+	return product
+}
+
+// nodeInfoFromLabels builds the cpu and gpu information of a node from the labels of the gpu feature discovery and
+// the node feature discovery, it is not complete when the node has gpus without the product label or an unknown cpu
+func nodeInfoFromLabels(node *coreV1.Node) (models.CollectNodeInfo, bool) {
+	var nodeInfo models.CollectNodeInfo
+	labels := node.Labels
+	switch {
+	case labels[constants.CPU_INTEL] == "true" || strings.EqualFold(labels["feature.node.kubernetes.io/cpu-model.vendor_id"], "Intel"):
+		nodeInfo.CpuName = constants.CPU_INTEL
+	case labels[constants.CPU_AMD] == "true" || strings.EqualFold(labels["feature.node.kubernetes.io/cpu-model.vendor_id"], "AMD"):
+		nodeInfo.CpuName = constants.CPU_AMD
+	default:
+		return nodeInfo, false
+	}
+
+	quantity, ok := node.Status.Capacity["nvidia.com/gpu"]
+	if !ok || quantity.Value() == 0 {
+		return nodeInfo, true
+	}
+	product := labels[gpuProductLabel]
+	if product == "" {
+		return nodeInfo, false
+	}
+	productName := gpuProductName(product)
+
+	var memory string
+	if mib := labels["nvidia.com/gpu.memory"]; mib != "" {
+		memory = mib + " MiB"
+	}
+	for i := 0; i < int(quantity.Value()); i++ {
+		nodeInfo.Gpu.Details = append(nodeInfo.Gpu.Details, models.GpuDetail{
+			Index:         strconv.Itoa(i),
+			ProductName:   productName,
+			OriginalName:  product,
+			Status:        models.Available,
+			FbMemoryUsage: models.Common{Total: memory},
+		})
+	}
+	nodeInfo.Gpu.AttachedGpus = len(nodeInfo.Gpu.Details)
+	if major := labels["nvidia.com/cuda.driver.major"]; major != "" {
+		nodeInfo.Gpu.DriverVersion = strings.Join([]string{major, labels["nvidia.com/cuda.driver.minor"], labels["nvidia.com/cuda.driver.rev"]}, ".")
+	}
+	if major := labels["nvidia.com/cuda.runtime.major"]; major != "" {
+		nodeInfo.Gpu.CudaVersion = major + "." + labels["nvidia.com/cuda.runtime.minor"]
+	}
+	return nodeInfo, true
+}
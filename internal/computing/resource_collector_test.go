@@ -0,0 +1,245 @@
+package computing
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// writeFiles writes the files under a temp dir and returns it, the keys are the paths relative to it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadCpuInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpuinfo string
+		cpuName string
+		count   int64
+		wantErr bool
+	}{
+		{"intel", "processor\t: 0\nvendor_id\t: GenuineIntel\n\nprocessor\t: 1\nvendor_id\t: GenuineIntel\n", constants.CPU_INTEL, 2, false},
+		{"amd", "processor\t: 0\nvendor_id\t: AuthenticAMD\n", constants.CPU_AMD, 1, false},
+		{"unknown vendor", "processor\t: 0\nvendor_id\t: ARM\nprocessor\t: 1\n", "", 2, false},
+		{"no processor", "vendor_id\t: GenuineIntel\n", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"cpuinfo": tt.cpuinfo})
+			cpuName, count, err := NewResourceCollector().WithPaths(dir, dir).readCpuInfo()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCpuInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cpuName != tt.cpuName || count != tt.count {
+				t.Errorf("readCpuInfo() = %q, %d, want %q, %d", cpuName, count, tt.cpuName, tt.count)
+			}
+		})
+	}
+}
+
+func TestReadCpuStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		stat    string
+		idle    uint64
+		total   uint64
+		wantErr bool
+	}{
+		{"all the fields", "cpu  100 0 50 800 50 0 0 0 0 0\ncpu0 50 0 25 400 25 0 0 0 0 0\n", 850, 1000, false},
+		{"old kernel", "cpu  10 20 30 40\n", 40, 100, false},
+		{"not the cpu line", "cpu0 10 20 30 40 50\n", 0, 0, true},
+		{"bad number", "cpu  10 x 30 40 50\n", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"stat": tt.stat})
+			idle, total, err := NewResourceCollector().WithPaths(dir, dir).readCpuStat()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCpuStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if idle != tt.idle || total != tt.total {
+				t.Errorf("readCpuStat() = %d, %d, want %d, %d", idle, total, tt.idle, tt.total)
+			}
+		})
+	}
+}
+
+func TestCpuBusy(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"stat": "cpu  100 0 100 700 100 0 0 0 0 0\n"})
+	rc := NewResourceCollector().WithPaths(dir, dir)
+	rc.cpuInterval = 0
+
+	// the first sample is compared with the boot
+	busy, err := rc.cpuBusy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(busy-0.2) > 1e-9 {
+		t.Errorf("first cpuBusy() = %v, want 0.2", busy)
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, "stat"), []byte("cpu  150 0 150 800 100 0 0 0 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if busy, err = rc.cpuBusy(); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(busy-0.5) > 1e-9 {
+		t.Errorf("second cpuBusy() = %v, want 0.5", busy)
+	}
+
+	// a sample taken too soon returns the last result
+	rc.cpuInterval = math.MaxInt64
+	if err = os.WriteFile(filepath.Join(dir, "stat"), []byte("cpu  150 0 150 900 100 0 0 0 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if busy, err = rc.cpuBusy(); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(busy-0.5) > 1e-9 {
+		t.Errorf("cpuBusy() too soon = %v, want 0.5", busy)
+	}
+}
+
+func TestCgroupCpuLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  int64
+	}{
+		{"v2 unlimited", map[string]string{"cpu.max": "max 100000\n"}, 0},
+		{"v2 limited", map[string]string{"cpu.max": "200000 100000\n"}, 2},
+		{"v2 part of a cpu is rounded up", map[string]string{"cpu.max": "150000 100000\n"}, 2},
+		{"v1 unlimited", map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"}, 0},
+		{"v1 limited", map[string]string{"cpu/cpu.cfs_quota_us": "400000\n", "cpu/cpu.cfs_period_us": "100000\n"}, 4},
+		{"no cgroup", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			if got := NewResourceCollector().WithPaths(dir, dir).cgroupCpuLimit(); got != tt.want {
+				t.Errorf("cgroupCpuLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMemory(t *testing.T) {
+	const gib = int64(1 << 30)
+	meminfo := "MemTotal:       16777216 kB\nMemFree:         1048576 kB\nMemAvailable:    8388608 kB\n"
+	tests := []struct {
+		name      string
+		cgroup    map[string]string
+		total     int64
+		available int64
+	}{
+		{"no cgroup", nil, 16 * gib, 8 * gib},
+		{"v2 unlimited", map[string]string{"memory.max": "max\n", "memory.current": "1073741824\n"}, 16 * gib, 8 * gib},
+		{"v2 limited", map[string]string{"memory.max": "4294967296\n", "memory.current": "1073741824\n"}, 4 * gib, 3 * gib},
+		{"v2 limit above the host", map[string]string{"memory.max": "34359738368\n", "memory.current": "1073741824\n"}, 16 * gib, 8 * gib},
+		{"v1 limited", map[string]string{"memory/memory.limit_in_bytes": "2147483648\n", "memory/memory.usage_in_bytes": "3221225472\n"}, 2 * gib, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			procPath := writeFiles(t, map[string]string{"meminfo": meminfo})
+			cgroupPath := writeFiles(t, tt.cgroup)
+			total, available, err := NewResourceCollector().WithPaths(procPath, cgroupPath).readMemory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.total || available != tt.available {
+				t.Errorf("readMemory() = %d, %d, want %d, %d", total, available, tt.total, tt.available)
+			}
+		})
+	}
+
+	procPath := writeFiles(t, map[string]string{"meminfo": "MemFree: 1024 kB\n"})
+	if _, _, err := NewResourceCollector().WithPaths(procPath, procPath).readMemory(); err == nil {
+		t.Error("readMemory() without MemTotal should fail")
+	}
+}
+
+func TestGpuProductName(t *testing.T) {
+	tests := []struct {
+		product string
+		want    string
+	}{
+		{"NVIDIA-A100-SXM4-40GB", "NVIDIA A100-SXM4-40GB"},
+		{"NVIDIA-A100-SXM4-40GB-SHARED", "NVIDIA A100-SXM4-40GB"},
+		{"Tesla-V100-SXM2-16GB", "Tesla V100-SXM2-16GB"},
+		{"NVIDIA-H100-80GB-HBM3", "NVIDIA H100-80GB-HBM3"},
+		{"A10", "A10"},
+	}
+	for _, tt := range tests {
+		if got := gpuProductName(tt.product); got != tt.want {
+			t.Errorf("gpuProductName(%s) = %s, want %s", tt.product, got, tt.want)
+		}
+	}
+}
+
+func TestNodeInfoFromLabels(t *testing.T) {
+	gpuNode := func(labels map[string]string, gpus int64) *coreV1.Node {
+		node := &coreV1.Node{ObjectMeta: metaV1.ObjectMeta{Labels: labels}}
+		if gpus > 0 {
+			node.Status.Capacity = coreV1.ResourceList{"nvidia.com/gpu": *resource.NewQuantity(gpus, resource.DecimalSI)}
+		}
+		return node
+	}
+	tests := []struct {
+		name     string
+		node     *coreV1.Node
+		complete bool
+		cpuName  string
+		product  string
+		gpus     int
+	}{
+		{"unknown cpu", gpuNode(map[string]string{}, 0), false, "", "", 0},
+		{"intel label of the cp", gpuNode(map[string]string{constants.CPU_INTEL: "true"}, 0), true, constants.CPU_INTEL, "", 0},
+		{"amd of the node feature discovery", gpuNode(map[string]string{"feature.node.kubernetes.io/cpu-model.vendor_id": "AMD"}, 0), true, constants.CPU_AMD, "", 0},
+		{"gpus without product", gpuNode(map[string]string{constants.CPU_INTEL: "true"}, 2), false, constants.CPU_INTEL, "", 0},
+		{"gpus with product", gpuNode(map[string]string{
+			constants.CPU_INTEL:            "true",
+			gpuProductLabel:                "NVIDIA-A100-SXM4-40GB",
+			"nvidia.com/gpu.memory":        "40960",
+			"nvidia.com/cuda.driver.major": "535",
+		}, 2), true, constants.CPU_INTEL, "NVIDIA A100-SXM4-40GB", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeInfo, complete := nodeInfoFromLabels(tt.node)
+			if complete != tt.complete {
+				t.Fatalf("nodeInfoFromLabels() complete = %v, want %v", complete, tt.complete)
+			}
+			if nodeInfo.CpuName != tt.cpuName {
+				t.Errorf("CpuName = %q, want %q", nodeInfo.CpuName, tt.cpuName)
+			}
+			if len(nodeInfo.Gpu.Details) != tt.gpus || nodeInfo.Gpu.AttachedGpus != tt.gpus {
+				t.Fatalf("got %d gpus, want %d", len(nodeInfo.Gpu.Details), tt.gpus)
+			}
+			for _, detail := range nodeInfo.Gpu.Details {
+				if detail.ProductName != tt.product || detail.Status != models.Available {
+					t.Errorf("gpu %s = %q %s, want %q available", detail.Index, detail.ProductName, detail.Status, tt.product)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package computing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/internal/models"
+)
+
+// resourcePolicyCache keeps the policy of resource_policy.json, the file is read again once it is modified
+var resourcePolicyCache struct {
+	sync.Mutex
+	loaded  bool
+	modTime time.Time
+	policy  models.ResourcePolicy
+}
+
+// currentResourcePolicy returns the resources every node keeps in reserve. An invalid file keeps the last valid policy,
+// so a typo made while editing the file does not release the reserved resources.
+func currentResourcePolicy() models.ResourcePolicy {
+	resourcePolicyCache.Lock()
+	defer resourcePolicyCache.Unlock()
+
+	cpPath, _ := os.LookupEnv("CP_PATH")
+	var modTime time.Time
+	if info, err := os.Stat(filepath.Join(cpPath, resourcePolicyFile)); err == nil {
+		modTime = info.ModTime()
+	}
+	if resourcePolicyCache.loaded && modTime.Equal(resourcePolicyCache.modTime) {
+		return resourcePolicyCache.policy
+	}
+
+	policy, err := loadResourcePolicy()
+	if err != nil {
+		logs.GetLogger().Errorf("failed to reload %s, the last policy is kept, error: %v", resourcePolicyFile, err)
+		if !resourcePolicyCache.loaded {
+			resourcePolicyCache.policy = defaultResourcePolicy()
+			resourcePolicyCache.loaded = true
+		}
+		resourcePolicyCache.modTime = modTime
+		return resourcePolicyCache.policy
+	}
+	if resourcePolicyCache.loaded {
+		logs.GetLogger().Infof("%s is reloaded, reserved: %+v", resourcePolicyFile, policy)
+	}
+	resourcePolicyCache.policy = policy
+	resourcePolicyCache.modTime = modTime
+	resourcePolicyCache.loaded = true
+	return policy
+}
+
+// reservedResource is the resource policy in the units of the admission checks
+type reservedResource struct {
+	cpu        int64
+	memoryGiB  float64
+	storageGiB float64
+	gpu        []models.GpuQuota
+}
+
+func currentReserve() reservedResource {
+	policy := currentResourcePolicy()
+	return reservedResource{
+		cpu:        policy.Cpu.Quota,
+		memoryGiB:  float64(quotaBytes(policy.Memory)) / 1024 / 1024 / 1024,
+		storageGiB: float64(quotaBytes(policy.Storage)) / 1024 / 1024 / 1024,
+		gpu:        policy.Gpu,
+	}
+}
+
+// gpuQuota returns the reserved count of the gpu product, the names are compared ignoring the case and the spaces
+func (r reservedResource) gpuQuota(productName string) int64 {
+	product := normalizeGpuName(productName)
+	for _, quota := range r.gpu {
+		if name := normalizeGpuName(quota.Name); name != "" && strings.Contains(product, name) {
+			return quota.Quota
+		}
+	}
+	return 0
+}
+
+func normalizeGpuName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), " ", "-"))
+}
+
+// setSellable fills the resources of the node which can be sold after keeping the reserve
+func setSellable(node *models.NodeResource, reserve reservedResource) {
+	sellable := &models.SellableResource{
+		Cpu:     max(int64(freeAmount(node.Cpu.Free))-reserve.cpu, 0),
+		Memory:  fmt.Sprintf("%.2f GiB", max(freeAmount(node.Memory.Free)-reserve.memoryGiB, 0)),
+		Storage: fmt.Sprintf("%.2f GiB", max(freeAmount(node.Storage.Free)-reserve.storageGiB, 0)),
+	}
+
+	available := make(map[string]int64)
+	for _, gpu := range node.Gpu.Details {
+		if gpu.Status == models.Available {
+			available[gpu.ProductName]++
+		}
+	}
+	if len(available) > 0 {
+		sellable.Gpu = make(map[string]int64)
+		for name, count := range available {
+			sellable.Gpu[name] = max(count-reserve.gpuQuota(name), 0)
+		}
+	}
+	node.Sellable = sellable
+}
+
+// freeAmount parses the amount of a free resource, such as "12" or "30.50 GiB"
+func freeAmount(free string) float64 {
+	fields := strings.Fields(free)
+	if len(fields) == 0 {
+		return 0
+	}
+	amount, _ := strconv.ParseFloat(fields[0], 64)
+	return amount
+}
@@ -0,0 +1,134 @@
+package computing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/swanchain/go-computing-provider/internal/models"
+)
+
+func TestCurrentResourcePolicy(t *testing.T) {
+	initTestLogger(t)
+	dir := t.TempDir()
+	t.Setenv("CP_PATH", dir)
+	resourcePolicyCache.loaded = false
+	t.Cleanup(func() {
+		resourcePolicyCache.loaded = false
+	})
+	policyFile := filepath.Join(dir, resourcePolicyFile)
+	writePolicy := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(policyFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(policyFile, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+
+	steps := []struct {
+		name    string
+		content string // empty keeps the file
+		modTime time.Time
+		cpu     int64
+		gpu     int
+	}{
+		{"no file is the default", "", time.Time{}, defaultResourcePolicy().Cpu.Quota, 0},
+		{"valid file", `{"cpu":{"quota":4},"gpu":[{"name":"A100","quota":1}],"memory":{"quota":8,"unit":"GiB"}}`, now.Add(-time.Hour), 4, 1},
+		{"invalid file keeps the last policy", `{"cpu":`, now.Add(-time.Minute), 4, 1},
+		{"fixed file is reloaded", `{"cpu":{"quota":2}}`, now, 2, 0},
+	}
+	for _, step := range steps {
+		if step.content != "" {
+			writePolicy(step.content, step.modTime)
+		}
+		policy := currentResourcePolicy()
+		if policy.Cpu.Quota != step.cpu || len(policy.Gpu) != step.gpu {
+			t.Errorf("%s: policy = %+v, want cpu %d and %d gpus", step.name, policy, step.cpu, step.gpu)
+		}
+	}
+}
+
+func TestQuotaBytes(t *testing.T) {
+	tests := []struct {
+		quota models.Quota
+		want  int64
+	}{
+		{models.Quota{Quota: 5, Unit: "GiB"}, 5 << 30},
+		{models.Quota{Quota: 512, Unit: "Mi"}, 512 << 20},
+		{models.Quota{Quota: 1, Unit: "GB"}, 1000000000},
+		{models.Quota{Quota: 100, Unit: ""}, 100},
+		{models.Quota{Quota: 7, Unit: "parsecs"}, 7},
+	}
+	for _, tt := range tests {
+		if got := quotaBytes(tt.quota); got != tt.want {
+			t.Errorf("quotaBytes(%+v) = %d, want %d", tt.quota, got, tt.want)
+		}
+	}
+}
+
+func TestSetSellable(t *testing.T) {
+	reserve := reservedResource{
+		cpu:        2,
+		memoryGiB:  4,
+		storageGiB: 10,
+		gpu:        []models.GpuQuota{{Name: "nvidia a100", Quota: 1}},
+	}
+	tests := []struct {
+		name    string
+		node    models.NodeResource
+		want    models.SellableResource
+		wantGpu map[string]int64
+	}{
+		{
+			name: "keeps the reserve",
+			node: models.NodeResource{
+				Cpu:     models.Common{Free: "8"},
+				Memory:  models.Common{Free: "16.50 GiB"},
+				Storage: models.Common{Free: "100.00 GiB"},
+				Gpu: models.Gpu{Details: []models.GpuDetail{
+					{ProductName: "NVIDIA A100-SXM4-40GB", Status: models.Available},
+					{ProductName: "NVIDIA A100-SXM4-40GB", Status: models.Available},
+					{ProductName: "NVIDIA A100-SXM4-40GB", Status: models.Occupied},
+					{ProductName: "NVIDIA H100", Status: models.Available},
+				}},
+			},
+			want:    models.SellableResource{Cpu: 6, Memory: "12.50 GiB", Storage: "90.00 GiB"},
+			wantGpu: map[string]int64{"NVIDIA A100-SXM4-40GB": 1, "NVIDIA H100": 1},
+		},
+		{
+			name: "never below zero",
+			node: models.NodeResource{
+				Cpu:     models.Common{Free: "1"},
+				Memory:  models.Common{Free: "2.00 GiB"},
+				Storage: models.Common{Free: ""},
+				Gpu: models.Gpu{Details: []models.GpuDetail{
+					{ProductName: "NVIDIA A100-PCIE-80GB", Status: models.Available},
+				}},
+			},
+			want:    models.SellableResource{Cpu: 0, Memory: "0.00 GiB", Storage: "0.00 GiB"},
+			wantGpu: map[string]int64{"NVIDIA A100-PCIE-80GB": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tt.node
+			setSellable(&node, reserve)
+			got := node.Sellable
+			if got.Cpu != tt.want.Cpu || got.Memory != tt.want.Memory || got.Storage != tt.want.Storage {
+				t.Errorf("sellable = %d %s %s, want %d %s %s", got.Cpu, got.Memory, got.Storage, tt.want.Cpu, tt.want.Memory, tt.want.Storage)
+			}
+			if len(got.Gpu) != len(tt.wantGpu) {
+				t.Fatalf("sellable gpus = %v, want %v", got.Gpu, tt.wantGpu)
+			}
+			for name, count := range tt.wantGpu {
+				if got.Gpu[name] != count {
+					t.Errorf("sellable gpu %s = %d, want %d", name, got.Gpu[name], count)
+				}
+			}
+		})
+	}
+}
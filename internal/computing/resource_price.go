@@ -44,7 +44,7 @@ func GeneratePriceConfig() error {
 
 	file.WriteString(resourcePrice)
 
-	statisticalSources, err := NewK8sService().StatisticalSources(context.TODO())
+	statisticalSources, err := StatisticalSourcesOfClusters(context.TODO())
 	if err != nil {
 		return fmt.Errorf("failed to get gpu resource, error: %v", err)
 	}
@@ -61,6 +61,16 @@ func GeneratePriceConfig() error {
 		data := fmt.Sprintf("TARGET_GPU_%s=\"\" # SWAN/%s GPU unit a hour", strings.ReplaceAll(gpuStr, " ", "_"), strings.ReplaceAll(gpuStr, " ", "_"))
 		file.WriteString(data)
 	}
+
+	var sliceProfiles = make(map[string]bool)
+	for _, source := range statisticalSources {
+		for _, slice := range source.Gpu.Slices {
+			sliceProfiles[slice.Profile] = true
+		}
+	}
+	for profile := range sliceProfiles {
+		file.WriteString(fmt.Sprintf("\n%s=\"\" # SWAN/%s GPU slice a hour, empty is the share of TARGET_GPU_DEFAULT", gpuSlicePriceKey(profile), profile))
+	}
 	fmt.Printf("Successfully generated resource price configuration file at %s \n", resourcePriceFile)
 	return nil
 }
@@ -138,36 +138,39 @@ func gpuInPod(pod *corev1.Pod) (gpuName string, gpuCount int64) {
 	return gpuName, gpuCount
 }
 
+// checkClusterProviderStatus warns about the nodes whose free resources are below the reserve, no job is admitted on them
 func checkClusterProviderStatus(nodeResources []*models.NodeResource) {
-	var policy models.ResourcePolicy
-	cpPath, _ := os.LookupEnv("CP_PATH")
-	resourcePolicy := filepath.Join(cpPath, "resource_policy.json")
-	bytes, err := os.ReadFile(resourcePolicy)
-	if err != nil {
-		policy = defaultResourcePolicy()
-	} else {
-		if err = json.Unmarshal(bytes, &policy); err != nil {
-			logs.GetLogger().Errorf("parse json failed, error: %v", err)
-			return
-		}
-	}
+	policy := currentResourcePolicy()
+	reservedMemory := quotaBytes(policy.Memory)
+	reservedStorage := quotaBytes(policy.Storage)
 
 	for _, node := range nodeResources {
 		if node.Cpu.RemainderNum < policy.Cpu.Quota {
 			logs.GetLogger().Warningf("Insufficient cpu resources, current cpu resource: %s less than %d", node.Cpu.Free, policy.Cpu.Quota)
-			return
 		}
-		if node.Memory.RemainderNum < policy.Memory.Quota {
+		if node.Memory.RemainderNum < reservedMemory {
 			logs.GetLogger().Warningf("Insufficient memory resources, current memory resource: %s less than %d %s", node.Memory.Free, policy.Memory.Quota, policy.Memory.Unit)
-			return
 		}
-		if node.Storage.RemainderNum < policy.Storage.Quota {
+		if node.Storage.RemainderNum < reservedStorage {
 			logs.GetLogger().Warningf("Insufficient storage resources, current storage resource: %s less than %d %s", node.Storage.Free, policy.Storage.Quota, policy.Storage.Unit)
-			return
 		}
 	}
 }
 
+// loadResourcePolicy reads $CP_PATH/resource_policy.json, the default policy is used when the file does not exist
+func loadResourcePolicy() (models.ResourcePolicy, error) {
+	var policy models.ResourcePolicy
+	cpPath, _ := os.LookupEnv("CP_PATH")
+	bytes, err := os.ReadFile(filepath.Join(cpPath, "resource_policy.json"))
+	if err != nil {
+		return defaultResourcePolicy(), nil
+	}
+	if err = json.Unmarshal(bytes, &policy); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
 func defaultResourcePolicy() models.ResourcePolicy {
 	return models.ResourcePolicy{
 		Cpu: models.CpuQuota{
@@ -0,0 +1,225 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/contract"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/util"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// maxSpaceReplicas limits the replicas of one space job
+const maxSpaceReplicas = 10
+
+// ScaleJob changes the replicas of a running space job, the added replicas are charged for the rest of the job duration
+func ScaleJob(c *gin.Context) {
+	var jobData struct {
+		TaskUuid  string `json:"task_uuid"`
+		Replicas  int    `json:"replicas"`
+		BidPrice  string `json:"bid_price"` // the price paid for the added replicas
+		Signature string `json:"signature"`
+		models.SignedEnvelope
+	}
+
+	if err := c.ShouldBindJSON(&jobData); err != nil {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
+		return
+	}
+	logs.GetLogger().Infof("scale Job received: %+v", jobData)
+
+	if strings.TrimSpace(jobData.TaskUuid) == "" {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "missing required field: task_uuid"))
+		return
+	}
+
+	if jobData.Replicas < 1 || jobData.Replicas > maxSpaceReplicas {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, fmt.Sprintf("replicas must be between 1 and %d", maxSpaceReplicas)))
+		return
+	}
+
+	if conf.GetConfig().HUB.VerifySign {
+		if len(jobData.Signature) == 0 {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "missing signature field"))
+			return
+		}
+		cpRepoPath, _ := os.LookupEnv("CP_PATH")
+		nodeID := GetNodeId(cpRepoPath)
+
+		cpAccountAddress, err := contract.GetCpAccountAddress()
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get cp account contract address, error: %v", err)
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.GetCpAccountError))
+			return
+		}
+
+		// the bid price is signed as well, the separator keeps the replicas from running into it
+		signMsg := signedMessage(fmt.Sprintf("%s%s%s%d:%s", cpAccountAddress, nodeID, jobData.TaskUuid, jobData.Replicas, jobData.BidPrice), jobData.SignedEnvelope)
+		signature, err := verifySignatureForHub(conf.GetConfig().HUB.OrchestratorPk, signMsg, jobData.Signature)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to verify signature for scale job, error: %+v", err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "verify sign data occur error"))
+			return
+		}
+
+		if !signature {
+			logs.GetLogger().Errorf("scale job sign verifing, task_uuid: %s, verify: %v", jobData.TaskUuid, signature)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "signature verify failed"))
+			return
+		}
+
+		if !allowSigner(c, conf.GetConfig().HUB.OrchestratorPk) {
+			return
+		}
+
+		if err = checkSignedEnvelope(NonceSourceHub, jobData.SignedEnvelope); err != nil {
+			logs.GetLogger().Warnf("reject scale job, task_uuid: %s, error: %v", jobData.TaskUuid, err)
+			c.JSON(envelopeErrorResponse(err))
+			return
+		}
+	}
+
+	jobEntity, err := NewJobService().GetJobEntityByTaskUuid(jobData.TaskUuid)
+	if err != nil {
+		logs.GetLogger().Errorf("failed get job from db, taskUuid: %s, error: %+v", jobData.TaskUuid, err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.FoundJobEntityError))
+		return
+	}
+	if jobEntity.JobUuid == "" {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.NotFoundJobEntityError))
+		return
+	}
+	leftTime := jobEntity.ExpireTime - time.Now().Unix()
+	if leftTime < 0 {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "The job was terminated due to its expiration date"))
+		return
+	}
+	if jobEntity.K8sResourceType != "" && jobEntity.K8sResourceType != "deployment" {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "only the job running as a deployment can be scaled"))
+		return
+	}
+
+	k8sService := NewK8sServiceFor(jobEntity.Cluster)
+	deployName := constants.K8S_DEPLOY_NAME_PREFIX + strings.ToLower(jobEntity.JobUuid)
+	deployment, err := k8sService.GetDeployment(context.TODO(), jobEntity.NameSpace, deployName)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to get deployment, job_uuid: %s, error: %v", jobEntity.JobUuid, err)
+		if errors.IsNotFound(err) {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "the deployment of the job is not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.ServerError))
+		return
+	}
+	if _, updating := updatingJobs.Load(jobEntity.JobUuid); updating {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "the job is being updated"))
+		return
+	}
+
+	if jobData.Replicas > 1 {
+		if reason := singleReplicaReason(k8sService, jobEntity.NameSpace, deployment.Spec.Template); reason != "" {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "the job can only run one replica, "+reason))
+			return
+		}
+	}
+
+	currentReplicas := 1
+	if deployment.Spec.Replicas != nil {
+		currentReplicas = int(*deployment.Spec.Replicas)
+	}
+
+	if added := jobData.Replicas - currentReplicas; added > 0 {
+		spaceDetail, err := getSpaceDetail(jobEntity.SourceUrl)
+		if err != nil {
+			logs.GetLogger().Errorln(err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SpaceParseResourceUriError))
+			return
+		}
+		spaceHardware := spaceDetail.Data.Space.ActiveOrder.Config
+
+		if !conf.GetConfig().API.Pricing {
+			checkPriceFlag, totalCost, err := checkPrice(jobData.BidPrice, int(leftTime), spaceHardware, added)
+			if err != nil {
+				logs.GetLogger().Errorf("failed to check price, task_uuid: %s, error: %v", jobData.TaskUuid, err)
+				c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
+				return
+			}
+			if !checkPriceFlag {
+				logs.GetLogger().Warnf("the price is too low, task_uuid: %s, paid: %s, added replicas: %d, required: %0.4f", jobData.TaskUuid, jobData.BidPrice, added, totalCost)
+				c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BelowPriceError))
+				return
+			}
+		}
+
+		if spaceHardware.Description != "" {
+			// the added replicas run in the cluster of the job
+			available, _, err := checkResourceAvailableInCluster(k8sService, spaceHardware.Description, added, spaceTypeName(jobEntity.SpaceType))
+			if err != nil {
+				logs.GetLogger().Errorf("failed to check job resource, error: %+v", err)
+				c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.CheckResourcesError))
+				return
+			}
+			if !available {
+				c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.NoAvailableResourcesError))
+				return
+			}
+		}
+	}
+
+	replicas := int32(jobData.Replicas)
+	deployment.Spec.Replicas = &replicas
+	scaled, err := k8sService.UpdateDeployment(context.TODO(), jobEntity.NameSpace, deployment)
+	RecordAudit(AuditActorApi(c), "job scale", map[string]interface{}{"task_uuid": jobData.TaskUuid, "job_uuid": jobEntity.JobUuid,
+		"from": currentReplicas, "to": jobData.Replicas}, "", err)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to scale deployment, job_uuid: %s, error: %v", jobEntity.JobUuid, err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.ServerError))
+		return
+	}
+
+	if err = NewJobService().UpdateJobEntityByJobUuid(&models.JobEntity{JobUuid: jobEntity.JobUuid, Replicas: jobData.Replicas}); err != nil {
+		logs.GetLogger().Errorf("failed to update job replicas, job_uuid: %s, error: %v", jobEntity.JobUuid, err)
+	}
+
+	// the scheduler places the added replicas, the nodes of the job are recorded once they run
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logs.GetLogger().Errorf("scale space job panic, job_uuid: %s, error: %+v", jobEntity.JobUuid, err)
+			}
+		}()
+		if err := waitForRollout(k8sService, jobEntity.NameSpace, deployName, scaled.Generation); err != nil {
+			logs.GetLogger().Warnf("the replicas of the scaled job are not all available, job_uuid: %s, error: %v", jobEntity.JobUuid, err)
+		}
+		refreshJobNodeName(jobEntity.NameSpace, jobEntity.JobUuid, jobEntity.NodeName)
+	}()
+	c.JSON(http.StatusOK, util.CreateSuccessResponse(map[string]interface{}{
+		"replicas": jobData.Replicas,
+	}))
+}
+
+// singleReplicaReason returns why the pods of the job can not be replicated, or empty when they can: the replicas of
+// a private space would share its node port, the ones of a host port the port of the node and a read-write-once pvc
+// is only attached to one node
+func singleReplicaReason(k8sService *K8sService, namespace string, template coreV1.PodTemplateSpec) string {
+	if template.Labels["hub-private"] != "" {
+		return "it is exposed by a node port"
+	}
+	if usesHostPort(template.Spec) {
+		return "it uses a host port"
+	}
+	if mountsReadWriteOnce(k8sService, namespace, template.Spec) {
+		return "it mounts a read-write-once volume"
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package computing
+
+import (
+	"testing"
+
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSingleReplicaReason(t *testing.T) {
+	container := coreV1.Container{Name: "web", Ports: []coreV1.ContainerPort{{ContainerPort: 80}}}
+	hostPort := coreV1.Container{Name: "web", Ports: []coreV1.ContainerPort{{ContainerPort: 80, HostPort: 30080}}}
+	tests := []struct {
+		name     string
+		template coreV1.PodTemplateSpec
+		want     string
+	}{
+		{"public space", coreV1.PodTemplateSpec{Spec: coreV1.PodSpec{Containers: []coreV1.Container{container}}}, ""},
+		{"private space", coreV1.PodTemplateSpec{
+			ObjectMeta: metaV1.ObjectMeta{Labels: map[string]string{"hub-private": "job-1"}},
+			Spec:       coreV1.PodSpec{Containers: []coreV1.Container{container}},
+		}, "it is exposed by a node port"},
+		{"host port", coreV1.PodTemplateSpec{Spec: coreV1.PodSpec{Containers: []coreV1.Container{hostPort}}}, "it uses a host port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// none of the pods mounts a pvc, so the cluster is not asked
+			if got := singleReplicaReason(nil, "ns-1", tt.template); got != tt.want {
+				t.Errorf("singleReplicaReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
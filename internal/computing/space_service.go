@@ -9,8 +9,10 @@ import (
 	"github.com/swanchain/go-computing-provider/internal/contract/account"
 	"github.com/swanchain/go-computing-provider/internal/yaml"
 	"io"
+	"math"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -51,6 +53,9 @@ func GetServiceProviderInfo(c *gin.Context) {
 }
 
 func ReceiveJob(c *gin.Context) {
+	if rejectInMaintenance(c) {
+		return
+	}
 	var jobData models.JobData
 	if err := c.ShouldBindJSON(&jobData); err != nil {
 		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
@@ -70,6 +75,11 @@ func ReceiveJob(c *gin.Context) {
 		return
 	}
 
+	if jobData.Replicas < 0 || jobData.Replicas > maxSpaceReplicas {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, fmt.Sprintf("replicas must be between 1 and %d", maxSpaceReplicas)))
+		return
+	}
+
 	if conf.GetConfig().HUB.VerifySign {
 		if len(jobData.NodeIdJobSourceUriSignature) == 0 {
 			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "missing node_id_job_source_uri_signature field"))
@@ -85,7 +95,13 @@ func ReceiveJob(c *gin.Context) {
 			return
 		}
 
-		signature, err := verifySignatureForHub(conf.GetConfig().HUB.OrchestratorPk, fmt.Sprintf("%s%s%s", cpAccountAddress, nodeID, jobData.JobSourceURI), jobData.NodeIdJobSourceUriSignature)
+		// the replicas are signed when they are requested, so the message of a single replica job is unchanged
+		signPayload := jobData.JobSourceURI
+		if jobData.Replicas > 0 {
+			signPayload += fmt.Sprintf(";replicas=%d", jobData.Replicas)
+		}
+		signMsg := signedMessage(fmt.Sprintf("%s%s%s", cpAccountAddress, nodeID, signPayload), jobData.SignedEnvelope)
+		signature, err := verifySignatureForHub(conf.GetConfig().HUB.OrchestratorPk, signMsg, jobData.NodeIdJobSourceUriSignature)
 		if err != nil {
 			logs.GetLogger().Errorf("failed to verify signature for space job, error: %+v", err)
 			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "verify sign data occur error"))
@@ -97,44 +113,22 @@ func ReceiveJob(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "signature verify failed"))
 			return
 		}
-	}
 
-	spaceDetail, err := getSpaceDetail(jobData.JobSourceURI)
-	if err != nil {
-		logs.GetLogger().Errorln(err)
-		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SpaceParseResourceUriError))
-		return
-	}
-
-	if jobData.JobType == 1 {
-		if !conf.GetConfig().API.Pricing {
-			checkPriceFlag, totalCost, err := checkPrice(jobData.BidPrice, jobData.Duration, spaceDetail.Data.Space.ActiveOrder.Config)
-			if err != nil {
-				logs.GetLogger().Errorf("failed to check price, job_uuid: %s, error: %v", jobData.UUID, err)
-				c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
-				return
-			}
+		if !allowSigner(c, conf.GetConfig().HUB.OrchestratorPk) {
+			return
+		}
 
-			if !checkPriceFlag {
-				logs.GetLogger().Warnf("the price is too low, job_uuid: %s, paid: %s, required: %0.4f", jobData.UUID, jobData.BidPrice, totalCost)
-				c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BelowPriceError))
-				return
-			}
+		if err = checkSignedEnvelope(NonceSourceHub, jobData.SignedEnvelope); err != nil {
+			logs.GetLogger().Warnf("reject space job, job_uuid: %s, error: %v", jobData.UUID, err)
+			c.JSON(envelopeErrorResponse(err))
+			return
 		}
 	}
 
-	available, gpuProductName, err := checkResourceAvailableForSpace(spaceDetail.Data.Space.ActiveOrder.Config.Description)
+	spaceDetail, err := getSpaceDetail(jobData.JobSourceURI)
 	if err != nil {
-		logs.GetLogger().Errorf("failed to check job resource, error: %+v", err)
-		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.CheckResourcesError))
-		return
-	}
-
-	saveGpuCache(gpuProductName)
-
-	if !available {
-		logs.GetLogger().Warnf("job_uuid: %s, name: %s, not found a resources available", jobData.UUID, jobData.Name)
-		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.NoAvailableResourcesError))
+		logs.GetLogger().Errorln(err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SpaceParseResourceUriError))
 		return
 	}
 
@@ -150,7 +144,6 @@ func ReceiveJob(c *gin.Context) {
 	}
 
 	multiAddressSplit := strings.Split(conf.GetConfig().API.MultiAddress, "/")
-	jobSourceUri := jobData.JobSourceURI
 	spaceUuid := spaceDetail.Data.Space.Uuid
 	wsUrl := fmt.Sprintf("wss://%s:%s/api/v1/computing/lagrange/spaces/log?job_uuid=%s", logHost, multiAddressSplit[4], jobData.UUID)
 	jobData.BuildLog = wsUrl + "&type=build"
@@ -165,125 +158,262 @@ func ReceiveJob(c *gin.Context) {
 		return
 	}
 
-	var serviceNodePort int32
+	replicas := max(jobData.Replicas, 1)
+	// a space is public until its yaml asks for a node port
+	spaceType := constants.SPACE_TYPE_PUBLIC
 	if deployParam.ContainsYaml {
 		containerResources, err := yaml.HandlerYaml(deployParam.YamlFilePath)
 		if err != nil {
 			logs.GetLogger().Errorf("failed to parse yaml, job_uuid: %s, error: %v", jobData.UUID, err)
+			if validationErr, ok := yaml.AsValidationError(err); ok {
+				c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.YamlValidationError, validationErr.Error()))
+				return
+			}
 			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.DownloadResourceError))
 			return
 		}
 
 		if len(containerResources) == 1 && containerResources[0].ServiceType == yaml.ServiceTypeNodePort {
-			chainRpc, err := conf.GetRpcByNetWorkName()
-			if err != nil {
-				logs.GetLogger().Errorf("failed to get rpc, job_uuid: %s, error: %v", jobData.UUID, err)
-				c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RpcConnectError))
+			spaceType = constants.SPACE_TYPE_PRIVATE
+		} else if count := containerResources[0].Count; count > 0 {
+			// the count of the deployment yaml overrides the replicas of the job
+			if count > maxSpaceReplicas {
+				c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.YamlValidationError, fmt.Sprintf("the count %d of the deployment exceeds %d replicas", count, maxSpaceReplicas)))
 				return
 			}
-			client, err := contract.GetEthClient(chainRpc)
-			if err != nil {
-				logs.GetLogger().Errorf("failed to connect rpc, job_uuid: %s, error: %v", jobData.UUID, err)
-				c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RpcConnectError))
-				return
-			}
-			defer client.Close()
+			replicas = count
+		}
+	}
 
-			cpStub, err := account.NewAccountStub(client)
-			if err != nil {
-				logs.GetLogger().Errorf("job_uuid: %s, error: %v", jobData.UUID, err)
-				c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RpcConnectError))
-				return
-			}
-			cpAccount, err := cpStub.GetCpAccountInfo()
-			if err != nil {
-				logs.GetLogger().Errorf("job_uuid: %s, error: %v", jobData.UUID, err)
-				c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RpcConnectError))
-				return
-			}
+	// the yaml is parsed first, so the job is admitted once with its real replicas and space type,
+	// the private spaces may be confined to other node pools
+	placement, ok := admitSpaceReplicas(c, jobData, spaceDetail.Data.Space.ActiveOrder.Config, replicas, spaceType)
+	if !ok {
+		return
+	}
 
-			var sshTaskFlag bool
-			for _, taskType := range cpAccount.TaskTypes {
-				if taskType == 5 {
-					sshTaskFlag = true
-					break
-				}
-			}
+	var serviceNodePort int32
+	if spaceType == constants.SPACE_TYPE_PRIVATE {
+		chainRpc, err := conf.GetRpcByNetWorkName()
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get rpc, job_uuid: %s, error: %v", jobData.UUID, err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RpcConnectError))
+			return
+		}
+		client, err := contract.GetEthClient(chainRpc)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to connect rpc, job_uuid: %s, error: %v", jobData.UUID, err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RpcConnectError))
+			return
+		}
+		defer client.Close()
 
-			if !sshTaskFlag {
-				c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.NotAcceptNodePortError))
-				return
-			}
+		cpStub, err := account.NewAccountStub(client)
+		if err != nil {
+			logs.GetLogger().Errorf("job_uuid: %s, error: %v", jobData.UUID, err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RpcConnectError))
+			return
+		}
+		cpAccount, err := cpStub.GetCpAccountInfo()
+		if err != nil {
+			logs.GetLogger().Errorf("job_uuid: %s, error: %v", jobData.UUID, err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RpcConnectError))
+			return
+		}
 
-			_, serviceNodePort, err = NewK8sService().CheckServiceNodePort(0)
-			if err != nil {
-				logs.GetLogger().Errorf("failed to check port, error: %v", err)
-				c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.PortNoAvailableError))
-				return
+		var sshTaskFlag bool
+		for _, taskType := range cpAccount.TaskTypes {
+			if taskType == 5 {
+				sshTaskFlag = true
+				break
 			}
-
-			realUrl := fmt.Sprintf("ssh root@%s -p%d", multiAddressSplit[2], serviceNodePort)
-			jobData.JobRealUri = realUrl
-			jobData.ContainerLog = jobData.ContainerLog + "&order=private"
-			logs.GetLogger().Infof("job_uuid: %s, real url: %s", jobData.UUID, realUrl)
 		}
-	}
 
-	go func() {
-		var currentBlockNumber uint64
-		for i := 0; i < 5; i++ {
-			currentBlockNumber, err = getChainBlockNumber()
-			if err != nil {
-				logs.GetLogger().Errorf("failed to get blockNumber, error: %v", err)
-				time.Sleep(time.Second)
-				continue
-			}
+		if !sshTaskFlag {
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.NotAcceptNodePortError))
+			return
 		}
 
-		var jobEntity = new(models.JobEntity)
-		jobEntity.Source = jobData.StorageSource
-		jobEntity.SpaceUuid = spaceUuid
-		jobEntity.TaskUuid = jobData.TaskUUID
-		jobEntity.SourceUrl = jobSourceUri
-		jobEntity.RealUrl = jobData.JobRealUri
-		jobEntity.BuildLog = jobData.BuildLog
-		jobEntity.ContainerLog = jobData.ContainerLog
-		jobEntity.Duration = jobData.Duration
-		jobEntity.JobUuid = jobData.UUID
-		jobEntity.DeployStatus = models.DEPLOY_RECEIVE_JOB
-		jobEntity.CreateTime = time.Now().Unix()
-		jobEntity.ExpireTime = time.Now().Unix() + int64(jobData.Duration)
-		jobEntity.StartedBlock = conf.GetConfig().CONTRACT.JobManagerCreated
-		jobEntity.ScannedBlock = currentBlockNumber
-		jobEntity.WalletAddress = spaceDetail.Data.Owner.PublicAddress
-		jobEntity.Name = spaceDetail.Data.Space.Name
-		jobEntity.Hardware = spaceDetail.Data.Space.ActiveOrder.Config.Description
-		jobEntity.SpaceType = 0
-		jobEntity.ResourceType = spaceDetail.Data.Space.ActiveOrder.Config.HardwareType
-		jobEntity.NameSpace = constants.K8S_NAMESPACE_NAME_PREFIX + strings.ToLower(spaceDetail.Data.Owner.PublicAddress)
-		jobEntity.K8sDeployName = constants.K8S_DEPLOY_NAME_PREFIX + strings.ToLower(jobData.UUID)
-		jobEntity.Status = models.JOB_RECEIVED_STATUS
-		jobEntity.K8sResourceType = "deployment"
-		jobEntity.IpWhiteList = strings.Join(jobData.IpWhiteList, ",")
-		err = NewJobService().SaveJobEntity(jobEntity)
+		_, serviceNodePort, err = NewK8sServiceFor(placement.cluster).CheckServiceNodePort(0)
 		if err != nil {
+			logs.GetLogger().Errorf("failed to check port, error: %v", err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.PortNoAvailableError))
+			return
+		}
+
+		realUrl := fmt.Sprintf("ssh root@%s -p%d", ClusterPublicIp(placement.cluster), serviceNodePort)
+		jobData.JobRealUri = realUrl
+		jobData.ContainerLog = jobData.ContainerLog + "&order=private"
+		logs.GetLogger().Infof("job_uuid: %s, real url: %s", jobData.UUID, realUrl)
+	}
+
+	saveGpuCache(placement.gpuProductName)
+	jobData.Replicas = replicas
+
+	// the checkpoint is saved before the job, so a job accepted just before the shutdown is deployed on the next start
+	cp := saveSpaceDeployCheckpoint(jobData, deployParam, hostName, placement, serviceNodePort)
+	runInBackground(func() {
+		jobEntity := newSpaceJobEntity(jobData, spaceDetail, placement, spaceType, waitChainBlockNumber())
+		if err := NewJobService().SaveJobEntity(jobEntity); err != nil {
 			logs.GetLogger().Errorf("failed to save job to db, job_uuid: %s, error: %+v", jobData.UUID, err)
 		}
 
 		go func() {
-			if err = submitJob(&jobData); err != nil {
+			if err := submitJob(&jobData); err != nil {
 				logs.GetLogger().Errorf("failed to upload job data to MCS, job_uuid: %s, spaceUuid: %s, error: %v", jobData.UUID, spaceUuid, err)
 				return
 			}
 			logs.GetLogger().Infof("successfully uploaded to MCS, jobuuid: %s", jobData.UUID)
 		}()
 
-		DeploySpaceTask(jobData, deployParam, hostName, gpuProductName, serviceNodePort, jobData.JobType, jobData.IpWhiteList)
-	}()
+		DeploySpaceTask(cp, jobData, deployParam, hostName, placement, serviceNodePort, jobData.JobType, jobData.IpWhiteList)
+	})
 
 	c.JSON(http.StatusOK, util.CreateSuccessResponse(jobData))
 }
 
+// waitChainBlockNumber returns the current block number of the chain, 0 if it is not got in 5 tries
+func waitChainBlockNumber() uint64 {
+	for i := 0; i < 5; i++ {
+		currentBlockNumber, err := getChainBlockNumber()
+		if err == nil {
+			return currentBlockNumber
+		}
+		logs.GetLogger().Errorf("failed to get blockNumber, error: %v", err)
+		time.Sleep(time.Second)
+	}
+	return 0
+}
+
+// newSpaceJobEntity returns the entity of a received space job, the jobs are scanned on chain from the block
+func newSpaceJobEntity(jobData models.JobData, spaceDetail models.SpaceJSON, placement spacePlacement, spaceType string, blockNumber uint64) *models.JobEntity {
+	var jobEntity = new(models.JobEntity)
+	jobEntity.Source = jobData.StorageSource
+	jobEntity.SpaceUuid = spaceDetail.Data.Space.Uuid
+	jobEntity.TaskUuid = jobData.TaskUUID
+	jobEntity.SourceUrl = jobData.JobSourceURI
+	jobEntity.RealUrl = jobData.JobRealUri
+	jobEntity.BuildLog = jobData.BuildLog
+	jobEntity.ContainerLog = jobData.ContainerLog
+	jobEntity.Duration = jobData.Duration
+	jobEntity.JobUuid = jobData.UUID
+	jobEntity.DeployStatus = models.DEPLOY_RECEIVE_JOB
+	jobEntity.CreateTime = time.Now().Unix()
+	jobEntity.ExpireTime = time.Now().Unix() + int64(jobData.Duration)
+	jobEntity.StartedBlock = conf.GetConfig().CONTRACT.JobManagerCreated
+	jobEntity.ScannedBlock = blockNumber
+	jobEntity.WalletAddress = spaceDetail.Data.Owner.PublicAddress
+	jobEntity.Name = spaceDetail.Data.Space.Name
+	jobEntity.Hardware = spaceDetail.Data.Space.ActiveOrder.Config.Description
+	if spaceType == constants.SPACE_TYPE_PRIVATE {
+		jobEntity.SpaceType = 1
+	}
+	jobEntity.NodeName = strings.Join(placement.nodeNames(), ",")
+	jobEntity.Cluster = placement.cluster
+	jobEntity.ResourceType = spaceDetail.Data.Space.ActiveOrder.Config.HardwareType
+	jobEntity.NameSpace = constants.K8S_NAMESPACE_NAME_PREFIX + strings.ToLower(spaceDetail.Data.Owner.PublicAddress)
+	jobEntity.K8sDeployName = constants.K8S_DEPLOY_NAME_PREFIX + strings.ToLower(jobData.UUID)
+	jobEntity.Status = models.JOB_RECEIVED_STATUS
+	jobEntity.K8sResourceType = "deployment"
+	jobEntity.IpWhiteList = strings.Join(jobData.IpWhiteList, ",")
+	jobEntity.Replicas = max(jobData.Replicas, 1)
+	return jobEntity
+}
+
+// admitSpaceReplicas checks the price and the free resources for the replicas of a space job and places them on the nodes,
+// the response is written when the job is rejected
+func admitSpaceReplicas(c *gin.Context, jobData models.JobData, hardware models.SpaceHardware, replicas int, spaceType string) (spacePlacement, bool) {
+	// the order of a standard job pays for one replica and the bid price for the others, a custom job pays for all of them
+	// by the bid price
+	paidReplicas := replicas
+	if jobData.JobType != 1 {
+		paidReplicas = replicas - 1
+	}
+	if paidReplicas > 0 {
+		if !conf.GetConfig().API.Pricing {
+			checkPriceFlag, totalCost, err := checkPrice(jobData.BidPrice, jobData.Duration, hardware, paidReplicas)
+			if err != nil {
+				logs.GetLogger().Errorf("failed to check price, job_uuid: %s, error: %v", jobData.UUID, err)
+				c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
+				return spacePlacement{}, false
+			}
+
+			if !checkPriceFlag {
+				logs.GetLogger().Warnf("the price is too low, job_uuid: %s, paid: %s, paid replicas: %d, required: %0.4f", jobData.UUID, jobData.BidPrice, paidReplicas, totalCost)
+				c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BelowPriceError))
+				return spacePlacement{}, false
+			}
+		}
+	}
+
+	available, placement, err := checkResourceAvailableForSpace(hardware.Description, replicas, spaceType)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to check job resource, error: %+v", err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.CheckResourcesError))
+		return spacePlacement{}, false
+	}
+
+	if !available {
+		logs.GetLogger().Warnf("job_uuid: %s, name: %s, replicas: %d, not found a resources available", jobData.UUID, jobData.Name, replicas)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.NoAvailableResourcesError))
+		return spacePlacement{}, false
+	}
+	return placement, true
+}
+
+// ValidateJob downloads the files of the space and returns every problem found by ValidateSpace without deploying it
+func ValidateJob(c *gin.Context) {
+	var req struct {
+		JobSourceURI string `json:"job_source_uri" binding:"required"`
+		JobType      int    `json:"job_type"` // 0: Standard job; 1: Custom job
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
+		return
+	}
+
+	// the uri is not signed by the orchestrator here, so the cp must not be made to fetch arbitrary urls
+	sourceUrl, err := url.Parse(req.JobSourceURI)
+	if err != nil || (sourceUrl.Scheme != "http" && sourceUrl.Scheme != "https") || !conf.GetConfig().HUB.AllowJobSourceHost(sourceUrl.Hostname()) {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "job_source_uri is not a space of the allowed hosts"))
+		return
+	}
+
+	spaceDetail, err := getSpaceDetail(req.JobSourceURI)
+	if err != nil {
+		logs.GetLogger().Errorln(err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SpaceParseResourceUriError))
+		return
+	}
+
+	validateDir, err := os.MkdirTemp("", "cp-validate-")
+	if err != nil {
+		logs.GetLogger().Errorf("failed to create validate directory, error: %v", err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.ServerError))
+		return
+	}
+	defer os.RemoveAll(validateDir)
+
+	deployParam, err := downloadSpaceFiles(validateDir, spaceDetail.Data.Files)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to download space resource, job_source_uri: %s, error: %v", req.JobSourceURI, err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.DownloadResourceError))
+		return
+	}
+
+	spaceHardware := spaceDetail.Data.Space.ActiveOrder.Config
+	var hardware *models.Resource
+	if req.JobType == 1 {
+		_, hardwareDetail := getHardwareDetailByByte(spaceHardware)
+		hardware = &hardwareDetail
+	} else if spaceHardware.Description != "" {
+		_, hardwareDetail := getHardwareDetail(spaceHardware.Description)
+		hardware = &hardwareDetail
+	}
+
+	c.JSON(http.StatusOK, util.CreateSuccessResponse(ValidateSpace(deployParam, hardware)))
+}
+
 func getChainBlockNumber() (uint64, error) {
 	var currentBlockNumber uint64
 	chainUrl, err := conf.GetRpcByNetWorkName()
@@ -359,8 +489,10 @@ func submitJob(jobData *models.JobData) error {
 
 func ReNewJob(c *gin.Context) {
 	var jobData struct {
-		TaskUuid string `json:"task_uuid"`
-		Duration int    `json:"duration"`
+		TaskUuid  string `json:"task_uuid"`
+		Duration  int    `json:"duration"`
+		Signature string `json:"signature"`
+		models.SignedEnvelope
 	}
 
 	if err := c.ShouldBindJSON(&jobData); err != nil {
@@ -379,6 +511,46 @@ func ReNewJob(c *gin.Context) {
 		return
 	}
 
+	if conf.GetConfig().HUB.VerifySign {
+		if len(jobData.Signature) == 0 {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "missing signature field"))
+			return
+		}
+		cpRepoPath, _ := os.LookupEnv("CP_PATH")
+		nodeID := GetNodeId(cpRepoPath)
+
+		cpAccountAddress, err := contract.GetCpAccountAddress()
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get cp account contract address, error: %v", err)
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.GetCpAccountError))
+			return
+		}
+
+		signMsg := signedMessage(fmt.Sprintf("%s%s%s%d", cpAccountAddress, nodeID, jobData.TaskUuid, jobData.Duration), jobData.SignedEnvelope)
+		signature, err := verifySignatureForHub(conf.GetConfig().HUB.OrchestratorPk, signMsg, jobData.Signature)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to verify signature for renew job, error: %+v", err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "verify sign data occur error"))
+			return
+		}
+
+		if !signature {
+			logs.GetLogger().Errorf("renew job sign verifing, task_uuid: %s, verify: %v", jobData.TaskUuid, signature)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "signature verify failed"))
+			return
+		}
+
+		if !allowSigner(c, conf.GetConfig().HUB.OrchestratorPk) {
+			return
+		}
+
+		if err = checkSignedEnvelope(NonceSourceHub, jobData.SignedEnvelope); err != nil {
+			logs.GetLogger().Warnf("reject renew job, task_uuid: %s, error: %v", jobData.TaskUuid, err)
+			c.JSON(envelopeErrorResponse(err))
+			return
+		}
+	}
+
 	jobEntity, err := NewJobService().GetJobEntityByTaskUuid(jobData.TaskUuid)
 	if err != nil {
 		logs.GetLogger().Errorf("failed get job from db, taskUuid: %s, error: %+v", jobData.TaskUuid, err)
@@ -403,6 +575,8 @@ func ReNewJob(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SaveJobEntityError))
 			return
 		}
+		RecordAudit(AuditActorApi(c), "job renew", map[string]interface{}{"task_uuid": jobData.TaskUuid, "duration": jobData.Duration,
+			"expire_time": jobEntity.ExpireTime}, "", nil)
 
 	}
 	c.JSON(http.StatusOK, util.CreateSuccessResponse("success"))
@@ -432,7 +606,13 @@ func CancelJob(c *gin.Context) {
 			return
 		}
 
-		signature, err := verifySignatureForHub(conf.GetConfig().HUB.OrchestratorPk, fmt.Sprintf("%s%s%s", cpAccountAddress, nodeID, taskUuid), nodeIdAndTaskUuidSignature)
+		var envelope models.SignedEnvelope
+		if err = c.ShouldBindQuery(&envelope); err != nil {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "invalid timestamp or nonce"))
+			return
+		}
+
+		signature, err := verifySignatureForHub(conf.GetConfig().HUB.OrchestratorPk, signedMessage(fmt.Sprintf("%s%s%s", cpAccountAddress, nodeID, taskUuid), envelope), nodeIdAndTaskUuidSignature)
 		if err != nil {
 			logs.GetLogger().Errorf("verifySignature for space job failed, error: %+v", err)
 			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.ServerError, "verify sign data failed"))
@@ -444,6 +624,16 @@ func CancelJob(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "signature verify failed"))
 			return
 		}
+
+		if !allowSigner(c, conf.GetConfig().HUB.OrchestratorPk) {
+			return
+		}
+
+		if err = checkSignedEnvelope(NonceSourceHub, envelope); err != nil {
+			logs.GetLogger().Warnf("reject cancel job, task_uuid: %s, error: %v", taskUuid, err)
+			c.JSON(envelopeErrorResponse(err))
+			return
+		}
 	}
 
 	jobEntity, err := NewJobService().GetJobEntityByTaskUuid(taskUuid)
@@ -457,6 +647,7 @@ func CancelJob(c *gin.Context) {
 		c.JSON(http.StatusOK, util.CreateSuccessResponse("deleted success"))
 		return
 	}
+	RecordAudit(AuditActorApi(c), "job cancel", map[string]interface{}{"task_uuid": taskUuid, "job_uuid": jobEntity.JobUuid}, "", nil)
 	go func() {
 		defer func() {
 			if err := recover(); err != nil {
@@ -658,14 +849,13 @@ func StatisticalSources(c *gin.Context) {
 		location = "-"
 	}
 
-	k8sService := NewK8sService()
-	statisticalSources, err := k8sService.StatisticalSources(context.TODO())
+	statisticalSources, err := StatisticalSourcesOfClusters(context.TODO())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.GeResourceError))
 		return
 	}
 
-	clusterRuntime, err := k8sService.GetClusterRuntime()
+	clusterRuntime, err := NewK8sService().GetClusterRuntime()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.GeResourceError))
 		return
@@ -677,10 +867,19 @@ func StatisticalSources(c *gin.Context) {
 		return
 	}
 
+	reserve := currentReserve()
+	for _, node := range statisticalSources {
+		setSellable(node, reserve)
+	}
+	policy := currentResourcePolicy()
+	maintenance := currentMaintenance()
+
 	cpRepo, _ := os.LookupEnv("CP_PATH")
 	c.JSON(http.StatusOK, models.ClusterResource{
 		Region:           location,
 		ClusterInfo:      statisticalSources,
+		Reserved:         &policy,
+		Maintenance:      &maintenance,
 		NodeName:         conf.GetConfig().API.NodeName,
 		NodeId:           GetNodeId(cpRepo),
 		CpAccountAddress: cpAccountAddress,
@@ -858,7 +1057,7 @@ func handlePodEvent(conn *websocket.Conn, jobUuid string, walletAddress string)
 	client := NewWsClient(conn)
 
 	k8sNameSpace := constants.K8S_NAMESPACE_NAME_PREFIX + strings.ToLower(walletAddress)
-	k8sService := NewK8sService()
+	k8sService := NewK8sServiceForJob(jobUuid)
 	events, err := k8sService.k8sClient.CoreV1().Events(k8sNameSpace).List(context.TODO(), metaV1.ListOptions{})
 	if err != nil {
 		logs.GetLogger().Errorf("get pod events failed, error: %v", err)
@@ -887,12 +1086,12 @@ func handleConnection(conn *websocket.Conn, jobDetail models.JobEntity, logType
 		} else {
 			logFile, _ := os.Open(buildLogPath)
 			defer logFile.Close()
-			client.HandleLogs(logFile)
+			client.HandleLogs(&buildLogReader{file: logFile, jobUuid: jobDetail.JobUuid})
 		}
 	} else if logType == "container" {
 		k8sNameSpace := constants.K8S_NAMESPACE_NAME_PREFIX + strings.ToLower(jobDetail.WalletAddress)
 
-		k8sService := NewK8sService()
+		k8sService := NewK8sServiceFor(jobDetail.Cluster)
 		pods, err := k8sService.k8sClient.CoreV1().Pods(k8sNameSpace).List(context.TODO(), metaV1.ListOptions{
 			LabelSelector: fmt.Sprintf("lad_app=%s", jobDetail.JobUuid),
 		})
@@ -927,18 +1126,23 @@ func handleConnection(conn *websocket.Conn, jobDetail models.JobEntity, logType
 	}
 }
 
-func DeploySpaceTask(jobData models.JobData, deployParam DeployParam, hostName string, gpuProductName string, nodePort int32, jobType int, ipWhiteList []string) {
+// DeploySpaceTask builds and deploys a space job, its checkpoint is kept when the shutdown interrupts it before a stage
+func DeploySpaceTask(cp *checkpoint, jobData models.JobData, deployParam DeployParam, hostName string, placement spacePlacement, nodePort int32, jobType int, ipWhiteList []string) {
 	updateJobStatus(jobData.UUID, models.DEPLOY_UPLOAD_RESULT)
 	var success bool
+	var interrupted bool
 	var jobUuid string
 	var walletAddress string
 	defer func() {
-		deleteGpuCache(gpuProductName)
-		if !success {
+		deleteGpuCache(placement.gpuProductName)
+		if !success && !interrupted {
 			k8sNameSpace := constants.K8S_NAMESPACE_NAME_PREFIX + strings.ToLower(walletAddress)
 			DeleteJob(k8sNameSpace, jobUuid, "failed to deploy space")
 			NewJobService().DeleteJobEntityByJobUuId(jobData.UUID, models.JOB_TERMINATED_STATUS)
 		}
+		if !interrupted {
+			cp.done()
+		}
 
 		if err := recover(); err != nil {
 			logs.GetLogger().Errorf("deploy space task painc, error: %+v", err)
@@ -969,10 +1173,15 @@ func DeploySpaceTask(jobData models.JobData, deployParam DeployParam, hostName s
 	}
 
 	deploy.WithIpWhiteList(ipWhiteList)
+	deploy.WithReplicas(jobData.Replicas)
 	deploy.WithSpaceName(spaceName)
-	deploy.WithGpuProductName(gpuProductName)
+	deploy.WithPlacement(placement)
 	deploy.WithSpacePath(deployParam.BuildImagePath)
 	if len(deployParam.ModelsSettingFilePath) > 0 {
+		if !cp.advance(stageDeploying) {
+			interrupted = true
+			return
+		}
 		err := deploy.WithModelSettingFile(deployParam.ModelsSettingFilePath).ModelInferenceToK8s()
 		if err != nil {
 			logs.GetLogger().Error(err)
@@ -983,9 +1192,16 @@ func DeploySpaceTask(jobData models.JobData, deployParam DeployParam, hostName s
 	}
 
 	if deployParam.ContainsYaml {
+		if !cp.advance(stageDeploying) {
+			interrupted = true
+			return
+		}
 		err := deploy.WithYamlInfo(deployParam.YamlFilePath).YamlToK8s(nodePort)
 		if err != nil {
 			logs.GetLogger().Errorf("failed to use yaml to deploy job, error: %v", err)
+			if err = NewJobService().UpdateJobError(jobData.UUID, err.Error()); err != nil {
+				logs.GetLogger().Errorf("failed to save job error, job_uuid: %s, error: %v", jobData.UUID, err)
+			}
 			return
 		}
 		if deploy.nodePortUrl != "" {
@@ -998,41 +1214,63 @@ func DeploySpaceTask(jobData models.JobData, deployParam DeployParam, hostName s
 		}
 		success = true
 	} else {
+		if !cp.advance(stageBuilding) {
+			interrupted = true
+			return
+		}
 		imageName, dockerfilePath := BuildImagesByDockerfile(jobData.UUID, spaceName, deployParam.BuildImagePath)
+		if err = importImageToCluster(imageName); err != nil {
+			logs.GetLogger().Error(err)
+			return
+		}
+		if !cp.advance(stageDeploying) {
+			interrupted = true
+			return
+		}
+		deploy.WithDockerfile(imageName, dockerfilePath).DockerfileToK8s()
+		success = true
+	}
+	return
+}
 
-		clusterRuntime, err := NewK8sService().GetClusterRuntime()
+// importImageToCluster loads the image built by docker into containerd, when the default cluster does not run on docker.
+// The images built inside the cluster are pulled from the registry, the other clusters need the registry as well.
+func importImageToCluster(imageName string) error {
+	if conf.GetConfig().Builder.InCluster() {
+		return nil
+	}
+	clusterRuntime, err := NewK8sService().GetClusterRuntime()
+	if err != nil {
+		return fmt.Errorf("failed to get cluster runtime, error: %v", err)
+	}
+	logs.GetLogger().Infof("cluster runtime: %s", clusterRuntime)
+	if strings.Contains(strings.ToLower(clusterRuntime), "containerd") {
+		imageTar, err := NewDockerService().SaveDockerImage(imageName)
 		if err != nil {
-			logs.GetLogger().Errorf("failed to get cluster runtime, error: %v", err)
-		} else {
-			logs.GetLogger().Infof("cluster runtime: %s", clusterRuntime)
-			if strings.Contains(strings.ToLower(clusterRuntime), "containerd") {
-				imageTar, err := NewDockerService().SaveDockerImage(imageName)
-				if err != nil {
-					logs.GetLogger().Errorf("failed to save image, imageName: %s error: %v", imageName, err)
-					return
-				}
-				if err = ImportImageToContainerd(imageTar); err != nil {
-					logs.GetLogger().Errorf("failed to load image into containerd, imageName: %s error: %v", imageName, err)
-					return
-				}
-			}
-			deploy.WithDockerfile(imageName, dockerfilePath).DockerfileToK8s()
-			success = true
+			return fmt.Errorf("failed to save image, imageName: %s error: %v", imageName, err)
+		}
+		if err = ImportImageToContainerd(imageTar); err != nil {
+			return fmt.Errorf("failed to load image into containerd, imageName: %s error: %v", imageName, err)
 		}
 	}
-	return
+	return nil
 }
 
 func DeleteJob(namespace, jobUuid string, msg string) error {
+	return deleteJobResources(namespace, jobUuid, msg, true)
+}
+
+// deleteJobResources deletes the k8s objects of the job, and the images of its deployment from this host when removeImages is set
+func deleteJobResources(namespace, jobUuid string, msg string, removeImages bool) error {
 	jobUuid = strings.ToLower(jobUuid)
 	deployName := constants.K8S_DEPLOY_NAME_PREFIX + jobUuid
 	serviceName := constants.K8S_SERVICE_NAME_PREFIX + jobUuid
 	ingressName := constants.K8S_INGRESS_NAME_PREFIX + jobUuid
 
-	k8sService := NewK8sService()
+	k8sService := NewK8sServiceForJob(jobUuid)
 
 	if namespace != "" {
-		if err := k8sService.DeleteIngress(context.TODO(), namespace, ingressName); err != nil && !errors.IsNotFound(err) {
+		if err := DeleteJobIngress(context.TODO(), namespace, jobUuid); err != nil && !errors.IsNotFound(err) {
 			logs.GetLogger().Errorf("Failed delete ingress, ingressName: %s, error: %+v", ingressName, err)
 			return err
 		}
@@ -1044,15 +1282,17 @@ func DeleteJob(namespace, jobUuid string, msg string) error {
 		}
 		logs.GetLogger().Infof(" deleted service, job_uuid: %s, serviceName: %s", jobUuid, serviceName)
 
-		dockerService := NewDockerService()
-		deployImageIds, err := k8sService.GetDeploymentImages(context.TODO(), namespace, deployName)
-		if err != nil && !errors.IsNotFound(err) {
-			logs.GetLogger().Errorf("Failed get deploy imageIds, deployName: %s, error: %+v", deployName, err)
-			return err
-		}
-		for _, imageId := range deployImageIds {
-			dockerService.RemoveImage(imageId)
-			logs.GetLogger().Infof(" deleted images, job_uuid: %s, image: %s", jobUuid, imageId)
+		if removeImages {
+			dockerService := NewDockerService()
+			deployImageIds, err := k8sService.GetDeploymentImages(context.TODO(), namespace, deployName)
+			if err != nil && !errors.IsNotFound(err) {
+				logs.GetLogger().Errorf("Failed get deploy imageIds, deployName: %s, error: %+v", deployName, err)
+				return err
+			}
+			for _, imageId := range deployImageIds {
+				dockerService.RemoveImage(imageId)
+				logs.GetLogger().Infof(" deleted images, job_uuid: %s, image: %s", jobUuid, imageId)
+			}
 		}
 
 		if err := k8sService.DeleteDeployment(context.TODO(), namespace, deployName); err != nil && !errors.IsNotFound(err) {
@@ -1060,6 +1300,16 @@ func DeleteJob(namespace, jobUuid string, msg string) error {
 			return err
 		}
 		logs.GetLogger().Infof(" deleted deployment, job_uuid: %s, deployName: %s", jobUuid, deployName)
+
+		if err := k8sService.DeleteBatchJob(context.TODO(), namespace, deployName); err != nil && !errors.IsNotFound(err) {
+			logs.GetLogger().Errorf("Failed delete job, jobName: %s, error: %+v", deployName, err)
+			return err
+		}
+
+		if err := k8sService.DeleteSecrets(context.TODO(), namespace, jobUuid); err != nil && !errors.IsNotFound(err) {
+			logs.GetLogger().Errorf("Failed delete secrets, job_uuid: %s, error: %+v", jobUuid, err)
+			return err
+		}
 		time.Sleep(6 * time.Second)
 
 		if err := k8sService.DeleteDeployRs(context.TODO(), namespace, jobUuid); err != nil && !errors.IsNotFound(err) {
@@ -1073,6 +1323,8 @@ func DeleteJob(namespace, jobUuid string, msg string) error {
 			return err
 		}
 		logs.GetLogger().Infof(" deleted pod, jobUuid: %s", jobUuid)
+
+		releaseJobPvc(namespace, jobUuid)
 	}
 
 	ticker := time.NewTicker(3 * time.Second)
@@ -1104,7 +1356,7 @@ func DeleteJob(namespace, jobUuid string, msg string) error {
 }
 
 func downloadModelUrl(namespace, jobUuid, serviceIp string, podCmd []string) {
-	k8sService := NewK8sService()
+	k8sService := NewK8sServiceForJob(jobUuid)
 	podName, err := k8sService.WaitForPodRunningByHttp(namespace, jobUuid, serviceIp)
 	if err != nil {
 		logs.GetLogger().Error(err)
@@ -1166,31 +1418,70 @@ func getSpaceDetail(jobSourceURI string) (models.SpaceJSON, error) {
 	return spaceJson, nil
 }
 
-func checkResourceAvailableForSpace(configDescription string) (bool, string, error) {
+// checkResourceAvailableForSpace places the replicas of the space in the first cluster which has room for all of them,
+// a cluster which fails to be checked is skipped while another one may still take the job. The public spaces are
+// reached by the hostnames of API.Domain, which resolve to the ingress controller of the default cluster, so only
+// the private spaces of the node ports are placed in the other clusters.
+func checkResourceAvailableForSpace(configDescription string, replicas int, spaceType string) (bool, spacePlacement, error) {
+	k8sServices := K8sServices()
+	if spaceType != constants.SPACE_TYPE_PRIVATE {
+		k8sServices = k8sServices[:1]
+	}
+	var lastErr error
+	for _, k8sService := range k8sServices {
+		if k8sService.k8sClient == nil {
+			lastErr = fmt.Errorf("cluster %q is not connected", k8sService.Cluster)
+			continue
+		}
+		available, placement, err := checkResourceAvailableInCluster(k8sService, configDescription, replicas, spaceType)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to check the resources of cluster %q, error: %v", k8sService.Cluster, err)
+			lastErr = err
+			continue
+		}
+		if available {
+			return true, placement, nil
+		}
+	}
+	return false, spacePlacement{}, lastErr
+}
+
+// checkResourceAvailableInCluster checks whether the replicas of the space fit in the free resources of the schedulable nodes
+// of its pools in the cluster, and chooses their nodes by the strategy of the scheduler. The replicas of a gpu space must run
+// on the same gpu product since it is used as the node selector.
+func checkResourceAvailableInCluster(k8sService *K8sService, configDescription string, replicas int, spaceType string) (bool, spacePlacement, error) {
 	taskType, hardwareDetail := getHardwareDetail(configDescription)
-	k8sService := NewK8sService()
 
 	activePods, err := k8sService.GetAllActivePod(context.TODO())
 	if err != nil {
-		return false, "", err
+		return false, spacePlacement{}, err
 	}
 
 	nodes, err := k8sService.k8sClient.CoreV1().Nodes().List(context.TODO(), metaV1.ListOptions{})
 	if err != nil {
-		return false, "", err
+		return false, spacePlacement{}, err
 	}
 
 	nodeGpuSummary, err := k8sService.GetNodeGpuSummary(context.TODO())
 	if err != nil {
 		logs.GetLogger().Errorf("Failed collect k8s gpu, error: %+v", err)
-		return false, "", err
+		return false, spacePlacement{}, err
 	}
 
+	scheduler := conf.GetConfig().Scheduler
+	pools := scheduler.PoolsOf(spaceType)
+	tolerations := jobTolerations(pools, taskType != "CPU")
+	reserve := currentReserve()
+	var candidates []placementCandidate
 	for _, node := range nodes.Items {
+		if !schedulableNode(&node, tolerations) || (len(pools) > 0 && !nodeInPools(&node, pools)) {
+			continue
+		}
+
 		nodeGpu, remainderResource, _ := GetNodeResource(activePods, &node)
-		remainderCpu := remainderResource[ResourceCpu]
-		remainderMemory := float64(remainderResource[ResourceMem] / 1024 / 1024 / 1024)
-		remainderStorage := float64(remainderResource[ResourceStorage] / 1024 / 1024 / 1024)
+		remainderCpu := remainderResource[ResourceCpu] - reserve.cpu
+		remainderMemory := float64(remainderResource[ResourceMem]/1024/1024/1024) - reserve.memoryGiB
+		remainderStorage := float64(remainderResource[ResourceStorage]/1024/1024/1024) - reserve.storageGiB
 
 		needCpu := hardwareDetail.Cpu.Quantity
 		needMemory := float64(hardwareDetail.Memory.Quantity)
@@ -1198,34 +1489,65 @@ func checkResourceAvailableForSpace(configDescription string) (bool, string, err
 		logs.GetLogger().Infof("checkResourceAvailableForSpace: needCpu: %d, needMemory: %.2f, needStorage: %.2f", needCpu, needMemory, needStorage)
 		logs.GetLogger().Infof("checkResourceAvailableForSpace: remainingCpu: %d, remainingMemory: %.2f, remainingStorage: %.2f", remainderCpu, remainderMemory, remainderStorage)
 		if needCpu <= remainderCpu && needMemory <= remainderMemory && needStorage <= remainderStorage {
+			nodeReplicas := fitCount(float64(remainderCpu), float64(needCpu))
+			nodeReplicas = min(nodeReplicas, fitCount(remainderMemory, needMemory), fitCount(remainderStorage, needStorage))
+			candidate := placementCandidate{
+				node:    node.Name,
+				freeCpu: remainderCpu,
+				hasGpu:  len(nodeGpuSummary[node.Name]) > 0 || len(nodeGpuSlices(&node, activePods)) > 0,
+			}
 			if taskType == "CPU" {
-				return true, "", nil
+				candidate.replicas = nodeReplicas
+			} else if hardwareDetail.GpuSlice != "" {
+				// the scheduler places the slices by their extended resource, so no gpu product is selected
+				candidate.freeGpu = availableGpuSlices(&node, activePods, hardwareDetail.Gpu.Unit, hardwareDetail.GpuSlice)
+				candidate.replicas = min(nodeReplicas, fitCount(float64(candidate.freeGpu), float64(hardwareDetail.Gpu.Quantity)))
 			} else if taskType == "GPU" {
 				var usedCount int64 = 0
 				gpuName := strings.ToUpper(strings.ReplaceAll(hardwareDetail.Gpu.Unit, " ", "-"))
 				logs.GetLogger().Infof("gpuName: %s, nodeGpu: %+v, nodeGpuSummary: %+v", gpuName, nodeGpu, nodeGpuSummary)
-				var gpuProductName = ""
 				for name, count := range nodeGpu {
 					if strings.Contains(strings.ToUpper(name), gpuName) {
 						usedCount = count
-						gpuProductName = strings.ReplaceAll(strings.ToUpper(name), " ", "-")
 						break
 					}
 				}
 
 				for gName, gCount := range nodeGpuSummary[node.Name] {
 					if strings.Contains(strings.ToUpper(gName), gpuName) {
-						gpuProductName = strings.ReplaceAll(strings.ToUpper(gName), " ", "-")
-						if usedCount+hardwareDetail.Gpu.Quantity <= gCount {
-							return true, gpuProductName, nil
+						sellableGpu := gCount - reserve.gpuQuota(gName)
+						if usedCount+hardwareDetail.Gpu.Quantity <= sellableGpu {
+							candidate.gpuProductName = strings.ReplaceAll(strings.ToUpper(gName), " ", "-")
+							candidate.freeGpu = sellableGpu - usedCount
+							candidate.replicas = min(nodeReplicas, fitCount(float64(candidate.freeGpu), float64(hardwareDetail.Gpu.Quantity)))
 						}
+						break
 					}
 				}
-				continue
+			}
+			if candidate.replicas > 0 {
+				candidates = append(candidates, candidate)
 			}
 		}
 	}
-	return false, "", nil
+
+	rankCandidates(scheduler.GetStrategy(), taskType, candidates)
+	placement := placeReplicas(scheduler.GetStrategy(), candidates, replicas)
+	placement.pools = poolNames(pools)
+	placement.cluster = k8sService.Cluster
+	if len(placement.nodes) < replicas {
+		return false, spacePlacement{}, nil
+	}
+	logs.GetLogger().Infof("checkResourceAvailableForSpace: cluster: %s, strategy: %s, pools: %v, nodes: %v", placement.cluster, scheduler.GetStrategy(), placement.pools, placement.nodes)
+	return true, placement, nil
+}
+
+// fitCount is how many times need fits in remainder, a resource which is not needed never limits the count
+func fitCount(remainder, need float64) int64 {
+	if need <= 0 {
+		return math.MaxInt32
+	}
+	return int64(remainder / need)
 }
 
 func checkResourceAvailableForUbi(taskType int, gpuName string, resource *models.TaskResource) (string, string, int64, int64, int64, error) {
@@ -1258,6 +1580,10 @@ func checkResourceAvailableForUbi(taskType int, gpuName string, resource *models
 
 	var nodeName, architecture string
 	for _, node := range nodes.Items {
+		// the pod is bound to the node by its name, which bypasses the cordons and taints checked by the scheduler
+		if !schedulableNode(&node, nil) {
+			continue
+		}
 		if _, ok := node.Labels[constants.CPU_INTEL]; ok {
 			architecture = constants.CPU_INTEL
 		}
@@ -1527,7 +1853,7 @@ func CheckWalletWhiteList(jobSourceURI string) bool {
 	}
 	whiteList, err := getWalletList(walletWhiteListUrl)
 	if err != nil {
-		logs.GetLogger().Errorf("get whiteList By url failed, url: %s, error: %v", err)
+		logs.GetLogger().Errorf("get whiteList By url failed, url: %s, error: %v", walletWhiteListUrl, err)
 		return true
 	}
 
@@ -1553,7 +1879,7 @@ func CheckWalletBlackList(jobSourceURI string) bool {
 	}
 	blackList, err := getWalletList(walletBlackListUrl)
 	if err != nil {
-		logs.GetLogger().Errorf("get blacklist By url failed, url: %s, error: %v", err)
+		logs.GetLogger().Errorf("get blacklist By url failed, url: %s, error: %v", walletBlackListUrl, err)
 		return true
 	}
 
@@ -1633,7 +1959,8 @@ func deleteGpuCache(gpuProductName string) {
 
 }
 
-func checkPrice(userPrice string, duration int, resource models.SpaceHardware) (bool, float64, error) {
+// checkPrice compares the price paid by the user with the cost of all replicas of the space
+func checkPrice(userPrice string, duration int, resource models.SpaceHardware, replicas int) (bool, float64, error) {
 	priceConfig, err := ReadPriceConfig()
 	if err != nil {
 		return false, 0, err
@@ -1677,13 +2004,21 @@ func checkPrice(userPrice string, duration int, resource models.SpaceHardware) (
 		return false, 0, fmt.Errorf("failed to converting GPU price: %v", err)
 	}
 
-	// Calculate total cost
-	cpuCost := float64(resource.Vcpu) * cpuPrice * float64(duration/3600)
-	memoryCost := float64(resource.Memory/1024/1024/1024) * memoryPrice * float64(duration/3600)
-	storageCost := float64(resource.Storage/1024/1024/1024) * storagePrice * float64(duration/3600)
-	gpuCost := float64(1) * gpuPrice * float64(duration/3600)
+	// Calculate total cost, a part of an hour is charged for the part, e.g. the rest of a job which is scaled up
+	hours := float64(duration) / 3600
+	cpuCost := float64(resource.Vcpu) * cpuPrice * hours
+	memoryCost := float64(resource.Memory/1024/1024/1024) * memoryPrice * hours
+	storageCost := float64(resource.Storage/1024/1024/1024) * storagePrice * hours
+	gpuCost := float64(1) * gpuPrice * hours
+	if _, gpuSlice := spaceGpuSlice(resource); gpuSlice != "" {
+		slicePrice, err := gpuSlicePrice(priceConfig, gpuSlice)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to converting GPU slice price: %v", err)
+		}
+		gpuCost = float64(max(resource.Gpu, 1)) * slicePrice * hours
+	}
 
-	totalCost := cpuCost + memoryCost + storageCost + gpuCost
+	totalCost := (cpuCost + memoryCost + storageCost + gpuCost) * float64(max(replicas, 1))
 
 	// Compare user's price with total cost
 	return userPayPrice >= totalCost, totalCost, nil
@@ -0,0 +1,42 @@
+package computing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/swanchain/go-computing-provider/internal/models"
+)
+
+func TestCheckPrice(t *testing.T) {
+	initTestLogger(t)
+	// no price.conf under CP_PATH, the default prices are used
+	t.Setenv("CP_PATH", t.TempDir())
+	hardware := models.SpaceHardware{Vcpu: 2, Memory: 4 << 30, Storage: 10 << 30}
+	const hourly = 2*0.25 + 4*0.139 + 10*0.035 + 17.5
+
+	tests := []struct {
+		name     string
+		duration int
+		replicas int
+		bid      string
+		want     float64
+		enough   bool
+	}{
+		{"half an hour left", 1800, 1, "0", hourly / 2, false},
+		{"part of the second hour", 7140, 1, "0", hourly * 7140 / 3600, false},
+		{"every added replica", 1800, 3, "0", hourly * 3 / 2, false},
+		{"bid covers the price", 3600, 2, "40", hourly * 2, true},
+		{"bid below the price", 3600, 2, "37", hourly * 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enough, required, err := checkPrice(tt.bid, tt.duration, hardware, tt.replicas)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(required-tt.want) > 1e-9 || enough != tt.enough {
+				t.Errorf("checkPrice() = %v, %v, want %v, %v", enough, required, tt.enough, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	pvcReleasedAnnotation = "swanchain.io/released-at"
+	defaultPvcMountPath   = "/data"
+
+	// pvcOrphanGracePeriod is how long a pvc of no job row is kept before it is released, its job may still be saving
+	pvcOrphanGracePeriod = time.Hour
+)
+
+// createPersistentVolume creates the pvc of the job, or reuses it if the job is redeployed,
+// and returns the volume to mount into the main container. It returns nil when EnablePvc is off.
+func (d *Deploy) createPersistentVolume() ([]coreV1.VolumeMount, []coreV1.Volume, error) {
+	storageConf := conf.GetConfig().Storage
+	if !storageConf.EnablePvc || d.hardwareResource.Storage.Quantity <= 0 {
+		return nil, nil, nil
+	}
+
+	size, err := resource.ParseQuantity(fmt.Sprintf("%d%s", d.hardwareResource.Storage.Quantity, d.hardwareResource.Storage.Unit))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse storage size, job_uuid: %s, error: %v", d.jobUuid, err)
+	}
+
+	k8sService := d.k8sService()
+	pvcName := constants.K8S_PVC_NAME_PREFIX + d.jobUuid
+	pvc, err := k8sService.GetPvc(context.TODO(), d.k8sNameSpace, pvcName)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("failed to get pvc, job_uuid: %s, error: %v", d.jobUuid, err)
+		}
+		if _, err = k8sService.CreatePvc(context.TODO(), d.k8sNameSpace, d.jobUuid, storageConf.StorageClass, size); err != nil {
+			return nil, nil, fmt.Errorf("failed to create pvc, job_uuid: %s, error: %v", d.jobUuid, err)
+		}
+		logs.GetLogger().Infof("created pvc, job_uuid: %s, pvc: %s, size: %s", d.jobUuid, pvcName, size.String())
+	} else if _, ok := pvc.Annotations[pvcReleasedAnnotation]; ok {
+		delete(pvc.Annotations, pvcReleasedAnnotation)
+		if _, err = k8sService.UpdatePvc(context.TODO(), pvc); err != nil {
+			return nil, nil, fmt.Errorf("failed to reuse pvc, job_uuid: %s, error: %v", d.jobUuid, err)
+		}
+		logs.GetLogger().Infof("reuse retained pvc, job_uuid: %s, pvc: %s", d.jobUuid, pvcName)
+	}
+
+	mountPath := storageConf.MountPath
+	if mountPath == "" {
+		mountPath = defaultPvcMountPath
+	}
+	return []coreV1.VolumeMount{
+		{
+			Name:      pvcName,
+			MountPath: mountPath,
+		},
+	}, []coreV1.Volume{
+		{
+			Name: pvcName,
+			VolumeSource: coreV1.VolumeSource{
+				PersistentVolumeClaim: &coreV1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvcName,
+				},
+			},
+		},
+	}, nil
+}
+
+// releaseJobPvc is called when the job is deleted, the pvc is kept for RetentionHours before it is deleted
+func releaseJobPvc(namespace, jobUuid string) {
+	k8sService := NewK8sServiceForJob(jobUuid)
+	pvcName := constants.K8S_PVC_NAME_PREFIX + jobUuid
+	pvc, err := k8sService.GetPvc(context.TODO(), namespace, pvcName)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			logs.GetLogger().Errorf("failed to get pvc, job_uuid: %s, error: %v", jobUuid, err)
+		}
+		return
+	}
+
+	if conf.GetConfig().Storage.RetentionHours <= 0 {
+		if err = k8sService.DeletePvc(context.TODO(), namespace, pvcName); err != nil && !errors.IsNotFound(err) {
+			logs.GetLogger().Errorf("failed to delete pvc, job_uuid: %s, error: %v", jobUuid, err)
+			return
+		}
+		logs.GetLogger().Infof("deleted pvc, job_uuid: %s, pvc: %s", jobUuid, pvcName)
+		return
+	}
+	markPvcReleased(k8sService, pvc)
+}
+
+func markPvcReleased(k8sService *K8sService, pvc *coreV1.PersistentVolumeClaim) {
+	if pvc.Annotations == nil {
+		pvc.Annotations = make(map[string]string)
+	}
+	pvc.Annotations[pvcReleasedAnnotation] = strconv.FormatInt(time.Now().Unix(), 10)
+	if _, err := k8sService.UpdatePvc(context.TODO(), pvc); err != nil {
+		logs.GetLogger().Errorf("failed to mark pvc released, pvc: %s, error: %v", pvc.Name, err)
+		return
+	}
+	logs.GetLogger().Infof("pvc %s released, it will be retained for %d hours", pvc.Name, conf.GetConfig().Storage.RetentionHours)
+}
+
+// cleanReleasedPvc deletes the pvc whose retention is over, and releases the pvc whose job no longer exists.
+// It returns true if there is a pvc still retained in the namespace, so the namespace must be kept.
+func cleanReleasedPvc(k8sService *K8sService, namespace string) bool {
+	pvcList, err := k8sService.ListPvc(context.TODO(), namespace)
+	if err != nil {
+		logs.GetLogger().Errorf("failed to list pvc, namespace: %s, error: %v", namespace, err)
+		return true
+	}
+
+	retention := time.Duration(conf.GetConfig().Storage.RetentionHours) * time.Hour
+	var retained bool
+	for i := range pvcList {
+		pvc := pvcList[i]
+		if !strings.HasPrefix(pvc.Name, constants.K8S_PVC_NAME_PREFIX) {
+			continue
+		}
+
+		releasedAt, ok := pvc.Annotations[pvcReleasedAnnotation]
+		if !ok {
+			jobUuid := strings.TrimPrefix(pvc.Name, constants.K8S_PVC_NAME_PREFIX)
+			if pvcOfEndedJob(&pvc, jobUuid) {
+				_, err = k8sService.k8sClient.AppsV1().Deployments(namespace).Get(context.TODO(), constants.K8S_DEPLOY_NAME_PREFIX+jobUuid, metaV1.GetOptions{})
+				if errors.IsNotFound(err) {
+					if hasPods, err := k8sService.GetPods(namespace, jobUuid); err == nil && !hasPods {
+						markPvcReleased(k8sService, &pvc)
+					}
+				}
+			}
+			retained = true
+			continue
+		}
+
+		releasedTime, err := strconv.ParseInt(releasedAt, 10, 64)
+		if err == nil && time.Since(time.Unix(releasedTime, 0)) < retention {
+			retained = true
+			continue
+		}
+		if err = k8sService.DeletePvc(context.TODO(), namespace, pvc.Name); err != nil && !errors.IsNotFound(err) {
+			logs.GetLogger().Errorf("failed to delete pvc, namespace: %s, pvc: %s, error: %v", namespace, pvc.Name, err)
+			retained = true
+			continue
+		}
+		logs.GetLogger().Infof("retention is over, deleted pvc, namespace: %s, pvc: %s", namespace, pvc.Name)
+	}
+	return retained
+}
+
+// pvcOfEndedJob reports whether the job of the pvc was deleted, or has no row after the grace period. A pvc is created
+// before the deployment of its job, so a missing deployment alone does not mean the job is gone.
+func pvcOfEndedJob(pvc *coreV1.PersistentVolumeClaim, jobUuid string) bool {
+	var job models.JobEntity
+	if err := NewJobService().Model(&models.JobEntity{}).Where("lower(job_uuid)=?", jobUuid).Order("id desc").Limit(1).Find(&job).Error; err != nil {
+		logs.GetLogger().Errorf("failed to get the job of pvc %s, error: %v", pvc.Name, err)
+		return false
+	}
+	if job.JobUuid != "" {
+		return job.DeleteAt == models.DELETED_FLAG
+	}
+	return time.Since(pvc.CreationTimestamp.Time) > pvcOrphanGracePeriod
+}
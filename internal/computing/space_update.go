@@ -0,0 +1,365 @@
+package computing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/swanchain/go-computing-provider/conf"
+	"github.com/swanchain/go-computing-provider/constants"
+	"github.com/swanchain/go-computing-provider/internal/contract"
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/internal/yaml"
+	"github.com/swanchain/go-computing-provider/util"
+	appV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// rolloutDeadlineSeconds is how long the new pods have to become ready before the update is rolled back
+	rolloutDeadlineSeconds = 300
+	updatedAtAnnotation    = "swanchain.io/updated-at"
+)
+
+// updatingJobs holds the jobs being updated, a job accepts one update at a time
+var updatingJobs sync.Map
+
+// UpdateJob replaces the image of a running space job by a rolling update of its deployment, the service, the ingress
+// and the hostname of the job are kept. Without an image the space files are downloaded and built again.
+func UpdateJob(c *gin.Context) {
+	var jobData struct {
+		TaskUuid  string `json:"task_uuid"`
+		Image     string `json:"image"`
+		Signature string `json:"signature"`
+		models.SignedEnvelope
+	}
+
+	if err := c.ShouldBindJSON(&jobData); err != nil {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
+		return
+	}
+	logs.GetLogger().Infof("update Job received: %+v", jobData)
+
+	if strings.TrimSpace(jobData.TaskUuid) == "" {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "missing required field: task_uuid"))
+		return
+	}
+
+	if conf.GetConfig().HUB.VerifySign {
+		if len(jobData.Signature) == 0 {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.BadParamError, "missing signature field"))
+			return
+		}
+		cpRepoPath, _ := os.LookupEnv("CP_PATH")
+		nodeID := GetNodeId(cpRepoPath)
+
+		cpAccountAddress, err := contract.GetCpAccountAddress()
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get cp account contract address, error: %v", err)
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.GetCpAccountError))
+			return
+		}
+
+		signMsg := signedMessage(fmt.Sprintf("%s%s%s%s", cpAccountAddress, nodeID, jobData.TaskUuid, jobData.Image), jobData.SignedEnvelope)
+		signature, err := verifySignatureForHub(conf.GetConfig().HUB.OrchestratorPk, signMsg, jobData.Signature)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to verify signature for update job, error: %+v", err)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "verify sign data occur error"))
+			return
+		}
+
+		if !signature {
+			logs.GetLogger().Errorf("update job sign verifing, task_uuid: %s, verify: %v", jobData.TaskUuid, signature)
+			c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "signature verify failed"))
+			return
+		}
+
+		if !allowSigner(c, conf.GetConfig().HUB.OrchestratorPk) {
+			return
+		}
+
+		if err = checkSignedEnvelope(NonceSourceHub, jobData.SignedEnvelope); err != nil {
+			logs.GetLogger().Warnf("reject update job, task_uuid: %s, error: %v", jobData.TaskUuid, err)
+			c.JSON(envelopeErrorResponse(err))
+			return
+		}
+	}
+
+	jobEntity, err := NewJobService().GetJobEntityByTaskUuid(jobData.TaskUuid)
+	if err != nil {
+		logs.GetLogger().Errorf("failed get job from db, taskUuid: %s, error: %+v", jobData.TaskUuid, err)
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.FoundJobEntityError))
+		return
+	}
+	if jobEntity.JobUuid == "" {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.NotFoundJobEntityError))
+		return
+	}
+	if jobEntity.ExpireTime < time.Now().Unix() {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "The job was terminated due to its expiration date"))
+		return
+	}
+	if jobEntity.K8sResourceType != "" && jobEntity.K8sResourceType != "deployment" {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "only the job running as a deployment can be updated"))
+		return
+	}
+
+	deployName := constants.K8S_DEPLOY_NAME_PREFIX + strings.ToLower(jobEntity.JobUuid)
+	if _, err = NewK8sServiceFor(jobEntity.Cluster).GetDeployment(context.TODO(), jobEntity.NameSpace, deployName); err != nil {
+		logs.GetLogger().Errorf("failed to get deployment, job_uuid: %s, error: %v", jobEntity.JobUuid, err)
+		if errors.IsNotFound(err) {
+			c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "the deployment of the job is not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.ServerError))
+		return
+	}
+
+	if _, loaded := updatingJobs.LoadOrStore(jobEntity.JobUuid, struct{}{}); loaded {
+		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JobNotUpdatableError, "the job is being updated"))
+		return
+	}
+
+	RecordAudit(AuditActorApi(c), "job update", map[string]interface{}{"task_uuid": jobData.TaskUuid, "job_uuid": jobEntity.JobUuid,
+		"image": jobData.Image}, "", nil)
+	go func() {
+		defer updatingJobs.Delete(jobEntity.JobUuid)
+		defer func() {
+			if err := recover(); err != nil {
+				logs.GetLogger().Errorf("update space job painc, job_uuid: %s, error: %+v", jobEntity.JobUuid, err)
+			}
+		}()
+
+		if err := updateSpaceJob(jobEntity, jobData.Image); err != nil {
+			logs.GetLogger().Errorf("failed to update job, job_uuid: %s, error: %v", jobEntity.JobUuid, err)
+			if err = NewJobService().UpdateJobError(jobEntity.JobUuid, err.Error()); err != nil {
+				logs.GetLogger().Errorf("failed to save job error, job_uuid: %s, error: %v", jobEntity.JobUuid, err)
+			}
+			return
+		}
+		logs.GetLogger().Infof("space job updated, job_uuid: %s", jobEntity.JobUuid)
+	}()
+
+	c.JSON(http.StatusOK, util.CreateSuccessResponse("success"))
+}
+
+func updateSpaceJob(jobEntity models.JobEntity, image string) error {
+	jobUuid := strings.ToLower(jobEntity.JobUuid)
+
+	// the images to set by container name, the empty name stands for the main container
+	images := make(map[string]string)
+	if image != "" {
+		pinned, err := CheckImagePolicy(context.TODO(), image)
+		if err != nil {
+			return err
+		}
+		images[""] = pinned
+	} else {
+		spaceDetail, err := getSpaceDetail(jobEntity.SourceUrl)
+		if err != nil {
+			return err
+		}
+		deployParam, err := DownloadSpaceResources(jobEntity.JobUuid, spaceDetail.Data.Files)
+		if err != nil {
+			return fmt.Errorf("failed to download space resource, error: %v", err)
+		}
+
+		switch {
+		case deployParam.ModelsSettingFilePath != "":
+			return fmt.Errorf("the model space can not be updated, please set the image")
+		case deployParam.ContainsYaml:
+			containerResources, err := yaml.HandlerYaml(deployParam.YamlFilePath)
+			if err != nil {
+				return err
+			}
+			if err = applyImagePolicy(containerResources); err != nil {
+				return err
+			}
+			for _, cr := range containerResources {
+				images[jobUuid+"-"+cr.Name] = cr.ImageName
+				for _, depend := range cr.Depends {
+					images[jobUuid+"-"+depend.Name] = depend.ImageName
+				}
+			}
+		default:
+			imageName, _ := BuildImagesByDockerfile(jobEntity.JobUuid, spaceDetail.Data.Space.Name, deployParam.BuildImagePath)
+			if imageName == "" {
+				return fmt.Errorf("failed to build the image of the space")
+			}
+			if err = importImageToCluster(imageName); err != nil {
+				return err
+			}
+			images[""] = imageName
+		}
+	}
+
+	updateJobStatus(jobEntity.JobUuid, models.DEPLOY_PULL_IMAGE)
+	jobImages, err := rollingUpdateDeployment(NewK8sServiceFor(jobEntity.Cluster), jobEntity.NameSpace, constants.K8S_DEPLOY_NAME_PREFIX+jobUuid, images)
+	if err != nil {
+		return err
+	}
+	updateJobStatus(jobEntity.JobUuid, models.DEPLOY_TO_K8S, jobEntity.RealUrl)
+
+	if err = NewJobService().UpdateJobEntityByJobUuid(&models.JobEntity{JobUuid: jobEntity.JobUuid, ImageName: jobImages}); err != nil {
+		logs.GetLogger().Errorf("failed to update job info, job_uuid: %s, error: %v", jobEntity.JobUuid, err)
+	}
+	RecordAudit(AuditActorSystem, "job update finished", map[string]interface{}{"job_uuid": jobEntity.JobUuid, "image": jobImages}, "", nil)
+	return nil
+}
+
+// rollingUpdateDeployment sets the images of the containers and waits for the new pods, the previous pod template is
+// restored when they are not ready in time. It returns the images of the pod as they are recorded for the job.
+func rollingUpdateDeployment(k8sService *K8sService, namespace, deployName string, images map[string]string) (string, error) {
+	deployment, err := k8sService.GetDeployment(context.TODO(), namespace, deployName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get deployment %s, error: %v", deployName, err)
+	}
+	previousTemplate := deployment.Spec.Template.DeepCopy()
+
+	containers := deployment.Spec.Template.Spec.Containers
+	for i := range containers {
+		if image, ok := images[containers[i].Name]; ok && image != "" {
+			containers[i].Image = image
+		}
+	}
+	if image, ok := images[""]; ok {
+		containers[len(containers)-1].Image = image
+	}
+
+	// the annotation restarts the pods even though the tag of the image is not changed
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = make(map[string]string)
+	}
+	deployment.Spec.Template.Annotations[updatedAtAnnotation] = time.Now().Format(time.RFC3339)
+
+	// the new pod is started before the old one is stopped, except when the gpus or the host ports of the old pod are
+	// needed by the new one. A volume attached to one node only has to be released by all the old pods first.
+	maxSurge, maxUnavailable := intstr.FromInt(1), intstr.FromInt(0)
+	if requestsGpu(deployment.Spec.Template.Spec) || usesHostPort(deployment.Spec.Template.Spec) {
+		maxSurge, maxUnavailable = intstr.FromInt(0), intstr.FromInt(1)
+	}
+	deployment.Spec.Strategy = appV1.DeploymentStrategy{
+		Type: appV1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appV1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+	if mountsReadWriteOnce(k8sService, namespace, deployment.Spec.Template.Spec) {
+		deployment.Spec.Strategy = appV1.DeploymentStrategy{Type: appV1.RecreateDeploymentStrategyType}
+	}
+	progressDeadline := int32(rolloutDeadlineSeconds)
+	deployment.Spec.ProgressDeadlineSeconds = &progressDeadline
+
+	updated, err := k8sService.UpdateDeployment(context.TODO(), namespace, deployment)
+	if err != nil {
+		return "", fmt.Errorf("failed to update deployment %s, error: %v", deployName, err)
+	}
+
+	rolloutErr := waitForRollout(k8sService, namespace, deployName, updated.Generation)
+	if rolloutErr == nil {
+		return podImages(strings.TrimPrefix(deployName, constants.K8S_DEPLOY_NAME_PREFIX), deployment.Spec.Template.Spec), nil
+	}
+
+	logs.GetLogger().Warnf("rollout of deployment %s failed, rolling back, error: %v", deployName, rolloutErr)
+	latest, err := k8sService.GetDeployment(context.TODO(), namespace, deployName)
+	if err != nil {
+		return "", fmt.Errorf("%v, failed to get deployment for rollback, error: %v", rolloutErr, err)
+	}
+	latest.Spec.Template = *previousTemplate
+	if latest, err = k8sService.UpdateDeployment(context.TODO(), namespace, latest); err != nil {
+		return "", fmt.Errorf("%v, failed to roll back deployment, error: %v", rolloutErr, err)
+	}
+	if err = waitForRollout(k8sService, namespace, deployName, latest.Generation); err != nil {
+		logs.GetLogger().Errorf("rollback of deployment %s is not ready, error: %v", deployName, err)
+	}
+	return "", fmt.Errorf("the new version is not ready and was rolled back, %v", rolloutErr)
+}
+
+// waitForRollout waits until every replica of the deployment runs the generation and is available
+func waitForRollout(k8sService *K8sService, namespace, deployName string, generation int64) error {
+	timeout := time.After((rolloutDeadlineSeconds + 60) * time.Second)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for the new pods of deployment %s", deployName)
+		case <-ticker.C:
+		}
+
+		deployment, err := k8sService.GetDeployment(context.TODO(), namespace, deployName)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get deployment %s, error: %v", deployName, err)
+			continue
+		}
+		if deployment.Status.ObservedGeneration < generation {
+			continue
+		}
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == appV1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+				return fmt.Errorf("deployment %s exceeded its progress deadline: %s", deployName, condition.Message)
+			}
+		}
+
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		status := deployment.Status
+		if status.UpdatedReplicas == replicas && status.Replicas == replicas && status.AvailableReplicas == replicas {
+			return nil
+		}
+	}
+}
+
+func requestsGpu(podSpec coreV1.PodSpec) bool {
+	for _, c := range podSpec.Containers {
+		for name, quantity := range c.Resources.Limits {
+			if (name == "nvidia.com/gpu" || gpuSliceProfile(name) != "") && !quantity.IsZero() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func usesHostPort(podSpec coreV1.PodSpec) bool {
+	for _, c := range podSpec.Containers {
+		for _, port := range c.Ports {
+			if port.HostPort > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mountsReadWriteOnce reports whether the pod mounts a pvc which can only be attached to one node, or one pod,
+// a pvc which fails to be read is taken as one
+func mountsReadWriteOnce(k8sService *K8sService, namespace string, podSpec coreV1.PodSpec) bool {
+	for _, volume := range podSpec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc, err := k8sService.GetPvc(context.TODO(), namespace, volume.PersistentVolumeClaim.ClaimName)
+		if err != nil {
+			logs.GetLogger().Errorf("failed to get pvc %s, error: %v", volume.PersistentVolumeClaim.ClaimName, err)
+			return true
+		}
+		for _, mode := range pvc.Spec.AccessModes {
+			if mode == coreV1.ReadWriteOnce || mode == coreV1.ReadWriteOncePod {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,373 @@
+package computing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/swanchain/go-computing-provider/internal/models"
+	"github.com/swanchain/go-computing-provider/internal/yaml"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	DeployTypeModel      = "model"
+	DeployTypeYaml       = "yaml"
+	DeployTypeDockerfile = "dockerfile"
+
+	resourcePolicyFile = "resource_policy.json"
+)
+
+type ValidateProblem struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+type ValidateResult struct {
+	Valid      bool              `json:"valid"`
+	DeployType string            `json:"deploy_type"`
+	Problems   []ValidateProblem `json:"problems,omitempty"`
+}
+
+type spaceValidator struct {
+	result ValidateResult
+}
+
+func (v *spaceValidator) add(file, format string, a ...interface{}) {
+	v.result.Problems = append(v.result.Problems, ValidateProblem{
+		File:    file,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// requestedResource is what the space asks from one node of the cluster
+type requestedResource struct {
+	cpu      resource.Quantity
+	memory   resource.Quantity
+	storage  resource.Quantity
+	gpu      int64
+	gpuModel string
+}
+
+// LocalDeployParam finds the deploy files of a space checked out in path, in the same way as DownloadSpaceResources
+func LocalDeployParam(path string) (DeployParam, error) {
+	var deployParam DeployParam
+	info, err := os.Stat(path)
+	if err != nil {
+		return deployParam, err
+	}
+	if !info.IsDir() {
+		path = filepath.Dir(path)
+	}
+	deployParam.BuildImagePath = path
+
+	for _, name := range append([]string{yamlDeployName, ymlDeployName}, yaml.ComposeFileNames()...) {
+		if _, err = os.Stat(filepath.Join(path, name)); err == nil {
+			deployParam.ContainsYaml = true
+			deployParam.YamlFilePath = filepath.Join(path, name)
+			break
+		}
+	}
+	if _, err = os.Stat(filepath.Join(path, modelSetName)); err == nil {
+		deployParam.ModelsSettingFilePath = filepath.Join(path, modelSetName)
+	}
+	return deployParam, nil
+}
+
+// ValidateSpace checks the space files before the job is accepted and returns all problems at once.
+// hardware is the hardware of the space order, it can be nil when the files are validated locally.
+func ValidateSpace(deployParam DeployParam, hardware *models.Resource) ValidateResult {
+	v := new(spaceValidator)
+
+	var request *requestedResource
+	switch {
+	case deployParam.ModelsSettingFilePath != "":
+		v.result.DeployType = DeployTypeModel
+		v.validateModelSetting(deployParam.ModelsSettingFilePath)
+	case deployParam.ContainsYaml:
+		v.result.DeployType = DeployTypeYaml
+		request = v.validateYaml(deployParam.YamlFilePath)
+	default:
+		v.result.DeployType = DeployTypeDockerfile
+		v.validateDockerfile(deployParam.BuildImagePath)
+	}
+
+	if hardware != nil {
+		hardwareRequest, err := hardwareToRequest(*hardware)
+		if err != nil {
+			v.add("", "invalid hardware of the space: %v", err)
+		} else {
+			request = hardwareRequest
+		}
+	}
+	if request != nil {
+		v.validateResources(*request)
+	}
+
+	v.result.Valid = len(v.result.Problems) == 0
+	return v.result
+}
+
+func (v *spaceValidator) validateModelSetting(modelSettingFile string) {
+	file := filepath.Base(modelSettingFile)
+	data, err := os.ReadFile(modelSettingFile)
+	if err != nil {
+		v.add(file, "failed to read file: %v", err)
+		return
+	}
+	var modelSetting struct {
+		ModelId string `json:"model_id"`
+	}
+	if err = json.Unmarshal(data, &modelSetting); err != nil {
+		v.add(file, "invalid json: %v", err)
+		return
+	}
+	if strings.TrimSpace(modelSetting.ModelId) == "" {
+		v.add(file, "model_id is required")
+	}
+}
+
+func (v *spaceValidator) validateYaml(yamlPath string) *requestedResource {
+	file := filepath.Base(yamlPath)
+	containerResources, err := yaml.HandlerYaml(yamlPath)
+	if err != nil {
+		if validationErr, ok := yaml.AsValidationError(err); ok {
+			for _, e := range validationErr.Errors {
+				v.add(file, "%s", e)
+			}
+		} else {
+			v.add(file, "%v", err)
+		}
+		return nil
+	}
+
+	if len(containerResources) == 1 && containerResources[0].ServiceType == yaml.ServiceTypeNodePort {
+		v.checkPortConflicts(file, containerResources[0])
+		return yamlRequest(containerResources[0])
+	}
+
+	// YamlToK8s creates one deployment for the job, the other services run beside it by depends-on
+	if len(containerResources) > 1 {
+		var names []string
+		for _, cr := range containerResources {
+			names = append(names, cr.Name)
+		}
+		v.add(file, "only one service can be deployed, found %s, list the others in depends-on of the main service", strings.Join(names, ", "))
+	}
+
+	var request *requestedResource
+	for _, cr := range containerResources {
+		if len(cr.Ports) == 0 {
+			v.add(file, "services.%s: the main service must expose at least one port", cr.Name)
+		}
+		v.checkPortConflicts(file, cr)
+
+		for _, c := range append([]yaml.ContainerResource{cr}, cr.Depends...) {
+			if c.VolumeMounts.Name == "" {
+				continue
+			}
+			if _, err = os.Stat(filepath.Join(filepath.Dir(yamlPath), c.VolumeMounts.Name)); err != nil {
+				v.add(file, "services.%s.config: config file %s is not found in the space", c.Name, c.VolumeMounts.Name)
+			}
+		}
+		request = yamlRequest(cr)
+	}
+	return request
+}
+
+// checkPortConflicts reports the ports which are exposed twice, the containers of a service share one pod
+func (v *spaceValidator) checkPortConflicts(file string, cr yaml.ContainerResource) {
+	exposed := make(map[string]string)
+	for _, c := range append([]yaml.ContainerResource{cr}, cr.Depends...) {
+		for _, port := range c.Ports {
+			key := fmt.Sprintf("%d/%s", port.ContainerPort, strings.ToLower(string(port.Protocol)))
+			if owner, ok := exposed[key]; ok {
+				v.add(file, "services.%s: port %s is already exposed by service %s", c.Name, key, owner)
+				continue
+			}
+			exposed[key] = c.Name
+		}
+	}
+}
+
+func (v *spaceValidator) validateDockerfile(buildPath string) {
+	dockerfilePath := filepath.Join(buildPath, "Dockerfile")
+	if _, err := os.Stat(dockerfilePath); err != nil {
+		dockerfilePath = filepath.Join(buildPath, "dockerfile")
+		if _, err = os.Stat(dockerfilePath); err != nil {
+			v.add("Dockerfile", "no deploy.yaml, docker-compose.yml, model-setting.json or Dockerfile is found in the space")
+			return
+		}
+	}
+	file := filepath.Base(dockerfilePath)
+
+	f, err := os.Open(dockerfilePath)
+	if err != nil {
+		v.add(file, "failed to open file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	var hasFrom bool
+	exposed := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FROM":
+			hasFrom = true
+		case "EXPOSE":
+			if len(fields) == 1 {
+				v.add(file, "line %d: EXPOSE requires a port", lineNum)
+			}
+			for _, expose := range fields[1:] {
+				port, protocol, _ := strings.Cut(expose, "/")
+				if protocol != "" && !strings.EqualFold(protocol, "tcp") && !strings.EqualFold(protocol, "udp") {
+					v.add(file, "line %d: unsupported protocol %s, only tcp and udp are supported", lineNum, protocol)
+				}
+				portNum, err := strconv.Atoi(port)
+				if err != nil || portNum <= 0 || portNum > 65535 {
+					v.add(file, "line %d: invalid port %s", lineNum, port)
+					continue
+				}
+				if protocol == "" {
+					protocol = "tcp"
+				}
+				key := fmt.Sprintf("%d/%s", portNum, strings.ToLower(protocol))
+				if first, ok := exposed[key]; ok {
+					v.add(file, "line %d: port %s is already exposed at line %d", lineNum, key, first)
+					continue
+				}
+				exposed[key] = lineNum
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		v.add(file, "failed to read file: %v", err)
+		return
+	}
+	if !hasFrom {
+		v.add(file, "FROM instruction is required")
+	}
+	if _, err = ExtractExposedPort(dockerfilePath); err != nil {
+		v.add(file, "%v", err)
+	}
+}
+
+// validateResources checks that at least one node can run the space after keeping the resources reserved by resource_policy.json.
+// The check is skipped when there is no kubernetes cluster, e.g. the command runs on a machine outside the cluster.
+func (v *spaceValidator) validateResources(request requestedResource) {
+	policy, err := loadResourcePolicy()
+	if err != nil {
+		v.add(resourcePolicyFile, "invalid json: %v", err)
+		return
+	}
+
+	if NewK8sService().Version == "" {
+		return
+	}
+	nodes, err := StatisticalSourcesOfClusters(context.TODO())
+	if err != nil {
+		v.add("", "failed to get the resources of the cluster: %v", err)
+		return
+	}
+
+	reservedMemory := quotaBytes(policy.Memory)
+	reservedStorage := quotaBytes(policy.Storage)
+	for _, node := range nodes {
+		if request.cpu.Value() > node.Cpu.RemainderNum-policy.Cpu.Quota {
+			continue
+		}
+		if request.memory.Value() > node.Memory.RemainderNum-reservedMemory {
+			continue
+		}
+		if request.storage.Value() > node.Storage.RemainderNum-reservedStorage {
+			continue
+		}
+		if request.gpu > 0 && availableGpu(node, request.gpuModel, policy.Gpu) < request.gpu {
+			continue
+		}
+		return
+	}
+
+	v.add(resourcePolicyFile, "no node can provide cpu: %s, memory: %s, storage: %s, gpu: %d %s after reserving the resources of %s",
+		request.cpu.String(), request.memory.String(), request.storage.String(), request.gpu, request.gpuModel, resourcePolicyFile)
+}
+
+func yamlRequest(cr yaml.ContainerResource) *requestedResource {
+	request := new(requestedResource)
+	for _, c := range append([]yaml.ContainerResource{cr}, cr.Depends...) {
+		if c.Resources == nil {
+			continue
+		}
+		for _, name := range []coreV1.ResourceName{coreV1.ResourceCPU, coreV1.ResourceMemory} {
+			quantity, ok := c.Resources.Limits[name]
+			if !ok {
+				quantity, ok = c.Resources.Requests[name]
+			}
+			if !ok {
+				continue
+			}
+			if name == coreV1.ResourceCPU {
+				request.cpu.Add(quantity)
+			} else {
+				request.memory.Add(quantity)
+			}
+		}
+		if quantity, ok := c.Resources.Limits["nvidia.com/gpu"]; ok {
+			request.gpu += quantity.Value()
+		}
+	}
+	return request
+}
+
+func hardwareToRequest(hardware models.Resource) (*requestedResource, error) {
+	memory, err := resource.ParseQuantity(fmt.Sprintf("%d%s", hardware.Memory.Quantity, hardware.Memory.Unit))
+	if err != nil {
+		return nil, fmt.Errorf("memory: %v", err)
+	}
+	storage, err := resource.ParseQuantity(fmt.Sprintf("%d%s", hardware.Storage.Quantity, hardware.Storage.Unit))
+	if err != nil {
+		return nil, fmt.Errorf("storage: %v", err)
+	}
+	return &requestedResource{
+		cpu:      *resource.NewQuantity(hardware.Cpu.Quantity, resource.DecimalSI),
+		memory:   memory,
+		storage:  storage,
+		gpu:      hardware.Gpu.Quantity,
+		gpuModel: hardware.Gpu.Unit,
+	}, nil
+}
+
+func availableGpu(node *models.NodeResource, gpuModel string, reserved []models.GpuQuota) int64 {
+	var available int64
+	for _, gpu := range node.Gpu.Details {
+		if gpu.Status == models.Available && (gpuModel == "" || strings.EqualFold(gpu.ProductName, gpuModel)) {
+			available++
+		}
+	}
+	for _, quota := range reserved {
+		if gpuModel != "" && strings.EqualFold(quota.Name, gpuModel) {
+			available -= quota.Quota
+		}
+	}
+	return available
+}
+
+func quotaBytes(quota models.Quota) int64 {
+	unit := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(quota.Unit), "B"), "b")
+	quantity, err := resource.ParseQuantity(fmt.Sprintf("%d%s", quota.Quota, unit))
+	if err != nil {
+		return quota.Quota
+	}
+	return quantity.Value()
+}
@@ -37,6 +37,9 @@ import (
 )
 
 func DoUbiTaskForK8s(c *gin.Context) {
+	if rejectInMaintenance(c) {
+		return
+	}
 	if !conf.GetConfig().UBI.EnableSequencer && !conf.GetConfig().UBI.AutoChainProof {
 		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RejectZkTaskError))
 		return
@@ -106,7 +109,7 @@ func DoUbiTaskForK8s(c *gin.Context) {
 		return
 	}
 
-	signature, err := verifySignature(conf.GetConfig().UBI.UbiEnginePk, fmt.Sprintf("%s%d", cpAccountAddress, ubiTask.ID), ubiTask.Signature)
+	signature, err := verifySignature(conf.GetConfig().UBI.UbiEnginePk, signedMessage(fmt.Sprintf("%s%d", cpAccountAddress, ubiTask.ID), ubiTask.SignedEnvelope), ubiTask.Signature)
 	if err != nil {
 		logs.GetLogger().Errorf("verifySignature for ubi task failed, error: %+v", err)
 		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.UbiTaskParamError, "sign data failed"))
@@ -119,6 +122,16 @@ func DoUbiTaskForK8s(c *gin.Context) {
 		return
 	}
 
+	if !allowSigner(c, conf.GetConfig().UBI.UbiEnginePk) {
+		return
+	}
+
+	if err = checkSignedEnvelope(NonceSourceUbi, ubiTask.SignedEnvelope); err != nil {
+		logs.GetLogger().Warnf("reject ubi task, task_id: %d, error: %v", ubiTask.ID, err)
+		c.JSON(envelopeErrorResponse(err))
+		return
+	}
+
 	var gpuFlag = "0"
 	if ubiTask.ResourceType == 1 {
 		gpuFlag = "1"
@@ -190,7 +203,7 @@ func DoUbiTaskForK8s(c *gin.Context) {
 	if err != nil {
 		taskEntity.Status = models.TASK_FAILED_STATUS
 		NewTaskService().SaveTaskEntity(taskEntity)
-		logs.GetLogger().Error("get memory failed, error: %+v", err)
+		logs.GetLogger().Errorf("get memory failed, error: %+v", err)
 		return
 	}
 
@@ -198,7 +211,7 @@ func DoUbiTaskForK8s(c *gin.Context) {
 	if err != nil {
 		taskEntity.Status = models.TASK_FAILED_STATUS
 		NewTaskService().SaveTaskEntity(taskEntity)
-		logs.GetLogger().Error("get storage failed, error: %+v", err)
+		logs.GetLogger().Errorf("get storage failed, error: %+v", err)
 		return
 	}
 
@@ -206,7 +219,7 @@ func DoUbiTaskForK8s(c *gin.Context) {
 	if err != nil {
 		taskEntity.Status = models.TASK_FAILED_STATUS
 		NewTaskService().SaveTaskEntity(taskEntity)
-		logs.GetLogger().Error("get memory failed, error: %+v", err)
+		logs.GetLogger().Errorf("get memory failed, error: %+v", err)
 		return
 	}
 
@@ -214,7 +227,7 @@ func DoUbiTaskForK8s(c *gin.Context) {
 	if err != nil {
 		taskEntity.Status = models.TASK_FAILED_STATUS
 		NewTaskService().SaveTaskEntity(taskEntity)
-		logs.GetLogger().Error("get storage failed, error: %+v", err)
+		logs.GetLogger().Errorf("get storage failed, error: %+v", err)
 		return
 	}
 
@@ -471,19 +484,22 @@ func ReceiveUbiProof(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
 		return
 	}
-	go func() {
+	runInBackground(func() {
 		defer func() {
 			if err := recover(); err != nil {
 				logs.GetLogger().Errorf("taskId: %d, submit zk-task proof catch painc error: %v", taskId, err)
 			}
 		}()
 		submitUBIProof(c2Proof, ubiTask)
-	}()
+	})
 
 	c.JSON(http.StatusOK, util.CreateSuccessResponse("success"))
 }
 
 func DoUbiTaskForDocker(c *gin.Context) {
+	if rejectInMaintenance(c) {
+		return
+	}
 	if !conf.GetConfig().UBI.EnableSequencer && !conf.GetConfig().UBI.AutoChainProof {
 		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.RejectZkTaskError))
 		return
@@ -491,7 +507,7 @@ func DoUbiTaskForDocker(c *gin.Context) {
 
 	var ubiTask models.UBITaskReq
 	if err := c.ShouldBindJSON(&ubiTask); err != nil {
-		logs.GetLogger().Error("failed to parse json, error: %v", err)
+		logs.GetLogger().Errorf("failed to parse json, error: %v", err)
 		c.JSON(http.StatusBadRequest, util.CreateErrorResponse(util.JsonError))
 		return
 	}
@@ -556,7 +572,7 @@ func DoUbiTaskForDocker(c *gin.Context) {
 		return
 	}
 
-	signature, err := verifySignature(conf.GetConfig().UBI.UbiEnginePk, fmt.Sprintf("%s%d", cpAccountAddress, ubiTask.ID), ubiTask.Signature)
+	signature, err := verifySignature(conf.GetConfig().UBI.UbiEnginePk, signedMessage(fmt.Sprintf("%s%d", cpAccountAddress, ubiTask.ID), ubiTask.SignedEnvelope), ubiTask.Signature)
 	if err != nil {
 		logs.GetLogger().Errorf("verifySignature for ubi task failed, error: %+v", err)
 		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.SignatureError, "verify sign data occur error"))
@@ -569,6 +585,16 @@ func DoUbiTaskForDocker(c *gin.Context) {
 		return
 	}
 
+	if !allowSigner(c, conf.GetConfig().UBI.UbiEnginePk) {
+		return
+	}
+
+	if err = checkSignedEnvelope(NonceSourceUbi, ubiTask.SignedEnvelope); err != nil {
+		logs.GetLogger().Warnf("reject ubi task, task_id: %d, error: %v", ubiTask.ID, err)
+		c.JSON(envelopeErrorResponse(err))
+		return
+	}
+
 	var gpuFlag = "0"
 	if ubiTask.ResourceType == 1 {
 		gpuFlag = "1"
@@ -734,17 +760,11 @@ func DoUbiTaskForDocker(c *gin.Context) {
 }
 
 func checkResourceForUbi(resource *models.TaskResource, gpuName string, resourceType int) (bool, string, int64, int64, error) {
-	dockerService := NewDockerService()
-	containerLogStr, err := dockerService.ContainerLogs("resource-exporter")
+	nodeResource, err := collectHostResource()
 	if err != nil {
 		return false, "", 0, 0, err
 	}
 
-	var nodeResource models.NodeResource
-	if err := json.Unmarshal([]byte(containerLogStr), &nodeResource); err != nil {
-		return false, "", 0, 0, err
-	}
-
 	needCpu, _ := strconv.ParseInt(resource.CPU, 10, 64)
 	var needMemory, needStorage float64
 	if len(strings.Split(strings.TrimSpace(resource.Memory), " ")) > 0 {
@@ -805,40 +825,45 @@ func GetCpResource(c *gin.Context) {
 		location = "-"
 	}
 
-	dockerService := NewDockerService()
-	containerLogStr, err := dockerService.ContainerLogs("resource-exporter")
+	nodeResource, err := collectHostResource()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.ServerError, err.Error()))
 		return
 	}
 
-	var nodeResource models.NodeResource
-	if err := json.Unmarshal([]byte(containerLogStr), &nodeResource); err != nil {
-		logs.GetLogger().Warnf("hardware info parse to json failed, restarting resource-exporter")
-		if err = RestartResourceExporter(); err != nil {
-			logs.GetLogger().Errorf("restartResourceExporter failed, error: %v", err)
-		}
-		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.JsonError))
-		return
-	}
-
 	cpAccountAddress, err := contract.GetCpAccountAddress()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.CreateErrorResponse(util.GetCpAccountError))
 		return
 	}
 
+	nodeResource.Gpu.Slices = dockerGpuSlices()
+	setSellable(&nodeResource, currentReserve())
+	policy := currentResourcePolicy()
+	maintenance := currentMaintenance()
+
 	cpRepo, _ := os.LookupEnv("CP_PATH")
 	c.JSON(http.StatusOK, models.ClusterResource{
 		Region:           location,
 		ClusterInfo:      []*models.NodeResource{&nodeResource},
+		Reserved:         &policy,
+		Maintenance:      &maintenance,
 		NodeName:         conf.GetConfig().API.NodeName,
 		NodeId:           GetNodeId(cpRepo),
 		CpAccountAddress: cpAccountAddress,
 	})
 }
 
+// submitUBIProof submits the proof of a ubi task, its checkpoint is kept when the shutdown interrupts it before the submission
 func submitUBIProof(c2Proof models.UbiC2Proof, task *models.TaskEntity) {
+	cp := saveCheckpoint(checkpointUbiProof, c2Proof.TaskId, c2Proof)
+	var interrupted bool
+	defer func() {
+		if !interrupted {
+			cp.done()
+		}
+	}()
+
 	chainUrl, err := conf.GetRpcByNetWorkName()
 	if err != nil {
 		logs.GetLogger().Errorf("failed to get rpc url, taskId: %s, error: %v", c2Proof.TaskId, err)
@@ -945,6 +970,10 @@ loopTask:
 		return
 	}
 
+	if !cp.advance(stageSubmitting) {
+		interrupted = true
+		return
+	}
 	if conf.GetConfig().UBI.EnableSequencer && conf.GetConfig().UBI.AutoChainProof {
 		if sequencerBalance <= 0 {
 			logs.GetLogger().Infof("taskId: %s starting to create task contract", c2Proof.TaskId)
@@ -1051,21 +1080,9 @@ func GetAggregatedTaskInfo(taskContract string) (string, error) {
 }
 
 func reportClusterResourceForDocker() {
-	dockerService := NewDockerService()
-	containerLogStr, err := dockerService.ContainerLogs("resource-exporter")
+	nodeResource, err := collectHostResource()
 	if err != nil {
-		if err = RestartResourceExporter(); err != nil {
-			logs.GetLogger().Errorf("restartResourceExporter failed, error: %v", err)
-		}
-		return
-	}
-
-	var nodeResource models.NodeResource
-	if err := json.Unmarshal([]byte(containerLogStr), &nodeResource); err != nil {
-		logs.GetLogger().Errorf("failed to convert json, container log: %s, error: %v", containerLogStr, err)
-		if err = RestartResourceExporter(); err != nil {
-			logs.GetLogger().Errorf("restartResourceExporter failed, error: %v", err)
-		}
+		logs.GetLogger().Errorf("failed to collect hardware resource, error: %v", err)
 		return
 	}
 
@@ -1084,57 +1101,58 @@ func reportClusterResourceForDocker() {
 }
 
 func CronTaskForEcp() {
-	go func() {
-		ticker := time.NewTicker(2 * time.Hour)
-		for range ticker.C {
-			NewDockerService().CleanResourceForDocker()
-		}
-	}()
+	startNonceCleaner()
 
-	go func() {
-		ticker := time.NewTicker(3 * time.Minute)
-		for range ticker.C {
-			reportClusterResourceForDocker()
+	runInBackground(func() {
+		NewImageCacheManager().PrePull()
+	})
+	runEvery(2*time.Hour, func(now time.Time) {
+		NewDockerService().CleanResourceForDocker()
+		NewImageCacheManager().PrePull()
+	})
+
+	runEvery(3*time.Minute, func(now time.Time) {
+		reportClusterResourceForDocker()
+	})
+
+	runEvery(usageSampleSeconds*time.Second, func(now time.Time) {
+		meterEcpUsage()
+		if now.Minute() == 0 {
+			deleteExpiredUsage()
 		}
-	}()
+	})
 
-	go func() {
-		ticker := time.NewTicker(5 * time.Minute)
-		for range ticker.C {
-			var taskList []models.TaskEntity
-			oneHourAgo := time.Now().Add(-1 * time.Hour).Unix()
-			err := NewTaskService().Model(&models.TaskEntity{}).Where("status in (?,?) and create_time <?", models.TASK_RECEIVED_STATUS, models.TASK_RUNNING_STATUS, oneHourAgo).
-				Or("tx_hash !='' and status =?", models.TASK_FAILED_STATUS).Find(&taskList).Error
-			if err != nil {
-				logs.GetLogger().Errorf("Failed get task list, error: %+v", err)
-				return
-			}
+	runEvery(5*time.Minute, func(now time.Time) {
+		var taskList []models.TaskEntity
+		oneHourAgo := now.Add(-1 * time.Hour).Unix()
+		err := NewTaskService().Model(&models.TaskEntity{}).Where("status in (?,?) and create_time <?", models.TASK_RECEIVED_STATUS, models.TASK_RUNNING_STATUS, oneHourAgo).
+			Or("tx_hash !='' and status =?", models.TASK_FAILED_STATUS).Find(&taskList).Error
+		if err != nil {
+			logs.GetLogger().Errorf("Failed get task list, error: %+v", err)
+			return
+		}
 
-			for _, entity := range taskList {
-				ubiTask := entity
-				if ubiTask.Contract != "" || ubiTask.BlockHash != "" {
-					ubiTask.Status = models.TASK_SUBMITTED_STATUS
-				} else {
-					ubiTask.Status = models.TASK_FAILED_STATUS
-				}
-				NewTaskService().SaveTaskEntity(&ubiTask)
+		for _, entity := range taskList {
+			ubiTask := entity
+			if ubiTask.Contract != "" || ubiTask.BlockHash != "" {
+				ubiTask.Status = models.TASK_SUBMITTED_STATUS
+			} else {
+				ubiTask.Status = models.TASK_FAILED_STATUS
 			}
+			NewTaskService().SaveTaskEntity(&ubiTask)
 		}
-	}()
+	})
 
-	go func() {
+	runEvery(10*time.Minute, func(now time.Time) {
 		defer func() {
 			if err := recover(); err != nil {
 				logs.GetLogger().Errorf("GetUbiTaskReward, error: %+v", err)
 			}
 		}()
-		ticker := time.NewTicker(10 * time.Minute)
-		for range ticker.C {
-			if err := syncTaskStatusForSequencerService(); err != nil {
-				logs.GetLogger().Errorf("failed to sync task from sequencer, error: %v", err)
-			}
+		if err := syncTaskStatusForSequencerService(); err != nil {
+			logs.GetLogger().Errorf("failed to sync task from sequencer, error: %v", err)
 		}
-	}()
+	})
 }
 
 func syncTaskStatusForSequencerService() error {
@@ -1250,7 +1268,6 @@ func SyncCpAccountInfo() (*models.Account, error) {
 }
 
 func RestartResourceExporter() error {
-	resourceExporterContainerName := "resource-exporter"
 	dockerService := NewDockerService()
 	dockerService.RemoveContainerByName(resourceExporterContainerName)
 	err := dockerService.PullImage(build.UBIResourceExporterDockerImage)
@@ -1356,7 +1373,7 @@ func submitTaskToSequencer(proof string, task *models.TaskEntity, timeOut int64,
 			ki = nil
 			taskStub, err := ecp.NewTaskStub(client, ecp.WithTaskContractAddress(task.Contract), ecp.WithTaskPrivateKey(workerPrivateKey))
 			if err != nil {
-				return fmt.Errorf("failed to create ubi task client, taskId: %s, contract: %s, error: %v", task.Id, task.Contract, err)
+				return fmt.Errorf("failed to create ubi task client, taskId: %d, contract: %s, error: %v", task.Id, task.Contract, err)
 			}
 
 			logs.GetLogger().Infof("taskId: %d, failed to submit proof using sequencer, starting to create task contract", task.Id)
@@ -1410,7 +1427,7 @@ func checkBalance(cpAccountAddress string) (bool, error) {
 	}
 	client, err := contract.GetEthClient(chainUrl)
 	if err != nil {
-		return false, fmt.Errorf("failed to dial rpc, cpAccount: %d, error: %v", cpAccountAddress, err)
+		return false, fmt.Errorf("failed to dial rpc, cpAccount: %s, error: %v", cpAccountAddress, err)
 	}
 	client.Close()
 
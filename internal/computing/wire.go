@@ -26,3 +26,33 @@ func NewEcpJobService() EcpJobService {
 	wire.Build(ecpJobSet)
 	return EcpJobService{}
 }
+
+func NewNonceService() NonceService {
+	wire.Build(nonceSet)
+	return NonceService{}
+}
+
+func NewAuditService() AuditService {
+	wire.Build(auditSet)
+	return AuditService{}
+}
+
+func NewImageUsageService() ImageUsageService {
+	wire.Build(imageUsageSet)
+	return ImageUsageService{}
+}
+
+func NewJobUsageService() JobUsageService {
+	wire.Build(jobUsageSet)
+	return JobUsageService{}
+}
+
+func NewCheckpointService() CheckpointService {
+	wire.Build(checkpointSet)
+	return CheckpointService{}
+}
+
+func NewSecretService() SecretService {
+	wire.Build(secretSet)
+	return SecretService{}
+}
@@ -47,3 +47,51 @@ func NewEcpJobService() EcpJobService {
 	}
 	return ecpJobService
 }
+
+func NewNonceService() NonceService {
+	gormDB := db.NewDbService()
+	nonceService := NonceService{
+		DB: gormDB,
+	}
+	return nonceService
+}
+
+func NewAuditService() AuditService {
+	gormDB := db.NewDbService()
+	auditService := AuditService{
+		DB: gormDB,
+	}
+	return auditService
+}
+
+func NewImageUsageService() ImageUsageService {
+	gormDB := db.NewDbService()
+	imageUsageService := ImageUsageService{
+		DB: gormDB,
+	}
+	return imageUsageService
+}
+
+func NewJobUsageService() JobUsageService {
+	gormDB := db.NewDbService()
+	jobUsageService := JobUsageService{
+		DB: gormDB,
+	}
+	return jobUsageService
+}
+
+func NewCheckpointService() CheckpointService {
+	gormDB := db.NewDbService()
+	checkpointService := CheckpointService{
+		DB: gormDB,
+	}
+	return checkpointService
+}
+
+func NewSecretService() SecretService {
+	gormDB := db.NewDbService()
+	secretService := SecretService{
+		DB: gormDB,
+	}
+	return secretService
+}
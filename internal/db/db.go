@@ -46,7 +46,13 @@ func InitDb(cpRepoPath string) {
 		&models.TaskEntity{},
 		&models.JobEntity{},
 		&models.CpInfoEntity{},
-		&models.EcpJobEntity{}); err != nil {
+		&models.EcpJobEntity{},
+		&models.RequestNonceEntity{},
+		&models.AuditLogEntity{},
+		&models.ImageUsageEntity{},
+		&models.JobUsageEntity{},
+		&models.CheckpointEntity{},
+		&models.SpaceSecretEntity{}); err != nil {
 		panic("failed to auto migrate for provider db")
 	}
 }
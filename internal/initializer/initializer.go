@@ -4,14 +4,21 @@ import (
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/swanchain/go-computing-provider/conf"
 	"github.com/swanchain/go-computing-provider/internal/computing"
+	"github.com/swanchain/go-computing-provider/util"
 )
 
 func ProjectInit(cpRepoPath string) {
+	// the lock is held until the process exits, it keeps the doctor from repairing the database under the running cp
+	if _, err := util.LockRepo(cpRepoPath); err != nil {
+		logs.GetLogger().Fatal(err)
+	}
 	if err := conf.InitConfig(cpRepoPath, false); err != nil {
 		logs.GetLogger().Fatal(err)
 	}
 	nodeID := computing.InitComputingProvider(cpRepoPath)
 
+	// the database is reconciled before the crons, which would otherwise act on the rows it corrects
+	computing.ReconcileOnStart(computing.ReconcileForK8s)
 	computing.NewCronTask(nodeID).RunTask()
-
+	computing.ResumeCheckpoints()
 }
@@ -20,6 +20,14 @@ type JobData struct {
 	JobType                     int      `json:"job_type"`  // 0: Standard job; 1: Custom job
 	BidPrice                    string   `json:"bid_price"` // Amount users are willing to pay
 	IpWhiteList                 []string `json:"ip_white_list"`
+	Replicas                    int      `json:"replicas,omitempty"` // the count of the deployment yaml takes priority
+	SignedEnvelope
+}
+
+// SignedEnvelope carries the anti-replay fields, they are appended to the signed message
+type SignedEnvelope struct {
+	Timestamp int64  `json:"timestamp" form:"timestamp"` // unix seconds
+	Nonce     string `json:"nonce" form:"nonce"`
 }
 
 type Job struct {
@@ -64,13 +72,15 @@ type SpaceHardware struct {
 	Vcpu         int64  `json:"vcpu"`
 	Storage      int64  `json:"storage"` // unit bytes
 	Gpu          int64  `json:"gpu"`
+	GpuSlice     string `json:"gpu_slice,omitempty"` // the MIG profile such as 1g.10gb or shared, Gpu is the count of the slices
 }
 
 type Resource struct {
-	Cpu     Specification
-	Memory  Specification
-	Gpu     Specification
-	Storage Specification
+	Cpu      Specification
+	Memory   Specification
+	Gpu      Specification
+	Storage  Specification
+	GpuSlice string // the slice profile, Gpu.Quantity is the count of the slices
 }
 
 type Specification struct {
@@ -89,6 +99,7 @@ type UBITaskReq struct {
 	ResourceType int           `json:"resource_type"`
 	DeadLine     int64         `json:"deadline"`
 	CheckCode    string        `json:"check_code"`
+	SignedEnvelope
 }
 
 type UbiC2Proof struct {
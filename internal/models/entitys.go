@@ -196,6 +196,9 @@ type JobEntity struct {
 	TaskUuid        string `json:"task_uuid" gorm:"task_uuid"`
 	ResourceType    string `json:"resource_type"  gorm:"resource_type"`
 	SpaceType       int    `json:"space_type" gorm:"space_type"` // 0: public; 1: private
+	NodeName        string `json:"node_name" gorm:"node_name"`   // the nodes of the replicas, separated by commas
+	Cluster         string `json:"cluster" gorm:"cluster"`       // empty for the default cluster
+	IngressBackend  string `json:"ingress_backend" gorm:"ingress_backend"` // the backend the space was exposed by, empty for the old jobs
 	SourceUrl       string `json:"source_url" gorm:"source_url"`
 	Hardware        string `json:"hardware" gorm:"hardware"`
 	Duration        int    `json:"duration" gorm:"duration"`
@@ -216,6 +219,7 @@ type JobEntity struct {
 	DeleteAt        int    `json:"delete_at" gorm:"delete_at; default:0"` // 1 deleted
 	IpWhiteList     string `json:"ip_white_list"`
 	PodStatus       int    `json:"pod_status"`
+	Replicas        int    `json:"replicas" gorm:"replicas;default:1"`
 	Status          int    `json:"status"`
 	StartedBlock    uint64 `json:"started_block" gorm:"column:started_block;not null;default:0"`
 	ScannedBlock    uint64 `json:"scanned_block" gorm:"column:scanned_block;not null;default:0"`
@@ -337,9 +341,105 @@ type EcpJobEntity struct {
 	Status        string `json:"status"` // created|restarting|running|removing|paused|exited|dead
 	ContainerName string `json:"container_name" gorm:"container_name"`
 	CreateTime    int64  `json:"create_time" gorm:"create_time"`
-	DeleteAt      int    `json:"delete_at" gorm:"delete_at; default:0"` // 1 deleted
+	ExpireTime    int64  `json:"expire_time" gorm:"expire_time; default:0"` // 0 when the job has no duration
+	DeleteAt      int    `json:"delete_at" gorm:"delete_at; default:0"`     // 1 deleted
 }
 
 func (*EcpJobEntity) TableName() string {
 	return "t_ecp_job"
 }
+
+type RequestNonceEntity struct {
+	Id         int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Nonce      string `json:"nonce" gorm:"uniqueIndex"` // <source>:<nonce>
+	ExpireTime int64  `json:"expire_time" gorm:"expire_time"`
+	CreateTime int64  `json:"create_time" gorm:"create_time"`
+}
+
+func (*RequestNonceEntity) TableName() string {
+	return "t_request_nonce"
+}
+
+type AuditLogEntity struct {
+	Id         int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Actor      string `json:"actor" gorm:"actor"` // cli, system, api:<client_ip>
+	Action     string `json:"action" gorm:"action"`
+	Params     string `json:"params" gorm:"params"` // json
+	TxHash     string `json:"tx_hash" gorm:"tx_hash"`
+	Result     string `json:"result" gorm:"result"`
+	PrevHash   string `json:"prev_hash" gorm:"uniqueIndex"`
+	Hash       string `json:"hash" gorm:"hash"`
+	Signature  string `json:"signature" gorm:"signature"` // signed hash by the node private key
+	CreateTime int64  `json:"create_time" gorm:"create_time"`
+}
+
+func (*AuditLogEntity) TableName() string {
+	return "t_audit_log"
+}
+
+type ImageUsageEntity struct {
+	Id           int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	ImageName    string `json:"image_name" gorm:"uniqueIndex"`
+	LastUsedTime int64  `json:"last_used_time" gorm:"last_used_time"`
+}
+
+func (*ImageUsageEntity) TableName() string {
+	return "t_image_usage"
+}
+
+// JobUsageEntity is the resource usage of a job rolled up over a window of time
+type JobUsageEntity struct {
+	Id                int64   `json:"id" gorm:"primaryKey;autoIncrement"`
+	JobUuid           string  `json:"job_uuid" gorm:"uniqueIndex:idx_job_usage_window"`
+	WindowStart       int64   `json:"window_start" gorm:"uniqueIndex:idx_job_usage_window"` // unix seconds
+	WindowSeconds     int64   `json:"window_seconds" gorm:"window_seconds"`
+	Source            string  `json:"source" gorm:"source"` // ecp or space
+	Samples           int64   `json:"samples" gorm:"samples"`
+	CpuSamples        int64   `json:"cpu_samples" gorm:"cpu_samples"`       // the samples the cpu is averaged over, the first sample of a container has no cpu
+	SampleSeconds     int64   `json:"sample_seconds" gorm:"sample_seconds"` // the interval between two samples
+	CpuCoresAvg       float64 `json:"cpu_cores_avg" gorm:"cpu_cores_avg"`
+	CpuCoresMax       float64 `json:"cpu_cores_max" gorm:"cpu_cores_max"`
+	MemoryBytesAvg    int64   `json:"memory_bytes_avg" gorm:"memory_bytes_avg"`
+	MemoryBytesMax    int64   `json:"memory_bytes_max" gorm:"memory_bytes_max"`
+	GpuUtilAvg        float64 `json:"gpu_util_avg" gorm:"gpu_util_avg"` // percent
+	GpuMemoryBytesMax int64   `json:"gpu_memory_bytes_max" gorm:"gpu_memory_bytes_max"`
+	NetworkRxBytes    int64   `json:"network_rx_bytes" gorm:"network_rx_bytes"` // received in the window
+	NetworkTxBytes    int64   `json:"network_tx_bytes" gorm:"network_tx_bytes"`
+	UpdateTime        int64   `json:"update_time" gorm:"update_time"`
+}
+
+func (*JobUsageEntity) TableName() string {
+	return "t_job_usage"
+}
+
+// CheckpointEntity is the progress of a deployment or a proof submission running in the background, it is removed
+// when the work finishes and is resumed on the next start otherwise
+type CheckpointEntity struct {
+	Id         int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Kind       string `json:"kind" gorm:"uniqueIndex:idx_checkpoint_work"`     // space_deploy, ecp_deploy or ubi_proof
+	WorkKey    string `json:"work_key" gorm:"uniqueIndex:idx_checkpoint_work"` // the job uuid or the task id
+	Stage      string `json:"stage" gorm:"stage"`
+	Payload    string `json:"payload" gorm:"payload"` // the arguments of the work in json, sealed by the key of the cp
+	Attempts   int    `json:"attempts" gorm:"attempts; default:0"`
+	CreateTime int64  `json:"create_time" gorm:"create_time"`
+	UpdateTime int64  `json:"update_time" gorm:"update_time"`
+}
+
+func (*CheckpointEntity) TableName() string {
+	return "t_checkpoint"
+}
+
+// SpaceSecretEntity is a secret of a space owner in the secret store of the cp, the spaces reference its keys by
+// secretRef in the deployment yaml, so the values are never written into the public space repo
+type SpaceSecretEntity struct {
+	Id            int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	WalletAddress string `json:"wallet_address" gorm:"uniqueIndex:idx_space_secret"` // lowercase
+	Name          string `json:"name" gorm:"uniqueIndex:idx_space_secret"`
+	Data          string `json:"-" gorm:"data"` // the keys and values in json, sealed by the key of the cp
+	CreateTime    int64  `json:"create_time" gorm:"create_time"`
+	UpdateTime    int64  `json:"update_time" gorm:"update_time"`
+}
+
+func (*SpaceSecretEntity) TableName() string {
+	return "t_space_secret"
+}
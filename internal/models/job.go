@@ -4,6 +4,7 @@ type EcpJobCreateReq struct {
 	UUID     string            `json:"uuid,omitempty"`
 	Name     string            `json:"name,omitempty"`
 	Image    string            `json:"image,omitempty"`
+	Compose  string            `json:"compose,omitempty"` // the content of a docker compose file, replaces image
 	Envs     map[string]string `json:"envs,omitempty"`
 	Resource HardwareResource  `json:"resource"`
 	Price    string            `json:"price"`
@@ -16,9 +17,31 @@ type HardwareResource struct {
 	Storage  int64  `json:"storage"`
 	GPU      int64  `json:"gpu"`
 	GPUModel string `json:"gpu_model"`
+	GPUSlice string `json:"gpu_slice,omitempty"` // the MIG profile such as 1g.10gb, GPU is the count of the slices
 }
 
 type EcpJobStatusResp struct {
 	Uuid   string `json:"uuid"`
 	Status string `json:"status"`
 }
+
+// JobUsageReport is the metered usage of a job, the summary adds up the windows
+type JobUsageReport struct {
+	JobUuid string           `json:"job_uuid"`
+	Summary JobUsageSummary  `json:"summary"`
+	Windows []JobUsageEntity `json:"windows"`
+}
+
+type JobUsageSummary struct {
+	From              int64   `json:"from"`
+	To                int64   `json:"to"`
+	MeteredSeconds    int64   `json:"metered_seconds"`
+	CpuCoreHours      float64 `json:"cpu_core_hours"`
+	CpuCoresMax       float64 `json:"cpu_cores_max"`
+	MemoryGiBHours    float64 `json:"memory_gib_hours"`
+	MemoryBytesMax    int64   `json:"memory_bytes_max"`
+	GpuUtilAvg        float64 `json:"gpu_util_avg"`
+	GpuMemoryBytesMax int64   `json:"gpu_memory_bytes_max"`
+	NetworkRxBytes    int64   `json:"network_rx_bytes"`
+	NetworkTxBytes    int64   `json:"network_tx_bytes"`
+}
@@ -7,9 +7,36 @@ type ClusterResource struct {
 	ClusterInfo      []*NodeResource `json:"cluster_info"`
 	NodeName         string          `json:"node_name,omitempty"`
 	Runtime          string          `json:"runtime,omitempty"`
+	Reserved         *ResourcePolicy `json:"reserved,omitempty"` // kept in reserve on every node
+	Maintenance      *Maintenance    `json:"maintenance,omitempty"`
+}
+
+// Maintenance is the maintenance state of the cp, no new task is accepted while it is enabled
+type Maintenance struct {
+	Enabled      bool     `json:"enabled"`
+	Reason       string   `json:"reason,omitempty"`
+	Since        int64    `json:"since,omitempty"`
+	DrainedNodes []string `json:"drained_nodes,omitempty"` // the nodes cordoned by node drain, node undrain uncordons them
+}
+
+// ReconcileReport is what the reconciler found different between the database and the cluster or the containers
+type ReconcileReport struct {
+	Time   int64           `json:"time"`
+	DryRun bool            `json:"dry_run"`
+	Policy string          `json:"policy"` // the orphan policy
+	Items  []ReconcileItem `json:"items"`
+}
+
+// ReconcileItem is a job, a task or an orphan which did not match, and what was done to it
+type ReconcileItem struct {
+	Kind   string `json:"kind"` // job, task, ecp_job or orphan
+	Id     string `json:"id"`
+	Found  string `json:"found"`
+	Action string `json:"action"`
 }
 
 type NodeResource struct {
+	Cluster   string `json:"cluster,omitempty"` // the cluster of the node when the cp runs on several clusters
 	MachineId string `json:"machine_id"`
 	CpuName   string `json:"cpu_name"`
 	Cpu       Common `json:"cpu"`
@@ -17,6 +44,46 @@ type NodeResource struct {
 	Memory    Common `json:"memory"`
 	Gpu       Gpu    `json:"gpu"`
 	Storage   Common `json:"storage"`
+
+	Sellable *SellableResource `json:"sellable,omitempty"`
+}
+
+// SellableResource is the free resource of a node after keeping the reserve of the resource policy
+type SellableResource struct {
+	Cpu     int64            `json:"cpu"`
+	Memory  string           `json:"memory"`
+	Storage string           `json:"storage"`
+	Gpu     map[string]int64 `json:"gpu,omitempty"` // the available count by product name
+}
+
+// CapacityForecast projects the sellable resources over the next hours from the expirations of the running jobs
+type CapacityForecast struct {
+	From     int64             `json:"from"`
+	Hours    int               `json:"hours"`
+	Slots    []CapacitySlot    `json:"slots"`    // the first slot is now, the others are at the top of each hour
+	Releases []CapacityRelease `json:"releases"` // the jobs expiring within the hours, ordered by the expire time
+}
+
+// CapacitySlot is the sellable resource at the time, after the jobs expired by then release their resources
+type CapacitySlot struct {
+	Time  int64          `json:"time"`
+	Total NodeCapacity   `json:"total"`
+	Nodes []NodeCapacity `json:"nodes"`
+}
+
+type NodeCapacity struct {
+	NodeName   string           `json:"node_name,omitempty"`
+	Cpu        int64            `json:"cpu"`
+	MemoryGiB  float64          `json:"memory_gib"`
+	StorageGiB float64          `json:"storage_gib"`
+	Gpu        map[string]int64 `json:"gpu,omitempty"` // the count by product name
+}
+
+// CapacityRelease is the resource a job gives back when it expires
+type CapacityRelease struct {
+	JobUuid    string       `json:"job_uuid"`
+	ExpireTime int64        `json:"expire_time"`
+	Resource   NodeCapacity `json:"resource"`
 }
 
 type CollectNodeInfo struct {
@@ -28,6 +95,16 @@ type Gpu struct {
 	CudaVersion   string      `json:"cuda_version"`
 	AttachedGpus  int         `json:"attached_gpus"`
 	Details       []GpuDetail `json:"details"`
+	Slices        []GpuSlice  `json:"slices,omitempty"`
+}
+
+// GpuSlice is a part of a gpu sold as a unit of its own, a MIG profile or a time-sliced replica
+type GpuSlice struct {
+	ProductName string `json:"product_name"`
+	Resource    string `json:"resource"` // the extended resource requested by the pods, such as nvidia.com/mig-1g.10gb
+	Profile     string `json:"profile"`  // the MIG profile such as 1g.10gb, or shared for time-slicing
+	Total       int64  `json:"total"`
+	Available   int64  `json:"available"`
 }
 
 type GpuDetail struct {
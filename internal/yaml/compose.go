@@ -0,0 +1,543 @@
+package yaml
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const resourceGpu corev1.ResourceName = "nvidia.com/gpu"
+
+// the limits of a depend which declares none
+const (
+	composeDefaultCpu    = "500m"
+	composeDefaultMemory = "512Mi"
+)
+
+var composeFileNames = []string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"}
+
+// IsComposeFile reports whether the file is a docker compose file by its name,
+// the version field can not be used because compose files may also declare version 2.0
+func IsComposeFile(yamlFilePath string) bool {
+	name := strings.ToLower(filepath.Base(yamlFilePath))
+	for _, composeName := range composeFileNames {
+		if name == composeName {
+			return true
+		}
+	}
+	return false
+}
+
+func ComposeFileNames() []string {
+	return composeFileNames
+}
+
+type ComposeFile struct {
+	Version  string                    `yaml:"version"`
+	Services map[string]ComposeService `yaml:"services"`
+	Volumes  map[string]interface{}    `yaml:"volumes"`
+}
+
+type ComposeService struct {
+	Image       string           `yaml:"image"`
+	Build       interface{}      `yaml:"build"`
+	Entrypoint  stringOrList     `yaml:"entrypoint"`
+	Command     stringOrList     `yaml:"command"`
+	Environment mapOrList        `yaml:"environment"`
+	Ports       []interface{}    `yaml:"ports"`
+	Expose      []interface{}    `yaml:"expose"`
+	DependsOn   composeDependsOn `yaml:"depends_on"`
+	Volumes     []interface{}    `yaml:"volumes"`
+	Restart     string           `yaml:"restart"`
+	Deploy      struct {
+		Replicas  int `yaml:"replicas"`
+		Resources struct {
+			Limits       composeResource `yaml:"limits"`
+			Reservations composeResource `yaml:"reservations"`
+		} `yaml:"resources"`
+	} `yaml:"deploy"`
+}
+
+type composeResource struct {
+	Cpus    string `yaml:"cpus"`
+	Memory  string `yaml:"memory"`
+	Devices []struct {
+		Driver       string      `yaml:"driver"`
+		Count        interface{} `yaml:"count"`
+		DeviceIds    []string    `yaml:"device_ids"`
+		Capabilities []string    `yaml:"capabilities"`
+	} `yaml:"devices"`
+}
+
+// stringOrList accepts both `command: npm start` and `command: ["npm", "start"]`
+type stringOrList []string
+
+func (s *stringOrList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		*s = strings.Fields(str)
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// mapOrList accepts both `environment: {KEY: value}` and `environment: ["KEY=value"]`, the result is KEY=value
+type mapOrList []string
+
+func (m *mapOrList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*m = list
+		return nil
+	}
+	var kv map[string]interface{}
+	if err := unmarshal(&kv); err != nil {
+		return err
+	}
+	var result []string
+	for _, k := range sortedKeys(kv) {
+		if kv[k] == nil {
+			result = append(result, k+"=")
+		} else {
+			result = append(result, fmt.Sprintf("%s=%v", k, kv[k]))
+		}
+	}
+	*m = result
+	return nil
+}
+
+// composeDependsOn accepts the short list syntax and the long syntax with conditions
+type composeDependsOn []string
+
+func (d *composeDependsOn) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*d = list
+		return nil
+	}
+	var conditions map[string]interface{}
+	if err := unmarshal(&conditions); err != nil {
+		return err
+	}
+	*d = sortedKeys(conditions)
+	return nil
+}
+
+// ParseCompose translates a docker compose file into the ContainerResource model. The compose services run in one pod,
+// the entry service is the one which publishes ports, or the one no other service depends on, the rest become its depends.
+func ParseCompose(yamlFile []byte) ([]ContainerResource, error) {
+	var compose ComposeFile
+	if err := yaml.Unmarshal(yamlFile, &compose); err != nil {
+		return nil, &ValidationError{Errors: []string{err.Error()}}
+	}
+
+	verr := new(ValidationError)
+	if len(compose.Services) == 0 {
+		verr.add("services", "at least one service must be defined")
+		return nil, verr
+	}
+
+	containers := make(map[string]*ContainerResource)
+	gpuAll := make(map[string]bool)
+	var volumes []corev1.Volume
+	for _, name := range sortedKeys(compose.Volumes) {
+		checkName(verr, "volumes."+name, name)
+		volumes = append(volumes, corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}})
+	}
+	for _, name := range sortedKeys(compose.Services) {
+		container, serviceVolumes, all := compose.convertService(verr, name, compose.Services[name])
+		containers[name] = container
+		volumes = append(volumes, serviceVolumes...)
+		gpuAll[name] = all
+	}
+
+	mainName := compose.entryService(verr)
+	if mainName == "" {
+		return nil, verr
+	}
+
+	main := containers[mainName]
+	main.Volumes = volumes
+	main.HostAliases = sortedKeys(compose.Services)
+	main.RestartPolicy = getRestartPolicy(composeRestart(compose.Services[mainName].Restart))
+	if compose.Services[mainName].Deploy.Replicas > 0 {
+		main.Count = compose.Services[mainName].Deploy.Replicas
+	}
+	for _, name := range compose.startOrder(verr, mainName) {
+		if name == mainName {
+			continue
+		}
+		if gpuAll[name] {
+			verr.add("services."+name+".deploy.resources.reservations.devices", "count: all is only supported on the entry service %s", mainName)
+		}
+		if restart := composeRestart(compose.Services[name].Restart); restart != RestartAlways {
+			verr.add("services."+name+".restart", "restart is only supported on the entry service %s", mainName)
+		}
+		containers[name].defaultLimits()
+		main.Depends = append(main.Depends, *containers[name])
+	}
+
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+	return []ContainerResource{*main}, nil
+}
+
+func (cf *ComposeFile) convertService(verr *ValidationError, name string, service ComposeService) (*ContainerResource, []corev1.Volume, bool) {
+	field := "services." + name
+	checkName(verr, field, name)
+	if service.Image == "" {
+		if service.Build != nil {
+			verr.add(field+".build", "build is not supported, push the image to a registry and set image")
+		} else {
+			verr.add(field+".image", "image is required")
+		}
+	}
+
+	container := &ContainerResource{
+		Name:      name,
+		ImageName: service.Image,
+		Command:   service.Entrypoint,
+		Args:      service.Command,
+	}
+
+	var envs []string
+	for _, env := range service.Environment {
+		if !strings.Contains(env, "=") {
+			env += "="
+		}
+		envs = append(envs, env)
+	}
+	checkEnv(verr, field+".environment", envs)
+	container.Env = parseEnv(envs)
+
+	for i, port := range service.Ports {
+		containerPort, err := parseComposePort(port)
+		if err != nil {
+			verr.add(fmt.Sprintf("%s.ports[%d]", field, i), "%v", err)
+			continue
+		}
+		container.Ports = append(container.Ports, containerPort)
+	}
+	for i, expose := range service.Expose {
+		containerPort, err := parseComposePort(fmt.Sprint(expose))
+		if err != nil {
+			verr.add(fmt.Sprintf("%s.expose[%d]", field, i), "%v", err)
+			continue
+		}
+		containerPort.HostPort = 0
+		container.Ports = append(container.Ports, containerPort)
+	}
+
+	var volumes []corev1.Volume
+	for i, v := range service.Volumes {
+		volumeField := fmt.Sprintf("%s.volumes[%d]", field, i)
+		source, target, readOnly, err := parseComposeVolume(v)
+		if err != nil {
+			verr.add(volumeField, "%v", err)
+			continue
+		}
+		if source == "" {
+			// an anonymous volume only lives with the job
+			source = fmt.Sprintf("%s-anonymous-%d", name, i)
+			volumes = append(volumes, corev1.Volume{Name: source, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}})
+		} else if _, ok := cf.Volumes[source]; !ok {
+			verr.add(volumeField, "volume %s is not defined in volumes", source)
+			continue
+		}
+		container.VolumeMountList = append(container.VolumeMountList, corev1.VolumeMount{
+			Name:      source,
+			MountPath: target,
+			ReadOnly:  readOnly,
+		})
+	}
+
+	requests, limits := make(corev1.ResourceList), make(corev1.ResourceList)
+	cf.convertResource(verr, field+".deploy.resources.reservations", service.Deploy.Resources.Reservations, requests)
+	cf.convertResource(verr, field+".deploy.resources.limits", service.Deploy.Resources.Limits, limits)
+	gpuCount, gpuAll := composeGpu(verr, field, service)
+	if gpuCount > 0 {
+		limits[resourceGpu] = *resource.NewQuantity(gpuCount, resource.DecimalSI)
+	}
+	if len(requests) > 0 || len(limits) > 0 {
+		container.Resources = &corev1.ResourceRequirements{Requests: requests, Limits: limits}
+	}
+	return container, volumes, gpuAll
+}
+
+// defaultLimits limits the cpu and memory of a depend which does not, the depends share the hardware of the space
+// with the entry service, so every service has to be accounted for
+func (c *ContainerResource) defaultLimits() {
+	if c.Resources == nil {
+		c.Resources = &corev1.ResourceRequirements{Requests: make(corev1.ResourceList), Limits: make(corev1.ResourceList)}
+	}
+	if c.Resources.Limits == nil {
+		c.Resources.Limits = make(corev1.ResourceList)
+	}
+	for name, value := range map[corev1.ResourceName]string{corev1.ResourceCPU: composeDefaultCpu, corev1.ResourceMemory: composeDefaultMemory} {
+		if _, ok := c.Resources.Limits[name]; ok {
+			continue
+		}
+		if request, ok := c.Resources.Requests[name]; ok {
+			c.Resources.Limits[name] = request
+		} else {
+			c.Resources.Limits[name] = resource.MustParse(value)
+		}
+	}
+}
+
+func (cf *ComposeFile) convertResource(verr *ValidationError, field string, value composeResource, list corev1.ResourceList) {
+	if value.Cpus != "" {
+		cpu, err := resource.ParseQuantity(value.Cpus)
+		if err != nil {
+			verr.add(field+".cpus", "invalid cpus %q", value.Cpus)
+		} else {
+			list[corev1.ResourceCPU] = cpu
+		}
+	}
+	if value.Memory != "" {
+		memory, err := parseComposeBytes(value.Memory)
+		if err != nil {
+			verr.add(field+".memory", "%v", err)
+		} else {
+			list[corev1.ResourceMemory] = *resource.NewQuantity(memory, resource.BinarySI)
+		}
+	}
+}
+
+// entryService picks the service exposed to the user: the only one publishing ports, otherwise the only one no other service depends on
+func (cf *ComposeFile) entryService(verr *ValidationError) string {
+	var published []string
+	dependedOn := make(map[string]bool)
+	for _, name := range sortedKeys(cf.Services) {
+		if len(cf.Services[name].Ports) > 0 {
+			published = append(published, name)
+		}
+		for _, depend := range cf.Services[name].DependsOn {
+			dependedOn[depend] = true
+		}
+	}
+	if len(published) == 1 {
+		return published[0]
+	}
+
+	var roots []string
+	for _, name := range sortedKeys(cf.Services) {
+		if !dependedOn[name] {
+			roots = append(roots, name)
+		}
+	}
+	if len(roots) == 1 {
+		return roots[0]
+	}
+	verr.add("services", "can not decide the entry service, only one service should publish ports or be left out of depends_on, candidates: %s",
+		strings.Join(append(published, roots...), ", "))
+	return ""
+}
+
+// startOrder sorts the services so that every service starts after the services it depends on
+func (cf *ComposeFile) startOrder(verr *ValidationError, mainName string) []string {
+	var order []string
+	state := make(map[string]int) // 1: visiting, 2: done
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		switch state[name] {
+		case 1:
+			verr.add("services."+name+".depends_on", "circular dependency %s", strings.Join(append(path, name), " -> "))
+			return
+		case 2:
+			return
+		}
+		state[name] = 1
+		for _, depend := range cf.Services[name].DependsOn {
+			if _, ok := cf.Services[depend]; !ok {
+				verr.add("services."+name+".depends_on", "service %s is not defined", depend)
+				continue
+			}
+			visit(depend, append(path, name))
+		}
+		state[name] = 2
+		order = append(order, name)
+	}
+
+	visit(mainName, nil)
+	for _, name := range sortedKeys(cf.Services) {
+		visit(name, nil)
+	}
+	// the entry service is started last
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[j] == mainName && order[i] != mainName
+	})
+	return order
+}
+
+func composeGpu(verr *ValidationError, field string, service ComposeService) (int64, bool) {
+	var count int64
+	var all bool
+	for i, device := range service.Deploy.Resources.Reservations.Devices {
+		var isGpu bool
+		for _, capability := range device.Capabilities {
+			if capability == "gpu" {
+				isGpu = true
+			}
+		}
+		if !isGpu && device.Driver != "nvidia" {
+			verr.add(fmt.Sprintf("%s.deploy.resources.reservations.devices[%d]", field, i), "only gpu devices are supported")
+			continue
+		}
+
+		switch c := device.Count.(type) {
+		case nil:
+			if len(device.DeviceIds) > 0 {
+				count += int64(len(device.DeviceIds))
+			} else {
+				all = true
+			}
+		case int:
+			count += int64(c)
+		case string:
+			if c == "all" {
+				all = true
+			} else if n, err := strconv.ParseInt(c, 10, 64); err == nil {
+				count += n
+			} else {
+				verr.add(fmt.Sprintf("%s.deploy.resources.reservations.devices[%d].count", field, i), "invalid count %q", c)
+			}
+		default:
+			verr.add(fmt.Sprintf("%s.deploy.resources.reservations.devices[%d].count", field, i), "invalid count %v", c)
+		}
+	}
+	return count, all
+}
+
+func composeRestart(restart string) string {
+	switch {
+	case restart == "no":
+		return RestartNo
+	case strings.HasPrefix(restart, "on-failure"):
+		return RestartOnFailure
+	default:
+		return RestartAlways
+	}
+}
+
+// parseComposePort supports the short syntax [[ip:]published:]target[/protocol] and the long syntax mapping
+func parseComposePort(port interface{}) (corev1.ContainerPort, error) {
+	var containerPort corev1.ContainerPort
+	var target, published, protocol string
+	switch p := port.(type) {
+	case int:
+		target = strconv.Itoa(p)
+	case string:
+		spec, proto, _ := strings.Cut(p, "/")
+		protocol = proto
+		parts := strings.Split(spec, ":")
+		target = parts[len(parts)-1]
+		if len(parts) > 1 {
+			published = parts[len(parts)-2]
+		}
+	case map[interface{}]interface{}:
+		target = fmt.Sprint(p["target"])
+		if v, ok := p["published"]; ok {
+			published = fmt.Sprint(v)
+		}
+		if v, ok := p["protocol"]; ok {
+			protocol = fmt.Sprint(v)
+		}
+	default:
+		return containerPort, fmt.Errorf("invalid port %v", port)
+	}
+
+	if strings.Contains(target, "-") || strings.Contains(published, "-") {
+		return containerPort, fmt.Errorf("port ranges are not supported")
+	}
+	targetNum, err := strconv.Atoi(target)
+	if err != nil || targetNum <= 0 || targetNum > 65535 {
+		return containerPort, fmt.Errorf("invalid port %s", target)
+	}
+	containerPort.ContainerPort = int32(targetNum)
+	if published != "" {
+		publishedNum, err := strconv.Atoi(published)
+		if err != nil || publishedNum <= 0 || publishedNum > 65535 {
+			return containerPort, fmt.Errorf("invalid published port %s", published)
+		}
+		containerPort.HostPort = int32(publishedNum)
+	}
+	if protocol != "" && protocol != "tcp" && protocol != "udp" {
+		return containerPort, fmt.Errorf("unsupported protocol %s, only tcp and udp are supported", protocol)
+	}
+	containerPort.Protocol = getProtocol(protocol)
+	return containerPort, nil
+}
+
+// parseComposeVolume returns the named volume and the mount path, bind mounts of host paths are rejected
+func parseComposeVolume(v interface{}) (source, target string, readOnly bool, err error) {
+	switch volume := v.(type) {
+	case string:
+		parts := strings.Split(volume, ":")
+		switch len(parts) {
+		case 1:
+			target = parts[0]
+		case 2, 3:
+			source, target = parts[0], parts[1]
+			readOnly = len(parts) == 3 && strings.Contains(parts[2], "ro")
+		default:
+			return "", "", false, fmt.Errorf("invalid volume %s", volume)
+		}
+	case map[interface{}]interface{}:
+		if t, ok := volume["type"]; ok && t != "volume" {
+			return "", "", false, fmt.Errorf("volume type %v is not supported, only named volumes are supported", t)
+		}
+		if s, ok := volume["source"]; ok {
+			source = fmt.Sprint(s)
+		}
+		target = fmt.Sprint(volume["target"])
+		readOnly, _ = volume["read_only"].(bool)
+	default:
+		return "", "", false, fmt.Errorf("invalid volume %v", v)
+	}
+
+	if strings.HasPrefix(source, ".") || strings.HasPrefix(source, "/") || strings.HasPrefix(source, "~") {
+		return "", "", false, fmt.Errorf("bind mount %s is not supported, use a named volume", source)
+	}
+	if !strings.HasPrefix(target, "/") {
+		return "", "", false, fmt.Errorf("an absolute path is required, got %s", target)
+	}
+	return source, target, readOnly, nil
+}
+
+// parseComposeBytes parses the byte values of compose, e.g. 512m, 1gb, 1024
+func parseComposeBytes(value string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	v = strings.TrimSuffix(v, "b")
+	multiplier := int64(1)
+	if len(v) > 0 {
+		switch v[len(v)-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			v = v[:len(v)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
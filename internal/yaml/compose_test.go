@@ -0,0 +1,234 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestIsComposeFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/tmp/space/docker-compose.yml", true},
+		{"Compose.YAML", true},
+		{"/tmp/space/deploy.yaml", false},
+		{"/tmp/docker-compose.yml/deploy.yaml", false},
+	}
+	for _, tt := range tests {
+		if got := IsComposeFile(tt.path); got != tt.want {
+			t.Errorf("IsComposeFile(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseCompose(t *testing.T) {
+	cr, err := ParseCompose([]byte(`
+services:
+  web:
+    image: nginx
+    command: nginx -g "daemon off;"
+    environment:
+      MODE: prod
+      EMPTY:
+    ports: ["8080:80"]
+    depends_on:
+      api:
+        condition: service_started
+    volumes: ["data:/data:ro", "/cache"]
+    restart: on-failure
+    deploy:
+      replicas: 2
+      resources:
+        reservations:
+          devices:
+            - capabilities: [gpu]
+              count: 1
+  api:
+    image: api
+    environment: ["DB=db:5432"]
+    expose: [3000]
+    depends_on: [db]
+    deploy:
+      resources:
+        limits: {cpus: "0.25", memory: 1g}
+  db:
+    image: postgres
+volumes:
+  data: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cr) != 1 {
+		t.Fatalf("ParseCompose() returned %d containers, want 1", len(cr))
+	}
+	main := cr[0]
+	if main.Name != "web" || main.ImageName != "nginx" || main.Count != 2 || main.RestartPolicy != corev1.RestartPolicyOnFailure {
+		t.Errorf("main = %s %s count %d restart %s, want web nginx count 2 restart OnFailure", main.Name, main.ImageName, main.Count, main.RestartPolicy)
+	}
+	if got := strings.Join(main.Args, " "); got != `nginx -g "daemon off;"` {
+		t.Errorf("args = %s", got)
+	}
+	if len(main.Env) != 2 || main.Env[0].Name != "EMPTY" || main.Env[1].Value != "prod" {
+		t.Errorf("env = %v, want EMPTY= and MODE=prod", main.Env)
+	}
+	if len(main.Ports) != 1 || main.Ports[0].ContainerPort != 80 || main.Ports[0].HostPort != 8080 {
+		t.Errorf("ports = %v, want 8080:80", main.Ports)
+	}
+	if gpu := main.Resources.Limits[resourceGpu]; gpu.Value() != 1 {
+		t.Errorf("gpu limit = %s, want 1", gpu.String())
+	}
+	if len(main.VolumeMountList) != 2 || !main.VolumeMountList[0].ReadOnly || main.VolumeMountList[1].Name != "web-anonymous-1" {
+		t.Errorf("volume mounts = %v", main.VolumeMountList)
+	}
+	if len(main.Volumes) != 2 {
+		t.Errorf("volumes = %v, want data and the anonymous one", main.Volumes)
+	}
+	if got := strings.Join(main.HostAliases, ","); got != "api,db,web" {
+		t.Errorf("host aliases = %s", got)
+	}
+
+	// the depends start in their order, and a depend without limits gets the default ones
+	if len(main.Depends) != 2 || main.Depends[0].Name != "db" || main.Depends[1].Name != "api" {
+		t.Fatalf("depends = %v, want db then api", main.Depends)
+	}
+	db, api := main.Depends[0], main.Depends[1]
+	if cpu := db.Resources.Limits[corev1.ResourceCPU]; cpu.String() != composeDefaultCpu {
+		t.Errorf("db cpu limit = %s, want %s", cpu.String(), composeDefaultCpu)
+	}
+	if cpu, memory := api.Resources.Limits[corev1.ResourceCPU], api.Resources.Limits[corev1.ResourceMemory]; cpu.MilliValue() != 250 || memory.Value() != 1<<30 {
+		t.Errorf("api limits = %s %s, want 250m 1Gi", cpu.String(), memory.String())
+	}
+	if len(api.Ports) != 1 || api.Ports[0].ContainerPort != 3000 || api.Ports[0].HostPort != 0 {
+		t.Errorf("api ports = %v, want 3000 without a host port", api.Ports)
+	}
+}
+
+func TestParseComposeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		yaml   string
+		errors []string // the substrings of the expected errors
+	}{
+		{"no services", "version: \"3\"\n", []string{"at least one service"}},
+		{"build", "services:\n  web:\n    build: .\n", []string{"build is not supported"}},
+		{"no entry service", `
+services:
+  web:
+    image: nginx
+  api:
+    image: api
+`, []string{"can not decide the entry service"}},
+		{"circular dependency", `
+services:
+  web:
+    image: nginx
+    ports: ["80"]
+    depends_on: [api]
+  api:
+    image: api
+    depends_on: [db]
+  db:
+    image: postgres
+    depends_on: [api]
+`, []string{"circular dependency"}},
+		{"depend options", `
+services:
+  web:
+    image: nginx
+    depends_on: [api, cache]
+  api:
+    image: api
+    restart: "no"
+    deploy:
+      resources:
+        reservations:
+          devices:
+            - driver: nvidia
+              count: all
+`, []string{"service cache is not defined", "count: all is only supported on the entry service", "restart is only supported on the entry service"}},
+		{"bind mount and bad values", `
+services:
+  web:
+    image: nginx
+    ports: ["8000-8010:80"]
+    volumes: ["./html:/usr/share/nginx/html", "logs:/logs"]
+    deploy:
+      resources:
+        limits: {cpus: x, memory: lots}
+        reservations:
+          devices:
+            - capabilities: [tpu]
+`, []string{"port ranges are not supported", "bind mount ./html is not supported", "volume logs is not defined",
+			"invalid cpus", "invalid memory", "only gpu devices are supported"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCompose([]byte(tt.yaml))
+			verr, ok := AsValidationError(err)
+			if !ok {
+				t.Fatalf("ParseCompose() error = %v, want a ValidationError", err)
+			}
+			all := strings.Join(verr.Errors, "; ")
+			for _, want := range tt.errors {
+				if !strings.Contains(all, want) {
+					t.Errorf("ParseCompose() errors = %s, want %q", all, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseComposePort(t *testing.T) {
+	tests := []struct {
+		port      interface{}
+		container int32
+		host      int32
+		protocol  corev1.Protocol
+		wantErr   bool
+	}{
+		{80, 80, 0, corev1.ProtocolTCP, false},
+		{"8080:80", 80, 8080, corev1.ProtocolTCP, false},
+		{"127.0.0.1:5353:53/udp", 53, 5353, corev1.ProtocolUDP, false},
+		{map[interface{}]interface{}{"target": 80, "published": 8080, "protocol": "tcp"}, 80, 8080, corev1.ProtocolTCP, false},
+		{"80/sctp", 0, 0, "", true},
+		{"70000", 0, 0, "", true},
+		{"abc:80", 0, 0, "", true},
+		{3.5, 0, 0, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseComposePort(tt.port)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseComposePort(%v) error = %v, wantErr %v", tt.port, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (got.ContainerPort != tt.container || got.HostPort != tt.host || got.Protocol != tt.protocol) {
+			t.Errorf("parseComposePort(%v) = %d:%d/%s, want %d:%d/%s", tt.port, got.HostPort, got.ContainerPort, got.Protocol, tt.host, tt.container, tt.protocol)
+		}
+	}
+}
+
+func TestParseComposeBytes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"512m", 512 << 20, false},
+		{"1gb", 1 << 30, false},
+		{"1.5G", 3 << 29, false},
+		{"64KB", 64 << 10, false},
+		{"0", 0, true},
+		{"lots", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseComposeBytes(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseComposeBytes(%s) = %d, %v, want %d, wantErr %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
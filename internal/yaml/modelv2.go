@@ -1,9 +1,11 @@
 package yaml
 
 import (
-	"gopkg.in/errgo.v2/errors"
-	corev1 "k8s.io/api/core/v1"
 	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
@@ -11,22 +13,17 @@ const (
 )
 
 type DeployYamlV2 struct {
-	Version     string                `yaml:"version"`
-	ServiceType string                `yaml:"type"`
-	Services    map[string]Service    `yaml:"services"`
-	Profiles    Profiles              `yaml:"profiles"`
-	Deployment  map[string]Deployment `yaml:"deployment"`
-}
-
-func (dy *DeployYamlV2) checkRequired() error {
-	if len(dy.Services) <= 0 {
-		return errors.New("at least one service must be defined")
-	}
-	return nil
+	Version     string                       `yaml:"version"`
+	ServiceType string                       `yaml:"type"`
+	Services    map[string]Service           `yaml:"services"`
+	Profiles    Profiles                     `yaml:"profiles"`
+	Deployment  map[string]Deployment        `yaml:"deployment"`
+	Volumes     map[string]Volume            `yaml:"volumes"`
+	Secrets     map[string]map[string]string `yaml:"secrets"` // rejected, the space repo is public so secrets are referenced by secretRef
 }
 
 func (dy *DeployYamlV2) ServiceToK8sResource() ([]ContainerResource, error) {
-	if err := dy.checkRequired(); err != nil {
+	if err := dy.validate(); err != nil {
 		return nil, err
 	}
 	var containers []ContainerResource
@@ -84,6 +81,8 @@ func (dy *DeployYamlV2) ServiceToK8sResource() ([]ContainerResource, error) {
 						container.ReadyCmd = service.ReadyCmd
 					}
 
+					container.applyExtensions(service)
+
 					if deployment.Akash.Count != 0 {
 						container.Count = deployment.Akash.Count
 					}
@@ -133,6 +132,10 @@ func (dy *DeployYamlV2) ServiceToK8sResource() ([]ContainerResource, error) {
 				}
 			}
 			containerNew.Models = service.Models
+			containerNew.applyExtensions(service)
+			containerNew.RestartPolicy = getRestartPolicy(service.Restart)
+			containerNew.Volumes = dy.namedVolumes()
+			containerNew.Secrets = dy.secretRefs()
 		}
 
 		containerNew.ResourceLimit = make(corev1.ResourceList)
@@ -174,8 +177,73 @@ type Service struct {
 		Name string `yaml:"name"`
 		Path string `yaml:"path"`
 	} `yaml:"config"`
-	ReadyCmd []string        `yaml:"ready-cmd"`
-	Models   []ModelResource `yaml:"models"`
+	ReadyCmd       []string          `yaml:"ready-cmd"`
+	Models         []ModelResource   `yaml:"models"`
+	LivenessProbe  *Probe            `yaml:"liveness-probe"`
+	ReadinessProbe *Probe            `yaml:"readiness-probe"`
+	Volumes        []VolumeMount     `yaml:"volumes"`
+	SecretEnv      []SecretEnv       `yaml:"secret-env"`
+	Resources      *ServiceResources `yaml:"resources"`
+	InitContainers []InitContainer   `yaml:"init-containers"`
+	Restart        string            `yaml:"restart"` // always(default), on-failure, no
+}
+
+type Probe struct {
+	Exec    []string `yaml:"exec"`
+	HttpGet *struct {
+		Path string `yaml:"path"`
+		Port int    `yaml:"port"`
+	} `yaml:"http-get"`
+	TcpPort          int `yaml:"tcp-port"`
+	InitialDelay     int `yaml:"initial-delay"`
+	Period           int `yaml:"period"`
+	Timeout          int `yaml:"timeout"`
+	FailureThreshold int `yaml:"failure-threshold"`
+}
+
+// Volume is a named volume shared by the containers of the deployment, it is removed with the job
+type Volume struct {
+	Size string `yaml:"size"`
+}
+
+type VolumeMount struct {
+	Name     string `yaml:"name"`
+	Path     string `yaml:"path"`
+	ReadOnly bool   `yaml:"read-only"`
+}
+
+// SecretEnv sets the env from a key of a secret in the secret store of the cp, referenced as "name/key",
+// so the value is never written into the deployment
+type SecretEnv struct {
+	Name      string `yaml:"name"`
+	SecretRef string `yaml:"secretRef"`
+}
+
+// splitSecretRef splits "name/key" into the name of the secret and the key
+func splitSecretRef(secretRef string) (string, string, bool) {
+	name, key, found := strings.Cut(secretRef, "/")
+	if !found || name == "" || key == "" || strings.Contains(key, "/") {
+		return "", "", false
+	}
+	return name, key, true
+}
+
+type ServiceResources struct {
+	Requests ResourceValue `yaml:"requests"`
+	Limits   ResourceValue `yaml:"limits"`
+}
+
+type ResourceValue struct {
+	Cpu    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+}
+
+type InitContainer struct {
+	Name    string   `yaml:"name"`
+	Image   string   `yaml:"image"`
+	Command []string `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Env     []string `yaml:"env"`
 }
 
 type Expose struct {
@@ -239,3 +307,142 @@ type ModelResource struct {
 	Url  string `yaml:"url"`
 	Dir  string `yaml:"dir"`
 }
+
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNo        = "no"
+)
+
+func getRestartPolicy(restart string) corev1.RestartPolicy {
+	switch restart {
+	case RestartOnFailure:
+		return corev1.RestartPolicyOnFailure
+	case RestartNo:
+		return corev1.RestartPolicyNever
+	default:
+		return corev1.RestartPolicyAlways
+	}
+}
+
+// applyExtensions converts the probes, volumes, secret env, resources and init containers of the service,
+// the service has been validated so the values can be parsed without checking errors
+func (c *ContainerResource) applyExtensions(service Service) {
+	c.LivenessProbe = service.LivenessProbe.toK8s()
+	c.ReadinessProbe = service.ReadinessProbe.toK8s()
+
+	for _, v := range service.Volumes {
+		c.VolumeMountList = append(c.VolumeMountList, corev1.VolumeMount{
+			Name:      v.Name,
+			MountPath: v.Path,
+			ReadOnly:  v.ReadOnly,
+		})
+	}
+
+	for _, secretEnv := range service.SecretEnv {
+		name, key, _ := splitSecretRef(secretEnv.SecretRef)
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name: secretEnv.Name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: name},
+					Key:                  key,
+				},
+			},
+		})
+	}
+
+	if service.Resources != nil {
+		c.Resources = &corev1.ResourceRequirements{
+			Requests: service.Resources.Requests.toK8s(),
+			Limits:   service.Resources.Limits.toK8s(),
+		}
+	}
+
+	for _, initContainer := range service.InitContainers {
+		c.InitContainers = append(c.InitContainers, corev1.Container{
+			Name:            initContainer.Name,
+			Image:           initContainer.Image,
+			Command:         initContainer.Command,
+			Args:            initContainer.Args,
+			Env:             parseEnv(initContainer.Env),
+			ImagePullPolicy: corev1.PullIfNotPresent,
+		})
+	}
+}
+
+// secretRefs returns the keys referenced of each secret by all the services, they are resolved when deploying
+func (dy *DeployYamlV2) secretRefs() map[string][]string {
+	refs := make(map[string][]string)
+	for _, name := range sortedKeys(dy.Services) {
+		for _, secretEnv := range dy.Services[name].SecretEnv {
+			secretName, key, _ := splitSecretRef(secretEnv.SecretRef)
+			refs[secretName] = append(refs[secretName], key)
+		}
+	}
+	return refs
+}
+
+func (dy *DeployYamlV2) namedVolumes() []corev1.Volume {
+	var volumes []corev1.Volume
+	for _, name := range sortedKeys(dy.Volumes) {
+		emptyDir := &corev1.EmptyDirVolumeSource{}
+		if size := dy.Volumes[name].Size; size != "" {
+			sizeLimit := resource.MustParse(size)
+			emptyDir.SizeLimit = &sizeLimit
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{EmptyDir: emptyDir},
+		})
+	}
+	return volumes
+}
+
+func (p *Probe) toK8s() *corev1.Probe {
+	if p == nil {
+		return nil
+	}
+	probe := &corev1.Probe{
+		InitialDelaySeconds: int32(p.InitialDelay),
+		PeriodSeconds:       int32(p.Period),
+		TimeoutSeconds:      int32(p.Timeout),
+		FailureThreshold:    int32(p.FailureThreshold),
+	}
+	switch {
+	case len(p.Exec) > 0:
+		probe.Exec = &corev1.ExecAction{Command: p.Exec}
+	case p.HttpGet != nil:
+		probe.HTTPGet = &corev1.HTTPGetAction{
+			Path: p.HttpGet.Path,
+			Port: intstr.FromInt(p.HttpGet.Port),
+		}
+	default:
+		probe.TCPSocket = &corev1.TCPSocketAction{Port: intstr.FromInt(p.TcpPort)}
+	}
+	return probe
+}
+
+func (r ResourceValue) toK8s() corev1.ResourceList {
+	list := make(corev1.ResourceList)
+	if r.Cpu != "" {
+		list[corev1.ResourceCPU] = resource.MustParse(r.Cpu)
+	}
+	if r.Memory != "" {
+		list[corev1.ResourceMemory] = resource.MustParse(r.Memory)
+	}
+	return list
+}
+
+func parseEnv(envs []string) []corev1.EnvVar {
+	var envVars []corev1.EnvVar
+	for _, env := range envs {
+		trimSpaceEnv := strings.TrimSpace(env)
+		index := strings.Index(trimSpaceEnv, "=")
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  trimSpaceEnv[:index],
+			Value: trimSpaceEnv[index+1:],
+		})
+	}
+	return envVars
+}
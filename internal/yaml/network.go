@@ -69,7 +69,7 @@ func GetNetSegment() ([]string, error) {
 func parseNetplanFile(filepath string, config *NetplanConfig) error {
 	data, err := os.ReadFile(filepath)
 	if err != nil {
-		return fmt.Errorf("failed to read file, name: %s, error: %v", err)
+		return fmt.Errorf("failed to read file, name: %s, error: %v", filepath, err)
 	}
 	return yaml.Unmarshal(data, config)
 }
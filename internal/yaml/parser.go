@@ -22,6 +22,16 @@ type ContainerResource struct {
 	GpuModel      string
 	Models        []ModelResource
 	ServiceType   string
+
+	LivenessProbe   *corev1.Probe
+	ReadinessProbe  *corev1.Probe
+	VolumeMountList []corev1.VolumeMount
+	Volumes         []corev1.Volume     // the named volumes of the deployment, only set on the main service
+	Secrets         map[string][]string // the keys referenced of each secret of the cp secret store, only set on the main service
+	Resources       *corev1.ResourceRequirements
+	InitContainers  []corev1.Container
+	RestartPolicy   corev1.RestartPolicy
+	HostAliases     []string // the service names of a compose file, resolved to the pod itself
 }
 
 type ConfigFile struct {
@@ -70,20 +80,24 @@ func HandlerYaml(yamlFilePath string) ([]ContainerResource, error) {
 		return nil, fmt.Errorf("failed unable to read file, %w", err)
 	}
 
+	if IsComposeFile(yamlFilePath) {
+		return ParseCompose(yamlFile)
+	}
+
 	var containerResources []ContainerResource
 	version, _ := getYAMLFileVersion(yamlFile)
 	switch version {
 	case "2.0":
 		parser := &ParserYamlV2{}
 		if err = parser.Parse(yamlFile); err != nil {
-			return nil, fmt.Errorf("failed unable to parse YAML file, %w", err)
+			return nil, fmt.Errorf("failed unable to parse YAML file, %w", &ValidationError{Errors: []string{err.Error()}})
 		}
 		containerResources, err = parser.config.ServiceToK8sResource()
 		if err != nil {
 			return nil, fmt.Errorf("failed unable to parse YAML file for k8s, %w", err)
 		}
 	default:
-		return nil, fmt.Errorf("not support yaml version: %d", version)
+		return nil, &ValidationError{Errors: []string{fmt.Sprintf("version: not support yaml version: %s", version)}}
 	}
 	return containerResources, err
 }
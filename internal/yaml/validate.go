@@ -0,0 +1,227 @@
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ValidationError lists every schema problem of the deployment yaml, so the user can fix them at once
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid deployment yaml: " + strings.Join(e.Errors, "; ")
+}
+
+func (e *ValidationError) add(field, format string, a ...interface{}) {
+	e.Errors = append(e.Errors, field+": "+fmt.Sprintf(format, a...))
+}
+
+// AsValidationError returns the ValidationError wrapped in err, if any
+func AsValidationError(err error) (*ValidationError, bool) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr, true
+	}
+	return nil, false
+}
+
+func (dy *DeployYamlV2) validate() error {
+	verr := new(ValidationError)
+	if len(dy.Services) <= 0 {
+		verr.add("services", "at least one service must be defined")
+	}
+
+	for _, name := range sortedKeys(dy.Volumes) {
+		if size := dy.Volumes[name].Size; size != "" {
+			if _, err := resource.ParseQuantity(size); err != nil {
+				verr.add("volumes."+name+".size", "invalid quantity %q", size)
+			}
+		}
+		checkName(verr, "volumes."+name, name)
+	}
+
+	if len(dy.Secrets) > 0 {
+		verr.add("secrets", "secret values must not be written into the deployment, reference them with secret-env secretRef: name/key")
+	}
+
+	dependServices := make(map[string]bool)
+	for _, name := range sortedKeys(dy.Services) {
+		for _, depend := range dy.Services[name].DependsOn {
+			dependServices[depend] = true
+		}
+	}
+
+	for _, name := range sortedKeys(dy.Services) {
+		dy.validateService(verr, name, dy.Services[name], dependServices[name])
+	}
+
+	for _, name := range sortedKeys(dy.Deployment) {
+		if _, ok := dy.Services[name]; !ok {
+			verr.add("deployment."+name, "service %s is not defined", name)
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (dy *DeployYamlV2) validateService(verr *ValidationError, name string, service Service, isDepend bool) {
+	field := "services." + name
+	checkName(verr, field, name)
+	if service.Image == "" {
+		verr.add(field+".image", "image is required")
+	}
+	checkEnv(verr, field+".env", service.Env)
+
+	for _, depend := range service.DependsOn {
+		if _, ok := dy.Services[depend]; !ok {
+			verr.add(field+".depends-on", "service %s is not defined", depend)
+		}
+	}
+	for i, expose := range service.Expose {
+		if expose.Port <= 0 || expose.Port > 65535 {
+			verr.add(fmt.Sprintf("%s.expose[%d].port", field, i), "port %d is out of range", expose.Port)
+		}
+		if expose.Protocol != "" && expose.Protocol != "tcp" && expose.Protocol != "udp" {
+			verr.add(fmt.Sprintf("%s.expose[%d].protocol", field, i), "protocol must be tcp or udp")
+		}
+	}
+	if (service.Config.Name == "") != (service.Config.Path == "") {
+		verr.add(field+".config", "both name and path are required")
+	}
+
+	checkProbe(verr, field+".liveness-probe", service.LivenessProbe)
+	checkProbe(verr, field+".readiness-probe", service.ReadinessProbe)
+
+	for i, v := range service.Volumes {
+		if _, ok := dy.Volumes[v.Name]; !ok {
+			verr.add(fmt.Sprintf("%s.volumes[%d]", field, i), "volume %s is not defined in volumes", v.Name)
+		}
+		if !strings.HasPrefix(v.Path, "/") {
+			verr.add(fmt.Sprintf("%s.volumes[%d].path", field, i), "an absolute path is required")
+		}
+	}
+
+	for i, secretEnv := range service.SecretEnv {
+		envField := fmt.Sprintf("%s.secret-env[%d]", field, i)
+		if secretEnv.Name == "" {
+			verr.add(envField+".name", "name is required")
+		}
+		name, key, ok := splitSecretRef(secretEnv.SecretRef)
+		if !ok {
+			verr.add(envField+".secretRef", "%q is not a reference in the form name/key", secretEnv.SecretRef)
+			continue
+		}
+		checkName(verr, envField+".secretRef", name)
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			verr.add(envField+".secretRef", "%s", strings.Join(errs, ", "))
+		}
+	}
+
+	if service.Resources != nil {
+		requests := checkResourceValue(verr, field+".resources.requests", service.Resources.Requests)
+		limits := checkResourceValue(verr, field+".resources.limits", service.Resources.Limits)
+		for resourceName, request := range requests {
+			if limit, ok := limits[resourceName]; ok && request.Cmp(limit) > 0 {
+				verr.add(field+".resources", "%s request is greater than the limit", resourceName)
+			}
+		}
+	}
+
+	for i, initContainer := range service.InitContainers {
+		initField := fmt.Sprintf("%s.init-containers[%d]", field, i)
+		checkName(verr, initField+".name", initContainer.Name)
+		if initContainer.Image == "" {
+			verr.add(initField+".image", "image is required")
+		}
+		checkEnv(verr, initField+".env", initContainer.Env)
+	}
+
+	switch service.Restart {
+	case "", RestartAlways:
+	case RestartOnFailure, RestartNo:
+		// the containers of a deployment share one pod, so only the main service decides the restart policy
+		if isDepend {
+			verr.add(field+".restart", "restart is only supported on the main service")
+		}
+	default:
+		verr.add(field+".restart", "restart must be one of %s, %s, %s", RestartAlways, RestartOnFailure, RestartNo)
+	}
+}
+
+func checkName(verr *ValidationError, field, name string) {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		verr.add(field, "invalid name %q, %s", name, strings.Join(errs, ", "))
+	}
+}
+
+func checkEnv(verr *ValidationError, field string, envs []string) {
+	for i, env := range envs {
+		if strings.Index(strings.TrimSpace(env), "=") <= 0 {
+			verr.add(fmt.Sprintf("%s[%d]", field, i), "env must be in the form of KEY=VALUE")
+		}
+	}
+}
+
+func checkProbe(verr *ValidationError, field string, probe *Probe) {
+	if probe == nil {
+		return
+	}
+	var handlers int
+	if len(probe.Exec) > 0 {
+		handlers++
+	}
+	if probe.HttpGet != nil {
+		handlers++
+		if probe.HttpGet.Port <= 0 || probe.HttpGet.Port > 65535 {
+			verr.add(field+".http-get.port", "port %d is out of range", probe.HttpGet.Port)
+		}
+	}
+	if probe.TcpPort != 0 {
+		handlers++
+		if probe.TcpPort < 0 || probe.TcpPort > 65535 {
+			verr.add(field+".tcp-port", "port %d is out of range", probe.TcpPort)
+		}
+	}
+	if handlers != 1 {
+		verr.add(field, "exactly one of exec, http-get and tcp-port is required")
+	}
+	if probe.InitialDelay < 0 || probe.Period < 0 || probe.Timeout < 0 || probe.FailureThreshold < 0 {
+		verr.add(field, "initial-delay, period, timeout and failure-threshold must not be negative")
+	}
+}
+
+func checkResourceValue(verr *ValidationError, field string, value ResourceValue) map[string]resource.Quantity {
+	quantities := make(map[string]resource.Quantity)
+	for _, item := range []struct{ resourceName, v string }{{"cpu", value.Cpu}, {"memory", value.Memory}} {
+		resourceName, v := item.resourceName, item.v
+		if v == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(v)
+		if err != nil {
+			verr.add(field+"."+resourceName, "invalid quantity %q", v)
+			continue
+		}
+		quantities[resourceName] = quantity
+	}
+	return quantities
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
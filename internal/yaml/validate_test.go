@@ -0,0 +1,155 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	const valid = `
+version: "2.0"
+services:
+  web:
+    image: nginx
+    env: ["MODE=prod"]
+    expose:
+      - port: 80
+    depends-on: [db]
+    volumes:
+      - name: data
+        path: /data
+    secret-env:
+      - name: DB_PASSWORD
+        secretRef: db/password
+    resources:
+      requests: {cpu: 500m, memory: 256Mi}
+      limits: {cpu: "1", memory: 512Mi}
+    liveness-probe:
+      http-get: {path: /healthz, port: 80}
+  db:
+    image: postgres
+volumes:
+  data:
+    size: 1Gi
+deployment:
+  web:
+    lagrange: {profile: web, count: 1}
+`
+	tests := []struct {
+		name   string
+		yaml   string
+		fields []string // the fields of the expected errors, none for a valid yaml
+	}{
+		{"valid", valid, nil},
+		{"no services", "version: \"2.0\"\n", []string{"services"}},
+		{"inline secrets", valid + "secrets:\n  db:\n    password: secret\n", []string{"secrets"}},
+		{"missing image and bad name", `
+services:
+  Web_1:
+    env: ["NOVALUE"]
+`, []string{"services.Web_1", "services.Web_1.image", "services.Web_1.env[0]"}},
+		{"undefined references", `
+services:
+  web:
+    image: nginx
+    depends-on: [db]
+    volumes:
+      - name: data
+        path: data
+deployment:
+  api: {}
+`, []string{"services.web.depends-on", "services.web.volumes[0]", "services.web.volumes[0].path", "deployment.api"}},
+		{"bad ports", `
+services:
+  web:
+    image: nginx
+    expose:
+      - port: 70000
+        protocol: sctp
+`, []string{"services.web.expose[0].port", "services.web.expose[0].protocol"}},
+		{"bad secret refs", `
+services:
+  web:
+    image: nginx
+    secret-env:
+      - secretRef: db
+      - name: TOKEN
+        secretRef: Bad_Name/key
+`, []string{"services.web.secret-env[0].name", "services.web.secret-env[0].secretRef", "services.web.secret-env[1].secretRef"}},
+		{"request above the limit", `
+services:
+  web:
+    image: nginx
+    resources:
+      requests: {cpu: "2", memory: 1x}
+      limits: {cpu: "1"}
+`, []string{"services.web.resources.requests.memory", "services.web.resources"}},
+		{"probe with two handlers", `
+services:
+  web:
+    image: nginx
+    readiness-probe:
+      exec: ["true"]
+      tcp-port: 80
+      period: -1
+`, []string{"services.web.readiness-probe", "services.web.readiness-probe"}},
+		{"restart of a depend", `
+services:
+  web:
+    image: nginx
+    depends-on: [db]
+    restart: no-way
+  db:
+    image: postgres
+    restart: on-failure
+`, []string{"services.db.restart", "services.web.restart"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := &ParserYamlV2{}
+			if err := parser.Parse([]byte(tt.yaml)); err != nil {
+				t.Fatal(err)
+			}
+			err := parser.config.validate()
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+				return
+			}
+			verr, ok := AsValidationError(err)
+			if !ok {
+				t.Fatalf("validate() error = %v, want a ValidationError", err)
+			}
+			if len(verr.Errors) != len(tt.fields) {
+				t.Fatalf("validate() errors = %q, want the fields %q", verr.Errors, tt.fields)
+			}
+			for i, field := range tt.fields {
+				if !strings.HasPrefix(verr.Errors[i], field+": ") {
+					t.Errorf("error %d = %q, want field %s", i, verr.Errors[i], field)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitSecretRef(t *testing.T) {
+	tests := []struct {
+		secretRef string
+		name      string
+		key       string
+		ok        bool
+	}{
+		{"db/password", "db", "password", true},
+		{"db", "", "", false},
+		{"/password", "", "", false},
+		{"db/", "", "", false},
+		{"db/a/b", "", "", false},
+	}
+	for _, tt := range tests {
+		name, key, ok := splitSecretRef(tt.secretRef)
+		if name != tt.name || key != tt.key || ok != tt.ok {
+			t.Errorf("splitSecretRef(%q) = %q, %q, %v, want %q, %q, %v", tt.secretRef, name, key, ok, tt.name, tt.key, tt.ok)
+		}
+	}
+}
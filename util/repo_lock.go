@@ -0,0 +1,40 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// repoLockFile is locked by the running cp for its whole life, the lock is released by the kernel when the process exits
+const repoLockFile = "repo.lock"
+
+// ErrRepoLocked means another process, usually the running cp, holds the lock of $CP_PATH
+var ErrRepoLocked = errors.New("the CP_PATH is in use by a running computing-provider")
+
+// lockedRepos keeps the locked files referenced, the finalizer of a dropped file would close it and release the lock
+var lockedRepos sync.Map
+
+// LockRepo takes the lock of the repo without waiting, the returned func releases it
+func LockRepo(cpRepoPath string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(cpRepoPath, repoLockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the repo lock, error: %v", err)
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrRepoLocked
+		}
+		return nil, fmt.Errorf("failed to lock the repo, error: %v", err)
+	}
+	lockedRepos.Store(f, struct{}{})
+	return func() {
+		lockedRepos.Delete(f)
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
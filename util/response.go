@@ -67,6 +67,13 @@ const (
 	CheckPriceError            = 4024
 	BelowPriceError            = 4025
 	ReadPriceError             = 4026
+	UnauthorizedError          = 4027
+	ReplayRequestError         = 4028
+	TooManyRequestsError       = 4029
+	YamlValidationError        = 4030
+	JobNotUpdatableError       = 4031
+	ImagePolicyError           = 4032
+	MaintenanceError           = 4033
 
 	ProofParamError   = 7001
 	ProofReadLogError = 7002
@@ -109,6 +116,13 @@ var codeMsg = map[int]string{
 	NotAcceptNodePortError:     "not accept node port type job",
 	RpcConnectError:            "An error occurred while connect rpc",
 	ReadPriceError:             "An error occurred while read price info",
+	UnauthorizedError:          "Unauthorized request, invalid or missing api token",
+	ReplayRequestError:         "The request is expired or has already been processed",
+	TooManyRequestsError:       "Too many requests, please try again later",
+	YamlValidationError:        "The deployment yaml is invalid",
+	JobNotUpdatableError:       "The job can not be updated",
+	ImagePolicyError:           "The image is not allowed by the image policy",
+	MaintenanceError:           "The cp is under maintenance and does not accept new tasks",
 
 	ProofReadLogError: "An error occurred while read the log of proof",
 	ProofError:        "An error occurred while executing the calculation task",
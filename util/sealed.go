@@ -0,0 +1,105 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// sealKeyFile is the key of the values sealed in the database of the cp, it never leaves $CP_PATH
+const sealKeyFile = "seal.key"
+
+var sealKey struct {
+	sync.Mutex
+	key []byte
+}
+
+// loadSealKey reads the key of $CP_PATH, it is generated on the first use
+func loadSealKey() ([]byte, error) {
+	sealKey.Lock()
+	defer sealKey.Unlock()
+	if sealKey.key != nil {
+		return sealKey.key, nil
+	}
+
+	cpRepoPath, _ := os.LookupEnv("CP_PATH")
+	keyPath := filepath.Join(cpRepoPath, sealKeyFile)
+	data, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		key := make([]byte, 32)
+		if _, err = io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		if err = os.WriteFile(keyPath, []byte(hex.EncodeToString(key)), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save the seal key, error: %v", err)
+		}
+		sealKey.key = key
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the seal key, error: %v", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("the seal key %s is invalid", keyPath)
+	}
+	sealKey.key = key
+	return key, nil
+}
+
+// Seal encrypts the value with the key of the cp by AES-GCM, so the secrets are not kept in plaintext in the database
+func Seal(plain []byte) (string, error) {
+	key, err := loadSealKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGcm(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// Unseal decrypts a value sealed by Seal
+func Unseal(sealed string) ([]byte, error) {
+	key, err := loadSealKey()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("the sealed value is invalid, error: %v", err)
+	}
+	gcm, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("the sealed value is too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal the value, error: %v", err)
+	}
+	return plain, nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
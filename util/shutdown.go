@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
-	"github.com/swanchain/go-computing-provider/conf"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,6 +11,9 @@ import (
 	"time"
 )
 
+// shutdownTimeout bounds how long each component may take to stop, such as the deployments in flight
+const shutdownTimeout = 2 * time.Minute
+
 type StopFunc func(context.Context) error
 
 type ShutdownHandler struct {
@@ -35,7 +37,10 @@ func MonitorShutdown(triggerCh <-chan struct{}, handlers ...ShutdownHandler) <-c
 
 		// Call all the handlers, logging on failure and success.
 		for _, h := range handlers {
-			if err := h.StopFunc(context.TODO()); err != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			err := h.StopFunc(ctx)
+			cancel()
+			if err != nil {
 				logs.GetLogger().Errorf("shutting down %s failed: %s", h.Component, err)
 				continue
 			}
@@ -60,16 +65,30 @@ func ServeHttp(h http.Handler, name string, addr string, ssl bool) (StopFunc, er
 		ReadHeaderTimeout: 60 * time.Second,
 	}
 
-	go func() {
-		if ssl {
-			certFile := conf.GetConfig().LOG.CrtFile
-			keyFile := conf.GetConfig().LOG.KeyFile
-			if _, err := os.Stat(certFile); err != nil {
-				logs.GetLogger().Fatalf("need to manually generate the wss authentication certificate. error: %v", err)
-				return
+	var challengeSrv *http.Server
+	if ssl {
+		tlsConfig, challengeHandler, err := NewTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = tlsConfig
+		if challengeHandler != nil {
+			challengeSrv = &http.Server{
+				Addr:              ":80",
+				Handler:           challengeHandler,
+				ReadHeaderTimeout: 60 * time.Second,
 			}
+			go func() {
+				if err := challengeSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logs.GetLogger().Errorf("failed to serve acme http-01 challenge on port 80, error: %v", err)
+				}
+			}()
+		}
+	}
 
-			if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	go func() {
+		if ssl {
+			if err := srv.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				logs.GetLogger().Fatalf("service: %s, listen: %s\n", name, err)
 			}
 		} else {
@@ -79,5 +98,12 @@ func ServeHttp(h http.Handler, name string, addr string, ssl bool) (StopFunc, er
 		}
 	}()
 
-	return srv.Shutdown, nil
+	return func(ctx context.Context) error {
+		if challengeSrv != nil {
+			if err := challengeSrv.Shutdown(ctx); err != nil {
+				logs.GetLogger().Errorf("failed to shut down the acme challenge server, error: %v", err)
+			}
+		}
+		return srv.Shutdown(ctx)
+	}, nil
 }
@@ -0,0 +1,156 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-mcs-sdk/mcs/api/common/logs"
+	"github.com/swanchain/go-computing-provider/conf"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const certCheckInterval = 30 * time.Second
+
+// certReloader serves the certificate from disk and reloads it when the files are changed,
+// so a renewed certificate is used without restarting the process.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate, cert: %s, key: %s, error: %v", r.certFile, r.keyFile, err)
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	needCheck := time.Since(r.lastCheck) > certCheckInterval
+	if needCheck {
+		r.lastCheck = time.Now()
+	}
+	r.mu.Unlock()
+
+	if needCheck {
+		if modTime, err := r.latestModTime(); err == nil && modTime.After(r.currentModTime()) {
+			if err = r.reload(); err != nil {
+				logs.GetLogger().Errorf("failed to reload certificate, keep using the old one, error: %v", err)
+			} else {
+				logs.GetLogger().Infof("certificate %s reloaded", r.certFile)
+			}
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) currentModTime() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.modTime
+}
+
+// NewTLSConfig builds the server tls config from the LOG and TLS sections of config.toml. With TLS.Acme it also
+// returns the handler of the http-01 challenge, which the caller serves on port 80 and stops with the server.
+func NewTLSConfig() (*tls.Config, http.Handler, error) {
+	cfg := conf.GetConfig()
+
+	var tlsConfig *tls.Config
+	var challengeHandler http.Handler
+	if cfg.TLS.Acme {
+		host := strings.TrimSpace(cfg.TLS.AcmeHost)
+		if host == "" || strings.Contains(host, "*") {
+			return nil, nil, fmt.Errorf("TLS.AcmeHost must be the hostname of the cp api when TLS.Acme is enabled")
+		}
+		cacheDir := cfg.TLS.AcmeCacheDir
+		if cacheDir == "" {
+			cpRepoPath, _ := os.LookupEnv("CP_PATH")
+			cacheDir = filepath.Join(cpRepoPath, "acme")
+		}
+
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(host),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      cfg.TLS.AcmeEmail,
+		}
+		challengeHandler = manager.HTTPHandler(nil)
+		tlsConfig = manager.TLSConfig()
+	} else {
+		if _, err := os.Stat(cfg.LOG.CrtFile); err != nil {
+			return nil, nil, fmt.Errorf("need to manually generate the wss authentication certificate. error: %v", err)
+		}
+		reloader, err := newCertReloader(cfg.LOG.CrtFile, cfg.LOG.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig = &tls.Config{GetCertificate: reloader.GetCertificate}
+	}
+	tlsConfig.MinVersion = tls.VersionTLS12
+
+	if cfg.TLS.ClientCaFile != "" {
+		caBytes, err := os.ReadFile(cfg.TLS.ClientCaFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read client ca file: %s, error: %v", cfg.TLS.ClientCaFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, nil, fmt.Errorf("no valid certificate found in client ca file: %s", cfg.TLS.ClientCaFile)
+		}
+		tlsConfig.ClientCAs = pool
+		if cfg.TLS.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return tlsConfig, challengeHandler, nil
+}